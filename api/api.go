@@ -0,0 +1,396 @@
+// Package api serves the stored gas prices over HTTP as JSON, either from a
+// long-running server or behind API Gateway.
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/charts"
+	"github.com/ryanc414/gas-tracker/notifications"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+	"github.com/ryanc414/gas-tracker/version"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+
+	defaultAlertsLimit = 20
+	maxAlertsLimit     = 100
+)
+
+// Handler serves the stored gas prices:
+//
+//	GET /prices/latest  returns the most recent price and its category
+//	GET /prices         returns a page of prices, oldest first, optionally
+//	                    between the "from" and "to" RFC 3339 timestamps, with
+//	                    up to "limit" prices per page; pass the "next" cursor
+//	                    of a page as "cursor" to get the next page
+//	GET /gas/current    returns the most recent price, its category and how
+//	                    many seconds ago it was sampled, see Current
+//	GET /gas/history    returns the prices of the last "hours", 24 by
+//	                    default and at most a week, oldest first, see History
+//	GET /stats          returns the stats of the prices, optionally between
+//	                    "from" and "to", with the latest of them and the
+//	                    percentage of them that were cheaper
+//	GET /chart.png      charts the prices, optionally between "from" and
+//	                    "to", over the default category bands; also served
+//	                    as an SVG from /chart.svg
+//	GET /alerts         returns the most recent alerts, newest first, with the
+//	                    channels each was sent to, up to "limit" alerts
+//	GET /version        returns the version of the build serving the API
+//	POST /graphql       queries the prices, stats and category changes with
+//	                    GraphQL, see schema
+//	/grafana/...        serves the prices to Grafana's JSON data source:
+//	                    GET /grafana tests the connection, POST
+//	                    /grafana/search lists the price, category and
+//	                    eth_usd targets, POST /grafana/query returns them
+//	                    as time series or a table over the dashboard's
+//	                    range, and POST /grafana/annotations marks
+//	                    category changes
+//
+// The /gas endpoints are meant for public status pages: they may be read from
+// any origin, and cached for a minute.
+type Handler struct {
+	svc *dynamodb.DynamoDB
+	mux *http.ServeMux
+}
+
+// NewHandler constructs a Handler reading prices from DynamoDB.
+func NewHandler(svc *dynamodb.DynamoDB) *Handler {
+	h := Handler{svc: svc, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/prices/latest", h.latest)
+	h.mux.HandleFunc("/prices", h.history)
+	h.mux.HandleFunc("/stats", h.stats)
+	h.mux.HandleFunc("/gas/current", h.current)
+	h.mux.HandleFunc("/gas/history", h.statusHistory)
+	h.mux.HandleFunc("/chart.png", h.chartPNG)
+	h.mux.HandleFunc("/chart.svg", h.chartSVG)
+	h.mux.HandleFunc("/alerts", h.alerts)
+	h.mux.HandleFunc("/version", h.version)
+	h.mux.Handle("/graphql", &relay.Handler{Schema: newGraphQLSchema(svc)})
+	h.mux.HandleFunc("/grafana", h.grafanaTest)
+	h.mux.HandleFunc("/grafana/", h.grafanaTest)
+	h.mux.HandleFunc("/grafana/search", h.grafanaSearch)
+	h.mux.HandleFunc("/grafana/query", h.grafanaQuery)
+	h.mux.HandleFunc("/grafana/annotations", h.grafanaAnnotations)
+
+	return &h
+}
+
+// Price is a gas price sample as returned by the API.
+type Price struct {
+	Price     int       `json:"price"`
+	Timestamp time.Time `json:"timestamp"`
+	Category  string    `json:"category"`
+	EthUSD    float64   `json:"ethUsd,omitempty"`
+}
+
+// Page is a page of prices. Next is empty on the last page.
+type Page struct {
+	Prices []Price `json:"prices"`
+	Next   string  `json:"next,omitempty"`
+}
+
+// Stats are the stats of a range of prices.
+type Stats struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Count  int       `json:"count"`
+	Mean   float64   `json:"mean"`
+	Stddev float64   `json:"stddev"`
+	Min    Price     `json:"min"`
+	Max    Price     `json:"max"`
+	Latest Price     `json:"latest"`
+	// LatestPercentile is the percentage of the prices that were cheaper
+	// than the latest, counting equal prices as half cheaper.
+	LatestPercentile float64 `json:"latestPercentile"`
+}
+
+// Alert is an alert that the tracker sent, as returned by the API. Delivered
+// is true if it reached at least one of its channels.
+type Alert struct {
+	Alert     string    `json:"alert"`
+	Price     int       `json:"price"`
+	Timestamp time.Time `json:"timestamp"`
+	Channels  []string  `json:"channels"`
+	Delivered bool      `json:"delivered"`
+}
+
+func newPrice(p *prices.GasPriceData) Price {
+	return Price{
+		Price:     p.Price,
+		Timestamp: p.Timestamp,
+		Category:  p.Category.String(),
+		EthUSD:    p.EthUSD,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	isPost := r.URL.Path == "/graphql" || strings.HasPrefix(r.URL.Path, "/grafana/")
+	if r.Method != http.MethodGet && !(isPost && r.Method == http.MethodPost) {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) version(w http.ResponseWriter, _ *http.Request) {
+	respond(w, http.StatusOK, version.Get())
+}
+
+func (h *Handler) latest(w http.ResponseWriter, _ *http.Request) {
+	latest, err := store.ReadLatest(h.svc)
+	if err != nil {
+		internalError(w, errors.Wrap(err, "while reading latest gas price"))
+		return
+	}
+	if latest == nil {
+		respondError(w, http.StatusNotFound, "no gas prices")
+		return
+	}
+
+	respond(w, http.StatusOK, newPrice(latest))
+}
+
+func (h *Handler) history(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := defaultPageSize
+	if raw := q.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			respondError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxPageSize))
+			return
+		}
+	}
+
+	gasPrices, ok := h.readRange(w, r)
+	if !ok {
+		return
+	}
+
+	// The cursor is the timestamp of the last price on the previous page.
+	if raw := q.Get("cursor"); raw != "" {
+		after, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+
+		i := sort.Search(len(gasPrices), func(i int) bool {
+			return gasPrices[i].Timestamp.After(after)
+		})
+		gasPrices = gasPrices[i:]
+	}
+
+	page := Page{Prices: []Price{}}
+	for i := range gasPrices {
+		if i == limit {
+			page.Next = page.Prices[limit-1].Timestamp.Format(time.RFC3339Nano)
+			break
+		}
+
+		page.Prices = append(page.Prices, newPrice(&gasPrices[i]))
+	}
+
+	respond(w, http.StatusOK, &page)
+}
+
+// alerts groups the notification history by alert. Notifications to
+// subscribers are left out, so that the API does not reveal who is subscribed.
+func (h *Handler) alerts(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAlertsLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxAlertsLimit {
+			respondError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxAlertsLimit))
+			return
+		}
+	}
+
+	records, err := notifications.ReadAll(h.svc)
+	if err != nil {
+		internalError(w, errors.Wrap(err, "while reading notification history"))
+		return
+	}
+
+	alerts := []Alert{}
+	byAlert := make(map[string]int)
+	for i := len(records) - 1; i >= 0; i-- {
+		rec := &records[i]
+		if strings.HasPrefix(rec.Channel, "subscriber/") {
+			continue
+		}
+
+		key := rec.Transition + "@" + rec.AlertTimestamp.Format(time.RFC3339Nano)
+		j, ok := byAlert[key]
+		if !ok {
+			if len(alerts) == limit {
+				continue
+			}
+
+			j = len(alerts)
+			byAlert[key] = j
+			alerts = append(alerts, Alert{Alert: rec.Transition, Price: rec.Price, Timestamp: rec.AlertTimestamp})
+		}
+
+		alerts[j].Channels = append(alerts[j].Channels, rec.Channel)
+		alerts[j].Delivered = alerts[j].Delivered || rec.Delivered
+	}
+
+	respond(w, http.StatusOK, alerts)
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	gasPrices, ok := h.readRange(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := prices.Stats(gasPrices)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "no gas prices in range")
+		return
+	}
+
+	latest := &gasPrices[len(gasPrices)-1]
+	respond(w, http.StatusOK, &Stats{
+		From:             gasPrices[0].Timestamp,
+		To:               latest.Timestamp,
+		Count:            len(gasPrices),
+		Mean:             stats.Mean,
+		Stddev:           stats.Stddev,
+		Min:              newPrice(sampledAt(gasPrices, stats.MinAt)),
+		Max:              newPrice(sampledAt(gasPrices, stats.MaxAt)),
+		Latest:           newPrice(latest),
+		LatestPercentile: prices.PercentileRank(latest.Price, gasPrices),
+	})
+}
+
+func (h *Handler) chartPNG(w http.ResponseWriter, r *http.Request) {
+	gasPrices, ok := h.readRange(w, r)
+	if !ok {
+		return
+	}
+	if len(gasPrices) == 0 {
+		respondError(w, http.StatusNotFound, "no gas prices in range")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := charts.PNG(&buf, gasPrices, charts.Options{Bands: prices.DefaultBands}); err != nil {
+		internalError(w, errors.Wrap(err, "while charting gas prices"))
+		return
+	}
+
+	respondImage(w, "image/png", buf.Bytes())
+}
+
+func (h *Handler) chartSVG(w http.ResponseWriter, r *http.Request) {
+	gasPrices, ok := h.readRange(w, r)
+	if !ok {
+		return
+	}
+	if len(gasPrices) == 0 {
+		respondError(w, http.StatusNotFound, "no gas prices in range")
+		return
+	}
+
+	chart, err := charts.SVG(gasPrices, charts.Options{Bands: prices.DefaultBands, Title: "Gas prices"})
+	if err != nil {
+		internalError(w, errors.Wrap(err, "while charting gas prices"))
+		return
+	}
+
+	respondImage(w, "image/svg+xml", []byte(chart))
+}
+
+// readRange reads the stored prices between the request's optional "from" and
+// "to" timestamps, inclusive, ordered oldest first. If the range is invalid,
+// it responds with an error and returns false.
+func (h *Handler) readRange(w http.ResponseWriter, r *http.Request) ([]prices.GasPriceData, bool) {
+	q := r.URL.Query()
+
+	var from, to time.Time
+	for _, param := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		raw := q.Get(param.name)
+		if raw == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, param.name+" must be an RFC 3339 timestamp")
+			return nil, false
+		}
+		*param.t = t
+	}
+
+	gasPrices, err := store.ReadRange(h.svc, from, to)
+	if err != nil {
+		internalError(w, errors.Wrap(err, "while reading gas prices"))
+		return nil, false
+	}
+
+	return gasPrices, true
+}
+
+// sampledAt returns the price among gasPrices that was sampled at t.
+func sampledAt(gasPrices []prices.GasPriceData, t time.Time) *prices.GasPriceData {
+	for i := range gasPrices {
+		if gasPrices[i].Timestamp.Equal(t) {
+			return &gasPrices[i]
+		}
+	}
+
+	return &prices.GasPriceData{Timestamp: t}
+}
+
+func respond(w http.ResponseWriter, status int, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		internalError(w, errors.Wrap(err, "while marshalling response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		log.Error().Err(err).Msg("failed to write response")
+	}
+}
+
+func respondImage(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		log.Error().Err(err).Msg("failed to write response")
+	}
+}
+
+func respondError(w http.ResponseWriter, status int, msg string) {
+	respond(w, status, map[string]string{"error": msg})
+}
+
+func internalError(w http.ResponseWriter, err error) {
+	log.Error().Err(err).Msg("internal error")
+	respondError(w, http.StatusInternalServerError, "internal error")
+}
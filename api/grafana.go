@@ -0,0 +1,238 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+// The metrics that Grafana can query, as the targets of its panels.
+const (
+	grafanaPrice    = "price"
+	grafanaCategory = "category"
+	grafanaEthUSD   = "eth_usd"
+)
+
+var grafanaTargets = []string{grafanaPrice, grafanaCategory, grafanaEthUSD}
+
+type grafanaRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type grafanaTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"`
+}
+
+type grafanaQuery struct {
+	Range         grafanaRange    `json:"range"`
+	Targets       []grafanaTarget `json:"targets"`
+	MaxDataPoints int             `json:"maxDataPoints"`
+}
+
+// grafanaSeries is a time series of [value, unix milliseconds] points.
+type grafanaSeries struct {
+	Target     string           `json:"target"`
+	Datapoints [][2]interface{} `json:"datapoints"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+type grafanaAnnotationQuery struct {
+	Range      grafanaRange    `json:"range"`
+	Annotation json.RawMessage `json:"annotation"`
+}
+
+type grafanaAnnotation struct {
+	Annotation json.RawMessage `json:"annotation"`
+	Time       int64           `json:"time"`
+	Title      string          `json:"title"`
+	Text       string          `json:"text"`
+	Tags       []string        `json:"tags"`
+}
+
+// grafanaTest answers Grafana's test of the data source's connection.
+func (h *Handler) grafanaTest(w http.ResponseWriter, _ *http.Request) {
+	respond(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// grafanaSearch lists the metrics that can be queried.
+func (h *Handler) grafanaSearch(w http.ResponseWriter, _ *http.Request) {
+	respond(w, http.StatusOK, grafanaTargets)
+}
+
+// grafanaQuery returns the prices in the dashboard's range, as a time series
+// for each target or, for targets of type "table", as a table of every price.
+func (h *Handler) grafanaQuery(w http.ResponseWriter, r *http.Request) {
+	var q grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid query: "+err.Error())
+		return
+	}
+
+	for _, t := range q.Targets {
+		if !isGrafanaTarget(t.Target) && t.Type != "table" {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("unknown target %q", t.Target))
+			return
+		}
+	}
+
+	gasPrices, ok := h.readGrafanaRange(w, q.Range)
+	if !ok {
+		return
+	}
+
+	results := make([]interface{}, 0, len(q.Targets))
+	for _, t := range q.Targets {
+		if t.Type == "table" {
+			results = append(results, grafanaPricesTable(gasPrices))
+			continue
+		}
+
+		results = append(results, grafanaTimeSeries(t.Target, gasPrices, q.MaxDataPoints))
+	}
+
+	respond(w, http.StatusOK, results)
+}
+
+// grafanaAnnotations marks each change of category in the dashboard's range.
+func (h *Handler) grafanaAnnotations(w http.ResponseWriter, r *http.Request) {
+	var q grafanaAnnotationQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid query: "+err.Error())
+		return
+	}
+
+	gasPrices, ok := h.readGrafanaRange(w, q.Range)
+	if !ok {
+		return
+	}
+
+	annotations := []grafanaAnnotation{}
+	for i := 1; i < len(gasPrices); i++ {
+		prev, p := &gasPrices[i-1], &gasPrices[i]
+		if p.Category == prev.Category {
+			continue
+		}
+
+		annotations = append(annotations, grafanaAnnotation{
+			Annotation: q.Annotation,
+			Time:       unixMillis(p.Timestamp),
+			Title:      p.Category.String(),
+			Text:       fmt.Sprintf("%s to %s at %d gwei", prev.Category, p.Category, p.Price),
+			Tags:       []string{p.Category.String()},
+		})
+	}
+
+	respond(w, http.StatusOK, annotations)
+}
+
+// readGrafanaRange reads the stored prices in a query's range, ordered oldest
+// first. If the range is invalid, it responds with an error and returns false.
+func (h *Handler) readGrafanaRange(w http.ResponseWriter, rng grafanaRange) ([]prices.GasPriceData, bool) {
+	from, err := time.Parse(time.RFC3339, rng.From)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "range.from must be an RFC 3339 timestamp")
+		return nil, false
+	}
+	to, err := time.Parse(time.RFC3339, rng.To)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "range.to must be an RFC 3339 timestamp")
+		return nil, false
+	}
+
+	gasPrices, err := store.ReadRange(h.svc, from, to)
+	if err != nil {
+		internalError(w, errors.Wrap(err, "while reading gas prices"))
+		return nil, false
+	}
+
+	return gasPrices, true
+}
+
+func isGrafanaTarget(target string) bool {
+	for _, t := range grafanaTargets {
+		if t == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// grafanaTimeSeries returns a target's value at each price, taking every nth
+// price if there are more than maxPoints. Prices without an ETH price are
+// left out of the eth_usd series.
+func grafanaTimeSeries(target string, gasPrices []prices.GasPriceData, maxPoints int) grafanaSeries {
+	step := 1
+	if maxPoints > 0 && len(gasPrices) > maxPoints {
+		step = (len(gasPrices) + maxPoints - 1) / maxPoints
+	}
+
+	series := grafanaSeries{Target: target, Datapoints: [][2]interface{}{}}
+	for i := 0; i < len(gasPrices); i += step {
+		p := &gasPrices[i]
+
+		var value interface{}
+		switch target {
+		case grafanaPrice:
+			value = p.Price
+
+		case grafanaCategory:
+			value = p.Category.Level()
+
+		case grafanaEthUSD:
+			if p.EthUSD == 0 {
+				continue
+			}
+			value = p.EthUSD
+		}
+
+		series.Datapoints = append(series.Datapoints, [2]interface{}{value, unixMillis(p.Timestamp)})
+	}
+
+	return series
+}
+
+// grafanaPricesTable returns every price as a row of a table.
+func grafanaPricesTable(gasPrices []prices.GasPriceData) grafanaTable {
+	table := grafanaTable{
+		Type: "table",
+		Columns: []grafanaColumn{
+			{Text: "Time", Type: "time"},
+			{Text: "Price", Type: "number"},
+			{Text: "Category", Type: "string"},
+			{Text: "ETH/USD", Type: "number"},
+		},
+		Rows: [][]interface{}{},
+	}
+
+	for i := range gasPrices {
+		p := &gasPrices[i]
+		table.Rows = append(table.Rows, []interface{}{
+			unixMillis(p.Timestamp), p.Price, p.Category.String(), p.EthUSD,
+		})
+	}
+
+	return table
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
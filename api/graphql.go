@@ -0,0 +1,244 @@
+package api
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+// schema is the GraphQL schema served at /graphql. Timestamps are RFC 3339
+// strings, and ranges are inclusive with either end optional.
+const schema = `
+	schema {
+		query: Query
+	}
+
+	type Query {
+		# The most recent price, or null if there are none.
+		latest: Price
+		# The prices in a range, oldest first, optionally only those in a
+		# category, e.g. "Low".
+		prices(from: String, to: String, category: String): [Price!]!
+		# The stats of the prices in a range, or null if there are none.
+		stats(from: String, to: String): Stats
+		# The prices in a range whose category differs from the price before.
+		categoryChanges(from: String, to: String): [CategoryChange!]!
+	}
+
+	type Price {
+		price: Int!
+		timestamp: String!
+		category: String!
+		ethUsd: Float
+	}
+
+	type Stats {
+		count: Int!
+		mean: Float!
+		stddev: Float!
+		min: Price!
+		max: Price!
+		latest: Price!
+		# The percentage of the prices that were cheaper than the latest.
+		latestPercentile: Float!
+	}
+
+	type CategoryChange {
+		previousCategory: String!
+		price: Price!
+	}
+`
+
+// newGraphQLSchema parses the schema with its resolvers.
+func newGraphQLSchema(svc *dynamodb.DynamoDB) *graphql.Schema {
+	return graphql.MustParseSchema(schema, &queryResolver{svc: svc})
+}
+
+type queryResolver struct {
+	svc *dynamodb.DynamoDB
+}
+
+type rangeArgs struct {
+	From *string
+	To   *string
+}
+
+func (q *queryResolver) Latest() (*priceResolver, error) {
+	latest, err := store.ReadLatest(q.svc)
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading latest gas price")
+	}
+	if latest == nil {
+		return nil, nil
+	}
+
+	return &priceResolver{p: *latest}, nil
+}
+
+func (q *queryResolver) Prices(args struct {
+	From     *string
+	To       *string
+	Category *string
+}) ([]*priceResolver, error) {
+	gasPrices, err := q.readRange(rangeArgs{From: args.From, To: args.To})
+	if err != nil {
+		return nil, err
+	}
+
+	var category prices.PriceCategory
+	if args.Category != nil {
+		category, err = prices.ParsePriceCategory(*args.Category)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resolvers := []*priceResolver{}
+	for i := range gasPrices {
+		if args.Category == nil || gasPrices[i].Category == category {
+			resolvers = append(resolvers, &priceResolver{p: gasPrices[i]})
+		}
+	}
+
+	return resolvers, nil
+}
+
+func (q *queryResolver) Stats(args rangeArgs) (*statsResolver, error) {
+	gasPrices, err := q.readRange(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(gasPrices) == 0 {
+		return nil, nil
+	}
+
+	stats, err := prices.Stats(gasPrices)
+	if err != nil {
+		return nil, err
+	}
+
+	return &statsResolver{
+		count: len(gasPrices),
+		stats: stats,
+		min:   *sampledAt(gasPrices, stats.MinAt),
+		max:   *sampledAt(gasPrices, stats.MaxAt),
+		all:   gasPrices,
+	}, nil
+}
+
+func (q *queryResolver) CategoryChanges(args rangeArgs) ([]*categoryChangeResolver, error) {
+	gasPrices, err := q.readRange(args)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []*categoryChangeResolver{}
+	for i := 1; i < len(gasPrices); i++ {
+		if gasPrices[i].Category != gasPrices[i-1].Category {
+			changes = append(changes, &categoryChangeResolver{
+				previous: gasPrices[i-1].Category,
+				price:    gasPrices[i],
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// readRange reads the stored prices in a range, ordered oldest first.
+func (q *queryResolver) readRange(args rangeArgs) ([]prices.GasPriceData, error) {
+	var from, to time.Time
+	var err error
+
+	if args.From != nil {
+		from, err = time.Parse(time.RFC3339, *args.From)
+		if err != nil {
+			return nil, errors.New("from must be an RFC 3339 timestamp")
+		}
+	}
+	if args.To != nil {
+		to, err = time.Parse(time.RFC3339, *args.To)
+		if err != nil {
+			return nil, errors.New("to must be an RFC 3339 timestamp")
+		}
+	}
+
+	gasPrices, err := store.ReadRange(q.svc, from, to)
+	return gasPrices, errors.Wrap(err, "while reading gas prices")
+}
+
+type priceResolver struct {
+	p prices.GasPriceData
+}
+
+func (r *priceResolver) Price() int32 {
+	return int32(r.p.Price)
+}
+
+func (r *priceResolver) Timestamp() string {
+	return r.p.Timestamp.Format(time.RFC3339)
+}
+
+func (r *priceResolver) Category() string {
+	return r.p.Category.String()
+}
+
+func (r *priceResolver) EthUsd() *float64 {
+	if r.p.EthUSD == 0 {
+		return nil
+	}
+
+	return &r.p.EthUSD
+}
+
+type statsResolver struct {
+	count    int
+	stats    *prices.PriceStats
+	min, max prices.GasPriceData
+	all      []prices.GasPriceData
+}
+
+func (r *statsResolver) Count() int32 {
+	return int32(r.count)
+}
+
+func (r *statsResolver) Mean() float64 {
+	return r.stats.Mean
+}
+
+func (r *statsResolver) Stddev() float64 {
+	return r.stats.Stddev
+}
+
+func (r *statsResolver) Min() *priceResolver {
+	return &priceResolver{p: r.min}
+}
+
+func (r *statsResolver) Max() *priceResolver {
+	return &priceResolver{p: r.max}
+}
+
+func (r *statsResolver) Latest() *priceResolver {
+	return &priceResolver{p: r.all[len(r.all)-1]}
+}
+
+func (r *statsResolver) LatestPercentile() float64 {
+	return prices.PercentileRank(r.all[len(r.all)-1].Price, r.all)
+}
+
+type categoryChangeResolver struct {
+	previous prices.PriceCategory
+	price    prices.GasPriceData
+}
+
+func (r *categoryChangeResolver) PreviousCategory() string {
+	return r.previous.String()
+}
+
+func (r *categoryChangeResolver) Price() *priceResolver {
+	return &priceResolver{p: r.price}
+}
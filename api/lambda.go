@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandleAPIGateway serves an API Gateway proxy request, so that the same
+// Handler can run as a Lambda.
+func (h *Handler) HandleAPIGateway(
+	ctx context.Context, req events.APIGatewayProxyRequest,
+) (events.APIGatewayProxyResponse, error) {
+	return ServeAPIGateway(ctx, h, req)
+}
+
+// ServeAPIGateway serves an API Gateway proxy request with any http.Handler.
+func ServeAPIGateway(
+	ctx context.Context, h http.Handler, req events.APIGatewayProxyRequest,
+) (events.APIGatewayProxyResponse, error) {
+	q := make(url.Values)
+	for k, v := range req.QueryStringParameters {
+		q.Set(k, v)
+	}
+
+	body := req.Body
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest}, nil
+		}
+		body = string(decoded)
+	}
+
+	u := url.URL{Path: req.Path, RawQuery: q.Encode()}
+	r, err := http.NewRequestWithContext(ctx, req.HTTPMethod, u.String(), strings.NewReader(body))
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest}, nil
+	}
+	for k, v := range req.Headers {
+		r.Header.Set(k, v)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	rsp := events.APIGatewayProxyResponse{
+		StatusCode: rec.Code,
+		Headers:    map[string]string{"Content-Type": rec.Header().Get("Content-Type")},
+		Body:       rec.Body.String(),
+	}
+
+	// API Gateway only passes binary responses, such as charts, through
+	// base64 encoded.
+	if strings.HasPrefix(rsp.Headers["Content-Type"], "image/png") {
+		rsp.Body = base64.StdEncoding.EncodeToString(rec.Body.Bytes())
+		rsp.IsBase64Encoded = true
+	}
+
+	return rsp, nil
+}
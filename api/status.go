@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const (
+	// statusMaxAge is how long browsers and CDNs may cache the responses of
+	// the status endpoints, which only change when a price is sampled.
+	statusMaxAge = time.Minute
+
+	defaultStatusHours = 24
+	maxStatusHours     = 7 * 24
+)
+
+// Current is the latest gas price as returned by /gas/current.
+type Current struct {
+	Price     int       `json:"price"`
+	Category  string    `json:"category"`
+	Timestamp time.Time `json:"timestamp"`
+	// AgeSeconds is how long ago the price was sampled, so that a status
+	// page can tell when the tracker has stopped sampling.
+	AgeSeconds int64   `json:"ageSeconds"`
+	EthUSD     float64 `json:"ethUsd,omitempty"`
+}
+
+// History is the gas prices of the last hours, oldest first, as returned by
+// /gas/history.
+type History struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Prices []Price   `json:"prices"`
+}
+
+// current serves the latest price for status pages.
+func (h *Handler) current(w http.ResponseWriter, _ *http.Request) {
+	setStatusHeaders(w)
+
+	latest, err := store.ReadLatest(h.svc)
+	if err != nil {
+		internalError(w, errors.Wrap(err, "while reading latest gas price"))
+		return
+	}
+	if latest == nil {
+		respondError(w, http.StatusNotFound, "no gas prices")
+		return
+	}
+
+	respond(w, http.StatusOK, &Current{
+		Price:      latest.Price,
+		Category:   latest.Category.String(),
+		Timestamp:  latest.Timestamp,
+		AgeSeconds: int64(clock.Since(latest.Timestamp).Seconds()),
+		EthUSD:     latest.EthUSD,
+	})
+}
+
+// statusHistory serves the prices of the last "hours" for status pages.
+func (h *Handler) statusHistory(w http.ResponseWriter, r *http.Request) {
+	setStatusHeaders(w)
+
+	hours := defaultStatusHours
+	if raw := r.URL.Query().Get("hours"); raw != "" {
+		var err error
+		hours, err = strconv.Atoi(raw)
+		if err != nil || hours < 1 || hours > maxStatusHours {
+			respondError(w, http.StatusBadRequest, "hours must be between 1 and "+strconv.Itoa(maxStatusHours))
+			return
+		}
+	}
+
+	now := clock.Now()
+	from := now.Add(-time.Duration(hours) * time.Hour)
+
+	gasPrices, err := store.ReadRange(h.svc, from, now)
+	if err != nil {
+		internalError(w, errors.Wrap(err, "while reading gas prices"))
+		return
+	}
+
+	history := History{From: from, To: now, Prices: make([]Price, len(gasPrices))}
+	for i := range gasPrices {
+		history.Prices[i] = newPrice(&gasPrices[i])
+	}
+
+	respond(w, http.StatusOK, &history)
+}
+
+// setStatusHeaders lets status pages on any origin read the status
+// endpoints, which only serve public prices, and lets them be cached briefly.
+func setStatusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(statusMaxAge.Seconds())))
+}
@@ -0,0 +1,100 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/ryanc414/gas-tracker/api"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/fakes"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+func TestStatus(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock.Set(fakes.NewClock(now))
+	defer clock.Set(nil)
+
+	svc := dynamodb.New(fakes.NewStore().Session())
+	for _, p := range []prices.GasPriceData{
+		{Price: 40, Timestamp: now.Add(-30 * time.Hour), Category: prices.High},
+		{Price: 30, Timestamp: now.Add(-2 * time.Hour), Category: prices.Average},
+		{Price: 20, Timestamp: now.Add(-5 * time.Minute), Category: prices.Low},
+	} {
+		p := p
+		if err := store.Write(svc, &p); err != nil {
+			t.Fatalf("store.Write: %v", err)
+		}
+		if err := store.WriteLatest(svc, &p); err != nil {
+			t.Fatalf("store.WriteLatest: %v", err)
+		}
+	}
+
+	h := api.NewHandler(svc)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantPrices []int
+	}{
+		{name: "current", path: "/gas/current", wantStatus: http.StatusOK, wantPrices: []int{20}},
+		{name: "last day", path: "/gas/history", wantStatus: http.StatusOK, wantPrices: []int{30, 20}},
+		{name: "last hour", path: "/gas/history?hours=1", wantStatus: http.StatusOK, wantPrices: []int{20}},
+		{name: "last week", path: "/gas/history?hours=168", wantStatus: http.StatusOK, wantPrices: []int{40, 30, 20}},
+		{name: "too long", path: "/gas/history?hours=169", wantStatus: http.StatusBadRequest},
+		{name: "not a number", path: "/gas/history?hours=day", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if origin := rec.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want *", origin)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got []int
+			if tt.path == "/gas/current" {
+				var current api.Current
+				if err := json.Unmarshal(rec.Body.Bytes(), &current); err != nil {
+					t.Fatalf("while decoding response: %v", err)
+				}
+				if current.AgeSeconds != 300 || current.Category != "Low" {
+					t.Errorf("current = %+v, want a Low price sampled 300s ago", current)
+				}
+				got = []int{current.Price}
+			} else {
+				var history api.History
+				if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+					t.Fatalf("while decoding response: %v", err)
+				}
+				for _, p := range history.Prices {
+					got = append(got, p.Price)
+				}
+			}
+
+			if len(got) != len(tt.wantPrices) {
+				t.Fatalf("prices = %v, want %v", got, tt.wantPrices)
+			}
+			for i := range got {
+				if got[i] != tt.wantPrices[i] {
+					t.Errorf("prices = %v, want %v", got, tt.wantPrices)
+					break
+				}
+			}
+		})
+	}
+}
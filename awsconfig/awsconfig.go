@@ -0,0 +1,98 @@
+// Package awsconfig constructs the AWS sessions used to reach DynamoDB and S3.
+package awsconfig
+
+import (
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
+)
+
+var (
+	// override is the session returned by NewSession, if set.
+	override *session.Session
+
+	mu     sync.Mutex
+	shared *session.Session
+)
+
+// SetSession makes NewSession return sess, e.g. the in-memory store of package
+// fakes in tests, until it is called again with nil.
+func SetSession(sess *session.Session) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	override = sess
+	shared = nil
+}
+
+// Session returns a session created by NewSession on first use and reused
+// after that, so that warm Lambda invocations reuse its connections and
+// credentials, including those of an assumed role, rather than resolving
+// them again.
+func Session() (*session.Session, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if shared != nil {
+		return shared, nil
+	}
+
+	sess, err := newSession()
+	if err != nil {
+		return nil, err
+	}
+	shared = sess
+
+	return sess, nil
+}
+
+// NewSession returns a session configured from the shared AWS config and
+// credentials files, as the AWS CLI is. GAS_AWS_REGION and GAS_AWS_PROFILE
+// override the region and the profile to use, and if GAS_AWS_ROLE_ARN is set,
+// the session assumes that role, e.g. to reach tables in another account.
+// Throttled and failed requests are retried as MaxRetries configures, and
+// counted by Retries.
+func NewSession() (*session.Session, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return newSession()
+}
+
+func newSession() (*session.Session, error) {
+	if override != nil {
+		return override, nil
+	}
+
+	opts := session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Profile:           os.Getenv("GAS_AWS_PROFILE"),
+	}
+	if region := os.Getenv("GAS_AWS_REGION"); region != "" {
+		opts.Config.Region = aws.String(region)
+	}
+	if err := withRetries(&opts.Config); err != nil {
+		return nil, err
+	}
+
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "while creating AWS session")
+	}
+	sess.Handlers.AfterRetry.PushFront(countRetry)
+
+	roleARN := os.Getenv("GAS_AWS_ROLE_ARN")
+	if roleARN == "" {
+		return sess, nil
+	}
+
+	return sess.Copy(&aws.Config{
+		Credentials: stscreds.NewCredentials(sess, roleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = "gas-tracker"
+		}),
+	}), nil
+}
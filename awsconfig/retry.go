@@ -0,0 +1,121 @@
+package awsconfig
+
+import (
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// defaultMaxRetries matches the SDK's default for DynamoDB, which it
+	// otherwise only applies to DynamoDB clients.
+	defaultMaxRetries = 10
+	minRetryDelay     = 50 * time.Millisecond
+	// Throttled requests back off for longer than other failures, since
+	// retrying them quickly only uses up more of the provisioned throughput.
+	minThrottleDelay = 500 * time.Millisecond
+	maxThrottleDelay = 20 * time.Second
+)
+
+var retries, throttled int64
+
+// RetryCounts are the numbers of AWS requests retried by this process, of
+// which Throttled were retried for being throttled, e.g. with DynamoDB's
+// ProvisionedThroughputExceededException.
+type RetryCounts struct {
+	Retries   int64
+	Throttled int64
+}
+
+// Retries returns the numbers of requests retried so far. The difference
+// between two calls is the number retried in between, e.g. during a run.
+func Retries() RetryCounts {
+	return RetryCounts{
+		Retries:   atomic.LoadInt64(&retries),
+		Throttled: atomic.LoadInt64(&throttled),
+	}
+}
+
+// Since returns the numbers of requests retried since the earlier counts.
+func (c RetryCounts) Since(earlier RetryCounts) RetryCounts {
+	return RetryCounts{Retries: c.Retries - earlier.Retries, Throttled: c.Throttled - earlier.Throttled}
+}
+
+// MaxRetries reads GAS_AWS_MAX_RETRIES, how many times a request to AWS that
+// is throttled, fails with a 5xx status or fails to connect is retried.
+// Defaults to 10.
+func MaxRetries() (int, error) {
+	raw := os.Getenv("GAS_AWS_MAX_RETRIES")
+	if raw == "" {
+		return defaultMaxRetries, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while parsing GAS_AWS_MAX_RETRIES %q", raw)
+	}
+	if n < 0 {
+		return 0, errors.Errorf("GAS_AWS_MAX_RETRIES must not be negative, got %d", n)
+	}
+
+	return n, nil
+}
+
+// withRetries configures the retries of every client created from a session
+// with cfg.
+func withRetries(cfg *aws.Config) error {
+	maxRetries, err := MaxRetries()
+	if err != nil {
+		return err
+	}
+
+	request.WithRetryer(cfg, client.DefaultRetryer{
+		NumMaxRetries:    maxRetries,
+		MinRetryDelay:    minRetryDelay,
+		MinThrottleDelay: minThrottleDelay,
+		MaxThrottleDelay: maxThrottleDelay,
+	})
+
+	return nil
+}
+
+// countRetry counts and logs a failed request that is about to be retried. It
+// runs before the SDK's own AfterRetry handler, which clears the error, so it
+// decides whether the request is retryable as that handler would, which then
+// keeps the decision.
+func countRetry(r *request.Request) {
+	if r.Retryable == nil {
+		r.Retryable = aws.Bool(r.ShouldRetry(r))
+	}
+	if !r.WillRetry() {
+		return
+	}
+
+	atomic.AddInt64(&retries, 1)
+	isThrottle := r.IsErrorThrottle()
+	if isThrottle {
+		atomic.AddInt64(&throttled, 1)
+	}
+
+	var code string
+	if aerr, ok := r.Error.(awserr.Error); ok {
+		code = aerr.Code()
+	}
+
+	log.Warn().
+		Err(r.Error).
+		Str("service", r.ClientInfo.ServiceName).
+		Str("operation", r.Operation.Name).
+		Str("code", code).
+		Bool("throttled", isThrottle).
+		Int("retry", r.RetryCount+1).
+		Msg("retrying AWS request")
+}
@@ -0,0 +1,177 @@
+// Package charts renders the history of gas prices as a chart, in SVG for web
+// pages or PNG for email attachments. The prices are drawn as a line, marked
+// in the colour of their category, over bands shaded in the colour of the
+// category that prices within them are categorised as.
+package charts
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+// The default size of a chart, in pixels.
+const (
+	DefaultWidth  = 800
+	DefaultHeight = 240
+)
+
+// pad is the space in pixels between the plotted prices and the edge.
+const pad = 4
+
+var (
+	lineColour  = color.RGBA{R: 0x09, G: 0x69, B: 0xda, A: 0xff}
+	meanColour  = color.RGBA{R: 0x6e, G: 0x77, B: 0x81, A: 0xff}
+	labelColour = color.RGBA{R: 0x65, G: 0x6d, B: 0x76, A: 0xff}
+)
+
+// categoryColours are the colours each category is shown in, from green for
+// Very Low to red for Very High.
+var categoryColours = map[prices.PriceCategory]color.RGBA{
+	prices.VeryLow:  {R: 0x1a, G: 0x7f, B: 0x37, A: 0xff},
+	prices.Low:      {R: 0x4a, G: 0xc2, B: 0x6b, A: 0xff},
+	prices.Average:  {R: 0x6e, G: 0x77, B: 0x81, A: 0xff},
+	prices.High:     {R: 0xd4, G: 0xa7, B: 0x2c, A: 0xff},
+	prices.VeryHigh: {R: 0xcf, G: 0x22, B: 0x2e, A: 0xff},
+}
+
+// Colour returns the colour a category is shown in, e.g. "#cf222e".
+func Colour(c prices.PriceCategory) string {
+	return hex(categoryColours[c])
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// Options configure a chart. A zero width or height is the default.
+type Options struct {
+	Width  int
+	Height int
+	// Bands are the bands the prices are categorised with.
+	Bands prices.Bands
+	// Title describes the chart for screen readers, e.g. "Gas prices over
+	// the past 7 days".
+	Title string
+}
+
+// chart is the layout of a chart, shared by both formats.
+type chart struct {
+	gasPrices []prices.GasPriceData
+	stats     *prices.PriceStats
+	bands     []band
+	width     int
+	height    int
+	start     time.Time
+	span      time.Duration
+	lo        float64
+	hi        float64
+}
+
+// band is the range of prices in a category, in gwei.
+type band struct {
+	category prices.PriceCategory
+	from     float64
+	to       float64
+}
+
+// newChart lays out the prices, oldest first. The bands are placed around the
+// mean and standard deviation of the charted prices, so they approximate the
+// categories of prices that were categorised against a different window.
+func newChart(gasPrices []prices.GasPriceData, opts Options) (*chart, error) {
+	stats, err := prices.Stats(gasPrices)
+	if err != nil {
+		return nil, errors.New("no gas prices to chart")
+	}
+
+	sorted := make([]prices.GasPriceData, len(gasPrices))
+	copy(sorted, gasPrices)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	c := chart{
+		gasPrices: sorted,
+		stats:     stats,
+		width:     opts.Width,
+		height:    opts.Height,
+		start:     sorted[0].Timestamp,
+		span:      sorted[len(sorted)-1].Timestamp.Sub(sorted[0].Timestamp),
+		lo:        float64(stats.Min),
+		hi:        float64(stats.Max),
+	}
+	if c.width <= 0 {
+		c.width = DefaultWidth
+	}
+	if c.height <= 0 {
+		c.height = DefaultHeight
+	}
+
+	c.bands = categoryBands(stats, opts.Bands)
+
+	// Show at least the Low and High bands either side of the mean, so that
+	// prices can be seen relative to them.
+	if len(c.bands) > 1 {
+		c.lo = math.Min(c.lo, c.bands[1].from)
+		c.hi = math.Max(c.hi, c.bands[len(c.bands)-1].from)
+	}
+	margin := math.Max((c.hi-c.lo)*0.05, 1)
+	c.lo = math.Max(c.lo-margin, 0)
+	c.hi += margin
+
+	return &c, nil
+}
+
+// categoryBands returns the bands of each category from the cheapest up. Until
+// there are enough prices to categorise them, every price is Average.
+func categoryBands(stats *prices.PriceStats, bands prices.Bands) []band {
+	if stats.Samples < bands.MinSamples {
+		return []band{{category: prices.Average, from: math.Inf(-1), to: math.Inf(1)}}
+	}
+
+	mean, stddev := stats.Mean, math.Max(stats.Stddev, bands.MinStddev)
+
+	var result []band
+	add := func(category prices.PriceCategory, to float64) {
+		from := math.Inf(-1)
+		if len(result) > 0 {
+			from = result[len(result)-1].to
+		}
+		result = append(result, band{category: category, from: from, to: to})
+	}
+
+	if bands.VeryLowEnter > 0 {
+		add(prices.VeryLow, mean-bands.VeryLowEnter*stddev)
+	}
+	add(prices.Low, mean-bands.LowEnter*stddev)
+	if bands.VeryHighEnter > 0 {
+		add(prices.Average, mean+bands.HighEnter*stddev)
+		add(prices.High, mean+bands.VeryHighEnter*stddev)
+		add(prices.VeryHigh, math.Inf(1))
+	} else {
+		add(prices.Average, mean+bands.HighEnter*stddev)
+		add(prices.High, math.Inf(1))
+	}
+
+	return result
+}
+
+// x returns the horizontal position of a time.
+func (c *chart) x(t time.Time) float64 {
+	if c.span == 0 {
+		return float64(c.width) / 2
+	}
+
+	return pad + float64(t.Sub(c.start))/float64(c.span)*float64(c.width-2*pad)
+}
+
+// y returns the vertical position of a price, clamped to the chart.
+func (c *chart) y(v float64) float64 {
+	v = math.Max(c.lo, math.Min(v, c.hi))
+	return float64(c.height-pad) - (v-c.lo)/(c.hi-c.lo)*float64(c.height-2*pad)
+}
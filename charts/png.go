@@ -0,0 +1,91 @@
+package charts
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+// PNG renders the prices as a PNG image. Unlike the SVG, it has no labels,
+// since drawing text would need a font.
+func PNG(w io.Writer, gasPrices []prices.GasPriceData, opts Options) error {
+	c, err := newChart(gasPrices, opts)
+	if err != nil {
+		return err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, c.width, c.height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for _, bd := range c.bands {
+		top, bottom := int(math.Round(c.y(bd.to))), int(math.Round(c.y(bd.from)))
+		shade := image.NewUniform(tint(categoryColours[bd.category], bandOpacity))
+		draw.Draw(img, image.Rect(0, top, c.width, bottom), shade, image.Point{}, draw.Src)
+	}
+
+	mean := int(math.Round(c.y(c.stats.Mean)))
+	for x := 0; x < c.width; x++ {
+		// Dashed, 4 pixels on and 4 off, as in the SVG.
+		if x/4%2 == 0 {
+			img.Set(x, mean, meanColour)
+		}
+	}
+
+	for i := 1; i < len(c.gasPrices); i++ {
+		prev, p := &c.gasPrices[i-1], &c.gasPrices[i]
+		drawLine(
+			img,
+			c.x(prev.Timestamp), c.y(float64(prev.Price)),
+			c.x(p.Timestamp), c.y(float64(p.Price)),
+			lineColour,
+		)
+	}
+
+	for i := range c.gasPrices {
+		p := &c.gasPrices[i]
+		drawDot(img, c.x(p.Timestamp), c.y(float64(p.Price)), 2, categoryColours[p.Category])
+	}
+
+	return errors.Wrap(png.Encode(w, img), "while encoding PNG")
+}
+
+// tint returns a colour blended with white, as if drawn over it with the
+// given opacity.
+func tint(c color.RGBA, opacity float64) color.RGBA {
+	blend := func(v uint8) uint8 {
+		return uint8(math.Round(float64(v)*opacity + 0xff*(1-opacity)))
+	}
+
+	return color.RGBA{R: blend(c.R), G: blend(c.G), B: blend(c.B), A: 0xff}
+}
+
+// drawLine draws a line about 1.5 pixels wide between two points.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 float64, c color.RGBA) {
+	steps := int(math.Ceil(math.Max(math.Abs(x1-x0), math.Abs(y1-y0)) * 2))
+	if steps == 0 {
+		steps = 1
+	}
+
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		drawDot(img, x0+(x1-x0)*t, y0+(y1-y0)*t, 0.75, c)
+	}
+}
+
+// drawDot fills a circle.
+func drawDot(img *image.RGBA, cx, cy, r float64, c color.RGBA) {
+	for y := int(math.Floor(cy - r)); y <= int(math.Ceil(cy+r)); y++ {
+		for x := int(math.Floor(cx - r)); x <= int(math.Ceil(cx+r)); x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			if dx*dx+dy*dy <= r*r+0.25 {
+				img.Set(x, y, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package charts
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+// bandOpacity is how strongly the bands are shaded.
+const bandOpacity = 0.15
+
+// SVG renders the prices as an SVG image, which scales to the width of the
+// page it is embedded in.
+func SVG(gasPrices []prices.GasPriceData, opts Options) (string, error) {
+	c, err := newChart(gasPrices, opts)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(
+		&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" role="img" aria-label="%s">`,
+		c.width, c.height, html.EscapeString(opts.Title),
+	)
+
+	for _, bd := range c.bands {
+		top, bottom := c.y(bd.to), c.y(bd.from)
+		fmt.Fprintf(
+			&b, `<rect x="0" y="%.1f" width="%d" height="%.1f" fill="%s" fill-opacity="%.2f"/>`,
+			top, c.width, bottom-top, Colour(bd.category), bandOpacity,
+		)
+	}
+
+	mean := c.y(c.stats.Mean)
+	fmt.Fprintf(
+		&b, `<line x1="0" y1="%.1f" x2="%d" y2="%.1f" stroke="%s" stroke-dasharray="4 4"/>`,
+		mean, c.width, mean, hex(meanColour),
+	)
+
+	fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="`, hex(lineColour))
+	for i := range c.gasPrices {
+		fmt.Fprintf(&b, "%.1f,%.1f ", c.x(c.gasPrices[i].Timestamp), c.y(float64(c.gasPrices[i].Price)))
+	}
+	b.WriteString(`"/>`)
+
+	for i := range c.gasPrices {
+		p := &c.gasPrices[i]
+		fmt.Fprintf(
+			&b, `<circle cx="%.1f" cy="%.1f" r="2" fill="%s"/>`,
+			c.x(p.Timestamp), c.y(float64(p.Price)), Colour(p.Category),
+		)
+	}
+
+	// The highest and lowest prices are labelled level with them.
+	fmt.Fprintf(
+		&b, `<text x="%d" y="%.1f" font-size="12" fill="%s">%d gwei</text>`,
+		pad, math.Max(c.y(float64(c.stats.Max))-3, 12), hex(labelColour), c.stats.Max,
+	)
+	fmt.Fprintf(
+		&b, `<text x="%d" y="%.1f" font-size="12" fill="%s">%d gwei</text>`,
+		pad, math.Min(c.y(float64(c.stats.Min))+13, float64(c.height-2)), hex(labelColour), c.stats.Min,
+	)
+	b.WriteString(`</svg>`)
+
+	return b.String(), nil
+}
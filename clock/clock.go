@@ -0,0 +1,58 @@
+// Package clock provides the current time to the gas tracker, so that tests
+// and replays of past prices can control the time that the pipeline sees, e.g.
+//
+//	clock.Set(fakes.NewClock(start))
+//	defer clock.Set(nil)
+//
+// Timings of requests, such as how long a price source took to respond, use
+// the system clock regardless.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time.
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the clock of the host.
+type System struct{}
+
+// Now returns the current time in UTC, whatever the timezone of the host, so
+// that stored times are consistent.
+func (System) Now() time.Time {
+	return time.Now().UTC()
+}
+
+var (
+	mu      sync.RWMutex
+	current Clock = System{}
+)
+
+// Set makes Now use c, until it is called again with nil to restore the
+// system clock.
+func Set(c Clock) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if c == nil {
+		c = System{}
+	}
+	current = c
+}
+
+// Now returns the current time from the clock in use.
+func Now() time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return current.Now()
+}
+
+// Since returns the time elapsed since t on the clock in use.
+func Since(t time.Time) time.Duration {
+	return Now().Sub(t)
+}
@@ -0,0 +1,58 @@
+// Package display shows times in the timezone that people reading alerts,
+// reports and command output expect. Times are stored and compared in UTC,
+// and shown in the timezone named by GAS_DISPLAY_TIMEZONE, e.g.
+// "Europe/London", which defaults to UTC.
+package display
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	// Embed the timezone database, which Lambda runtimes may not have.
+	_ "time/tzdata"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	mu         sync.Mutex
+	cachedName string
+	cachedLoc  *time.Location
+)
+
+// Location returns the display timezone.
+func Location() (*time.Location, error) {
+	name := os.Getenv("GAS_DISPLAY_TIMEZONE")
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cachedLoc != nil && cachedName == name {
+		return cachedLoc, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while loading GAS_DISPLAY_TIMEZONE %q", name)
+	}
+	cachedName, cachedLoc = name, loc
+
+	return loc, nil
+}
+
+// In returns t in the display timezone. If the timezone is invalid, which
+// validating the config reports, t is shown in UTC instead.
+func In(t time.Time) time.Time {
+	loc, err := Location()
+	if err != nil {
+		log.Warn().Err(err).Msg("showing times in UTC")
+		return t.UTC()
+	}
+
+	return t.In(loc)
+}
@@ -0,0 +1,138 @@
+// Package fakes provides in-memory stand-ins for the tracker's dependencies,
+// so that the pipeline can be run without AWS or network access, e.g.
+//
+//	db := fakes.NewStore()
+//	awsconfig.SetSession(db.Session())
+//	defer awsconfig.SetSession(nil)
+//
+//	clk := fakes.NewClock(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC))
+//	clock.Set(clk)
+//	defer clock.Set(nil)
+//
+//	notifier := &fakes.Notifier{}
+//	gastracker.RegisterNotifier("recorder", notifier)
+//	defer gastracker.UnregisterNotifier("recorder")
+//
+//	_, err := gastracker.Run(ctx, gastracker.RunOptions{Source: fakes.NewSource(30, 10)})
+package fakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ryanc414/gas-tracker/gastracker"
+)
+
+// Source is a scripted price source. Each call to MediumGas returns the next
+// of Prices, repeating the last once they run out, or Err if it is set.
+type Source struct {
+	Prices []int
+	EthUSD float64
+	Err    error
+
+	mu    sync.Mutex
+	calls int
+}
+
+// NewSource returns a source of the given prices, in order.
+func NewSource(prices ...int) *Source {
+	return &Source{Prices: prices}
+}
+
+// MediumGas returns the next scripted price.
+func (s *Source) MediumGas(context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Err != nil {
+		return 0, s.Err
+	}
+	if len(s.Prices) == 0 {
+		return 0, nil
+	}
+
+	i := s.calls
+	if i >= len(s.Prices) {
+		i = len(s.Prices) - 1
+	}
+	s.calls++
+
+	return s.Prices[i], nil
+}
+
+// ETHPrice returns EthUSD.
+func (s *Source) ETHPrice(context.Context) (float64, error) {
+	return s.EthUSD, nil
+}
+
+// Notifier records the alerts sent to it. Register it with
+// gastracker.RegisterNotifier. If Err is set, every delivery fails with it,
+// after the tracker's usual retries.
+type Notifier struct {
+	Err error
+
+	mu     sync.Mutex
+	alerts []gastracker.Alert
+}
+
+// Notify records an alert.
+func (n *Notifier) Notify(_ context.Context, a *gastracker.Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.alerts = append(n.alerts, *a)
+
+	return n.Err
+}
+
+// Alerts returns the alerts recorded so far, in the order they were sent.
+func (n *Notifier) Alerts() []gastracker.Alert {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]gastracker.Alert(nil), n.alerts...)
+}
+
+// Reset forgets the recorded alerts.
+func (n *Notifier) Reset() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.alerts = nil
+}
+
+// Clock is a clock that only moves when told to. Install it with clock.Set.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock stopped at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time the clock is stopped at.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Set stops the clock at now.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
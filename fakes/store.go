@@ -0,0 +1,382 @@
+package fakes
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/ryanc414/gas-tracker/notifications"
+	"github.com/ryanc414/gas-tracker/pushsubs"
+	"github.com/ryanc414/gas-tracker/snooze"
+	"github.com/ryanc414/gas-tracker/store"
+	"github.com/ryanc414/gas-tracker/subscribers"
+)
+
+// Store is an in-memory DynamoDB, serving the requests of clients created
+// from its Session instead of sending them to AWS. It supports the requests
+// that the tracker makes: GetItem, PutItem, with conditions of the form
+// "attribute_not_exists(attribute)" or "attribute = :value", DeleteItem,
+// BatchWriteItem, DescribeTable and Scan, with filters that compare
+// attributes to values, e.g. "attribute = :value AND other >= :min". Batch
+// writes process every item, and scans return every matching item in one
+// page.
+type Store struct {
+	mu     sync.Mutex
+	tables map[string]*table
+}
+
+// table is the items of a table, keyed by the value of their key attribute.
+type table struct {
+	key   string
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+// NewStore returns an empty store with the tables that the tracker uses.
+func NewStore() *Store {
+	s := Store{tables: make(map[string]*table)}
+
+	s.CreateTable(store.TableName, "timestamp")
+	s.CreateTable(store.StateTableName, "id")
+	s.CreateTable(notifications.TableName, "id")
+	s.CreateTable(subscribers.TableName, "id")
+	s.CreateTable(pushsubs.TableName, "endpoint")
+	s.CreateTable(snooze.TableName, "scope")
+	// The tables of notification cooldowns and undelivered alerts.
+	s.CreateTable("gasNotifications", "transition")
+	s.CreateTable("gasUndeliveredAlerts", "id")
+
+	return &s
+}
+
+// CreateTable adds an empty table with the given hash key attribute,
+// replacing any table of the same name.
+func (s *Store) CreateTable(name, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tables[name] = &table{key: key, items: make(map[string]map[string]*dynamodb.AttributeValue)}
+}
+
+// Session returns a session whose DynamoDB clients use the store. Pass it to
+// awsconfig.SetSession to use it throughout the tracker.
+func (s *Store) Session() *session.Session {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("fake", "fake", ""),
+	}))
+	sess.Handlers.Send.Clear()
+	sess.Handlers.Send.PushBack(s.serve)
+
+	return sess
+}
+
+func (s *Store) serve(r *request.Request) {
+	// The response is unmarshalled into the output already filled in below,
+	// so an empty object leaves it unchanged.
+	r.HTTPResponse = &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+	}
+
+	if r.ClientInfo.ServiceName != dynamodb.ServiceName {
+		r.Error = awserr.New("UnsupportedOperation", "fakes.Store only serves DynamoDB, not "+r.ClientInfo.ServiceName, nil)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch in := r.Params.(type) {
+	case *dynamodb.GetItemInput:
+		t, key, err := s.lookup(in.TableName, in.Key)
+		if err != nil {
+			r.Error = err
+			return
+		}
+		r.Data.(*dynamodb.GetItemOutput).Item = t.items[key]
+
+	case *dynamodb.PutItemInput:
+		t, key, err := s.lookup(in.TableName, in.Item)
+		if err != nil {
+			r.Error = err
+			return
+		}
+		if err := checkCondition(in, t.items[key]); err != nil {
+			r.Error = err
+			return
+		}
+		t.items[key] = in.Item
+
+	case *dynamodb.DeleteItemInput:
+		t, key, err := s.lookup(in.TableName, in.Key)
+		if err != nil {
+			r.Error = err
+			return
+		}
+		if aws.StringValue(in.ReturnValues) == dynamodb.ReturnValueAllOld {
+			r.Data.(*dynamodb.DeleteItemOutput).Attributes = t.items[key]
+		}
+		delete(t.items, key)
+
+	case *dynamodb.BatchWriteItemInput:
+		if err := s.batchWrite(in); err != nil {
+			r.Error = err
+		}
+
+	case *dynamodb.DescribeTableInput:
+		t, err := s.table(in.TableName)
+		if err != nil {
+			r.Error = err
+			return
+		}
+		r.Data.(*dynamodb.DescribeTableOutput).Table = &dynamodb.TableDescription{
+			TableName:   in.TableName,
+			TableStatus: aws.String(dynamodb.TableStatusActive),
+			ItemCount:   aws.Int64(int64(len(t.items))),
+		}
+
+	case *dynamodb.ScanInput:
+		out, err := s.scan(in)
+		if err != nil {
+			r.Error = err
+			return
+		}
+		*r.Data.(*dynamodb.ScanOutput) = *out
+
+	default:
+		r.Error = awserr.New("UnsupportedOperation", "fakes.Store does not support "+r.Operation.Name, nil)
+	}
+}
+
+func (s *Store) table(name *string) (*table, error) {
+	t, ok := s.tables[aws.StringValue(name)]
+	if !ok {
+		return nil, awserr.New(
+			dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found: "+aws.StringValue(name), nil,
+		)
+	}
+
+	return t, nil
+}
+
+// lookup returns a table and the key of the item with the given attributes.
+func (s *Store) lookup(name *string, attrs map[string]*dynamodb.AttributeValue) (*table, string, error) {
+	t, err := s.table(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, ok := scalar(attrs[t.key])
+	if !ok {
+		return nil, "", awserr.New("ValidationException", "missing key attribute "+t.key, nil)
+	}
+
+	return t, key, nil
+}
+
+func (s *Store) batchWrite(in *dynamodb.BatchWriteItemInput) error {
+	for name, requests := range in.RequestItems {
+		name := name
+		for _, req := range requests {
+			switch {
+			case req.PutRequest != nil:
+				t, key, err := s.lookup(&name, req.PutRequest.Item)
+				if err != nil {
+					return err
+				}
+				t.items[key] = req.PutRequest.Item
+
+			case req.DeleteRequest != nil:
+				t, key, err := s.lookup(&name, req.DeleteRequest.Key)
+				if err != nil {
+					return err
+				}
+				delete(t.items, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) scan(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	t, err := s.table(in.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := filter(in)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(t.items))
+	for key := range t.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := dynamodb.ScanOutput{ScannedCount: aws.Int64(int64(len(keys)))}
+	for _, key := range keys {
+		if match(t.items[key]) {
+			out.Items = append(out.Items, t.items[key])
+		}
+	}
+	out.Count = aws.Int64(int64(len(out.Items)))
+
+	return &out, nil
+}
+
+// filter returns whether items match the filter of a scan, which is a
+// conjunction of comparisons of the form "a = :v", "a >= :v" and so on.
+func filter(in *dynamodb.ScanInput) (func(map[string]*dynamodb.AttributeValue) bool, error) {
+	expr := aws.StringValue(in.FilterExpression)
+	if expr == "" {
+		return func(map[string]*dynamodb.AttributeValue) bool { return true }, nil
+	}
+
+	var clauses []func(map[string]*dynamodb.AttributeValue) bool
+	for _, clause := range strings.Split(expr, " AND ") {
+		parts := strings.Fields(clause)
+		if len(parts) != 3 {
+			return nil, awserr.New("ValidationException", "fakes.Store only supports filters of the form a = :v AND b >= :w", nil)
+		}
+
+		name, op := parts[0], parts[1]
+		if alias, ok := in.ExpressionAttributeNames[name]; ok {
+			name = aws.StringValue(alias)
+		}
+
+		want := in.ExpressionAttributeValues[parts[2]]
+		if _, ok := scalar(want); !ok {
+			return nil, awserr.New("ValidationException", "missing value for "+parts[2], nil)
+		}
+
+		holds, ok := comparisons[op]
+		if !ok {
+			return nil, awserr.New("ValidationException", "fakes.Store does not support the comparison "+op, nil)
+		}
+
+		clauses = append(clauses, func(item map[string]*dynamodb.AttributeValue) bool {
+			c, ok := compare(item[name], want)
+			return ok && holds(c)
+		})
+	}
+
+	return func(item map[string]*dynamodb.AttributeValue) bool {
+		for _, clause := range clauses {
+			if !clause(item) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// comparisons are the comparison operators of filters, given the result of
+// compare.
+var comparisons = map[string]func(int) bool{
+	"=":  func(c int) bool { return c == 0 },
+	"<>": func(c int) bool { return c != 0 },
+	"<":  func(c int) bool { return c < 0 },
+	"<=": func(c int) bool { return c <= 0 },
+	">":  func(c int) bool { return c > 0 },
+	">=": func(c int) bool { return c >= 0 },
+}
+
+// compare compares two attribute values of the same type, numbers by value
+// and anything else by its bytes. It returns false if they cannot be
+// compared.
+func compare(a, b *dynamodb.AttributeValue) (int, bool) {
+	if a != nil && b != nil && a.N != nil && b.N != nil {
+		x, errX := strconv.ParseFloat(*a.N, 64)
+		y, errY := strconv.ParseFloat(*b.N, 64)
+		if errX != nil || errY != nil {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+
+	x, okX := scalar(a)
+	y, okY := scalar(b)
+	if !okX || !okY || x[0] != y[0] {
+		return 0, false
+	}
+
+	return strings.Compare(x, y), true
+}
+
+// checkCondition checks the condition of a put against the item it would
+// replace, if any.
+func checkCondition(in *dynamodb.PutItemInput, existing map[string]*dynamodb.AttributeValue) error {
+	expr := aws.StringValue(in.ConditionExpression)
+	if expr == "" {
+		return nil
+	}
+
+	failed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+
+	if parts := strings.Fields(expr); len(parts) == 3 && parts[1] == "=" {
+		name := parts[0]
+		if alias, ok := in.ExpressionAttributeNames[name]; ok {
+			name = aws.StringValue(alias)
+		}
+
+		c, ok := compare(existing[name], in.ExpressionAttributeValues[parts[2]])
+		if !ok || c != 0 {
+			return failed
+		}
+		return nil
+	}
+
+	if !strings.HasPrefix(expr, "attribute_not_exists(") || !strings.HasSuffix(expr, ")") {
+		return awserr.New("ValidationException", "fakes.Store only supports conditions of the form attribute_not_exists(a) or a = :v", nil)
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(expr, "attribute_not_exists("), ")")
+	if alias, ok := in.ExpressionAttributeNames[name]; ok {
+		name = aws.StringValue(alias)
+	}
+
+	if _, ok := existing[name]; ok {
+		return failed
+	}
+
+	return nil
+}
+
+// scalar returns a string, number or boolean attribute value as a string.
+func scalar(av *dynamodb.AttributeValue) (string, bool) {
+	switch {
+	case av == nil:
+		return "", false
+	case av.S != nil:
+		return "S" + *av.S, true
+	case av.N != nil:
+		return "N" + *av.N, true
+	case av.BOOL != nil:
+		if *av.BOOL {
+			return "BOOL true", true
+		}
+		return "BOOL false", true
+	default:
+		return "", false
+	}
+}
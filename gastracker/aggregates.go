@@ -0,0 +1,217 @@
+package gastracker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const (
+	// aggregatesStateID is the ID of the running aggregates of the stored
+	// prices, which are updated as prices are added and pruned rather than
+	// recalculated from every stored price.
+	aggregatesStateID = "aggregates"
+	// aggregatesRebuildInterval is how often the aggregates are recalculated
+	// from every stored price anyway, correcting any drift, e.g. from a price
+	// that was written or deleted without updating them.
+	aggregatesRebuildInterval = 24 * time.Hour
+)
+
+// loadAggregates reads the persisted aggregates. If there are none yet, there
+// is no up to date copy of the recent prices, e.g. because a run failed
+// between writing a price and the aggregates, or prices were written by
+// another command, or they were last rebuilt over aggregatesRebuildInterval
+// ago, they are rebuilt from the stored prices.
+func loadAggregates(svc *dynamodb.DynamoDB, recent []prices.GasPriceData) (*prices.Aggregates, error) {
+	var agg prices.Aggregates
+
+	found, err := store.ReadState(svc, aggregatesStateID, &agg)
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading aggregates")
+	}
+	if found && recent != nil && agg.Valid() && clock.Since(agg.RebuiltAt) < aggregatesRebuildInterval {
+		return &agg, nil
+	}
+
+	// Prices stored under non-UTC keys by earlier versions are rewritten
+	// first, so that duplicates of them are not counted. Failing to is not
+	// fatal, since it is tried again at the next rebuild.
+	if _, err := store.NormaliseKeys(svc); err != nil {
+		log.Warn().Err(err).Msg("failed to rewrite gas prices stored under non-UTC keys")
+	}
+
+	// The stored prices are added a page at a time, so that rebuilding does
+	// not hold every one of them.
+	rebuilt := prices.NewAggregates(nil)
+	rebuilt.RebuiltAt = clock.Now().UTC()
+	err = store.EachPrice(svc, func(p *prices.GasPriceData) error {
+		rebuilt.Add(p)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading gas prices")
+	}
+	log.Info().Int("prices", rebuilt.All.Count).Msg("rebuilt aggregates from stored prices")
+
+	return rebuilt, nil
+}
+
+// saveAggregates updates the aggregates with the price that was added and
+// the prices that were pruned, and persists them. As the pruned prices are
+// the oldest, the oldest price is then taken to be the latest of them, which
+// is just before the oldest left.
+func saveAggregates(
+	svc *dynamodb.DynamoDB, agg *prices.Aggregates, added *prices.GasPriceData, pruned []prices.GasPriceData,
+) error {
+	agg.Add(added)
+	for i := range pruned {
+		agg.Remove(&pruned[i])
+		if pruned[i].Timestamp.After(agg.Oldest) {
+			agg.Oldest = pruned[i].Timestamp.UTC()
+		}
+	}
+
+	return errors.Wrap(store.WriteState(svc, aggregatesStateID, agg), "while writing aggregates")
+}
+
+// loadStoredPrices reads the aggregates of the stored prices, and the most
+// recent of them as readRecentPrices does.
+func loadStoredPrices(
+	svc *dynamodb.DynamoDB, window time.Duration, at time.Time,
+) ([]prices.GasPriceData, *prices.Aggregates, error) {
+	recent, err := store.ReadRecent(svc)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "while reading recent gas prices")
+	}
+
+	agg, err := loadAggregates(svc, recent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recent, err = readRecentPrices(svc, agg, recent, window, at)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "while reading gas prices")
+	}
+
+	return recent, agg, nil
+}
+
+// readRecentPrices reads the most recent stored prices, ordered oldest first,
+// including every one sampled within window of at. They are taken from the
+// copy of the recent prices if it has them all, otherwise the window is read
+// from the table. Either way, every stored price since the oldest returned is
+// included, and the latest is included however long ago it was sampled, so
+// that its category is carried over.
+func readRecentPrices(
+	svc *dynamodb.DynamoDB,
+	agg *prices.Aggregates,
+	recent []prices.GasPriceData,
+	window time.Duration,
+	at time.Time,
+) ([]prices.GasPriceData, error) {
+	from := at.Add(-window)
+
+	// The copy has every stored price since its oldest, so it has the window
+	// if it starts before it, or if it has every stored price.
+	if oldest := prices.Oldest(recent); oldest != nil && (!oldest.Timestamp.After(from) || len(recent) == agg.All.Count) {
+		return recent, nil
+	}
+
+	log.Info().Dur("window", window).Msg("too few recent gas prices kept, reading the window of prices")
+
+	gasPrices, err := store.ReadRange(svc, from, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if len(gasPrices) > 0 {
+		return gasPrices, nil
+	}
+
+	latest, err := store.ReadLatest(svc)
+	if err != nil || latest == nil {
+		return gasPrices, err
+	}
+
+	return []prices.GasPriceData{*latest}, nil
+}
+
+// windowOf returns the prices, ordered oldest first, that were sampled within
+// window of at, or the latest if none were.
+func windowOf(gasPrices []prices.GasPriceData, window time.Duration, at time.Time) []prices.GasPriceData {
+	from := at.Add(-window)
+	for i := range gasPrices {
+		if !gasPrices[i].Timestamp.Before(from) {
+			return gasPrices[i:]
+		}
+	}
+	if len(gasPrices) == 0 {
+		return gasPrices
+	}
+
+	return gasPrices[len(gasPrices)-1:]
+}
+
+// findExpired returns the stored prices sampled at or before the given time.
+// They are found in the recent prices if those are every stored price,
+// otherwise read from the table.
+func findExpired(
+	svc *dynamodb.DynamoDB, agg *prices.Aggregates, recent []prices.GasPriceData, before time.Time,
+) ([]prices.GasPriceData, error) {
+	if len(recent) != agg.All.Count {
+		return store.ReadExpired(svc, before)
+	}
+
+	var expired []prices.GasPriceData
+	for i := range recent {
+		if !recent[i].Timestamp.After(before) {
+			expired = append(expired, recent[i])
+		}
+	}
+
+	return expired, nil
+}
+
+// saveRecentPrices records the recent prices, with the price that was added
+// and without those that were pruned, as the copy that the next run reads
+// rather than the table. Failing to is only logged, since the next run then
+// finds the copy out of date and reads the table.
+func saveRecentPrices(
+	svc *dynamodb.DynamoDB, recent []prices.GasPriceData, added *prices.GasPriceData, pruned []prices.GasPriceData,
+) {
+	prunedAt := make(map[time.Time]bool, len(pruned))
+	for i := range pruned {
+		prunedAt[pruned[i].Timestamp.UTC()] = true
+	}
+
+	kept := make([]prices.GasPriceData, 0, len(recent)+1)
+	for i := range recent {
+		if !prunedAt[recent[i].Timestamp.UTC()] {
+			kept = append(kept, recent[i])
+		}
+	}
+	kept = append(kept, *added)
+
+	if err := store.WriteRecent(svc, kept); err != nil {
+		log.Warn().Err(err).Msg("failed to keep recent gas prices, the next run will read the table")
+	}
+}
+
+// aggregateHourStats returns the stats of the prices from the same UTC hour of
+// day as the given time, or nil if there are too few of them.
+func aggregateHourStats(agg *prices.Aggregates, at time.Time) *prices.PriceStats {
+	if agg.Hours[at.UTC().Hour()].Count < minSeasonalSamples {
+		return nil
+	}
+
+	stats := agg.HourStats(at)
+	stats.Context = fmt.Sprintf("%02d:00 UTC", at.UTC().Hour())
+
+	return stats
+}
@@ -0,0 +1,243 @@
+package gastracker
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/display"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+// getSustainedSamples reads how many consecutive samples, including the
+// current one, a condition must hold for before alerting. Defaults to 1,
+// which alerts as soon as the condition is met.
+func getSustainedSamples() (int, error) {
+	raw := os.Getenv("GAS_SUSTAINED_SAMPLES")
+	if raw == "" {
+		return 1, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while parsing GAS_SUSTAINED_SAMPLES %q", raw)
+	}
+	if n < 1 {
+		return 0, errors.Errorf("GAS_SUSTAINED_SAMPLES must be at least 1, got %d", n)
+	}
+
+	return n, nil
+}
+
+// alertDetails is extra context about the current price that is included in
+// every alert.
+type alertDetails struct {
+	// Window is the stats over all stored prices, which span WindowDays.
+	Window     *prices.PriceStats `dynamodbav:"window"`
+	WindowDays int                `dynamodbav:"windowDays"`
+	Rank       *percentileRank    `dynamodbav:"rank"`
+	Summaries  []windowSummary    `dynamodbav:"summaries"`
+	Baselines  []baselineCategory `dynamodbav:"baselines"`
+	Trend      *trend             `dynamodbav:"trend"`
+	Volatility *volatility        `dynamodbav:"volatility"`
+	Market     *marketContext     `dynamodbav:"market"`
+	Forecast   *priceForecast     `dynamodbav:"forecast"`
+	Recommend  *recommendation    `dynamodbav:"recommend"`
+	Costs      []txCost           `dynamodbav:"costs"`
+	Coverage   *coverage          `dynamodbav:"coverage"`
+}
+
+// describe returns the details as lines of text to append to an alert.
+func (d *alertDetails) describe() string {
+	var lines string
+	if d.Rank != nil {
+		lines += d.Rank.String() + "\n"
+	}
+	if w := d.Window; w != nil {
+		lines += fmt.Sprintf(
+			"Lowest in the last %d days was %d gwei on %s, highest was %d gwei on %s\n",
+			d.WindowDays, w.Min, formatSampleTime(w.MinAt), w.Max, formatSampleTime(w.MaxAt),
+		)
+	}
+	if d.Coverage != nil && d.Coverage.Gaps > 0 {
+		lines += d.Coverage.String() + "\n"
+	}
+	if len(d.Baselines) > 0 {
+		vs := make([]string, len(d.Baselines))
+		for i, b := range d.Baselines {
+			vs[i] = fmt.Sprintf("%s vs the last %s", b.Category, b.Window)
+		}
+		lines += strings.Join(vs, ", ") + "\n"
+	}
+	if len(d.Summaries) > 0 {
+		means := make([]string, len(d.Summaries))
+		for i, s := range d.Summaries {
+			means[i] = fmt.Sprintf("%s %.0f gwei", s.Window, s.Mean)
+		}
+		lines += "Mean over " + strings.Join(means, ", ") + "\n"
+	}
+	if d.Trend != nil {
+		lines += d.Trend.String() + "\n"
+	}
+	if d.Volatility != nil {
+		lines += d.Volatility.String() + "\n"
+	}
+	if d.Market != nil {
+		lines += d.Market.String() + "\n"
+	}
+	if d.Forecast != nil {
+		lines += d.Forecast.String() + "\n"
+	}
+	if d.Recommend != nil {
+		lines += d.Recommend.String() + "\n"
+	}
+	if len(d.Costs) > 0 {
+		lines += "Estimated costs:\n"
+		for i := range d.Costs {
+			lines += "  " + d.Costs[i].String() + "\n"
+		}
+	}
+
+	return lines
+}
+
+// windowDays returns the number of days, rounded up, that the stored prices
+// span up to the given time.
+func windowDays(gasPrices []prices.GasPriceData, now time.Time) int {
+	oldest := now
+	for i := range gasPrices {
+		if gasPrices[i].Timestamp.Before(oldest) {
+			oldest = gasPrices[i].Timestamp
+		}
+	}
+
+	return int(math.Ceil(now.Sub(oldest).Hours() / 24))
+}
+
+// formatSampleTime formats when a price was sampled in the display timezone,
+// e.g. "Tue 03:00 UTC".
+func formatSampleTime(t time.Time) string {
+	return display.In(t).Format("Mon 15:04 MST")
+}
+
+// withDetails sets the details of each alert.
+func withDetails(alerts []alert, details alertDetails) []alert {
+	for i := range alerts {
+		alerts[i].Details = details
+	}
+
+	return alerts
+}
+
+// findAlerts returns the alerts triggered by the current gas price, given the
+// stored history of previous prices.
+func findAlerts(
+	current *prices.GasPriceData,
+	gasPrices []prices.GasPriceData,
+	stats *prices.PriceStats,
+	bands prices.Bands,
+	thresholds []threshold,
+	sustainedSamples int,
+) []alert {
+	recent := mostRecentFirst(current, gasPrices)
+	sev := severityFor(current.Price, stats, bands)
+
+	var alerts []alert
+
+	category := current.Category
+	if category != prices.Average {
+		isCategory := func(p *prices.GasPriceData) bool { return p.Category == category }
+
+		if sustained(recent, sustainedSamples, isCategory) {
+			alerts = append(alerts, newCategoryAlert(current, recent[sustainedSamples].Category, stats, bands))
+		}
+	}
+
+	for i := range thresholds {
+		t := &thresholds[i]
+		exceeded := func(p *prices.GasPriceData) bool { return t.exceeded(p.Price) }
+
+		if sustained(recent, sustainedSamples, exceeded) {
+			alerts = append(alerts, alert{
+				Kind:        thresholdAlert,
+				Severity:    sev,
+				NewCategory: category,
+				Price:       current.Price,
+				Threshold:   t,
+				Timestamp:   current.Timestamp,
+			})
+		}
+	}
+
+	return alerts
+}
+
+// newCategoryAlert returns an alert that the price has changed from the
+// previous category to its current one.
+func newCategoryAlert(
+	current *prices.GasPriceData,
+	previous prices.PriceCategory,
+	stats *prices.PriceStats,
+	bands prices.Bands,
+) alert {
+	return alert{
+		Kind:             categoryChangeAlert,
+		Severity:         severityFor(current.Price, stats, bands),
+		NewCategory:      current.Category,
+		PreviousCategory: previous,
+		Price:            current.Price,
+		Timestamp:        current.Timestamp,
+		Context:          stats.Context,
+		TypicalPrice:     stats.Mean,
+	}
+}
+
+// hasAlertOf returns true if any of the alerts is of the given kind.
+func hasAlertOf(alerts []alert, kind alertKind) bool {
+	for i := range alerts {
+		if alerts[i].Kind == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mostRecentFirst returns the current price followed by the stored prices,
+// ordered from newest to oldest.
+func mostRecentFirst(
+	current *prices.GasPriceData, gasPrices []prices.GasPriceData,
+) []prices.GasPriceData {
+	recent := make([]prices.GasPriceData, 0, len(gasPrices)+1)
+	recent = append(recent, *current)
+	recent = append(recent, gasPrices...)
+
+	sort.SliceStable(recent[1:], func(i, j int) bool {
+		return recent[i+1].Timestamp.After(recent[j+1].Timestamp)
+	})
+
+	return recent
+}
+
+// sustained returns true if a condition has held for exactly the n most
+// recent samples: it must hold for each of them but not for the sample before,
+// so that the alert fires once when the condition has been sustained rather
+// than on every subsequent sample.
+func sustained(recent []prices.GasPriceData, n int, cond func(*prices.GasPriceData) bool) bool {
+	if len(recent) <= n {
+		return false
+	}
+
+	for i := 0; i < n; i++ {
+		if !cond(&recent[i]) {
+			return false
+		}
+	}
+
+	return !cond(&recent[n])
+}
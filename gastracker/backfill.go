@@ -0,0 +1,227 @@
+package gastracker
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+// runBackfill stores the prices from a history file that are within the
+// retention and not already stored. Each is categorised against the stats
+// window of prices before it, as it would have been if it had been sampled
+// live. Prices with fewer than two prices before them are Average.
+func runBackfill(file string) error {
+	if file == "" {
+		return errors.New("a history file is required")
+	}
+
+	history, err := readBacktestHistory(file)
+	if err != nil {
+		return err
+	}
+
+	bands, err := getBands()
+	if err != nil {
+		return err
+	}
+	windows, err := getWindowConfig()
+	if err != nil {
+		return err
+	}
+
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return err
+	}
+	svc := dynamodb.New(sess)
+
+	stored, err := store.ReadAll(svc)
+	if err != nil {
+		return errors.Wrap(err, "while reading gas prices")
+	}
+
+	storedAt := make(map[time.Time]bool, len(stored))
+	for i := range stored {
+		storedAt[stored[i].Timestamp.UTC()] = true
+	}
+
+	since := clock.Now().Add(-windows.retention)
+	addedAt := make(map[time.Time]bool)
+	var added []prices.GasPriceData
+	for i := range history {
+		ts := history[i].Timestamp.UTC()
+		if storedAt[ts] || addedAt[ts] || !ts.After(since) {
+			continue
+		}
+
+		addedAt[ts] = true
+		added = append(added, history[i])
+	}
+
+	all := append(stored[:len(stored):len(stored)], added...)
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Timestamp.Before(all[j].Timestamp)
+	})
+
+	for i := range all {
+		p := &all[i]
+		if !addedAt[p.Timestamp.UTC()] {
+			continue
+		}
+
+		p.Category, err = categoriseAfter(all[:i], p, windows, bands)
+		if err != nil {
+			return err
+		}
+
+		if err := store.Write(svc, p); err != nil {
+			return errors.Wrapf(err, "while writing gas price at %s", p.Timestamp)
+		}
+	}
+
+	// The copy of the recent prices that runs read no longer has every price
+	// since its oldest, and clearing it makes the next run rebuild the
+	// aggregates too.
+	if err := store.ClearRecent(svc); err != nil {
+		return errors.Wrap(err, "while clearing recent gas prices")
+	}
+
+	// The latest price changes if a backfilled price is newer than any stored.
+	if len(added) > 0 && addedAt[all[len(all)-1].Timestamp.UTC()] {
+		if err := store.WriteLatest(svc, &all[len(all)-1]); err != nil {
+			return errors.Wrap(err, "while writing latest gas price")
+		}
+	}
+
+	log.Info().Int("skipped", len(history)-len(added)).Msg("skipped prices that were already stored or older than the retention")
+	fmt.Printf("backfilled %d gas prices\n", len(added))
+
+	return nil
+}
+
+// categoriseAfter categorises a price against the stats window of the prices
+// before it, ordered oldest first, as it would have been if it had been
+// sampled live. Prices with fewer than two prices before them are Average.
+func categoriseAfter(
+	before []prices.GasPriceData, p *prices.GasPriceData, windows windowConfig, bands prices.Bands,
+) (prices.PriceCategory, error) {
+	window := prices.Within(before, windows.stats, p.Timestamp)
+	if len(window) < 2 {
+		return prices.Average, nil
+	}
+
+	stats, err := prices.Stats(window)
+	if err != nil {
+		return prices.Average, err
+	}
+
+	return prices.CategorisePriceWithBands(p.Price, stats, prices.LastCategory(before), bands), nil
+}
+
+// BackfillSummary describes the stored prices that a backfill over a range
+// recategorised.
+type BackfillSummary struct {
+	// Checked is the number of stored prices in the range.
+	Checked int `json:"checked"`
+	// Recategorised is the number whose category changed.
+	Recategorised int `json:"recategorised"`
+}
+
+// runBackfillRange recategorises the stored prices sampled from the start of
+// a range up to and including its end, e.g. after changing the bands or the
+// stats window, or after backfilling prices before them. Each is categorised
+// against the stats window of the prices before it, as by runBackfill, in
+// order, so that the hysteresis of each category follows the recategorised
+// one before it. Either bound may be empty to leave the range open.
+func runBackfillRange(rawFrom, rawTo string) (*BackfillSummary, error) {
+	from, err := parseExportTime(rawFrom, false)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseExportTime(rawTo, true)
+	if err != nil {
+		return nil, err
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return nil, errors.Errorf("to (%s) is before from (%s)", rawTo, rawFrom)
+	}
+
+	bands, err := getBands()
+	if err != nil {
+		return nil, err
+	}
+	windows, err := getWindowConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return nil, err
+	}
+	svc := dynamodb.New(sess)
+
+	all, err := store.ReadAll(svc)
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading gas prices")
+	}
+
+	var summary BackfillSummary
+	latestChanged := false
+
+	for i := range all {
+		p := &all[i]
+		if (!from.IsZero() && p.Timestamp.Before(from)) || (!to.IsZero() && p.Timestamp.After(to)) {
+			continue
+		}
+		summary.Checked++
+
+		category, err := categoriseAfter(all[:i], p, windows, bands)
+		if err != nil {
+			return nil, err
+		}
+		if category == p.Category {
+			continue
+		}
+
+		p.Category = category
+		if err := store.Rewrite(svc, p); err != nil {
+			if errors.Is(err, store.ErrNotStored) {
+				log.Warn().Time("timestamp", p.Timestamp).Msg("skipped gas price that is no longer stored")
+				continue
+			}
+			return nil, errors.Wrapf(err, "while rewriting gas price at %s", p.Timestamp)
+		}
+
+		summary.Recategorised++
+		latestChanged = latestChanged || i == len(all)-1
+	}
+
+	if summary.Recategorised > 0 {
+		// The copy of the recent prices that runs read has their old
+		// categories.
+		if err := store.ClearRecent(svc); err != nil {
+			return nil, errors.Wrap(err, "while clearing recent gas prices")
+		}
+	}
+	if latestChanged {
+		if err := store.WriteLatest(svc, &all[len(all)-1]); err != nil {
+			return nil, errors.Wrap(err, "while writing latest gas price")
+		}
+	}
+
+	log.Info().
+		Int("checked", summary.Checked).
+		Int("recategorised", summary.Recategorised).
+		Msg("recategorised stored gas prices")
+
+	return &summary, nil
+}
@@ -0,0 +1,355 @@
+package gastracker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/display"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+// minBacktestHistory is the number of samples replayed before alerts are
+// evaluated, so that the first alerts are not based on a tiny baseline.
+const minBacktestHistory = 24
+
+// defaultBacktestWindow is 7 days of prices, assuming they were sampled
+// hourly.
+const defaultBacktestWindow = 7 * 24
+
+// backtestResult is an alert that would have fired while replaying history.
+type backtestResult struct {
+	alert alert
+	// saving is how much cheaper, as a percentage, the price at a Low or
+	// below-threshold alert was than the mean price over the baseline.
+	saving *float64
+}
+
+// BacktestOptions configures a backtest.
+type BacktestOptions struct {
+	// File is a JSON or CSV (timestamp,price) history to replay instead of
+	// the stored prices.
+	File string
+	// Window is the number of previous samples the baseline is calculated
+	// over.
+	Window int
+	// Verbose prints every alert rather than only the summary.
+	Verbose bool
+}
+
+// DefaultBacktestOptions replays the stored prices over a 7 day window.
+var DefaultBacktestOptions = BacktestOptions{Window: defaultBacktestWindow}
+
+// runBacktest replays stored or imported history through the alert rules
+// configured in the environment, e.g. GAS_HIGH_SIGMA and
+// GAS_SUSTAINED_SAMPLES, and reports the alerts that would have fired.
+func runBacktest(opts BacktestOptions) error {
+	if opts.Window < 2 {
+		return errors.Errorf("window must be at least 2, got %d", opts.Window)
+	}
+
+	gasPrices, err := readBacktestHistory(opts.File)
+	if err != nil {
+		return err
+	}
+
+	bands, err := getBands()
+	if err != nil {
+		return err
+	}
+	thresholds, err := getThresholds()
+	if err != nil {
+		return err
+	}
+	sustainedSamples, err := getSustainedSamples()
+	if err != nil {
+		return err
+	}
+	baseline, err := getBaselineConfig()
+	if err != nil {
+		return err
+	}
+	spikes, err := getSpikeConfig()
+	if err != nil {
+		return err
+	}
+	cooldown, err := getNotificationCooldown()
+	if err != nil {
+		return err
+	}
+	rules, err := getAlertRules()
+	if err != nil {
+		return err
+	}
+	trendSamples, err := getTrendSamples()
+	if err != nil {
+		return err
+	}
+
+	results := backtest(
+		gasPrices, opts.Window, bands, thresholds, sustainedSamples, baseline, spikes, cooldown, rules, trendSamples,
+	)
+	printBacktest(gasPrices, results, opts.Verbose)
+
+	return nil
+}
+
+// readBacktestHistory reads the history to replay from a file, or the stored
+// prices if no file is given, ordered oldest first.
+func readBacktestHistory(file string) ([]prices.GasPriceData, error) {
+	var gasPrices []prices.GasPriceData
+	var err error
+
+	switch {
+	case file == "":
+		var sess *session.Session
+		sess, err = awsconfig.Session()
+		if err != nil {
+			return nil, err
+		}
+		gasPrices, err = store.ReadAll(dynamodb.New(sess))
+
+	case filepath.Ext(file) == ".csv":
+		gasPrices, err = readHistoryCSV(file)
+
+	default:
+		gasPrices, err = readHistoryJSON(file)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading history")
+	}
+
+	sort.Slice(gasPrices, func(i, j int) bool {
+		return gasPrices[i].Timestamp.Before(gasPrices[j].Timestamp)
+	})
+
+	return gasPrices, nil
+}
+
+func readHistoryJSON(file string) ([]prices.GasPriceData, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var gasPrices []prices.GasPriceData
+	if err := json.Unmarshal(data, &gasPrices); err != nil {
+		return nil, errors.Wrapf(err, "while parsing %s", file)
+	}
+
+	return gasPrices, nil
+}
+
+// readHistoryCSV reads a CSV file of RFC 3339 timestamps and prices in gwei,
+// with an optional header row.
+func readHistoryCSV(file string) ([]prices.GasPriceData, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, errors.Wrapf(err, "while parsing %s", file)
+	}
+
+	gasPrices := make([]prices.GasPriceData, 0, len(rows))
+	for i, row := range rows {
+		if len(row) < 2 {
+			return nil, errors.Errorf("%s line %d: expected timestamp and price", file, i+1)
+		}
+
+		ts, err := time.Parse(time.RFC3339, row[0])
+		if err != nil {
+			if i == 0 {
+				continue // Header row.
+			}
+			return nil, errors.Wrapf(err, "%s line %d", file, i+1)
+		}
+
+		price, err := strconv.Atoi(row[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s line %d", file, i+1)
+		}
+
+		gasPrices = append(gasPrices, prices.GasPriceData{Price: price, Timestamp: ts})
+	}
+
+	return gasPrices, nil
+}
+
+// backtest replays the history, oldest first, categorising each sample
+// against the previous window samples and collecting the alerts that would
+// have been sent.
+func backtest(
+	gasPrices []prices.GasPriceData,
+	window int,
+	bands prices.Bands,
+	thresholds []threshold,
+	sustainedSamples int,
+	baseline baselineConfig,
+	spikes spikeConfig,
+	cooldown time.Duration,
+	rules []alertRule,
+	trendSamples int,
+) []backtestResult {
+	var results []backtestResult
+	var ewma prices.EWMA
+	lastSent := make(map[string]time.Time)
+
+	for i := range gasPrices {
+		current := &gasPrices[i]
+		history := gasPrices[:i]
+		if len(history) > window {
+			history = history[len(history)-window:]
+		}
+
+		stats, err := prices.Stats(history)
+		if err != nil {
+			// No history yet to categorise the first sample against.
+			current.Category = prices.Average
+			ewma.Update(current.Price, current.Timestamp, baseline.halfLife)
+			continue
+		}
+
+		windowStats := stats
+		if baseline.kind == ewmaBaseline {
+			stats = ewma.Stats()
+		}
+		if seasonal := seasonalBacktestStats(baseline.kind, history, current.Timestamp); seasonal != nil {
+			stats = seasonal
+		}
+
+		current.Category = prices.CategorisePriceWithBands(
+			current.Price, stats, prices.LastCategory(history), bands,
+		)
+		ewma.Update(current.Price, current.Timestamp, baseline.halfLife)
+
+		if i < minBacktestHistory {
+			continue
+		}
+
+		alerts := findAlerts(current, history, stats, bands, thresholds, sustainedSamples)
+		alerts = applyRules(alerts, rules, current, history, stats, bands, sustainedSamples, trendSamples)
+		if s := findSpike(current, history, stats, bands, spikes); s != nil {
+			alerts = append(alerts, *s)
+		}
+
+		for j := range alerts {
+			a := &alerts[j]
+			key := a.key()
+
+			if sent, ok := lastSent[key]; ok && cooldown > 0 && current.Timestamp.Sub(sent) < cooldown {
+				continue
+			}
+			lastSent[key] = current.Timestamp
+
+			results = append(results, backtestResult{alert: *a, saving: savingFor(a, windowStats)})
+		}
+	}
+
+	return results
+}
+
+// seasonalBacktestStats returns the seasonal stats without logging, since a
+// backtest evaluates many samples.
+func seasonalBacktestStats(
+	kind baselineKind, history []prices.GasPriceData, at time.Time,
+) *prices.PriceStats {
+	switch kind {
+	case hourlyBaseline:
+		return hourOfDayStats(history, at)
+
+	case dayOfWeekBaseline:
+		return dayOfWeekStats(history, at)
+
+	default:
+		return nil
+	}
+}
+
+// savingFor returns how much cheaper the price was than the window mean for
+// alerts that suggest transacting now, or nil for other alerts.
+func savingFor(a *alert, stats *prices.PriceStats) *float64 {
+	buy := a.Kind == categoryChangeAlert && a.NewCategory.Broad() == prices.Low
+	buy = buy || (a.Kind == thresholdAlert && a.Threshold.Direction == thresholdBelow)
+
+	if !buy || stats.Mean == 0 {
+		return nil
+	}
+
+	saving := (stats.Mean - float64(a.Price)) / stats.Mean * 100
+	return &saving
+}
+
+func printBacktest(gasPrices []prices.GasPriceData, results []backtestResult, verbose bool) {
+	if len(gasPrices) == 0 {
+		fmt.Println("no history to replay")
+		return
+	}
+
+	fmt.Printf(
+		"replayed %d samples from %s to %s\n",
+		len(gasPrices),
+		display.In(gasPrices[0].Timestamp).Format(time.RFC3339),
+		display.In(gasPrices[len(gasPrices)-1].Timestamp).Format(time.RFC3339),
+	)
+
+	counts := make(map[string]int)
+	var keys []string
+	var savings []float64
+
+	for i := range results {
+		r := &results[i]
+		key := r.alert.key()
+		if counts[key] == 0 {
+			keys = append(keys, key)
+		}
+		counts[key]++
+
+		if r.saving != nil {
+			savings = append(savings, *r.saving)
+		}
+
+		if verbose {
+			fmt.Printf(
+				"%s  %-24s price=%-5d %s\n",
+				display.In(r.alert.Timestamp).Format(time.RFC3339),
+				key,
+				r.alert.Price,
+				r.alert.Severity,
+			)
+		}
+	}
+
+	fmt.Printf("%d alerts would have fired\n", len(results))
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("  %-24s %d\n", key, counts[key])
+	}
+
+	if len(savings) > 0 {
+		var sum float64
+		for _, s := range savings {
+			sum += s
+		}
+
+		fmt.Printf(
+			"transacting at the %d buy alerts would have been %.1f%% cheaper than the mean on average\n",
+			len(savings), sum/float64(len(savings)),
+		)
+	}
+}
@@ -0,0 +1,119 @@
+package gastracker
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const (
+	ewmaStateID         = "ewma"
+	defaultEWMAHalfLife = 24 * time.Hour
+)
+
+type baselineKind string
+
+const (
+	// windowBaseline uses the mean and standard deviation of every stored
+	// price.
+	windowBaseline baselineKind = "window"
+	// ewmaBaseline uses an exponentially weighted moving average.
+	ewmaBaseline baselineKind = "ewma"
+	// hourlyBaseline uses the mean and standard deviation of the stored
+	// prices from the same UTC hour of day as the current price.
+	hourlyBaseline baselineKind = "hourly"
+	// dayOfWeekBaseline uses the mean and standard deviation of the stored
+	// prices from weekends or weekdays, matching the current price, since
+	// weekend prices are structurally lower.
+	dayOfWeekBaseline baselineKind = "dayofweek"
+)
+
+type baselineConfig struct {
+	kind     baselineKind
+	halfLife time.Duration
+}
+
+// getBaselineConfig reads which baseline prices are categorised against.
+func getBaselineConfig() (baselineConfig, error) {
+	cfg := baselineConfig{
+		kind:     baselineKind(os.Getenv("GAS_BASELINE")),
+		halfLife: defaultEWMAHalfLife,
+	}
+
+	switch cfg.kind {
+	case "":
+		cfg.kind = windowBaseline
+
+	case windowBaseline, ewmaBaseline, hourlyBaseline, dayOfWeekBaseline:
+
+	default:
+		return baselineConfig{}, errors.Errorf(
+			"GAS_BASELINE must be one of window, ewma, hourly or dayofweek, got %q", cfg.kind,
+		)
+	}
+
+	if raw := os.Getenv("GAS_EWMA_HALF_LIFE"); raw != "" {
+		halfLife, err := time.ParseDuration(raw)
+		if err != nil {
+			return baselineConfig{}, errors.Wrapf(err, "while parsing GAS_EWMA_HALF_LIFE %q", raw)
+		}
+		if halfLife <= 0 {
+			return baselineConfig{}, errors.Errorf("GAS_EWMA_HALF_LIFE must be positive, got %v", halfLife)
+		}
+
+		cfg.halfLife = halfLife
+	}
+
+	return cfg, nil
+}
+
+// loadEWMA reads the persisted EWMA state. If there is none yet, it is seeded
+// by replaying the stored prices in order.
+func loadEWMA(
+	svc *dynamodb.DynamoDB, gasPrices []prices.GasPriceData, halfLife time.Duration,
+) (*prices.EWMA, error) {
+	var ewma prices.EWMA
+
+	found, err := store.ReadState(svc, ewmaStateID, &ewma)
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading EWMA state")
+	}
+	if found {
+		return &ewma, nil
+	}
+
+	log.Info().Int("prices", len(gasPrices)).Msg("seeded EWMA from stored prices")
+
+	return replayEWMA(gasPrices, halfLife), nil
+}
+
+// replayEWMA calculates the EWMA of the prices by replaying them in order.
+func replayEWMA(gasPrices []prices.GasPriceData, halfLife time.Duration) *prices.EWMA {
+	sorted := make([]prices.GasPriceData, len(gasPrices))
+	copy(sorted, gasPrices)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	var ewma prices.EWMA
+	for i := range sorted {
+		ewma.Update(sorted[i].Price, sorted[i].Timestamp, halfLife)
+	}
+
+	return &ewma
+}
+
+// saveEWMA updates the EWMA with the current price and persists it.
+func saveEWMA(
+	svc *dynamodb.DynamoDB, ewma *prices.EWMA, current *prices.GasPriceData, halfLife time.Duration,
+) error {
+	ewma.Update(current.Price, current.Timestamp, halfLife)
+
+	return errors.Wrap(store.WriteState(svc, ewmaStateID, ewma), "while writing EWMA state")
+}
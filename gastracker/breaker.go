@@ -0,0 +1,177 @@
+package gastracker
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const (
+	circuitStateIDPrefix   = "circuit/"
+	defaultBreakerFailures = 3
+	defaultBreakerCooldown = 30 * time.Minute
+)
+
+var (
+	// errCircuitOpen is returned instead of attempting a delivery to a
+	// notifier whose circuit is open, when its alerts are queued.
+	errCircuitOpen = errors.New("circuit open after repeated failures")
+	// errAlertDropped is returned instead when its alerts are dropped.
+	errAlertDropped = errors.New("alert dropped while circuit is open")
+)
+
+// breakerMode is what happens to the alerts for a notifier whose circuit is
+// open.
+type breakerMode string
+
+const (
+	// queueAlerts saves them as undelivered, to be retried once the circuit
+	// closes, as long as they are still recent enough to be useful.
+	queueAlerts breakerMode = "queue"
+	// dropAlerts discards them.
+	dropAlerts breakerMode = "drop"
+)
+
+// breakerConfig configures when a notifier's circuit opens, and for how long.
+type breakerConfig struct {
+	failures int
+	cooldown time.Duration
+	mode     breakerMode
+}
+
+// getBreakerConfig reads how many consecutive failed deliveries open a
+// notifier's circuit from GAS_NOTIFIER_BREAKER_FAILURES, 3 by default or
+// never if 0, how long it stays open from GAS_NOTIFIER_BREAKER_COOLDOWN, 30
+// minutes by default, and whether the alerts for it are queued or dropped
+// meanwhile from GAS_NOTIFIER_BREAKER_MODE.
+func getBreakerConfig() (breakerConfig, error) {
+	cfg := breakerConfig{failures: defaultBreakerFailures, cooldown: defaultBreakerCooldown, mode: queueAlerts}
+
+	if raw := os.Getenv("GAS_NOTIFIER_BREAKER_FAILURES"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return breakerConfig{}, errors.Wrapf(err, "while parsing GAS_NOTIFIER_BREAKER_FAILURES %q", raw)
+		}
+		if n < 0 {
+			return breakerConfig{}, errors.Errorf("GAS_NOTIFIER_BREAKER_FAILURES must not be negative, got %d", n)
+		}
+		cfg.failures = n
+	}
+
+	if raw := os.Getenv("GAS_NOTIFIER_BREAKER_COOLDOWN"); raw != "" {
+		cooldown, err := time.ParseDuration(raw)
+		if err != nil {
+			return breakerConfig{}, errors.Wrapf(err, "while parsing GAS_NOTIFIER_BREAKER_COOLDOWN %q", raw)
+		}
+		if cooldown <= 0 {
+			return breakerConfig{}, errors.Errorf("GAS_NOTIFIER_BREAKER_COOLDOWN must be positive, got %v", cooldown)
+		}
+		cfg.cooldown = cooldown
+	}
+
+	switch raw := breakerMode(os.Getenv("GAS_NOTIFIER_BREAKER_MODE")); raw {
+	case "":
+
+	case queueAlerts, dropAlerts:
+		cfg.mode = raw
+
+	default:
+		return breakerConfig{}, errors.Errorf("GAS_NOTIFIER_BREAKER_MODE must be queue or drop, got %q", raw)
+	}
+
+	return cfg, nil
+}
+
+// circuitState is the persisted state of a notifier's circuit, since each run
+// is a separate invocation.
+type circuitState struct {
+	Failures  int       `dynamodbav:"failures"`
+	OpenUntil time.Time `dynamodbav:"openUntil"`
+}
+
+// breakerNotifier wraps another notifier, skipping deliveries to it for a
+// cooldown once it has failed repeatedly, e.g. during an SMTP outage, so that
+// runs do not spend their time retrying it. After the cooldown, the next
+// delivery is attempted, closing the circuit if it succeeds or opening it
+// again if it fails.
+type breakerNotifier struct {
+	notifier notifier
+	svc      *dynamodb.DynamoDB
+	cfg      breakerConfig
+}
+
+// newBreakerNotifier wraps n in a circuit breaker, or returns n unchanged if
+// circuits are disabled.
+func newBreakerNotifier(svc *dynamodb.DynamoDB, cfg breakerConfig, n notifier) notifier {
+	if cfg.failures == 0 {
+		return n
+	}
+
+	return &breakerNotifier{notifier: n, svc: svc, cfg: cfg}
+}
+
+func (b *breakerNotifier) name() string {
+	return b.notifier.name()
+}
+
+// Unwrap returns the notifier that the circuit protects.
+func (b *breakerNotifier) Unwrap() notifier {
+	return b.notifier
+}
+
+func (b *breakerNotifier) notify(ctx context.Context, a *alert) error {
+	id := circuitStateIDPrefix + b.name()
+
+	var state circuitState
+	if _, err := store.ReadState(b.svc, id, &state); err != nil {
+		return errors.Wrap(err, "while reading circuit state")
+	}
+
+	now := clock.Now()
+	if now.Before(state.OpenUntil) {
+		log.Warn().
+			Str("notifier", b.name()).
+			Str("alert", a.key()).
+			Time("until", state.OpenUntil).
+			Msg("notifier circuit is open, not attempting delivery")
+
+		if b.cfg.mode == dropAlerts {
+			return errAlertDropped
+		}
+		return errCircuitOpen
+	}
+
+	err := b.notifier.notify(ctx, a)
+	if err == nil {
+		if state.Failures == 0 {
+			return nil
+		}
+
+		log.Info().Str("notifier", b.name()).Msg("notifier recovered, closing circuit")
+		state = circuitState{}
+	} else {
+		state.Failures++
+	}
+
+	if state.Failures >= b.cfg.failures {
+		state.OpenUntil = now.Add(b.cfg.cooldown)
+		log.Warn().
+			Str("notifier", b.name()).
+			Int("failures", state.Failures).
+			Time("until", state.OpenUntil).
+			Msg("notifier keeps failing, opening circuit")
+	}
+
+	if werr := store.WriteState(b.svc, id, &state); werr != nil {
+		log.Error().Err(werr).Str("notifier", b.name()).Msg("failed to write circuit state")
+	}
+
+	return err
+}
@@ -0,0 +1,191 @@
+package gastracker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const (
+	gasPriceMetricName    = "GasPrice"
+	categoryMetricName    = "Category"
+	fetchErrorsMetricName = "FetchErrors"
+
+	// trackedTier is the tier of gas price that the tracker samples.
+	trackedTier = "medium"
+
+	metricsPutMode = "put"
+	metricsEMFMode = "emf"
+)
+
+// priceMetrics publishes each run's price to CloudWatch as custom metrics, so
+// that alarms and dashboards can be built on them without reading DynamoDB:
+// GasPrice in gwei, Category from 0 for Very Low to 4 for Very High, and
+// FetchErrors, 1 if the price could not be fetched and 0 otherwise. Each has
+// the Chain and Tier dimensions, e.g. ethereum and medium.
+//
+// The metrics are either put with PutMetricData, or written to stdout in the
+// Embedded Metric Format, from which CloudWatch extracts them when the
+// Lambda's logs are ingested, without the API calls or their cost.
+type priceMetrics struct {
+	sess      *session.Session
+	namespace string
+	// emf is where metrics are written in the Embedded Metric Format, or
+	// nil to put them.
+	emf io.Writer
+}
+
+// metricValue is a value of a metric.
+type metricValue struct {
+	name  string
+	value float64
+	unit  string
+}
+
+// newPriceMetrics publishes to the CloudWatch namespace in
+// GAS_CLOUDWATCH_NAMESPACE, using the mode in GAS_CLOUDWATCH_METRICS_MODE,
+// put by default or emf. It returns nil if no namespace is set.
+func newPriceMetrics(sess *session.Session) (*priceMetrics, error) {
+	namespace := os.Getenv("GAS_CLOUDWATCH_NAMESPACE")
+	if namespace == "" {
+		return nil, nil
+	}
+
+	m := priceMetrics{sess: sess, namespace: namespace}
+	switch mode := os.Getenv("GAS_CLOUDWATCH_METRICS_MODE"); mode {
+	case "", metricsPutMode:
+
+	case metricsEMFMode:
+		m.emf = os.Stdout
+
+	default:
+		return nil, errors.Errorf("GAS_CLOUDWATCH_METRICS_MODE must be put or emf, got %q", mode)
+	}
+
+	return &m, nil
+}
+
+// publishPrice publishes a stored price as of when it was sampled, with no
+// fetch error. Any problem doing so is logged rather than returned, since the
+// price is already stored.
+func (m *priceMetrics) publishPrice(ctx context.Context, p *prices.GasPriceData) {
+	if m == nil {
+		return
+	}
+
+	err := m.publish(ctx, p.Timestamp, []metricValue{
+		{name: gasPriceMetricName, value: float64(p.Price), unit: cloudwatch.StandardUnitNone},
+		{name: categoryMetricName, value: float64(p.Category.Level()), unit: cloudwatch.StandardUnitNone},
+		{name: fetchErrorsMetricName, value: 0, unit: cloudwatch.StandardUnitCount},
+	})
+	if err != nil {
+		log.Error().Err(err).Str("namespace", m.namespace).Msg("failed to publish price metrics")
+	}
+}
+
+// publishFetchError publishes that the price could not be fetched. Any problem
+// doing so is logged, so as not to hide the fetch error.
+func (m *priceMetrics) publishFetchError(ctx context.Context) {
+	if m == nil {
+		return
+	}
+
+	err := m.publish(ctx, clock.Now(), []metricValue{
+		{name: fetchErrorsMetricName, value: 1, unit: cloudwatch.StandardUnitCount},
+	})
+	if err != nil {
+		log.Error().Err(err).Str("namespace", m.namespace).Msg("failed to publish fetch error metric")
+	}
+}
+
+func (m *priceMetrics) publish(ctx context.Context, at time.Time, values []metricValue) error {
+	if m.emf != nil {
+		return m.writeEMF(at, values)
+	}
+
+	return m.put(ctx, at, values)
+}
+
+func (m *priceMetrics) put(ctx context.Context, at time.Time, values []metricValue) error {
+	ctx, cancel := context.WithTimeout(ctx, failureMetricTimeout)
+	defer cancel()
+
+	dimensions := []*cloudwatch.Dimension{
+		{Name: aws.String("Chain"), Value: aws.String(trackedChain)},
+		{Name: aws.String("Tier"), Value: aws.String(trackedTier)},
+	}
+
+	data := make([]*cloudwatch.MetricDatum, 0, len(values))
+	for _, v := range values {
+		data = append(data, &cloudwatch.MetricDatum{
+			MetricName: aws.String(v.name),
+			Dimensions: dimensions,
+			Timestamp:  aws.Time(at),
+			Unit:       aws.String(v.unit),
+			Value:      aws.Float64(v.value),
+		})
+	}
+
+	_, err := cloudwatch.New(m.sess).PutMetricDataWithContext(ctx, &cloudwatch.PutMetricDataInput{
+		Namespace:  aws.String(m.namespace),
+		MetricData: data,
+	})
+
+	return errors.Wrap(err, "while publishing to CloudWatch")
+}
+
+// emfMetadata is the _aws member of a log line in the Embedded Metric Format,
+// which declares which of the line's members are metrics and dimensions.
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// writeEMF writes the values as a single line in the Embedded Metric Format.
+func (m *priceMetrics) writeEMF(at time.Time, values []metricValue) error {
+	directive := emfDirective{
+		Namespace:  m.namespace,
+		Dimensions: [][]string{{"Chain", "Tier"}},
+	}
+	line := map[string]interface{}{
+		"Chain": trackedChain,
+		"Tier":  trackedTier,
+	}
+	for _, v := range values {
+		directive.Metrics = append(directive.Metrics, emfMetric{Name: v.name, Unit: v.unit})
+		line[v.name] = v.value
+	}
+	line["_aws"] = emfMetadata{
+		Timestamp:         at.UnixNano() / int64(time.Millisecond),
+		CloudWatchMetrics: []emfDirective{directive},
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		return errors.Wrap(err, "while marshalling metrics")
+	}
+
+	_, err = m.emf.Write(append(data, '\n'))
+	return errors.Wrap(err, "while writing metrics")
+}
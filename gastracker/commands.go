@@ -0,0 +1,138 @@
+package gastracker
+
+import (
+	"context"
+	"io"
+)
+
+// Backtest replays stored or imported history through the configured alert
+// rules and prints the alerts that would have fired.
+func Backtest(opts BacktestOptions) error {
+	return withConfig(func() error { return runBacktest(opts) })
+}
+
+// Costs prints the estimated cost of common transactions at gwei, or at the
+// current gas price if gwei is zero.
+func Costs(ctx context.Context, gwei int) error {
+	return withConfig(func() error { return runCosts(ctx, gwei) })
+}
+
+// Decide decides whether to transact at the latest stored price.
+func Decide(opts DecisionOptions) (*Decision, error) {
+	var d *Decision
+	err := withConfig(func() error {
+		var err error
+		d, err = runDecide(opts)
+		return err
+	})
+
+	return d, err
+}
+
+// Report prints the weekly report for the stored prices.
+func Report() error {
+	return withConfig(runReport)
+}
+
+// Stats prints the stats and price distribution of the stored prices, with
+// the given number of histogram buckets.
+func Stats(buckets int) error {
+	return withConfig(func() error { return runStats(buckets) })
+}
+
+// History prints up to limit of the most recent stored prices, or all of them
+// if limit is zero.
+func History(limit int) error {
+	return withConfig(func() error { return runHistory(limit) })
+}
+
+// Notifications prints up to limit of the most recent notifications in the
+// history, or all of them if limit is zero, only those sent over channel if
+// it is set.
+func Notifications(limit int, channel string) error {
+	return withConfig(func() error { return runNotifications(limit, channel) })
+}
+
+// Export writes the stored prices in the range, oldest first, to w in the
+// given format, either "json" or "csv".
+func Export(w io.Writer, opts ExportOptions) error {
+	return withConfig(func() error { return runExport(w, opts) })
+}
+
+// ExportParquet writes the stored prices in the range to dir as Parquet files
+// partitioned by date.
+func ExportParquet(dir string, opts ExportOptions) error {
+	return withConfig(func() error { return runExportParquet(dir, opts) })
+}
+
+// Backfill categorises the prices in a JSON or CSV (timestamp,price) history
+// file and stores those within the retention that are not already stored.
+func Backfill(file string) error {
+	return withConfig(func() error { return runBackfill(file) })
+}
+
+// BackfillRange recategorises the stored prices sampled between from and to,
+// inclusive, against the prices before them. Each is an RFC 3339 timestamp or
+// a date, as for Export, or empty to leave the range open.
+func BackfillRange(from, to string) (*BackfillSummary, error) {
+	var summary *BackfillSummary
+	err := withConfig(func() error {
+		var err error
+		summary, err = runBackfillRange(from, to)
+		return err
+	})
+
+	return summary, err
+}
+
+// Serve serves the HTTP price API, health endpoints, web dashboard and
+// decisions whether to transact, and optionally the gRPC API, until either
+// fails or ctx is done, when it shuts down gracefully. See api.Handler,
+// healthHandler, webui, decisionHandler and grpcapi.GasTrackerServer for the
+// endpoints.
+func Serve(ctx context.Context, opts ServeOptions) error {
+	return withConfig(func() error { return runServe(ctx, opts) })
+}
+
+// Publish renders the dashboard for the stored prices and uploads it to S3.
+func Publish() error {
+	return withConfig(runPublish)
+}
+
+// NotifyTest sends a test alert through every configured notifier.
+func NotifyTest(ctx context.Context) error {
+	return withConfig(func() error { return runNotifyTest(ctx) })
+}
+
+// SendAlert sends an alert on behalf of another system, returning the number
+// of notifications delivered.
+func SendAlert(ctx context.Context, req AlertRequest) (int, error) {
+	var sent int
+	err := withConfig(func() error {
+		var err error
+		sent, err = runSendAlert(ctx, req)
+		return err
+	})
+
+	return sent, err
+}
+
+// ValidateConfig checks the configuration without fetching or storing any
+// prices.
+func ValidateConfig() error {
+	if err := loadConfigFile(); err != nil {
+		return err
+	}
+
+	return validateConfig()
+}
+
+// withConfig loads the config file before running f, and points any errors
+// about variables set by the config file back to their keys.
+func withConfig(f func() error) error {
+	if err := loadConfigFile(); err != nil {
+		return err
+	}
+
+	return withConfigSource(f())
+}
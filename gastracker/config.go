@@ -0,0 +1,456 @@
+package gastracker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/display"
+	"gopkg.in/yaml.v2"
+)
+
+// configKeys maps each key of the config file to the environment variable it
+// sets. Environment variables that are already set override the config file.
+var configKeys = map[string]string{
+	"aws.region":      "GAS_AWS_REGION",
+	"aws.profile":     "GAS_AWS_PROFILE",
+	"aws.role_arn":    "GAS_AWS_ROLE_ARN",
+	"aws.max_retries": "GAS_AWS_MAX_RETRIES",
+
+	"run_timeout": "GAS_RUN_TIMEOUT",
+
+	"display.timezone": "GAS_DISPLAY_TIMEZONE",
+
+	"sources.use":                    "GAS_SOURCE",
+	"sources.timeout":                "GAS_SOURCE_TIMEOUT",
+	"sources.concurrency":            "GAS_SOURCE_CONCURRENCY",
+	"sources.etherscan.api_key":      "ETHERSCAN_API_KEY",
+	"sources.etherscan.timeout":      "GAS_SOURCE_ETHERSCAN_TIMEOUT",
+	"sources.etherscan.attempts":     "GAS_SOURCE_ETHERSCAN_ATTEMPTS",
+	"sources.etherscan.retry_budget": "GAS_SOURCE_ETHERSCAN_RETRY_BUDGET",
+	"sources.exec.command":           "GAS_SOURCE_EXEC_COMMAND",
+	"sources.exec.timeout":           "GAS_SOURCE_EXEC_TIMEOUT",
+
+	"thresholds.high_sigma":        "GAS_HIGH_SIGMA",
+	"thresholds.high_exit_sigma":   "GAS_HIGH_EXIT_SIGMA",
+	"thresholds.low_sigma":         "GAS_LOW_SIGMA",
+	"thresholds.low_exit_sigma":    "GAS_LOW_EXIT_SIGMA",
+	"thresholds.very_high_sigma":   "GAS_VERY_HIGH_SIGMA",
+	"thresholds.very_low_sigma":    "GAS_VERY_LOW_SIGMA",
+	"thresholds.min_samples":       "GAS_MIN_SAMPLES",
+	"thresholds.min_stddev_gwei":   "GAS_MIN_STDDEV_GWEI",
+	"thresholds.alert_above_gwei":  "GAS_ALERT_ABOVE_GWEI",
+	"thresholds.alert_below_gwei":  "GAS_ALERT_BELOW_GWEI",
+	"thresholds.sustained_samples": "GAS_SUSTAINED_SAMPLES",
+
+	"baseline.kind":           "GAS_BASELINE",
+	"baseline.ewma_half_life": "GAS_EWMA_HALF_LIFE",
+
+	"windows.retention":      "GAS_RETENTION",
+	"windows.stats":          "GAS_STATS_WINDOW",
+	"windows.short_baseline": "GAS_SHORT_BASELINE_WINDOW",
+	"windows.summaries":      "GAS_STATS_SUMMARY_WINDOWS",
+	"windows.min_coverage":   "GAS_MIN_COVERAGE",
+	"windows.warmup":         "GAS_WARMUP",
+
+	"analysis.forecast_hours":         "GAS_FORECAST_HOURS",
+	"analysis.spike_mad_multiplier":   "GAS_SPIKE_MAD_MULTIPLIER",
+	"analysis.spike_window":           "GAS_SPIKE_WINDOW",
+	"analysis.trend_samples":          "GAS_TREND_SAMPLES",
+	"analysis.volatility_window":      "GAS_VOLATILITY_WINDOW",
+	"analysis.volatility_alerts":      "GAS_VOLATILITY_ALERTS",
+	"analysis.correlation_window":     "GAS_CORRELATION_WINDOW",
+	"analysis.recommend_window_hours": "GAS_RECOMMEND_WINDOW_HOURS",
+	"analysis.cost_presets":           "GAS_COST_PRESETS",
+
+	"notifiers.cooldown":    "GAS_NOTIFIER_COOLDOWN",
+	"notifiers.subscribers": "GAS_SUBSCRIBERS_ENABLED",
+	"notifiers.desktop":     "GAS_DESKTOP_NOTIFICATIONS",
+	"notifiers.from_stream": "GAS_NOTIFY_FROM_STREAM",
+	"notifiers.function":    "GAS_NOTIFIER_FUNCTION",
+
+	"notifiers.breaker.failures": "GAS_NOTIFIER_BREAKER_FAILURES",
+	"notifiers.breaker.cooldown": "GAS_NOTIFIER_BREAKER_COOLDOWN",
+	"notifiers.breaker.mode":     "GAS_NOTIFIER_BREAKER_MODE",
+
+	"notifiers.failures.runs":             "GAS_FAILURE_ALERT_RUNS",
+	"notifiers.failures.notifiers":        "GAS_FAILURE_ALERT_NOTIFIERS",
+	"notifiers.failures.metric_namespace": "GAS_FAILURE_METRIC_NAMESPACE",
+
+	"notifiers.rules": "GAS_ALERT_RULES",
+
+	"notifiers.routes.info":   "GAS_ROUTE_INFO",
+	"notifiers.routes.notice": "GAS_ROUTE_NOTICE",
+	"notifiers.routes.urgent": "GAS_ROUTE_URGENT",
+
+	"notifiers.email.from":                "GAS_NOTIFIER_FROM",
+	"notifiers.email.to":                  "GAS_NOTIFIER_TO",
+	"notifiers.email.password":            "GAS_NOTIFIER_PASSWORD",
+	"notifiers.email.smtp_host":           "GAS_NOTIFIER_SMTP_HOST",
+	"notifiers.email.smtp_port":           "GAS_NOTIFIER_SMTP_PORT",
+	"notifiers.email.smtp_tls":            "GAS_NOTIFIER_SMTP_TLS",
+	"notifiers.email.smtp_auth":           "GAS_NOTIFIER_SMTP_AUTH",
+	"notifiers.email.oauth_client_id":     "GAS_NOTIFIER_OAUTH_CLIENT_ID",
+	"notifiers.email.oauth_client_secret": "GAS_NOTIFIER_OAUTH_CLIENT_SECRET",
+	"notifiers.email.oauth_refresh_token": "GAS_NOTIFIER_OAUTH_REFRESH_TOKEN",
+
+	"notifiers.teams.webhook_url": "GAS_TEAMS_WEBHOOK_URL",
+
+	"notifiers.slack.webhook_url":    "GAS_SLACK_WEBHOOK_URL",
+	"notifiers.slack.signing_secret": "GAS_SLACK_SIGNING_SECRET",
+
+	"notifiers.exec.command": "GAS_EXEC_NOTIFIER_COMMAND",
+	"notifiers.exec.timeout": "GAS_EXEC_NOTIFIER_TIMEOUT",
+	"notifiers.exec.env":     "GAS_EXEC_NOTIFIER_ENV",
+
+	"notifiers.webpush.vapid_private_key": "GAS_WEBPUSH_VAPID_PRIVATE_KEY",
+	"notifiers.webpush.vapid_public_key":  "GAS_WEBPUSH_VAPID_PUBLIC_KEY",
+	"notifiers.webpush.subscriber":        "GAS_WEBPUSH_SUBSCRIBER",
+
+	"notifiers.mqtt.broker":           "GAS_MQTT_BROKER",
+	"notifiers.mqtt.client_id":        "GAS_MQTT_CLIENT_ID",
+	"notifiers.mqtt.username":         "GAS_MQTT_USERNAME",
+	"notifiers.mqtt.password":         "GAS_MQTT_PASSWORD",
+	"notifiers.mqtt.topic_prefix":     "GAS_MQTT_TOPIC_PREFIX",
+	"notifiers.mqtt.discovery_prefix": "GAS_MQTT_DISCOVERY_PREFIX",
+
+	"outputs.prometheus.remote_write_url": "GAS_PROMETHEUS_REMOTE_WRITE_URL",
+	"outputs.prometheus.username":         "GAS_PROMETHEUS_USERNAME",
+	"outputs.prometheus.password":         "GAS_PROMETHEUS_PASSWORD",
+	"outputs.prometheus.job":              "GAS_PROMETHEUS_JOB",
+
+	"outputs.sheets.spreadsheet_id":      "GAS_SHEETS_SPREADSHEET_ID",
+	"outputs.sheets.sheet":               "GAS_SHEETS_SHEET",
+	"outputs.sheets.mode":                "GAS_SHEETS_MODE",
+	"outputs.sheets.oauth_client_id":     "GAS_SHEETS_OAUTH_CLIENT_ID",
+	"outputs.sheets.oauth_client_secret": "GAS_SHEETS_OAUTH_CLIENT_SECRET",
+	"outputs.sheets.oauth_refresh_token": "GAS_SHEETS_OAUTH_REFRESH_TOKEN",
+
+	"outputs.cloudwatch.namespace":    "GAS_CLOUDWATCH_NAMESPACE",
+	"outputs.cloudwatch.metrics_mode": "GAS_CLOUDWATCH_METRICS_MODE",
+
+	"outputs.statsd.addr":   "GAS_STATSD_ADDR",
+	"outputs.statsd.prefix": "GAS_STATSD_PREFIX",
+	"outputs.statsd.tags":   "GAS_STATSD_TAGS",
+
+	"dashboard.bucket": "GAS_DASHBOARD_BUCKET",
+	"dashboard.key":    "GAS_DASHBOARD_KEY",
+
+	"ingest.token": "GAS_INGEST_TOKEN",
+
+	"actions.url":    "GAS_ACTIONS_URL",
+	"actions.secret": "GAS_ACTIONS_SECRET",
+
+	"unsubscribe.url":    "GAS_UNSUBSCRIBE_URL",
+	"unsubscribe.secret": "GAS_UNSUBSCRIBE_SECRET",
+
+	"reports.weekly_day":  "GAS_WEEKLY_REPORT_DAY",
+	"reports.weekly_hour": "GAS_WEEKLY_REPORT_HOUR",
+	"reports.bucket":      "GAS_REPORT_BUCKET",
+}
+
+var (
+	// configSources records the config file key that set each environment
+	// variable, so that errors about the variable can point back to the file.
+	configSources = map[string]string{}
+	// loadedConfigFile is the config file already loaded, which is not read
+	// again by warm Lambda invocations or later commands.
+	loadedConfigFile string
+)
+
+// loadConfigFile reads the YAML config file named by GAS_CONFIG_FILE, if set
+// and not already loaded, and sets the environment variable for each key that
+// is not already set.
+func loadConfigFile() error {
+	file := os.Getenv("GAS_CONFIG_FILE")
+	if file == "" || file == loadedConfigFile {
+		return nil
+	}
+
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.Wrap(err, "while reading GAS_CONFIG_FILE")
+	}
+
+	var doc map[interface{}]interface{}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return errors.Wrapf(err, "while parsing config file %s", file)
+	}
+
+	values := make(map[string]string)
+	if err := flattenConfig("", doc, values); err != nil {
+		return errors.Wrapf(err, "in config file %s", file)
+	}
+
+	for key, value := range values {
+		envVar := configKeys[key]
+		if _, ok := os.LookupEnv(envVar); ok {
+			if configSources[envVar] == "" {
+				log.Info().Str("env", envVar).Str("key", key).Str("file", file).Msg("environment variable overrides config file")
+			}
+			continue
+		}
+
+		if err := os.Setenv(envVar, value); err != nil {
+			return errors.Wrapf(err, "while setting %s", envVar)
+		}
+		configSources[envVar] = fmt.Sprintf("%s in config file %s", key, file)
+	}
+	loadedConfigFile = file
+
+	return nil
+}
+
+// flattenConfig converts a section of the config file to the values of the
+// environment variables it sets, keyed by their full config keys.
+func flattenConfig(prefix string, section map[interface{}]interface{}, values map[string]string) error {
+	for rawKey, value := range section {
+		key := fmt.Sprint(rawKey)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if _, ok := configKeys[key]; ok {
+			str, err := configValue(value)
+			if err != nil {
+				return errors.Wrapf(err, "while parsing %s", key)
+			}
+			values[key] = str
+			continue
+		}
+
+		subsection, ok := value.(map[interface{}]interface{})
+		if !ok || !isConfigSection(key) {
+			return errors.Errorf("unknown key %s, expected one of: %s", key, strings.Join(configKeysUnder(prefix), ", "))
+		}
+
+		if err := flattenConfig(key, subsection, values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// configValue converts a config value to the format of its environment
+// variable. Lists are comma-separated, and maps are comma-separated lists of
+// key=value pairs, whose values may themselves be "|"-separated lists, e.g.
+// the categories each recipient wants in notifiers.email.to.
+func configValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+
+	case []interface{}:
+		fields := make([]string, len(v))
+		for i := range v {
+			field, err := configScalar(v[i])
+			if err != nil {
+				return "", err
+			}
+			fields[i] = field
+		}
+		return strings.Join(fields, ","), nil
+
+	case map[interface{}]interface{}:
+		var fields []string
+		for key, item := range v {
+			field := fmt.Sprint(key)
+			if list, ok := item.([]interface{}); ok {
+				var parts []string
+				for i := range list {
+					part, err := configScalar(list[i])
+					if err != nil {
+						return "", err
+					}
+					parts = append(parts, part)
+				}
+				field += "=" + strings.Join(parts, "|")
+			} else if item != nil {
+				part, err := configScalar(item)
+				if err != nil {
+					return "", err
+				}
+				field += "=" + part
+			}
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		return strings.Join(fields, ","), nil
+
+	default:
+		return configScalar(v)
+	}
+}
+
+// configScalar converts a single string, number or boolean to a string.
+func configScalar(value interface{}) (string, error) {
+	switch value.(type) {
+	case string, int, int64, uint64, float64, bool:
+		return fmt.Sprint(value), nil
+
+	default:
+		return "", errors.Errorf("expected a string, number or boolean, got %v", value)
+	}
+}
+
+// isConfigSection returns true if key is a prefix of any config key.
+func isConfigSection(key string) bool {
+	for k := range configKeys {
+		if strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// configKeysUnder returns the keys and sections directly within a section of
+// the config file, or at the top level if prefix is empty.
+func configKeysUnder(prefix string) []string {
+	if prefix != "" {
+		prefix += "."
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	for k := range configKeys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		name := strings.SplitN(strings.TrimPrefix(k, prefix), ".", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// withConfigSource adds the config file key to an error about an environment
+// variable that was set from the config file.
+func withConfigSource(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	var envVars []string
+	for envVar := range configSources {
+		if strings.Contains(msg, envVar) {
+			envVars = append(envVars, envVar)
+		}
+	}
+	if len(envVars) == 0 {
+		return err
+	}
+
+	sort.Strings(envVars)
+	sources := make([]string, len(envVars))
+	for i, envVar := range envVars {
+		sources[i] = fmt.Sprintf("%s is set by %s", envVar, configSources[envVar])
+	}
+
+	return errors.Wrap(err, strings.Join(sources, "; "))
+}
+
+// validateConfig reads every setting, reporting all that are invalid rather
+// than only the first.
+func validateConfig() error {
+	var problems []string
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, withConfigSource(err).Error())
+		}
+	}
+
+	_, _, err := getSource()
+	check(err)
+
+	_, notifiers, _, err := loadNotifiers(nil)
+	check(err)
+	if err == nil {
+		_, err = getRoutes(notifiers)
+		check(err)
+
+		var rules []alertRule
+		rules, err = getAlertRules()
+		check(err)
+		check(checkRuleNotifiers(rules, notifiers))
+
+		var failureAlerts failureAlertConfig
+		failureAlerts, err = getFailureAlertConfig()
+		check(err)
+		for _, name := range failureAlerts.notifiers {
+			if findNotifier(notifiers, name) == nil {
+				check(errors.Errorf("GAS_FAILURE_ALERT_NOTIFIERS refers to unconfigured channel %q", name))
+			}
+		}
+	}
+
+	_, err = getNotificationCooldown()
+	check(err)
+	_, err = newSheetsWriter(nil)
+	check(errors.Wrap(err, "while configuring Google Sheets"))
+	_, err = newPriceMetrics(nil)
+	check(errors.Wrap(err, "while configuring CloudWatch metrics"))
+	statsdClient, err := newStatsdClient()
+	check(err)
+	if statsdClient != nil {
+		statsdClient.conn.Close()
+	}
+	_, err = newLinker()
+	check(errors.Wrap(err, "while configuring alert links"))
+	_, err = newUnsubscribeLinker()
+	check(errors.Wrap(err, "while configuring unsubscribe links"))
+	_, err = getBands()
+	check(err)
+	_, err = getThresholds()
+	check(err)
+	_, err = getSustainedSamples()
+	check(err)
+	_, err = getBaselineConfig()
+	check(err)
+	_, err = getForecastHours()
+	check(err)
+	_, err = getSpikeConfig()
+	check(err)
+	_, err = getTrendSamples()
+	check(err)
+	_, err = getVolatilityConfig()
+	check(err)
+	_, err = getCorrelationWindow()
+	check(err)
+	_, err = getRecommendWindowHours()
+	check(err)
+	_, err = getCostPresets()
+	check(err)
+	_, err = getReportSchedule()
+	check(err)
+	_, err = getWindowConfig()
+	check(err)
+	_, err = getMinCoverage()
+	check(err)
+	_, err = getWarmup()
+	check(err)
+	_, err = getRunTimeout()
+	check(err)
+	_, err = display.Location()
+	check(err)
+	_, err = awsconfig.MaxRetries()
+	check(err)
+
+	if len(problems) > 0 {
+		return errors.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package gastracker
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/subscribers"
+)
+
+// SubscriptionConfirmer sends the links that new subscribers, and subscribers
+// who change their channels, must follow before they are sent alerts, so that
+// nobody can subscribe an address or webhook they do not control.
+type SubscriptionConfirmer struct {
+	baseURL string
+	secret  []byte
+	email   *emailNotifier
+}
+
+// NewSubscriptionConfirmer constructs a confirmer for links to the subscriber
+// API at baseURL, signed with the secret. Emails are sent as configured by
+// GAS_NOTIFIER_FROM and the other email settings.
+func NewSubscriptionConfirmer(baseURL, secret string) (*SubscriptionConfirmer, error) {
+	email, err := newEmailNotifier()
+	if err != nil {
+		return nil, errors.Wrap(err, "while configuring email")
+	}
+
+	return &SubscriptionConfirmer{baseURL: baseURL, secret: []byte(secret), email: email}, nil
+}
+
+// Send sends a link that confirms a subscriber to each of their channels.
+func (c *SubscriptionConfirmer) Send(ctx context.Context, sub *subscribers.Subscriber) error {
+	now := clock.Now()
+	link, err := subscribers.ConfirmLink(c.baseURL, c.secret, sub, now)
+	if err != nil {
+		return errors.Wrap(err, "while generating confirm link")
+	}
+
+	channels, err := subscriberChannels(sub, c.email, nil)
+	if err != nil {
+		return err
+	}
+
+	a := alert{
+		Kind:     requestedAlert,
+		Severity: severityInfo,
+		Title:    "Confirm your gas price alerts",
+		Message: "Someone subscribed this channel to gas price alerts. " +
+			"Follow the link to confirm, or ignore this message and no alerts will be sent.",
+		Links:     []AlertLink{{Label: "Confirm", URL: link}},
+		Timestamp: now,
+	}
+
+	for i := range channels {
+		if err := channels[i].notifier.notify(ctx, &a); err != nil {
+			return errors.Wrapf(err, "while sending confirmation to %s", channels[i].kind)
+		}
+	}
+
+	return nil
+}
+
+// Verify checks that a signed token from a confirm link confirms the
+// subscriber's current channels.
+func (c *SubscriptionConfirmer) Verify(sub *subscribers.Subscriber, token string) error {
+	return subscribers.VerifyConfirm(c.secret, sub, token, clock.Now())
+}
@@ -0,0 +1,102 @@
+package gastracker
+
+import (
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const notificationsTableName = "gasNotifications"
+
+// notificationRecord stores when a notification was last sent for a given
+// alert key, e.g. the category transition "Average->Low".
+type notificationRecord struct {
+	Transition string    `dynamodbav:"transition"`
+	LastSent   time.Time `dynamodbav:"lastSent"`
+}
+
+func transitionKey(previousCategory, newCategory prices.PriceCategory) string {
+	return previousCategory.String() + "->" + newCategory.String()
+}
+
+// getNotificationCooldown reads the minimum interval between notifications
+// for the same category transition or threshold. Defaults to zero, meaning no
+// cooldown.
+func getNotificationCooldown() (time.Duration, error) {
+	raw := os.Getenv("GAS_NOTIFIER_COOLDOWN")
+	if raw == "" {
+		return 0, nil
+	}
+
+	cooldown, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while parsing GAS_NOTIFIER_COOLDOWN %q", raw)
+	}
+	if cooldown < 0 {
+		return 0, errors.Errorf("GAS_NOTIFIER_COOLDOWN must not be negative, got %v", cooldown)
+	}
+
+	return cooldown, nil
+}
+
+// inCooldown returns true if a notification for the same alert key was
+// already sent within the cooldown period.
+func inCooldown(
+	svc *dynamodb.DynamoDB, key string, cooldown time.Duration, now time.Time,
+) (bool, error) {
+	if cooldown == 0 {
+		return false, nil
+	}
+
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"transition": {
+				S: aws.String(key),
+			},
+		},
+		TableName: aws.String(notificationsTableName),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if result.Item == nil {
+		return false, nil
+	}
+
+	var record notificationRecord
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &record); err != nil {
+		return false, err
+	}
+
+	return now.Sub(record.LastSent) < cooldown, nil
+}
+
+func recordNotification(svc *dynamodb.DynamoDB, key string, now time.Time) error {
+	av, err := dynamodbattribute.MarshalMap(notificationRecord{
+		Transition: key,
+		LastSent:   now,
+	})
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(notificationsTableName),
+	}
+
+	if _, err = svc.PutItem(input); err != nil {
+		return err
+	}
+
+	log.Debug().Str("alert", key).Msg("recorded notification time")
+
+	return nil
+}
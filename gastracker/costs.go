@@ -0,0 +1,138 @@
+package gastracker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const gweiPerETH = 1e9
+
+// costPreset is a common kind of transaction and the gas units it uses.
+type costPreset struct {
+	Name     string `dynamodbav:"name"`
+	GasUnits int    `dynamodbav:"gasUnits"`
+}
+
+// defaultCostPresets are typical gas usages of common transactions.
+var defaultCostPresets = []costPreset{
+	{Name: "transfer", GasUnits: 21000},
+	{Name: "erc20", GasUnits: 65000},
+	{Name: "swap", GasUnits: 150000},
+	{Name: "nft-mint", GasUnits: 200000},
+}
+
+// txCost is the estimated cost of a transaction at a gas price.
+type txCost struct {
+	costPreset
+	Gwei float64 `dynamodbav:"gwei"`
+	ETH  float64 `dynamodbav:"eth"`
+	// USD is 0 if the ETH price is unknown.
+	USD float64 `dynamodbav:"usd"`
+}
+
+func (c *txCost) String() string {
+	s := fmt.Sprintf("%s (%d gas): %.0f gwei, %.6f ETH", c.Name, c.GasUnits, c.Gwei, c.ETH)
+	if c.USD > 0 {
+		s += fmt.Sprintf(", $%.2f", c.USD)
+	}
+
+	return s
+}
+
+// getCostPresets reads the transaction presets to estimate costs for. The
+// defaults may be extended or overridden by GAS_COST_PRESETS, e.g.
+// "bridge=120000,swap=180000". Setting it to "none" disables cost estimates.
+func getCostPresets() ([]costPreset, error) {
+	raw := os.Getenv("GAS_COST_PRESETS")
+	if raw == "none" {
+		return nil, nil
+	}
+
+	presets := make([]costPreset, len(defaultCostPresets))
+	copy(presets, defaultCostPresets)
+
+	if raw == "" {
+		return presets, nil
+	}
+
+	for _, field := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid cost preset %q in GAS_COST_PRESETS, expected name=gas", field)
+		}
+
+		units, err := strconv.Atoi(parts[1])
+		if err != nil || units <= 0 {
+			return nil, errors.Errorf("invalid gas units %q for cost preset %s", parts[1], parts[0])
+		}
+
+		presets = setCostPreset(presets, costPreset{Name: parts[0], GasUnits: units})
+	}
+
+	return presets, nil
+}
+
+// setCostPreset replaces the preset with the same name, or appends it.
+func setCostPreset(presets []costPreset, preset costPreset) []costPreset {
+	for i := range presets {
+		if presets[i].Name == preset.Name {
+			presets[i] = preset
+			return presets
+		}
+	}
+
+	return append(presets, preset)
+}
+
+// estimateCosts estimates the cost of each preset at a gas price in gwei, and
+// an ETH price in USD, which may be 0 if unknown.
+func estimateCosts(presets []costPreset, gwei int, ethUSD float64) []txCost {
+	costs := make([]txCost, len(presets))
+	for i := range presets {
+		c := txCost{costPreset: presets[i], Gwei: float64(presets[i].GasUnits * gwei)}
+		c.ETH = c.Gwei / gweiPerETH
+		c.USD = c.ETH * ethUSD
+
+		costs[i] = c
+	}
+
+	return costs
+}
+
+// runCosts prints the estimated cost of each preset at the current gas price,
+// or at gwei if it is not zero.
+func runCosts(ctx context.Context, gwei int) error {
+	presets, err := getCostPresets()
+	if err != nil {
+		return err
+	}
+
+	source, _, err := getSource()
+	if err != nil {
+		return err
+	}
+
+	if gwei == 0 {
+		gwei, err = source.MediumGas(ctx)
+		if err != nil {
+			return errors.Wrap(err, "while getting current gas price")
+		}
+	}
+
+	ethUSD, err := source.ETHPrice(ctx)
+	if err != nil {
+		return errors.Wrap(err, "while getting ETH price")
+	}
+
+	fmt.Printf("at %d gwei and $%.2f/ETH:\n", gwei, ethUSD)
+	for _, c := range estimateCosts(presets, gwei, ethUSD) {
+		fmt.Printf("  %-10s %8d gas  %12.0f gwei  %.6f ETH  $%.2f\n", c.Name, c.GasUnits, c.Gwei, c.ETH, c.USD)
+	}
+
+	return nil
+}
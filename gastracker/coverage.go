@@ -0,0 +1,101 @@
+package gastracker
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+// gapFactor is how many times longer than the usual interval between samples
+// an interval must be to count as a gap, so that jitter in when runs start is
+// not mistaken for missing samples.
+const gapFactor = 2
+
+// coverage describes how completely the samples in the stats window cover
+// it, so that stats skewed by the tracker being down can be told apart.
+type coverage struct {
+	Window string `dynamodbav:"window"`
+	// Percent is the percentage of the window not lost to gaps.
+	Percent float64       `dynamodbav:"percent"`
+	Gaps    int           `dynamodbav:"gaps"`
+	Missing time.Duration `dynamodbav:"missing"`
+}
+
+func (c *coverage) String() string {
+	return fmt.Sprintf(
+		"Samples cover %.0f%% of the last %s, missing %s in %d gaps",
+		c.Percent, c.Window, c.Missing.Round(time.Minute), c.Gaps,
+	)
+}
+
+// getMinCoverage reads the percentage of the stats window that samples must
+// cover for alerts to be sent, from GAS_MIN_COVERAGE. It is 0 by default, so
+// that alerts are always sent.
+func getMinCoverage() (float64, error) {
+	raw := os.Getenv("GAS_MIN_COVERAGE")
+	if raw == "" {
+		return 0, nil
+	}
+
+	percent, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while parsing GAS_MIN_COVERAGE %q", raw)
+	}
+	if percent < 0 || percent > 100 {
+		return 0, errors.Errorf("GAS_MIN_COVERAGE must be a percentage between 0 and 100, got %v", percent)
+	}
+
+	return percent, nil
+}
+
+// findCoverage finds the gaps in the samples within the window up to the
+// current sample, where the interval between samples is over gapFactor times
+// the median interval. Time before the oldest sample is not counted against
+// the coverage, so that a tracker that has just started is not penalised. It
+// returns nil if there are too few samples to tell the usual interval.
+func findCoverage(
+	current *prices.GasPriceData, gasPrices []prices.GasPriceData, window time.Duration,
+) *coverage {
+	within := prices.Within(gasPrices, window, current.Timestamp)
+	if len(within) < 2 {
+		return nil
+	}
+
+	times := make([]time.Time, 0, len(within)+1)
+	for i := range within {
+		times = append(times, within[i].Timestamp)
+	}
+	times = append(times, current.Timestamp)
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	intervals := make([]time.Duration, len(times)-1)
+	for i := 1; i < len(times); i++ {
+		intervals[i-1] = times[i].Sub(times[i-1])
+	}
+
+	sorted := append([]time.Duration(nil), intervals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	usual := sorted[len(sorted)/2]
+	if usual <= 0 {
+		return nil
+	}
+
+	c := coverage{Window: formatWindow(window), Percent: 100}
+	for _, interval := range intervals {
+		if interval > gapFactor*usual {
+			c.Gaps++
+			c.Missing += interval - usual
+		}
+	}
+
+	if span := times[len(times)-1].Sub(times[0]); span > 0 {
+		c.Percent = 100 * (1 - c.Missing.Seconds()/span.Seconds())
+	}
+
+	return &c
+}
@@ -0,0 +1,225 @@
+package gastracker
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/charts"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/display"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const (
+	dashboardPeriod       = 7 * 24 * time.Hour
+	defaultDashboardKey   = "index.html"
+	dashboardContentType  = "text/html; charset=utf-8"
+	dashboardCacheControl = "max-age=60"
+)
+
+// dashboardConfig configures where the dashboard is published.
+type dashboardConfig struct {
+	bucket string
+	key    string
+}
+
+// getDashboardConfig reads the S3 bucket to publish the dashboard to from
+// GAS_DASHBOARD_BUCKET, and its key from GAS_DASHBOARD_KEY, "index.html" by
+// default, e.g. "gas/index.html" to serve it from a path of a CloudFront
+// distribution. It is not published unless the bucket is set.
+func getDashboardConfig() dashboardConfig {
+	cfg := dashboardConfig{bucket: os.Getenv("GAS_DASHBOARD_BUCKET"), key: os.Getenv("GAS_DASHBOARD_KEY")}
+	if cfg.key == "" {
+		cfg.key = defaultDashboardKey
+	}
+
+	return cfg
+}
+
+// dashboardPage is the data the dashboard is rendered from.
+type dashboardPage struct {
+	Price          int
+	Category       string
+	CategoryColour string
+	SampledAt      string
+	UpdatedAt      string
+	From           string
+	Samples        int
+	Mean           float64
+	Stddev         float64
+	Min            int
+	Max            int
+	Categories     []dashboardShare
+	Chart          template.HTML
+}
+
+// dashboardShare is the share of the week's prices in a category.
+type dashboardShare struct {
+	Category string
+	Colour   string
+	Percent  float64
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Gas: {{.Price}} gwei ({{.Category}})</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 860px; padding: 0 1em; color: #1f2328; }
+.current { font-size: 3em; margin: 0; }
+.category { display: inline-block; padding: 0.2em 0.6em; border-radius: 1em; color: #fff; font-size: 0.4em; vertical-align: middle; }
+.muted { color: #656d76; }
+table { border-collapse: collapse; margin: 1em 0; }
+td, th { padding: 0.3em 1em 0.3em 0; text-align: left; }
+svg { width: 100%; height: auto; }
+</style>
+</head>
+<body>
+<p class="current">{{.Price}} gwei <span class="category" style="background: {{.CategoryColour}}">{{.Category}}</span></p>
+<p class="muted">Sampled {{.SampledAt}}</p>
+
+<h2>Past 7 days</h2>
+{{.Chart}}
+<table>
+<tr><th>Samples</th><td>{{.Samples}}</td></tr>
+<tr><th>Mean</th><td>{{printf "%.1f" .Mean}} gwei</td></tr>
+<tr><th>Standard deviation</th><td>{{printf "%.1f" .Stddev}} gwei</td></tr>
+<tr><th>Lowest</th><td>{{.Min}} gwei</td></tr>
+<tr><th>Highest</th><td>{{.Max}} gwei</td></tr>
+</table>
+
+<h2>Time in each category</h2>
+<table>
+{{range .Categories}}<tr><th><span style="color: {{.Colour}}">&#9632;</span> {{.Category}}</th><td>{{printf "%.0f" .Percent}}%</td></tr>
+{{end}}</table>
+
+<p class="muted">Since {{.From}}. Updated {{.UpdatedAt}}.</p>
+</body>
+</html>
+`))
+
+// buildDashboard summarises the prices over the week before now, the last of
+// which is shown as the current price, and charts them over the bands they
+// are categorised with.
+func buildDashboard(gasPrices []prices.GasPriceData, bands prices.Bands, now time.Time) (*dashboardPage, error) {
+	from := now.Add(-dashboardPeriod)
+
+	var week []prices.GasPriceData
+	for i := range gasPrices {
+		if !gasPrices[i].Timestamp.Before(from) {
+			week = append(week, gasPrices[i])
+		}
+	}
+	sort.Slice(week, func(i, j int) bool {
+		return week[i].Timestamp.Before(week[j].Timestamp)
+	})
+
+	stats, err := prices.Stats(week)
+	if err != nil {
+		return nil, errors.New("no prices in the past week to show")
+	}
+
+	// The chart only contains numbers, fixed colours and an escaped title.
+	chart, err := charts.SVG(week, charts.Options{Bands: bands, Title: "Gas prices over the past 7 days"})
+	if err != nil {
+		return nil, errors.Wrap(err, "while charting prices")
+	}
+
+	current := &week[len(week)-1]
+	page := dashboardPage{
+		Price:          current.Price,
+		Category:       current.Category.String(),
+		CategoryColour: charts.Colour(current.Category),
+		SampledAt:      display.In(current.Timestamp).Format(time.RFC1123),
+		UpdatedAt:      display.In(now).Format(time.RFC1123),
+		From:           display.In(from).Format("Mon 2 Jan 15:04 MST"),
+		Samples:        stats.Samples,
+		Mean:           stats.Mean,
+		Stddev:         stats.Stddev,
+		Min:            stats.Min,
+		Max:            stats.Max,
+		Chart:          template.HTML(chart),
+	}
+
+	counts := make(map[prices.PriceCategory]int)
+	for i := range week {
+		counts[week[i].Category]++
+	}
+	for _, c := range []prices.PriceCategory{prices.VeryLow, prices.Low, prices.Average, prices.High, prices.VeryHigh} {
+		if counts[c] > 0 {
+			page.Categories = append(page.Categories, dashboardShare{
+				Category: c.String(),
+				Colour:   charts.Colour(c),
+				Percent:  float64(counts[c]) / float64(len(week)) * 100,
+			})
+		}
+	}
+
+	return &page, nil
+}
+
+// publishDashboard renders the dashboard for the prices and uploads it to S3.
+func publishDashboard(
+	sess *session.Session, cfg dashboardConfig, gasPrices []prices.GasPriceData, bands prices.Bands, now time.Time,
+) error {
+	page, err := buildDashboard(gasPrices, bands, now)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := dashboardTemplate.Execute(&buf, page); err != nil {
+		return errors.Wrap(err, "while rendering dashboard")
+	}
+
+	_, err = s3.New(sess).PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String(cfg.bucket),
+		Key:          aws.String(cfg.key),
+		Body:         bytes.NewReader(buf.Bytes()),
+		ContentType:  aws.String(dashboardContentType),
+		CacheControl: aws.String(dashboardCacheControl),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "while uploading dashboard to s3://%s/%s", cfg.bucket, cfg.key)
+	}
+
+	log.Info().Str("bucket", cfg.bucket).Str("key", cfg.key).Msg("published dashboard")
+
+	return nil
+}
+
+// runPublish renders the dashboard for the stored prices and uploads it.
+func runPublish() error {
+	cfg := getDashboardConfig()
+	if cfg.bucket == "" {
+		return errors.New("GAS_DASHBOARD_BUCKET not set")
+	}
+
+	bands, err := getBands()
+	if err != nil {
+		return err
+	}
+
+	gasPrices, err := readStoredPrices()
+	if err != nil {
+		return err
+	}
+
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return err
+	}
+
+	return publishDashboard(sess, cfg, gasPrices, bands, clock.Now())
+}
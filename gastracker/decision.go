@@ -0,0 +1,289 @@
+package gastracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const (
+	// DefaultDecisionPercentile is the highest percentile of recent prices
+	// that the current price may be at to transact.
+	DefaultDecisionPercentile = 40
+
+	// decisionPath is where the serve command answers whether to transact.
+	decisionPath = "/decision"
+	// decisionMaxAge is how old the latest stored price may be to decide on,
+	// since a script should not transact on a price that is out of date.
+	decisionMaxAge = 2 * time.Hour
+	// decisionMinPrices is how many stored prices a decision needs for the
+	// percentile to mean anything.
+	decisionMinPrices = 24
+	// decisionForecastDrop is how far below the current price the forecast
+	// must expect gas to fall to advise waiting for it.
+	decisionForecastDrop = 0.1
+	// decisionSignalWeight is how much the trend and forecast each raise
+	// the confidence when they agree with the decision, or lower it when
+	// they do not.
+	decisionSignalWeight = 0.1
+)
+
+// errStaleDecision is returned when the latest stored price is too old to
+// decide on.
+var errStaleDecision = errors.New("latest stored price is too old to decide on")
+
+// DecisionOptions configures whether to transact.
+type DecisionOptions struct {
+	// MaxPercentile is the highest percentile of the prices over the stats
+	// window that the current price may be at to transact.
+	MaxPercentile float64
+}
+
+// Decision is whether to transact at the current price, for scripts that gate
+// on-chain operations on it. Confidence is from 0 to 1, and Rationale
+// explains the decision in a sentence per signal.
+type Decision struct {
+	Transact         bool      `json:"transact"`
+	Confidence       float64   `json:"confidence"`
+	Price            int       `json:"price"`
+	Category         string    `json:"category"`
+	Timestamp        time.Time `json:"timestamp"`
+	Percentile       float64   `json:"percentile"`
+	Trend            string    `json:"trend,omitempty"`
+	ForecastLowest   float64   `json:"forecastLowest,omitempty"`
+	ForecastLowestIn int       `json:"forecastLowestInHours,omitempty"`
+	Rationale        []string  `json:"rationale"`
+}
+
+// decisionInputs are the config that decisions depend on.
+type decisionInputs struct {
+	window        windowConfig
+	trendSamples  int
+	forecastHours int
+}
+
+func getDecisionInputs() (*decisionInputs, error) {
+	var in decisionInputs
+	var err error
+
+	if in.window, err = getWindowConfig(); err != nil {
+		return nil, err
+	}
+	if in.trendSamples, err = getTrendSamples(); err != nil {
+		return nil, err
+	}
+	if in.forecastHours, err = getForecastHours(); err != nil {
+		return nil, err
+	}
+
+	return &in, nil
+}
+
+// readDecision decides whether to transact at the latest stored price,
+// against the stored prices over the stats window before it.
+func readDecision(svc *dynamodb.DynamoDB, in *decisionInputs, opts DecisionOptions, now time.Time) (*Decision, error) {
+	if opts.MaxPercentile <= 0 || opts.MaxPercentile >= 100 {
+		return nil, errors.Errorf("max percentile must be between 0 and 100, got %v", opts.MaxPercentile)
+	}
+
+	latest, err := store.ReadLatest(svc)
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading latest gas price")
+	}
+	if latest == nil {
+		return nil, errors.New("no gas prices")
+	}
+	if age := now.Sub(latest.Timestamp); age > decisionMaxAge {
+		return nil, errors.Wrapf(errStaleDecision, "sampled %v ago", age.Round(time.Minute))
+	}
+
+	stored, err := store.ReadRange(svc, latest.Timestamp.Add(-in.window.stats), latest.Timestamp)
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading gas prices")
+	}
+
+	var window []prices.GasPriceData
+	for i := range stored {
+		if stored[i].Timestamp.Before(latest.Timestamp) {
+			window = append(window, stored[i])
+		}
+	}
+	if len(window) < decisionMinPrices {
+		return nil, errors.Errorf("only %d prices stored, at least %d are needed to decide", len(window), decisionMinPrices)
+	}
+
+	return decide(latest, window, in, opts), nil
+}
+
+// decide advises transacting if the current price is at or below the maximum
+// percentile of the window's prices, unless the forecast expects it to fall
+// by at least decisionForecastDrop. The confidence starts from how far the
+// percentile is from the maximum, from 0.5 at the maximum to 1 at either end,
+// or 0.5 if the forecast overrides it, and each of the trend and forecast
+// raise it if they agree and lower it if they disagree.
+func decide(current *prices.GasPriceData, window []prices.GasPriceData, in *decisionInputs, opts DecisionOptions) *Decision {
+	d := Decision{
+		Price:      current.Price,
+		Category:   current.Category.String(),
+		Timestamp:  current.Timestamp,
+		Percentile: prices.PercentileRank(current.Price, window),
+	}
+	stats := describeWindow(in.window.stats)
+
+	d.Transact = d.Percentile <= opts.MaxPercentile
+	if d.Transact {
+		d.Confidence = 0.5 + (opts.MaxPercentile-d.Percentile)/opts.MaxPercentile/2
+		d.Rationale = append(d.Rationale, fmt.Sprintf(
+			"%d gwei is cheaper than %.0f%% of prices over the last %s, within the cheapest %.0f%%",
+			d.Price, 100-d.Percentile, stats, opts.MaxPercentile,
+		))
+	} else {
+		d.Confidence = 0.5 + (d.Percentile-opts.MaxPercentile)/(100-opts.MaxPercentile)/2
+		d.Rationale = append(d.Rationale, fmt.Sprintf(
+			"%d gwei is more expensive than %.0f%% of prices over the last %s, outside the cheapest %.0f%%",
+			d.Price, d.Percentile, stats, opts.MaxPercentile,
+		))
+	}
+
+	if f := forecastPrices(current, window, in.forecastHours); f != nil {
+		d.ForecastLowest = math.Round(f.Lowest)
+		d.ForecastLowestIn = f.LowestIn
+
+		drop := (float64(current.Price) - f.Lowest) / float64(current.Price)
+		if drop >= decisionForecastDrop {
+			if d.Transact {
+				d.Transact = false
+				d.Confidence = 0.5
+			}
+			d.Confidence += decisionSignalWeight
+			d.Rationale = append(d.Rationale, fmt.Sprintf(
+				"Forecast expects %.0f gwei in %d hours, %.0f%% cheaper, which is worth waiting for",
+				f.Lowest, f.LowestIn, drop*100,
+			))
+		} else {
+			d.Confidence += signalAgreement(d.Transact)
+			d.Rationale = append(d.Rationale, fmt.Sprintf(
+				"Forecast expects no more than %.0f%% cheaper in the next %d hours, lowest %.0f gwei",
+				decisionForecastDrop*100, f.Hours, f.Lowest,
+			))
+		}
+	}
+
+	// Waiting is dearer if prices are rising, and may be cheaper if they
+	// are falling.
+	if t := findTrend(current, window, in.trendSamples); t != nil {
+		d.Trend = t.Direction
+
+		switch t.Direction {
+		case "rising", "rising fast":
+			d.Confidence += signalAgreement(d.Transact)
+			d.Rationale = append(d.Rationale, fmt.Sprintf(
+				"Prices are %s (%+.1f gwei/hour), so waiting is likely to cost more", t.Direction, t.Slope,
+			))
+
+		case "falling", "falling fast":
+			d.Confidence -= signalAgreement(d.Transact)
+			d.Rationale = append(d.Rationale, fmt.Sprintf(
+				"Prices are %s (%+.1f gwei/hour), so waiting may be cheaper", t.Direction, t.Slope,
+			))
+
+		default:
+			d.Rationale = append(d.Rationale, "Prices are stable")
+		}
+	}
+
+	d.Confidence = math.Round(math.Max(0, math.Min(1, d.Confidence))*100) / 100
+
+	return &d
+}
+
+// signalAgreement is how much a signal in favour of transacting now changes
+// the confidence in a decision: up if the decision is to transact, and down
+// if it is to wait.
+func signalAgreement(transact bool) float64 {
+	if transact {
+		return decisionSignalWeight
+	}
+
+	return -decisionSignalWeight
+}
+
+// runDecide decides whether to transact at the latest stored price.
+func runDecide(opts DecisionOptions) (*Decision, error) {
+	in, err := getDecisionInputs()
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return nil, err
+	}
+
+	return readDecision(dynamodb.New(sess), in, opts, clock.Now())
+}
+
+// decisionHandler answers whether to transact, as a Decision in JSON, with
+// the maximum percentile optionally set by the "maxPercentile" query
+// parameter. It responds 503 if the latest stored price is too old.
+type decisionHandler struct {
+	svc *dynamodb.DynamoDB
+	in  *decisionInputs
+}
+
+func (h *decisionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondDecision(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	opts := DecisionOptions{MaxPercentile: DefaultDecisionPercentile}
+	if raw := r.URL.Query().Get("maxPercentile"); raw != "" {
+		p, err := strconv.ParseFloat(raw, 64)
+		if err != nil || p <= 0 || p >= 100 {
+			respondDecision(w, http.StatusBadRequest, map[string]string{"error": "maxPercentile must be between 0 and 100"})
+			return
+		}
+		opts.MaxPercentile = p
+	}
+
+	d, err := readDecision(h.svc, h.in, opts, clock.Now())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errStaleDecision) {
+			status = http.StatusServiceUnavailable
+		}
+
+		log.Error().Err(err).Msg("failed to decide whether to transact")
+		respondDecision(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respondDecision(w, http.StatusOK, d)
+}
+
+func respondDecision(w http.ResponseWriter, status int, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		log.Error().Err(err).Msg("failed to write response")
+	}
+}
@@ -0,0 +1,80 @@
+package gastracker
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// windowsToastScript shows a balloon notification using Windows Forms, reading
+// the title and body from the environment to avoid any quoting issues.
+const windowsToastScript = `Add-Type -AssemblyName System.Windows.Forms
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+$n.Visible = $true
+$n.ShowBalloonTip(10000, $env:GAS_DESKTOP_TITLE, $env:GAS_DESKTOP_BODY, 'Info')
+Start-Sleep -Seconds 10
+$n.Dispose()`
+
+// desktopNotifier shows native desktop notifications, for when the tracker
+// is run locally rather than on Lambda.
+type desktopNotifier struct {
+	goos string
+}
+
+// newDesktopNotifier constructs a desktop notifier if enabled in the
+// environment, otherwise it returns nil.
+func newDesktopNotifier() (*desktopNotifier, error) {
+	if os.Getenv("GAS_DESKTOP_NOTIFICATIONS") != "true" {
+		return nil, nil
+	}
+
+	switch runtime.GOOS {
+	case "darwin", "linux", "windows":
+		return &desktopNotifier{goos: runtime.GOOS}, nil
+
+	default:
+		return nil, errors.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+}
+
+func (n *desktopNotifier) name() string {
+	return "desktop"
+}
+
+func (n *desktopNotifier) notify(ctx context.Context, a *alert) error {
+	cmd := n.command(ctx, a.subject(), a.summary())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "while running %s: %s", cmd.Path, string(out))
+	}
+
+	return nil
+}
+
+func (n *desktopNotifier) command(ctx context.Context, title, body string) *exec.Cmd {
+	switch n.goos {
+	case "darwin":
+		return exec.CommandContext(
+			ctx,
+			"osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title,
+			body,
+		)
+
+	case "windows":
+		cmd := exec.CommandContext(
+			ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToastScript,
+		)
+		cmd.Env = append(os.Environ(), "GAS_DESKTOP_TITLE="+title, "GAS_DESKTOP_BODY="+body)
+		return cmd
+
+	default:
+		return exec.CommandContext(ctx, "notify-send", "--app-name=gas-tracker", title, body)
+	}
+}
@@ -0,0 +1,50 @@
+package gastracker
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// NotifyRequest asks the notifier Lambda to send the alerts for the stored
+// price sampled at Timestamp.
+type NotifyRequest struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// notifierFunction returns the name or ARN of the Lambda that the tracker
+// hands its alerts to, from GAS_NOTIFIER_FUNCTION, or "" if the tracker sends
+// them itself.
+func notifierFunction() string {
+	return os.Getenv("GAS_NOTIFIER_FUNCTION")
+}
+
+// dispatchNotify invokes the notifier Lambda asynchronously for the stored
+// price sampled at, so that slow notifiers do not count towards the run.
+// Lambda retries the invocation if notifying fails.
+func dispatchNotify(ctx context.Context, sess *session.Session, function string, at time.Time) error {
+	payload, err := json.Marshal(NotifyRequest{Timestamp: at})
+	if err != nil {
+		return errors.Wrap(err, "while encoding notify request")
+	}
+
+	_, err = lambda.New(sess).InvokeWithContext(ctx, &lambda.InvokeInput{
+		FunctionName:   aws.String(function),
+		InvocationType: aws.String(lambda.InvocationTypeEvent),
+		Payload:        payload,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "while invoking notifier function %s", function)
+	}
+
+	log.Info().Str("function", function).Time("timestamp", at).Msg("handed alerts to notifier function")
+
+	return nil
+}
@@ -0,0 +1,13 @@
+// Package gastracker tracks Ethereum gas prices, categorising each sample
+// against recent history and alerting through the configured notifiers when
+// the category changes.
+//
+// Run takes a single sample and is what the tracker Lambda calls on each
+// invocation. The other exported functions, such as Backtest and Stats, back
+// the subcommands of the tracker CLI.
+//
+// Configuration is read from GAS_ prefixed environment variables, or from the
+// YAML file named by GAS_CONFIG_FILE (see config.example.yaml), with any
+// environment variables that are set overriding the file. Prices are fetched
+// by the sources package and stored by the store package.
+package gastracker
@@ -0,0 +1,298 @@
+package gastracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+// emailChartFilename is the name of the chart attached to alert emails.
+const emailChartFilename = "gas-prices.png"
+
+type emailNotifier struct {
+	fromAddr   string
+	recipients []recipient
+	password   string
+	oauth      *oauthTokenSource
+	smtp       smtpConfig
+	// unsubscribeURL is the link that unsubscribes the recipient, for
+	// emails to a single subscriber.
+	unsubscribeURL string
+}
+
+// recipient is a single email address along with the price categories it
+// wants to be notified about. An empty set of categories means all categories.
+type recipient struct {
+	addr       string
+	categories []prices.PriceCategory
+}
+
+func (r *recipient) wants(category prices.PriceCategory) bool {
+	return wantsCategory(r.categories, category)
+}
+
+// wantsCategory returns true if a category is in a set of wanted categories.
+// An empty set means all categories are wanted. Wanting High or Low also
+// includes Very High or Very Low respectively.
+func wantsCategory(wanted []prices.PriceCategory, category prices.PriceCategory) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+
+	for i := range wanted {
+		if wanted[i] == category || wanted[i] == category.Broad() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseRecipients parses a comma-separated list of recipients. Each recipient
+// may optionally be followed by "=" and a "|"-separated list of the categories
+// they want to be notified about, e.g. "alice@example.com=Low,bob@example.com".
+func parseRecipients(input string) ([]recipient, error) {
+	fields := strings.Split(input, ",")
+	recipients := make([]recipient, 0, len(fields))
+
+	for _, field := range fields {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if parts[0] == "" {
+			return nil, errors.Errorf("empty recipient address in %q", input)
+		}
+
+		r := recipient{addr: parts[0]}
+		if len(parts) == 2 {
+			for _, name := range strings.Split(parts[1], "|") {
+				category, err := prices.ParsePriceCategory(strings.TrimSpace(name))
+				if err != nil {
+					return nil, errors.Wrapf(err, "while parsing categories for %s", r.addr)
+				}
+
+				r.categories = append(r.categories, category)
+			}
+		}
+
+		recipients = append(recipients, r)
+	}
+
+	return recipients, nil
+}
+
+// newEmailNotifier constructs an email notifier from the environment. It
+// returns nil if no sender address is configured. The recipients in
+// GAS_NOTIFIER_TO are optional, since the notifier may only be used to email
+// subscribers.
+func newEmailNotifier() (*emailNotifier, error) {
+	from := os.Getenv("GAS_NOTIFIER_FROM")
+	if from == "" {
+		return nil, nil
+	}
+	var recipients []recipient
+	if to := os.Getenv("GAS_NOTIFIER_TO"); to != "" {
+		var err error
+		recipients, err = parseRecipients(to)
+		if err != nil {
+			return nil, errors.Wrap(err, "while parsing GAS_NOTIFIER_TO")
+		}
+	}
+	oauth, err := newOAuthTokenSource()
+	if err != nil {
+		return nil, errors.Wrap(err, "while configuring OAuth2")
+	}
+	smtpCfg, err := getSMTPConfig(oauth != nil)
+	if err != nil {
+		return nil, err
+	}
+	pass := os.Getenv("GAS_NOTIFIER_PASSWORD")
+
+	switch smtpCfg.auth {
+	case authPlain, authLogin:
+		if pass == "" {
+			return nil, errors.New("GAS_NOTIFIER_PASSWORD not set")
+		}
+
+	case authXOAuth2:
+		if oauth == nil {
+			return nil, errors.New("GAS_NOTIFIER_OAUTH_REFRESH_TOKEN not set")
+		}
+	}
+
+	return &emailNotifier{
+		fromAddr:   from,
+		recipients: recipients,
+		password:   pass,
+		oauth:      oauth,
+		smtp:       smtpCfg,
+	}, nil
+}
+
+// withRecipients returns a copy of the notifier that sends to different
+// recipients.
+func (n *emailNotifier) withRecipients(recipients []recipient) *emailNotifier {
+	copied := *n
+	copied.recipients = recipients
+	return &copied
+}
+
+// withUnsubscribe returns a copy of the notifier that includes an unsubscribe
+// link in its emails.
+func (n *emailNotifier) withUnsubscribe(unsubscribeURL string) *emailNotifier {
+	copied := *n
+	copied.unsubscribeURL = unsubscribeURL
+	return &copied
+}
+
+// recipientsFor returns the addresses of all recipients who want to be
+// notified about the given alert. Category filters only apply to category
+// change alerts: every recipient is notified of other alerts.
+func (n *emailNotifier) recipientsFor(a *alert) []string {
+	var addrs []string
+	for i := range n.recipients {
+		if a.Kind != categoryChangeAlert || n.recipients[i].wants(a.NewCategory) {
+			addrs = append(addrs, n.recipients[i].addr)
+		}
+	}
+
+	return addrs
+}
+
+func (n *emailNotifier) name() string {
+	return "email"
+}
+
+// smtpAuth returns the SMTP authentication for the configured mechanism, or
+// nil if authentication is disabled.
+func (n *emailNotifier) smtpAuth(ctx context.Context) (smtp.Auth, error) {
+	switch n.smtp.auth {
+	case authNone:
+		return nil, nil
+
+	case authLogin:
+		return &loginAuth{username: n.fromAddr, password: n.password}, nil
+
+	case authXOAuth2:
+		token, err := n.oauth.token(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "while refreshing OAuth2 access token")
+		}
+
+		return &xoauth2Auth{username: n.fromAddr, accessToken: token}, nil
+
+	default:
+		return smtp.PlainAuth("", n.fromAddr, n.password, n.smtp.host), nil
+	}
+}
+
+func (n *emailNotifier) notify(ctx context.Context, a *alert) error {
+	toAddrs := n.recipientsFor(a)
+	if len(toAddrs) == 0 {
+		log.Info().Str("alert", a.key()).Msg("no email recipients want to be notified of alert")
+		return nil
+	}
+
+	msg, err := emailMessage(n.fromAddr, toAddrs, a, n.unsubscribeURL)
+	if err != nil {
+		return err
+	}
+
+	auth, err := n.smtpAuth(ctx)
+	if err != nil {
+		return err
+	}
+
+	return sendMail(ctx, &n.smtp, auth, n.fromAddr, toAddrs, msg)
+}
+
+// emailMessage formats an alert as an email. If the alert has a chart, the
+// email is multipart, with the chart attached as a PNG. If an unsubscribe URL
+// is given, it is linked from the body and the List-Unsubscribe headers, which
+// let mail clients offer one-click unsubscribe.
+func emailMessage(from string, to []string, a *alert, unsubscribeURL string) ([]byte, error) {
+	body := a.description()
+	if len(a.Links) > 0 {
+		body += "\n"
+		for _, l := range a.Links {
+			body += l.Label + ": " + l.URL + "\n"
+		}
+	}
+
+	// The subject may come from an enqueued alert, so it is encoded rather
+	// than trusted not to contain line breaks.
+	headers := "From: " + from + "\r\n" +
+		"To: " + strings.Join(to, ",") + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", a.subject()) + "\r\n"
+
+	if unsubscribeURL != "" {
+		body += "\nUnsubscribe: " + unsubscribeURL + "\n"
+		headers += "List-Unsubscribe: <" + unsubscribeURL + ">\r\n" +
+			"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n"
+	}
+
+	if len(a.Chart) == 0 {
+		return []byte(headers + "\r\n" + body), nil
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	buf.WriteString(headers +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n\r\n")
+
+	text, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, errors.Wrap(err, "while writing email body")
+	}
+	if _, err := io.WriteString(text, body); err != nil {
+		return nil, errors.Wrap(err, "while writing email body")
+	}
+
+	attachment, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"image/png"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {`attachment; filename="` + emailChartFilename + `"`},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "while attaching chart")
+	}
+	if err := writeBase64Lines(attachment, a.Chart); err != nil {
+		return nil, errors.Wrap(err, "while attaching chart")
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, errors.Wrap(err, "while writing email")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeBase64Lines writes data in base64, wrapped at 76 characters as MIME
+// requires.
+func writeBase64Lines(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := 76
+		if len(encoded) < n {
+			n = len(encoded)
+		}
+
+		if _, err := io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+
+	return nil
+}
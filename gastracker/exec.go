@@ -0,0 +1,103 @@
+package gastracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultExecNotifierTimeout = 30 * time.Second
+
+// execNotifier runs a user-specified command for each alert, so that alerts
+// can be sent anywhere, e.g. via signal-cli or a custom relay, without
+// compiling the integration into the tracker. The alert is written to the
+// command's stdin as JSON, see Alert, and its main fields are also set as
+// GAS_ALERT_ environment variables for simple scripts.
+//
+// The command does not inherit the tracker's environment, which holds
+// credentials for every other integration, and its output ends up in logs
+// and dead letters. It only sees PATH, HOME, the GAS_ALERT_ variables and any
+// variables named in GAS_EXEC_NOTIFIER_ENV.
+type execNotifier struct {
+	path    string
+	args    []string
+	env     []string
+	timeout time.Duration
+}
+
+// newExecNotifier constructs an exec notifier running the command line in
+// GAS_EXEC_NOTIFIER_COMMAND, split on whitespace, passing it the variables in
+// GAS_EXEC_NOTIFIER_ENV, a comma separated list of names. It returns nil if no
+// command is configured.
+func newExecNotifier() (*execNotifier, error) {
+	fields := strings.Fields(os.Getenv("GAS_EXEC_NOTIFIER_COMMAND"))
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	n := execNotifier{path: fields[0], args: fields[1:], timeout: defaultExecNotifierTimeout}
+
+	names := append([]string{"PATH", "HOME"}, strings.Split(os.Getenv("GAS_EXEC_NOTIFIER_ENV"), ",")...)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if strings.HasPrefix(name, "GAS_ALERT_") {
+			return nil, errors.Errorf("invalid GAS_EXEC_NOTIFIER_ENV, %s is set for each alert", name)
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			n.env = append(n.env, name+"="+value)
+		}
+	}
+
+	if raw := os.Getenv("GAS_EXEC_NOTIFIER_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			return nil, errors.Errorf("invalid GAS_EXEC_NOTIFIER_TIMEOUT %q, expected a positive duration", raw)
+		}
+		n.timeout = timeout
+	}
+
+	return &n, nil
+}
+
+func (n *execNotifier) name() string {
+	return "exec"
+}
+
+func (n *execNotifier) notify(ctx context.Context, a *alert) error {
+	payload := newAlert(a)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "while marshalling alert")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, n.path, n.args...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(
+		n.env[:len(n.env):len(n.env)],
+		"GAS_ALERT_KIND="+payload.Kind,
+		"GAS_ALERT_SEVERITY="+payload.Severity,
+		"GAS_ALERT_SUBJECT="+payload.Subject,
+		"GAS_ALERT_SUMMARY="+payload.Summary,
+		"GAS_ALERT_PRICE="+strconv.Itoa(payload.Price),
+		"GAS_ALERT_CATEGORY="+payload.Category,
+	)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "while running %s: %s", n.path, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
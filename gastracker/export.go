@@ -0,0 +1,220 @@
+package gastracker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/display"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+// readStoredPrices reads the stored prices, ordered oldest first.
+func readStoredPrices() ([]prices.GasPriceData, error) {
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return nil, err
+	}
+
+	gasPrices, err := store.ReadAll(dynamodb.New(sess))
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading gas prices")
+	}
+
+	sort.Slice(gasPrices, func(i, j int) bool {
+		return gasPrices[i].Timestamp.Before(gasPrices[j].Timestamp)
+	})
+
+	return gasPrices, nil
+}
+
+// runHistory prints up to limit of the most recent stored prices, most recent
+// first, or all of them if limit is zero.
+func runHistory(limit int) error {
+	if limit < 0 {
+		return errors.Errorf("limit must not be negative, got %d", limit)
+	}
+
+	gasPrices, err := readStoredPrices()
+	if err != nil {
+		return err
+	}
+
+	shown := 0
+	for i := len(gasPrices) - 1; i >= 0; i-- {
+		if limit > 0 && shown == limit {
+			break
+		}
+
+		p := &gasPrices[i]
+		fmt.Printf("%s  %4d gwei  %s\n", display.In(p.Timestamp).Format(time.RFC3339), p.Price, p.Category)
+		shown++
+	}
+
+	return nil
+}
+
+// ExportOptions configures an export.
+type ExportOptions struct {
+	// Format is "json" or "csv" for Export, and ignored by ExportParquet.
+	Format string
+	// From and To limit the export to the prices sampled between them,
+	// inclusive. Each is an RFC 3339 timestamp or a date, e.g. "2021-03-01",
+	// in the display timezone, which To includes the whole of. Either may be
+	// empty to leave that end of the range open.
+	From, To string
+	// Fields are the CSV columns to write, in order, or DefaultExportFields
+	// if empty.
+	Fields []string
+}
+
+// DefaultExportFields are the CSV columns written by default, which backtest
+// and backfill can read back.
+var DefaultExportFields = []string{"timestamp", "price", "category", "eth_usd"}
+
+// exportFields formats each CSV column that can be exported.
+var exportFields = map[string]func(p *prices.GasPriceData) string{
+	"timestamp": func(p *prices.GasPriceData) string { return p.Timestamp.UTC().Format(time.RFC3339) },
+	"local_time": func(p *prices.GasPriceData) string {
+		return display.In(p.Timestamp).Format(time.RFC3339)
+	},
+	"unix":     func(p *prices.GasPriceData) string { return strconv.FormatInt(p.Timestamp.Unix(), 10) },
+	"price":    func(p *prices.GasPriceData) string { return strconv.Itoa(p.Price) },
+	"category": func(p *prices.GasPriceData) string { return p.Category.String() },
+	"eth_usd":  func(p *prices.GasPriceData) string { return strconv.FormatFloat(p.EthUSD, 'f', -1, 64) },
+}
+
+// checkExportFields returns an error if any of fields cannot be exported.
+func checkExportFields(fields []string) error {
+	for _, field := range fields {
+		if _, ok := exportFields[field]; !ok {
+			names := make([]string, 0, len(exportFields))
+			for name := range exportFields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			return errors.Errorf("unknown field %q, must be one of %s", field, strings.Join(names, ", "))
+		}
+	}
+
+	return nil
+}
+
+// parseExportTime parses the start or, if end is true, the end of an export's
+// range.
+func parseExportTime(raw string, end bool) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+
+	loc, err := display.Location()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", raw, loc)
+	if err != nil {
+		return time.Time{}, errors.Errorf("%q is neither an RFC 3339 timestamp nor a date", raw)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	return t, nil
+}
+
+// readExportRange reads the stored prices in an export's range, ordered
+// oldest first.
+func readExportRange(opts ExportOptions) ([]prices.GasPriceData, error) {
+	from, err := parseExportTime(opts.From, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "while parsing from")
+	}
+	to, err := parseExportTime(opts.To, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "while parsing to")
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return nil, errors.Errorf("to (%s) is before from (%s)", opts.To, opts.From)
+	}
+
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return nil, err
+	}
+	gasPrices, err := store.ReadRange(dynamodb.New(sess), from, to)
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading gas prices")
+	}
+
+	return gasPrices, nil
+}
+
+// runExport writes the stored prices in the range, oldest first, as JSON or
+// CSV. Both formats can be read back by backtest and backfill, as long as
+// CSV exports include the timestamp and price first.
+func runExport(w io.Writer, opts ExportOptions) error {
+	if opts.Format != "json" && opts.Format != "csv" {
+		return errors.Errorf("format must be json or csv, got %q", opts.Format)
+	}
+	if opts.Format == "json" && len(opts.Fields) > 0 {
+		return errors.New("fields can only be selected for CSV exports")
+	}
+	if err := checkExportFields(opts.Fields); err != nil {
+		return err
+	}
+
+	gasPrices, err := readExportRange(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(gasPrices), "while writing JSON")
+	}
+
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = DefaultExportFields
+	}
+
+	return writePricesCSV(w, gasPrices, fields)
+}
+
+// writePricesCSV writes prices as CSV with a header row of the given fields,
+// wherever the prices were read from.
+func writePricesCSV(w io.Writer, gasPrices []prices.GasPriceData, fields []string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(fields); err != nil {
+		return errors.Wrap(err, "while writing CSV")
+	}
+
+	row := make([]string, len(fields))
+	for i := range gasPrices {
+		for j, field := range fields {
+			row[j] = exportFields[field](&gasPrices[i])
+		}
+		if err := cw.Write(row); err != nil {
+			return errors.Wrap(err, "while writing CSV")
+		}
+	}
+	cw.Flush()
+
+	return errors.Wrap(cw.Error(), "while writing CSV")
+}
@@ -0,0 +1,107 @@
+package gastracker
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Alert is an alert as sent to notifiers outside this package, and as written
+// to the stdin of the exec notifier.
+type Alert struct {
+	Kind             string      `json:"kind"`
+	Severity         string      `json:"severity,omitempty"`
+	Key              string      `json:"key"`
+	Subject          string      `json:"subject"`
+	Summary          string      `json:"summary"`
+	Description      string      `json:"description"`
+	Price            int         `json:"price"`
+	Category         string      `json:"category"`
+	PreviousCategory string      `json:"previousCategory,omitempty"`
+	Timestamp        time.Time   `json:"timestamp"`
+	Links            []AlertLink `json:"links,omitempty"`
+}
+
+func newAlert(a *alert) *Alert {
+	ext := Alert{
+		Kind:        string(a.Kind),
+		Severity:    string(a.Severity),
+		Key:         a.key(),
+		Subject:     a.subject(),
+		Summary:     a.summary(),
+		Description: a.description(),
+		Price:       a.Price,
+		Category:    a.NewCategory.String(),
+		Timestamp:   a.Timestamp,
+		Links:       a.Links,
+	}
+	if a.Kind == categoryChangeAlert {
+		ext.PreviousCategory = a.PreviousCategory.String()
+	}
+
+	return &ext
+}
+
+// Notifier sends alerts over a channel implemented outside this package, e.g.
+// one that records them in tests. See RegisterNotifier.
+type Notifier interface {
+	Notify(ctx context.Context, a *Alert) error
+}
+
+var (
+	externalMu        sync.Mutex
+	externalNotifiers = map[string]Notifier{}
+)
+
+// RegisterNotifier adds a notifier that alerts are sent to alongside the
+// configured ones. Like them, it is referred to by name in routes and rules,
+// and failed deliveries are retried. It panics if the name is already
+// registered.
+func RegisterNotifier(name string, n Notifier) {
+	externalMu.Lock()
+	defer externalMu.Unlock()
+
+	if _, ok := externalNotifiers[name]; ok {
+		panic("gastracker: notifier " + name + " is already registered")
+	}
+
+	externalNotifiers[name] = n
+}
+
+// UnregisterNotifier removes a notifier added by RegisterNotifier.
+func UnregisterNotifier(name string) {
+	externalMu.Lock()
+	defer externalMu.Unlock()
+
+	delete(externalNotifiers, name)
+}
+
+// registeredNotifiers returns the notifiers added by RegisterNotifier, sorted
+// by name.
+func registeredNotifiers() []notifier {
+	externalMu.Lock()
+	defer externalMu.Unlock()
+
+	notifiers := make([]notifier, 0, len(externalNotifiers))
+	for name, n := range externalNotifiers {
+		notifiers = append(notifiers, &externalNotifier{channel: name, n: n})
+	}
+	sort.Slice(notifiers, func(i, j int) bool { return notifiers[i].name() < notifiers[j].name() })
+
+	return notifiers
+}
+
+// externalNotifier adapts a Notifier to the notifiers in this package.
+type externalNotifier struct {
+	channel string
+	n       Notifier
+}
+
+func (e *externalNotifier) name() string {
+	return e.channel
+}
+
+func (e *externalNotifier) notify(ctx context.Context, a *alert) error {
+	return e.n.Notify(ctx, newAlert(a))
+}
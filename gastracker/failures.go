@@ -0,0 +1,229 @@
+package gastracker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const (
+	runFailuresStateID      = "runFailures"
+	defaultFailureAlertRuns = 3
+	runFailedMetricName     = "RunFailed"
+	failureMetricTimeout    = 5 * time.Second
+)
+
+// failureAlertConfig configures how the tracker reports its own failures.
+type failureAlertConfig struct {
+	// runs is how many consecutive runs must fail before alerting, or 0 to
+	// never alert.
+	runs int
+	// notifiers are the channels to alert, or all that urgent alerts are
+	// routed to if empty.
+	notifiers []string
+	// namespace is the CloudWatch namespace to publish whether each run
+	// failed to, if set.
+	namespace string
+}
+
+// getFailureAlertConfig reads GAS_FAILURE_ALERT_RUNS, the number of
+// consecutive failed runs to alert after, 3 by default or never if 0,
+// GAS_FAILURE_ALERT_NOTIFIERS, a comma separated list of the channels to
+// alert, and GAS_FAILURE_METRIC_NAMESPACE, the CloudWatch namespace to
+// publish the RunFailed metric to.
+func getFailureAlertConfig() (failureAlertConfig, error) {
+	cfg := failureAlertConfig{
+		runs:      defaultFailureAlertRuns,
+		namespace: os.Getenv("GAS_FAILURE_METRIC_NAMESPACE"),
+	}
+
+	if raw := os.Getenv("GAS_FAILURE_ALERT_RUNS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return failureAlertConfig{}, errors.Wrapf(err, "while parsing GAS_FAILURE_ALERT_RUNS %q", raw)
+		}
+		if n < 0 {
+			return failureAlertConfig{}, errors.Errorf("GAS_FAILURE_ALERT_RUNS must not be negative, got %d", n)
+		}
+		cfg.runs = n
+	}
+
+	for _, name := range strings.Split(os.Getenv("GAS_FAILURE_ALERT_NOTIFIERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.notifiers = append(cfg.notifiers, name)
+		}
+	}
+
+	return cfg, nil
+}
+
+// runFailures records the runs that have failed in a row, and whether they
+// have been alerted.
+type runFailures struct {
+	Consecutive int       `dynamodbav:"consecutive"`
+	Since       time.Time `dynamodbav:"since"`
+	LastError   string    `dynamodbav:"lastError"`
+	Alerted     bool      `dynamodbav:"alerted"`
+}
+
+// reportRunOutcome publishes whether a run failed, and alerts once enough runs
+// have failed in a row, then again once a run succeeds, so that a tracker that
+// keeps failing does not go unnoticed for days. Any problem doing so is
+// logged rather than returned, so as not to hide the run's own error.
+func reportRunOutcome(ctx context.Context, runErr error) {
+	cfg, err := getFailureAlertConfig()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read failure alert config")
+		return
+	}
+	if cfg.runs == 0 && cfg.namespace == "" {
+		return
+	}
+
+	sess, err := awsconfig.Session()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to report run outcome")
+		return
+	}
+
+	if cfg.namespace != "" {
+		if err := publishRunFailed(ctx, sess, cfg.namespace, runErr != nil); err != nil {
+			log.Error().Err(err).Str("namespace", cfg.namespace).Msg("failed to publish run metric")
+		}
+	}
+
+	if cfg.runs > 0 {
+		if err := alertRunFailures(ctx, dynamodb.New(sess), cfg, runErr); err != nil {
+			log.Error().Err(err).Msg("failed to alert of run failures")
+		}
+	}
+}
+
+// publishRunFailed publishes 1 to the RunFailed metric if the run failed, or
+// 0 if it succeeded. An alarm on it can also treat missing data as a failure,
+// to catch the tracker no longer running at all.
+func publishRunFailed(ctx context.Context, sess *session.Session, namespace string, failed bool) error {
+	ctx, cancel := context.WithTimeout(ctx, failureMetricTimeout)
+	defer cancel()
+
+	var value float64
+	if failed {
+		value = 1
+	}
+
+	_, err := cloudwatch.New(sess).PutMetricDataWithContext(ctx, &cloudwatch.PutMetricDataInput{
+		Namespace: aws.String(namespace),
+		MetricData: []*cloudwatch.MetricDatum{{
+			MetricName: aws.String(runFailedMetricName),
+			Timestamp:  aws.Time(clock.Now()),
+			Unit:       aws.String(cloudwatch.StandardUnitCount),
+			Value:      aws.Float64(value),
+		}},
+	})
+
+	return errors.Wrap(err, "while publishing to CloudWatch")
+}
+
+// alertRunFailures counts the runs that have failed in a row, alerting when
+// they reach the configured number and when they end.
+func alertRunFailures(ctx context.Context, svc *dynamodb.DynamoDB, cfg failureAlertConfig, runErr error) error {
+	var failures runFailures
+	if _, err := store.ReadState(svc, runFailuresStateID, &failures); err != nil {
+		return errors.Wrap(err, "while reading run failures")
+	}
+
+	now := clock.Now()
+	var a *alert
+
+	switch {
+	case runErr != nil:
+		if failures.Consecutive == 0 {
+			failures.Since = now
+		}
+		failures.Consecutive++
+		failures.LastError = runErr.Error()
+
+		if failures.Consecutive >= cfg.runs && !failures.Alerted {
+			failures.Alerted = true
+			a = &alert{
+				Title: fmt.Sprintf("Gas Tracker Failing (%d runs)", failures.Consecutive),
+				Message: fmt.Sprintf(
+					"The gas tracker has failed %d runs in a row, since %s\n\nThe last error was: %s\n",
+					failures.Consecutive, formatSampleTime(failures.Since), failures.LastError,
+				),
+			}
+		}
+
+	case failures.Consecutive == 0:
+		return nil
+
+	default:
+		if failures.Alerted {
+			a = &alert{
+				Title: "Gas Tracker Recovered",
+				Message: fmt.Sprintf(
+					"The gas tracker is running again, after %d failed runs since %s\n",
+					failures.Consecutive, formatSampleTime(failures.Since),
+				),
+			}
+		}
+		failures = runFailures{}
+	}
+
+	// Record the failures before alerting, so that an alert that fails to
+	// send is not repeated every run.
+	if err := store.WriteState(svc, runFailuresStateID, &failures); err != nil {
+		return errors.Wrap(err, "while writing run failures")
+	}
+	if a == nil {
+		return nil
+	}
+
+	a.Kind = healthAlert
+	a.Severity = severityUrgent
+	a.Notifiers = cfg.notifiers
+	a.Timestamp = now
+
+	return sendHealthAlert(ctx, svc, a)
+}
+
+// sendHealthAlert sends an alert about the tracker itself through the
+// notifiers it targets, or those that urgent alerts are routed to.
+func sendHealthAlert(ctx context.Context, svc *dynamodb.DynamoDB, a *alert) error {
+	_, notifiers, mqttPub, err := loadNotifiers(svc)
+	if err != nil {
+		return err
+	}
+	if mqttPub != nil {
+		defer mqttPub.close()
+	}
+
+	severityRoutes, err := getRoutes(notifiers)
+	if err != nil {
+		return err
+	}
+
+	al := alerter{svc: svc, notifiers: notifiers, routes: severityRoutes}
+	routed := al.routedNotifiers(a)
+	if len(routed) == 0 {
+		return errors.Errorf("no notifiers configured to send %q to", a.Title)
+	}
+
+	log.Warn().Str("alert", a.key()).Msg("sending tracker health alert")
+	_, err = sendAlert(ctx, svc, routed, a)
+
+	return err
+}
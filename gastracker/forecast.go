@@ -0,0 +1,99 @@
+package gastracker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const (
+	defaultForecastHours = 6
+	maxForecastHours     = 24
+	// samplesPerDay is the seasonal period of the forecast model, since
+	// prices are sampled hourly and follow a daily cycle.
+	samplesPerDay = 24
+)
+
+// priceForecast summarises the predicted prices over the next few hours.
+type priceForecast struct {
+	Hours    int     `dynamodbav:"hours"`
+	Price    float64 `dynamodbav:"price"`
+	Lowest   float64 `dynamodbav:"lowest"`
+	LowestIn int     `dynamodbav:"lowestIn"`
+}
+
+func (f *priceForecast) String() string {
+	return fmt.Sprintf(
+		"Forecast in %d hours is %.0f, lowest %.0f in %d hours",
+		f.Hours, f.Price, f.Lowest, f.LowestIn,
+	)
+}
+
+// getForecastHours reads how many hours ahead to forecast prices. Forecasting
+// is disabled if it is set to 0.
+func getForecastHours() (int, error) {
+	raw := os.Getenv("GAS_FORECAST_HOURS")
+	if raw == "" {
+		return defaultForecastHours, nil
+	}
+
+	hours, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while parsing GAS_FORECAST_HOURS %q", raw)
+	}
+	if hours < 0 || hours > maxForecastHours {
+		return 0, errors.Errorf("GAS_FORECAST_HOURS must be between 0 and %d, got %d", maxForecastHours, hours)
+	}
+
+	return hours, nil
+}
+
+// forecastPrices fits a Holt-Winters model to the stored prices and the
+// current price, and predicts the prices over the given number of hours. It
+// returns nil if forecasting is disabled or there are too few prices.
+func forecastPrices(
+	current *prices.GasPriceData, gasPrices []prices.GasPriceData, hours int,
+) *priceForecast {
+	if hours == 0 {
+		return nil
+	}
+
+	predictions := predictPrices(current, gasPrices, hours)
+	if predictions == nil {
+		return nil
+	}
+
+	f := priceForecast{Hours: hours, Price: predictions[hours-1]}
+
+	for i, p := range predictions {
+		if i == 0 || p < f.Lowest {
+			f.Lowest = p
+			f.LowestIn = i + 1
+		}
+	}
+
+	return &f
+}
+
+// predictPrices fits a Holt-Winters model to the stored prices and the current
+// price, and returns the predicted price for each of the following hours. It
+// returns nil if there are too few prices.
+func predictPrices(
+	current *prices.GasPriceData, gasPrices []prices.GasPriceData, hours int,
+) []float64 {
+	recent := mostRecentFirst(current, gasPrices)
+	series := make([]float64, len(recent))
+	for i := range recent {
+		series[len(recent)-1-i] = float64(recent[i].Price)
+	}
+
+	model, err := prices.FitHoltWinters(series, samplesPerDay)
+	if err != nil {
+		return nil
+	}
+
+	return model.Predict(hours)
+}
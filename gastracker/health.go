@@ -0,0 +1,130 @@
+package gastracker
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/store"
+	"github.com/ryanc414/gas-tracker/version"
+)
+
+// healthHandler serves the health endpoints of the serve command, so that a
+// container orchestrator can restart it when it is wedged:
+//
+//	GET /healthz  reports when a price was last fetched, failing if no price
+//	              has been stored within the maximum fetch age
+//	GET /readyz   reports whether the store is reachable and which notifiers
+//	              are configured, failing if either check fails
+type healthHandler struct {
+	svc         *dynamodb.DynamoDB
+	maxFetchAge time.Duration
+	// notifiers and notifierErr are the result of constructing the notifiers
+	// at startup. Their configuration cannot change while serving, and
+	// constructing them on every probe would connect to the MQTT broker each
+	// time.
+	notifiers   []string
+	notifierErr string
+}
+
+// newHealthHandler constructs a health handler, checking the notifiers once.
+func newHealthHandler(svc *dynamodb.DynamoDB, maxFetchAge time.Duration) *healthHandler {
+	h := healthHandler{svc: svc, maxFetchAge: maxFetchAge}
+
+	_, notifiers, mqttPub, err := loadNotifiers(svc)
+	if mqttPub != nil {
+		mqttPub.close()
+	}
+
+	switch {
+	case err != nil:
+		h.notifierErr = withConfigSource(err).Error()
+	case len(notifiers) == 0:
+		h.notifierErr = "no notifiers are configured"
+	default:
+		for _, n := range notifiers {
+			h.notifiers = append(h.notifiers, n.name())
+		}
+	}
+
+	return &h
+}
+
+// healthStatus is the response of a health endpoint. Status is "ok", or
+// "unavailable" along with the Errors found.
+type healthStatus struct {
+	Status    string     `json:"status"`
+	Version   string     `json:"version"`
+	LastFetch *time.Time `json:"lastFetch,omitempty"`
+	Store     string     `json:"store,omitempty"`
+	Notifiers []string   `json:"notifiers,omitempty"`
+	Errors    []string   `json:"errors,omitempty"`
+}
+
+func (h *healthHandler) register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.healthz)
+	mux.HandleFunc("/readyz", h.readyz)
+}
+
+func (h *healthHandler) healthz(w http.ResponseWriter, _ *http.Request) {
+	var status healthStatus
+
+	latest, err := store.ReadLatest(h.svc)
+	if err != nil {
+		status.Errors = append(status.Errors, errors.Wrap(err, "while reading latest gas price").Error())
+	} else if latest == nil {
+		status.Errors = append(status.Errors, "no gas prices have been fetched")
+	} else {
+		status.LastFetch = &latest.Timestamp
+		if age := clock.Since(latest.Timestamp); age > h.maxFetchAge {
+			status.Errors = append(
+				status.Errors,
+				errors.Errorf("last fetched %v ago, over the maximum of %v", age.Round(time.Second), h.maxFetchAge).Error(),
+			)
+		}
+	}
+
+	respondHealth(w, &status)
+}
+
+func (h *healthHandler) readyz(w http.ResponseWriter, _ *http.Request) {
+	var status healthStatus
+
+	_, err := h.svc.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(store.TableName)})
+	if err != nil {
+		status.Store = "unreachable"
+		status.Errors = append(status.Errors, errors.Wrap(err, "while describing gas prices table").Error())
+	} else {
+		status.Store = "ok"
+	}
+
+	status.Notifiers = h.notifiers
+	if h.notifierErr != "" {
+		status.Errors = append(status.Errors, h.notifierErr)
+	}
+
+	respondHealth(w, &status)
+}
+
+// respondHealth sets the overall status, responding 503 Service Unavailable
+// if any check failed.
+func respondHealth(w http.ResponseWriter, status *healthStatus) {
+	code := http.StatusOK
+	status.Status = "ok"
+	status.Version = version.Get().Version
+	if len(status.Errors) > 0 {
+		code = http.StatusServiceUnavailable
+		status.Status = "unavailable"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Error().Err(err).Msg("failed to write health response")
+	}
+}
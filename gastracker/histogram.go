@@ -0,0 +1,165 @@
+package gastracker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+// DefaultHistogramBuckets is the number of buckets in the price distribution
+// of reports and stats.
+const DefaultHistogramBuckets = 10
+
+const histogramBarWidth = 40
+
+// histogramBucket counts the prices from Low up to, but not including, High,
+// except for the last bucket which includes its upper bound.
+type histogramBucket struct {
+	Low   int `dynamodbav:"low"`
+	High  int `dynamodbav:"high"`
+	Count int `dynamodbav:"count"`
+}
+
+// buildHistogram buckets prices into equal width buckets between the lowest
+// and highest price.
+func buildHistogram(gasPrices []prices.GasPriceData, buckets int) []histogramBucket {
+	counts := make(map[int]int)
+	for i := range gasPrices {
+		counts[gasPrices[i].Price]++
+	}
+
+	return bucketCounts(counts, buckets)
+}
+
+// bucketCounts buckets the number of prices at each price into equal width
+// buckets between the lowest and highest price.
+func bucketCounts(counts map[int]int, buckets int) []histogramBucket {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	first := true
+	var min, max int
+	for price := range counts {
+		if first || price < min {
+			min = price
+		}
+		if first || price > max {
+			max = price
+		}
+		first = false
+	}
+
+	// Round the width up so that the buckets cover the whole range, and use
+	// fewer buckets if the range is narrower than the number of buckets.
+	width := (max - min + buckets) / buckets
+	if width < 1 {
+		width = 1
+	}
+	n := (max-min)/width + 1
+
+	histogram := make([]histogramBucket, n)
+	for i := range histogram {
+		histogram[i].Low = min + i*width
+		histogram[i].High = min + (i+1)*width
+	}
+
+	for price, n := range counts {
+		histogram[(price-min)/width].Count += n
+	}
+
+	return histogram
+}
+
+// formatHistogram renders the histogram as text, one bar per bucket.
+func formatHistogram(histogram []histogramBucket) string {
+	var most int
+	for _, b := range histogram {
+		if b.Count > most {
+			most = b.Count
+		}
+	}
+
+	var sb strings.Builder
+	for _, b := range histogram {
+		bar := 0
+		if most > 0 {
+			bar = b.Count * histogramBarWidth / most
+		}
+
+		fmt.Fprintf(
+			&sb, "  %4d-%-4d %-*s %d\n",
+			b.Low, b.High-1, histogramBarWidth, strings.Repeat("#", bar), b.Count,
+		)
+	}
+
+	return sb.String()
+}
+
+// runStats prints the stats and price distribution of the stored prices.
+func runStats(buckets int) error {
+	if buckets < 1 {
+		return errors.Errorf("buckets must be at least 1, got %d", buckets)
+	}
+
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return err
+	}
+
+	// The prices are summarised as they are read, rather than held, so that
+	// long retentions do not need more memory.
+	var running prices.RunningStats
+	var latest prices.GasPriceData
+	counts := make(map[int]int)
+	err = store.EachPrice(dynamodb.New(sess), func(p *prices.GasPriceData) error {
+		running.Add(p)
+		counts[p.Price]++
+		if p.Timestamp.After(latest.Timestamp) {
+			latest = *p
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "while reading gas prices")
+	}
+
+	stats := running.Stats()
+	if stats == nil {
+		return errors.New("no gas prices")
+	}
+
+	fmt.Printf("%d prices, mean %.1f gwei, stddev %.1f gwei\n", running.Count(), stats.Mean, stats.Stddev)
+	fmt.Printf("lowest %d gwei on %s\n", stats.Min, formatSampleTime(stats.MinAt))
+	fmt.Printf("highest %d gwei on %s\n", stats.Max, formatSampleTime(stats.MaxAt))
+
+	rank := percentileRank{Percentile: countsPercentileRank(latest.Price, counts)}
+	fmt.Printf("latest %d gwei on %s, %s\n", latest.Price, formatSampleTime(latest.Timestamp), rank.relative("stored prices"))
+	fmt.Print("\nprice distribution (gwei):\n", formatHistogram(bucketCounts(counts, buckets)))
+
+	return nil
+}
+
+// countsPercentileRank returns the percentage of the prices counted by price
+// that are cheaper than price, as prices.PercentileRank does for a slice.
+func countsPercentileRank(price int, counts map[int]int) float64 {
+	var below float64
+	var total int
+	for p, n := range counts {
+		total += n
+		switch {
+		case p < price:
+			below += float64(n)
+
+		case p == price:
+			below += float64(n) / 2
+		}
+	}
+
+	return below / float64(total) * 100
+}
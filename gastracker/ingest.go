@@ -0,0 +1,235 @@
+package gastracker
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const (
+	// ingestPath is where external collectors post their samples.
+	ingestPath = "/samples"
+	// maxIngestBody bounds the size of a posted batch of samples.
+	maxIngestBody = 1 << 20
+	// maxIngestSkew is how far ahead of the tracker's clock a sample may be
+	// timestamped, to allow for the collector's clock being fast.
+	maxIngestSkew = 5 * time.Minute
+	// maxIngestPrice rejects prices that are surely mistakes, e.g. in wei
+	// rather than gwei.
+	maxIngestPrice = 100000
+)
+
+// ingestHandler accepts prices sampled by external collectors, e.g. a script
+// running beside a node, and processes them as if the tracker had sampled
+// them. The body is a sample, e.g.
+//
+//	{"price": 42, "ethUsd": 1800.5, "timestamp": "2021-03-01T12:00:00Z"}
+//
+// or an array of them, which are processed oldest first, stopping at the
+// first that fails. Samples that are not newer than the latest stored price,
+// e.g. because a collector posted them twice, are rejected before they are
+// processed, so that they are not counted as failed runs. Requests must carry
+// the token as a bearer token.
+type ingestHandler struct {
+	svc   *dynamodb.DynamoDB
+	token string
+	// mu processes one request at a time, since samples must be stored in
+	// order.
+	mu sync.Mutex
+}
+
+// ingestResponse reports the samples that were stored, and the error that
+// stopped the rest, if any.
+type ingestResponse struct {
+	Stored    int           `json:"stored"`
+	Summaries []*RunSummary `json:"summaries,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// IngestHandler returns a handler that accepts samples posted to /samples by
+// external collectors authenticated with the token.
+func IngestHandler(svc *dynamodb.DynamoDB, token string) http.Handler {
+	return &ingestHandler{svc: svc, token: token}
+}
+
+// IngestToken returns the token that external collectors authenticate with,
+// from GAS_INGEST_TOKEN, or an empty string if it is not set. Surrounding
+// whitespace, such as the newline left by reading it from a file, is trimmed.
+func IngestToken() string {
+	return strings.TrimSpace(os.Getenv("GAS_INGEST_TOKEN"))
+}
+
+// newIngestHandler constructs the ingest handler from the environment. It
+// returns nil if GAS_INGEST_TOKEN is not set.
+func newIngestHandler(svc *dynamodb.DynamoDB) http.Handler {
+	token := IngestToken()
+	if token == "" {
+		return nil
+	}
+
+	return IngestHandler(svc, token)
+}
+
+func (h *ingestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != ingestPath {
+		respondIngest(w, http.StatusNotFound, &ingestResponse{Error: "not found"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondIngest(w, http.StatusMethodNotAllowed, &ingestResponse{Error: "method not allowed"})
+		return
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(h.token)) != 1 {
+		respondIngest(w, http.StatusUnauthorized, &ingestResponse{Error: "invalid or missing bearer token"})
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBody))
+	if err != nil {
+		respondIngest(w, http.StatusRequestEntityTooLarge, &ingestResponse{Error: "request body too large"})
+		return
+	}
+
+	samples, err := parseSamples(body, clock.Now())
+	if err != nil {
+		respondIngest(w, http.StatusBadRequest, &ingestResponse{Error: err.Error()})
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := checkSamplesNewer(h.svc, samples); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrStaleSample) {
+			status = http.StatusConflict
+		} else {
+			log.Error().Err(err).Msg("failed to check ingested samples")
+		}
+		respondIngest(w, status, &ingestResponse{Error: err.Error()})
+		return
+	}
+
+	var rsp ingestResponse
+	for i := range samples {
+		summary, err := Run(r.Context(), RunOptions{Sample: &samples[i]})
+		if err != nil {
+			log.Error().Err(err).Int("price", samples[i].Price).Msg("failed to process ingested sample")
+
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrStaleSample) {
+				status = http.StatusConflict
+			}
+			rsp.Error = err.Error()
+			respondIngest(w, status, &rsp)
+			return
+		}
+
+		rsp.Stored++
+		rsp.Summaries = append(rsp.Summaries, summary)
+	}
+
+	log.Info().Int("samples", rsp.Stored).Msg("ingested samples")
+	respondIngest(w, http.StatusOK, &rsp)
+}
+
+// parseSamples parses and checks a sample or an array of samples, ordering
+// them oldest first. A sample without a timestamp is processed as of when it
+// arrives, so only a single sample may leave it out.
+func parseSamples(body []byte, now time.Time) ([]Sample, error) {
+	var samples []Sample
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(body, &samples); err != nil {
+			return nil, errors.Wrap(err, "while parsing samples")
+		}
+	} else {
+		var s Sample
+		if err := json.Unmarshal(body, &s); err != nil {
+			return nil, errors.Wrap(err, "while parsing sample")
+		}
+		samples = []Sample{s}
+	}
+
+	if len(samples) == 0 {
+		return nil, errors.New("no samples given")
+	}
+
+	for i := range samples {
+		s := &samples[i]
+		if s.Price <= 0 || s.Price > maxIngestPrice {
+			return nil, errors.Errorf("invalid price %d, expected gwei between 1 and %d", s.Price, maxIngestPrice)
+		}
+		if s.EthUSD < 0 {
+			return nil, errors.Errorf("invalid ETH price %v, expected a positive number of dollars", s.EthUSD)
+		}
+		if s.Timestamp.IsZero() && len(samples) > 1 {
+			return nil, errors.New("every sample in an array must have a timestamp")
+		}
+		if s.Timestamp.After(now.Add(maxIngestSkew)) {
+			return nil, errors.Errorf("sample at %s is in the future", s.Timestamp.UTC().Format(time.RFC3339))
+		}
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Timestamp.Before(samples[j].Timestamp)
+	})
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Timestamp.Equal(samples[i-1].Timestamp) {
+			return nil, errors.Errorf("more than one sample at %s", samples[i].Timestamp.UTC().Format(time.RFC3339))
+		}
+	}
+
+	return samples, nil
+}
+
+// checkSamplesNewer returns ErrStaleSample if the oldest of the samples, which
+// are ordered oldest first, is not newer than the latest stored price.
+func checkSamplesNewer(svc *dynamodb.DynamoDB, samples []Sample) error {
+	at := samples[0].Timestamp
+	if at.IsZero() {
+		return nil
+	}
+
+	latest, err := store.ReadLatest(svc)
+	if err != nil {
+		return errors.Wrap(err, "while reading latest gas price")
+	}
+	if latest != nil && !at.After(latest.Timestamp) {
+		return errors.Wrapf(
+			ErrStaleSample, "sample at %s, latest stored price at %s",
+			at.UTC().Format(time.RFC3339), latest.Timestamp.UTC().Format(time.RFC3339),
+		)
+	}
+
+	return nil
+}
+
+func respondIngest(w http.ResponseWriter, status int, rsp *ingestResponse) {
+	body, err := json.Marshal(rsp)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		log.Error().Err(err).Msg("failed to write response")
+	}
+}
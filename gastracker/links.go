@@ -0,0 +1,75 @@
+package gastracker
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/snooze"
+)
+
+// ackDuration is how long repeats of an acknowledged alert are silenced for.
+const ackDuration = 24 * time.Hour
+
+// snoozeDurations are the snooze periods offered in each alert, in whole
+// hours.
+var snoozeDurations = []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour}
+
+// AlertLink is a signed link included in an alert, e.g. to snooze alerts.
+type AlertLink struct {
+	Label string `dynamodbav:"label" json:"label"`
+	URL   string `dynamodbav:"url" json:"url"`
+}
+
+// linker generates signed snooze and acknowledge links for alerts.
+type linker struct {
+	baseURL string
+	secret  []byte
+}
+
+// newLinker constructs a linker from the environment. It returns nil if no
+// actions URL is configured.
+func newLinker() (*linker, error) {
+	baseURL := os.Getenv("GAS_ACTIONS_URL")
+	if baseURL == "" {
+		return nil, nil
+	}
+	secret := os.Getenv("GAS_ACTIONS_SECRET")
+	if secret == "" {
+		return nil, errors.New("GAS_ACTIONS_SECRET not set")
+	}
+
+	return &linker{baseURL: baseURL, secret: []byte(secret)}, nil
+}
+
+func (l *linker) links(a *alert) ([]AlertLink, error) {
+	expires := a.Timestamp.Add(snooze.LinkLifetime)
+
+	ack, err := snooze.Link(l.baseURL, l.secret, &snooze.Token{
+		Action:   snooze.Acknowledge,
+		Scope:    a.key(),
+		Duration: ackDuration,
+		Expires:  expires,
+	})
+	if err != nil {
+		return nil, err
+	}
+	links := []AlertLink{{Label: "Acknowledge", URL: ack}}
+
+	for _, d := range snoozeDurations {
+		u, err := snooze.Link(l.baseURL, l.secret, &snooze.Token{
+			Action:   snooze.Snooze,
+			Scope:    snooze.AllAlerts,
+			Duration: d,
+			Expires:  expires,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		links = append(links, AlertLink{Label: fmt.Sprintf("Snooze %dh", int(d.Hours())), URL: u})
+	}
+
+	return links, nil
+}
@@ -0,0 +1,131 @@
+package gastracker
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const (
+	defaultCorrelationWindow = 24
+	minCorrelationSamples    = 3
+	// Gas is described as market-driven if its correlation with the ETH
+	// price is at least marketDrivenCorrelation, or as independent of the
+	// market if it is below independentCorrelation.
+	marketDrivenCorrelation = 0.5
+	independentCorrelation  = 0.2
+)
+
+// getCorrelationWindow reads how many of the most recent samples the
+// correlation between gas and ETH prices is calculated over.
+func getCorrelationWindow() (int, error) {
+	raw := os.Getenv("GAS_CORRELATION_WINDOW")
+	if raw == "" {
+		return defaultCorrelationWindow, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while parsing GAS_CORRELATION_WINDOW %q", raw)
+	}
+	if n < minCorrelationSamples {
+		return 0, errors.Errorf("GAS_CORRELATION_WINDOW must be at least %d, got %d", minCorrelationSamples, n)
+	}
+
+	return n, nil
+}
+
+// marketContext relates the gas price to the ETH market, to distinguish gas
+// moving with market volatility from gas moving on its own, e.g. during an
+// NFT mint or airdrop.
+type marketContext struct {
+	EthUSD float64 `dynamodbav:"ethUsd"`
+	// EthChangePercent is the change in the ETH price over the samples the
+	// correlation is calculated over.
+	EthChangePercent float64 `dynamodbav:"ethChangePercent"`
+	// Correlation is the Pearson correlation between gas and ETH prices.
+	Correlation float64 `dynamodbav:"correlation"`
+	Samples     int     `dynamodbav:"samples"`
+}
+
+func (m *marketContext) String() string {
+	description := fmt.Sprintf(
+		"ETH is $%.2f (%+.1f%% over %d samples), gas/ETH correlation is %.2f",
+		m.EthUSD, m.EthChangePercent, m.Samples, m.Correlation,
+	)
+
+	switch {
+	case math.Abs(m.Correlation) >= marketDrivenCorrelation:
+		description += ", so gas is likely moving with the market"
+
+	case math.Abs(m.Correlation) < independentCorrelation:
+		description += ", so gas is likely driven by on-chain events such as NFT mints or airdrops"
+	}
+
+	return description
+}
+
+// findMarketContext correlates gas and ETH prices over the most recent samples
+// that have an ETH price. It returns nil if there are too few of them.
+func findMarketContext(
+	current *prices.GasPriceData, gasPrices []prices.GasPriceData, window int,
+) *marketContext {
+	if current.EthUSD == 0 {
+		return nil
+	}
+
+	var gas, eth []float64
+	for _, p := range mostRecentFirst(current, gasPrices) {
+		if len(gas) == window {
+			break
+		}
+		if p.EthUSD > 0 {
+			gas = append(gas, float64(p.Price))
+			eth = append(eth, p.EthUSD)
+		}
+	}
+
+	if len(gas) < minCorrelationSamples {
+		return nil
+	}
+
+	oldest := eth[len(eth)-1]
+
+	return &marketContext{
+		EthUSD:           current.EthUSD,
+		EthChangePercent: (current.EthUSD - oldest) / oldest * 100,
+		Correlation:      correlation(gas, eth),
+		Samples:          len(gas),
+	}
+}
+
+// correlation returns the Pearson correlation coefficient of two equal length
+// series, or 0 if either is constant.
+func correlation(xs, ys []float64) float64 {
+	n := float64(len(xs))
+
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+
+	if varX == 0 || varY == 0 {
+		return 0
+	}
+
+	return cov / math.Sqrt(varX*varY)
+}
@@ -0,0 +1,244 @@
+package gastracker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const (
+	mqttTimeout                = 30 * time.Second
+	defaultMQTTTopicPrefix     = "gas_tracker"
+	defaultMQTTDiscoveryPrefix = "homeassistant"
+)
+
+// mqttPublisher publishes each new gas price sample and any category changes
+// to an MQTT broker, along with Home Assistant discovery payloads so that the
+// price and category automatically show up as sensors.
+type mqttPublisher struct {
+	client          mqtt.Client
+	topicPrefix     string
+	discoveryPrefix string
+}
+
+// newMQTTPublisher constructs an MQTT publisher from the environment. It
+// returns nil if no broker is configured.
+func newMQTTPublisher() *mqttPublisher {
+	broker := os.Getenv("GAS_MQTT_BROKER")
+	if broker == "" {
+		return nil
+	}
+
+	clientID := os.Getenv("GAS_MQTT_CLIENT_ID")
+	if clientID == "" {
+		clientID = "gas-tracker"
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(os.Getenv("GAS_MQTT_USERNAME")).
+		SetPassword(os.Getenv("GAS_MQTT_PASSWORD")).
+		SetConnectTimeout(mqttTimeout).
+		SetAutoReconnect(false)
+
+	p := mqttPublisher{
+		client:          mqtt.NewClient(opts),
+		topicPrefix:     os.Getenv("GAS_MQTT_TOPIC_PREFIX"),
+		discoveryPrefix: os.Getenv("GAS_MQTT_DISCOVERY_PREFIX"),
+	}
+
+	if p.topicPrefix == "" {
+		p.topicPrefix = defaultMQTTTopicPrefix
+	}
+	if p.discoveryPrefix == "" {
+		p.discoveryPrefix = defaultMQTTDiscoveryPrefix
+	}
+
+	return &p
+}
+
+// mqttState is published, retained, to the state topic after every sample.
+type mqttState struct {
+	Price     int       `json:"price"`
+	Category  string    `json:"category"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// mqttAlert is published to the alert topic for its kind when an alert is
+// triggered, e.g. gas_tracker/category_change or gas_tracker/spike.
+type mqttAlert struct {
+	NewCategory      string    `json:"new_category"`
+	PreviousCategory string    `json:"previous_category,omitempty"`
+	Threshold        string    `json:"threshold,omitempty"`
+	Rule             string    `json:"rule,omitempty"`
+	Title            string    `json:"title,omitempty"`
+	Message          string    `json:"message,omitempty"`
+	Price            int       `json:"price"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// haSensorConfig is a Home Assistant MQTT discovery payload for a sensor.
+type haSensorConfig struct {
+	Name              string `json:"name"`
+	UniqueID          string `json:"unique_id"`
+	StateTopic        string `json:"state_topic"`
+	ValueTemplate     string `json:"value_template"`
+	UnitOfMeasurement string `json:"unit_of_measurement,omitempty"`
+	Icon              string `json:"icon,omitempty"`
+}
+
+func (p *mqttPublisher) stateTopic() string {
+	return p.topicPrefix + "/state"
+}
+
+func (p *mqttPublisher) alertTopic(kind alertKind) string {
+	switch kind {
+	case thresholdAlert:
+		return p.topicPrefix + "/threshold"
+
+	case spikeAlert:
+		return p.topicPrefix + "/spike"
+
+	case volatilityAlert:
+		return p.topicPrefix + "/volatility"
+
+	case reportAlert:
+		return p.topicPrefix + "/report"
+
+	case testAlert:
+		return p.topicPrefix + "/test"
+
+	case ruleAlert:
+		return p.topicPrefix + "/rule"
+
+	case requestedAlert:
+		return p.topicPrefix + "/requested"
+
+	case calibratedAlert:
+		return p.topicPrefix + "/calibrated"
+
+	case healthAlert:
+		return p.topicPrefix + "/health"
+
+	default:
+		return p.topicPrefix + "/category_change"
+	}
+}
+
+func (p *mqttPublisher) connect() error {
+	if p.client.IsConnected() {
+		return nil
+	}
+
+	return waitToken(p.client.Connect())
+}
+
+func (p *mqttPublisher) close() {
+	if p.client.IsConnected() {
+		p.client.Disconnect(250)
+	}
+}
+
+func (p *mqttPublisher) publish(topic string, retained bool, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "while marshalling payload")
+	}
+
+	if err := p.connect(); err != nil {
+		return errors.Wrap(err, "while connecting to MQTT broker")
+	}
+
+	return errors.Wrapf(waitToken(p.client.Publish(topic, 1, retained, data)), "while publishing to %s", topic)
+}
+
+// publishDiscovery publishes the Home Assistant discovery payloads for the
+// price and category sensors.
+func (p *mqttPublisher) publishDiscovery() error {
+	sensors := map[string]haSensorConfig{
+		"price": {
+			Name:              "Ethereum Gas Price",
+			UniqueID:          p.topicPrefix + "_price",
+			StateTopic:        p.stateTopic(),
+			ValueTemplate:     "{{ value_json.price }}",
+			UnitOfMeasurement: "gwei",
+			Icon:              "mdi:gas-station",
+		},
+		"category": {
+			Name:          "Ethereum Gas Price Category",
+			UniqueID:      p.topicPrefix + "_category",
+			StateTopic:    p.stateTopic(),
+			ValueTemplate: "{{ value_json.category }}",
+			Icon:          "mdi:chart-bell-curve",
+		},
+	}
+
+	for id, cfg := range sensors {
+		topic := fmt.Sprintf("%s/sensor/%s/%s/config", p.discoveryPrefix, p.topicPrefix, id)
+		if err := p.publish(topic, true, &cfg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publishSample publishes the latest gas price sample to the state topic.
+func (p *mqttPublisher) publishSample(sample *prices.GasPriceData) error {
+	if err := p.publishDiscovery(); err != nil {
+		return errors.Wrap(err, "while publishing discovery payloads")
+	}
+
+	state := mqttState{
+		Price:     sample.Price,
+		Category:  sample.Category.String(),
+		Timestamp: sample.Timestamp,
+	}
+
+	return p.publish(p.stateTopic(), true, &state)
+}
+
+func (p *mqttPublisher) name() string {
+	return "mqtt"
+}
+
+func (p *mqttPublisher) notify(_ context.Context, a *alert) error {
+	event := mqttAlert{
+		NewCategory: a.NewCategory.String(),
+		Price:       a.Price,
+		Timestamp:   a.Timestamp,
+	}
+
+	switch a.Kind {
+	case thresholdAlert:
+		event.Threshold = a.Threshold.String()
+
+	case categoryChangeAlert:
+		event.PreviousCategory = a.PreviousCategory.String()
+
+	case ruleAlert:
+		event.Rule = a.Rule
+		event.PreviousCategory = a.PreviousCategory.String()
+
+	case requestedAlert, healthAlert:
+		event.Title = a.Title
+		event.Message = a.Message
+	}
+
+	return p.publish(p.alertTopic(a.Kind), false, &event)
+}
+
+func waitToken(token mqtt.Token) error {
+	if !token.WaitTimeout(mqttTimeout) {
+		return errors.New("timed out waiting for MQTT broker")
+	}
+
+	return token.Error()
+}
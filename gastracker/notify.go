@@ -0,0 +1,928 @@
+package gastracker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/display"
+	"github.com/ryanc414/gas-tracker/notifications"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/snooze"
+)
+
+const (
+	deadLettersTableName = "gasUndeliveredAlerts"
+	notifyMaxAttempts    = 3
+	notifyInitialBackoff = 2 * time.Second
+	deadLetterMaxAge     = 24 * time.Hour
+)
+
+type alertKind string
+
+const (
+	// categoryChangeAlert is sent when the price category changes.
+	categoryChangeAlert alertKind = "category"
+	// thresholdAlert is sent when the price crosses an absolute threshold.
+	thresholdAlert alertKind = "threshold"
+	// spikeAlert is sent when the price suddenly jumps far above the recent
+	// median.
+	spikeAlert alertKind = "spike"
+	// volatilityAlert is sent when the volatility regime changes, which
+	// often precedes a sustained move in price.
+	volatilityAlert alertKind = "volatility"
+	// reportAlert is the weekly summary report.
+	reportAlert alertKind = "report"
+	// testAlert is sent on demand to check that notifiers are configured
+	// correctly.
+	testAlert alertKind = "test"
+	// ruleAlert is sent when the conditions of an alert rule from the config
+	// become true.
+	ruleAlert alertKind = "rule"
+	// requestedAlert is sent on behalf of another system, e.g. one that
+	// enqueued it for the queue worker.
+	requestedAlert alertKind = "requested"
+	// calibratedAlert is sent once the tracker has finished warming up and
+	// starts alerting.
+	calibratedAlert alertKind = "calibrated"
+	// healthAlert is sent when the tracker itself keeps failing, and when it
+	// recovers.
+	healthAlert alertKind = "health"
+	// digestAlert is several alerts for a subscriber's channel, sent as one
+	// notification.
+	digestAlert alertKind = "digest"
+)
+
+// alert describes a change in the price category, the price crossing an
+// absolute threshold, or another event such as an alert rule firing.
+type alert struct {
+	Kind             alertKind            `dynamodbav:"kind"`
+	Severity         severity             `dynamodbav:"severity"`
+	NewCategory      prices.PriceCategory `dynamodbav:"newCategory"`
+	PreviousCategory prices.PriceCategory `dynamodbav:"previousCategory"`
+	Price            int                  `dynamodbav:"price"`
+	Threshold        *threshold           `dynamodbav:"threshold"`
+	Spike            *spike               `dynamodbav:"spike"`
+	Volatility       *volatilityChange    `dynamodbav:"volatility"`
+	Report           *weeklyReport        `dynamodbav:"report"`
+	Timestamp        time.Time            `dynamodbav:"timestamp"`
+	Links            []AlertLink          `dynamodbav:"links"`
+	// Context describes the baseline the category is relative to, if it
+	// is not all stored prices, e.g. "15:00 UTC", and the typical price for
+	// that baseline.
+	Context      string       `dynamodbav:"context"`
+	TypicalPrice float64      `dynamodbav:"typicalPrice"`
+	Details      alertDetails `dynamodbav:"details"`
+	// Rule is the conditions of the alert rule that fired, and Notifiers
+	// the channels it targets, if any, rather than those routed by severity.
+	Rule      string   `dynamodbav:"rule"`
+	Notifiers []string `dynamodbav:"notifiers"`
+	// Title and Message are the subject and text of a requested alert.
+	Title   string `dynamodbav:"title"`
+	Message string `dynamodbav:"message"`
+	// Chart is a PNG of the prices leading up to the alert, attached to
+	// emails. It is not stored, so queued alerts are retried without it.
+	Chart []byte `dynamodbav:"-"`
+	// Batch is the alerts in a digest, without their details, which are
+	// only described once for the digest.
+	Batch []alert `dynamodbav:"batch"`
+}
+
+// key identifies what the alert is about, e.g. "Average->Low" or
+// "below 20 gwei", so that repeated alerts can be identified.
+func (a *alert) key() string {
+	switch a.Kind {
+	case thresholdAlert:
+		return a.Threshold.String()
+
+	case spikeAlert:
+		return string(spikeAlert)
+
+	case volatilityAlert:
+		return fmt.Sprintf("volatility %s->%s", a.Volatility.Previous, a.Volatility.Current)
+
+	case reportAlert:
+		return "weekly report"
+
+	case testAlert:
+		return string(testAlert)
+
+	case ruleAlert:
+		return a.Rule
+
+	case requestedAlert:
+		return "requested: " + a.Title
+
+	case calibratedAlert:
+		return string(calibratedAlert)
+
+	case healthAlert:
+		return "health: " + a.Title
+
+	case digestAlert:
+		keys := make([]string, len(a.Batch))
+		for i := range a.Batch {
+			keys[i] = a.Batch[i].key()
+		}
+		return strings.Join(keys, ", ")
+
+	default:
+		return transitionKey(a.PreviousCategory, a.NewCategory)
+	}
+}
+
+// subject returns a short title for the alert.
+func (a *alert) subject() string {
+	var subject string
+	switch a.Kind {
+	case thresholdAlert:
+		subject = fmt.Sprintf("Gas Price is %s", a.Threshold)
+
+	case spikeAlert:
+		subject = "Gas Spike - likely mint/liquidation event"
+
+	case volatilityAlert:
+		subject = fmt.Sprintf("Gas Volatility is %s", a.Volatility.Current)
+
+	case reportAlert:
+		subject = "Weekly Gas Report"
+
+	case testAlert:
+		subject = "Gas Tracker Test Notification"
+
+	case ruleAlert:
+		subject = fmt.Sprintf("Gas Price is %d gwei (%s)", a.Price, a.categoryInContext())
+
+	case requestedAlert, healthAlert:
+		subject = a.Title
+
+	case calibratedAlert:
+		subject = "Gas Tracker Calibrated"
+
+	case digestAlert:
+		subject = fmt.Sprintf("%d Gas Alerts, medium gas is %d gwei", len(a.Batch), a.Price)
+
+	default:
+		subject = fmt.Sprintf("Gas Prices are %s", a.categoryInContext())
+	}
+
+	if a.Severity == severityUrgent {
+		return "[URGENT] " + subject
+	}
+
+	return subject
+}
+
+// summary returns a single line describing the alert.
+func (a *alert) summary() string {
+	var summary string
+	switch a.Kind {
+	case thresholdAlert:
+		summary = fmt.Sprintf("Medium gas is now %d gwei, %s", a.Price, a.Threshold)
+
+	case spikeAlert:
+		summary = fmt.Sprintf("Medium gas jumped to %d gwei, recent median is %.0f gwei", a.Price, a.Spike.Median)
+
+	case volatilityAlert:
+		summary = fmt.Sprintf(
+			"Volatility is no longer %s, medium gas is now %d gwei", a.Volatility.Previous, a.Price,
+		)
+
+	case reportAlert:
+		summary = fmt.Sprintf("Gas averaged %.0f gwei this week", a.Report.Mean)
+		if len(a.Report.Cheapest) > 0 {
+			summary += ", cheapest at " + a.Report.Cheapest[0].Label
+		}
+		return summary
+
+	case testAlert:
+		return "Notifications from the gas tracker are working"
+
+	case ruleAlert:
+		summary = fmt.Sprintf("Medium gas is now %d gwei, matching %s", a.Price, a.Rule)
+
+	case requestedAlert, healthAlert:
+		return strings.SplitN(a.Message, "\n", 2)[0]
+
+	case calibratedAlert:
+		return fmt.Sprintf("Alerts are now on, medium gas is %d gwei against a mean of %.0f gwei", a.Price, a.TypicalPrice)
+
+	case digestAlert:
+		summaries := make([]string, len(a.Batch))
+		for i := range a.Batch {
+			summaries[i] = a.Batch[i].summary()
+		}
+		return strings.Join(summaries, "; ")
+
+	default:
+		summary = fmt.Sprintf("No longer %s, medium gas is now %d gwei", a.PreviousCategory, a.Price)
+	}
+
+	if t := a.Details.Trend; t != nil {
+		summary += fmt.Sprintf(" and %s (%+.1f%%)", t.Direction, t.ChangePercent)
+	}
+
+	return summary
+}
+
+// description returns the full text of the alert.
+func (a *alert) description() string {
+	switch a.Kind {
+	case thresholdAlert:
+		return fmt.Sprintf(
+			"Ethereum gas prices have crossed your threshold, medium gas is now %d gwei (%s)\n",
+			a.Price,
+			a.Threshold,
+		) + a.Details.describe()
+
+	case spikeAlert:
+		return fmt.Sprintf(
+			"Ethereum gas prices have suddenly spiked, likely due to an NFT mint or liquidations\n\n"+
+				"Specifically, medium gas is now %d, compared to a recent median of %.0f\n",
+			a.Price,
+			a.Spike.Median,
+		) + a.Details.describe()
+
+	case reportAlert:
+		return a.Report.String()
+
+	case testAlert:
+		return "This is a test notification, sent to check that the gas tracker can reach you.\n"
+
+	case requestedAlert, healthAlert:
+		return strings.TrimRight(a.Message, "\n") + "\n"
+
+	case calibratedAlert:
+		return fmt.Sprintf(
+			"The gas tracker has finished warming up, and will now alert you when gas prices change\n\n"+
+				"Specifically, medium gas is now %d (%s), against a mean of %.0f\n",
+			a.Price,
+			a.NewCategory,
+			a.TypicalPrice,
+		)
+
+	case digestAlert:
+		var description string
+		for i := range a.Batch {
+			if i > 0 {
+				description += "\n"
+			}
+			description += a.Batch[i].subject() + "\n\n" + a.Batch[i].description()
+		}
+		if details := a.Details.describe(); details != "" {
+			description += "\n" + details
+		}
+		return description
+
+	case ruleAlert:
+		return fmt.Sprintf(
+			"Ethereum gas prices now match your alert rule: %s\n\nSpecifically, medium gas is now %d gwei (%s)\n",
+			a.Rule,
+			a.Price,
+			a.categoryInContext(),
+		) + a.Details.describe()
+
+	case volatilityAlert:
+		return fmt.Sprintf(
+			"Ethereum gas price volatility is no longer %s, which often precedes a sustained move in price\n\n"+
+				"Specifically, medium gas is now %d\n",
+			a.Volatility.Previous,
+			a.Price,
+		) + a.Details.describe()
+	}
+
+	description := fmt.Sprintf(
+		"Ethereum gas prices are no longer %s, they are now %s\n\nSpecifically, medium gas is now %d\n",
+		a.PreviousCategory,
+		a.categoryInContext(),
+		a.Price,
+	)
+
+	if a.Context != "" {
+		description += fmt.Sprintf("Typical for %s is %.0f\n", a.Context, a.TypicalPrice)
+	}
+
+	return description + a.Details.describe()
+}
+
+// categoryInContext returns the new category along with the baseline it is
+// relative to, e.g. "Low for 15:00 UTC".
+func (a *alert) categoryInContext() string {
+	if a.Context == "" {
+		return a.NewCategory.String()
+	}
+
+	return fmt.Sprintf("%s for %s", a.NewCategory, a.Context)
+}
+
+// notifier sends alerts over a single channel, e.g. email.
+type notifier interface {
+	name() string
+	notify(ctx context.Context, a *alert) error
+}
+
+// unwrapNotifier returns the notifier at the bottom of any wrappers that add
+// behaviour to it, e.g. retries, each of which has an Unwrap method returning
+// the notifier it wraps.
+func unwrapNotifier(n notifier) notifier {
+	for {
+		w, ok := n.(interface{ Unwrap() notifier })
+		if !ok {
+			return n
+		}
+		n = w.Unwrap()
+	}
+}
+
+// alerter decides whether each alert should be sent, and sends it to every
+// notifier.
+type alerter struct {
+	svc       *dynamodb.DynamoDB
+	notifiers []notifier
+	cooldown  time.Duration
+	linker    *linker
+	routes    routes
+	// force sends alerts even if they are snoozed or in cooldown.
+	force bool
+	// sent counts the notifications delivered.
+	sent int
+}
+
+// handleAlert sends an alert, unless alerts have been snoozed or an alert
+// with the same key was already sent within the cooldown period. An alert
+// that cannot be prepared for sending is queued to be retried next run.
+func (al *alerter) handleAlert(ctx context.Context, a *alert) error {
+	if !al.force {
+		suppressed, err := al.suppressed(a, a.key())
+		if err != nil {
+			return al.queueAlert(a, err, al.routedNotifiers(a))
+		}
+		if suppressed {
+			return nil
+		}
+	}
+
+	if al.linker != nil {
+		links, err := al.linker.links(a)
+		if err != nil {
+			return al.queueAlert(a, errors.Wrap(err, "while generating alert links"), al.routedNotifiers(a))
+		}
+
+		a.Links = links
+	}
+
+	sent, err := sendAlert(ctx, al.svc, al.routedNotifiers(a), a)
+	al.sent += sent
+	if err != nil {
+		return err
+	}
+
+	if al.cooldown == 0 {
+		return nil
+	}
+
+	return errors.Wrap(
+		recordNotification(al.svc, a.key(), a.Timestamp),
+		"while recording notification time",
+	)
+}
+
+// handleSubscriberAlert sends an alert to one of the subscribers' channels,
+// as handleAlert does, except that the cooldown is per channel and the alert
+// is sent without the operator's snooze links.
+func (al *alerter) handleSubscriberAlert(ctx context.Context, n notifier, a *alert) error {
+	cooldownKey := n.name() + "/" + a.key()
+	if !al.force {
+		suppressed, err := al.suppressed(a, cooldownKey)
+		if err != nil {
+			return al.queueAlert(a, err, []notifier{n})
+		}
+		if suppressed {
+			return nil
+		}
+	}
+
+	sent, err := sendAlert(ctx, al.svc, []notifier{n}, a)
+	al.sent += sent
+	if err != nil {
+		return err
+	}
+
+	if al.cooldown == 0 {
+		return nil
+	}
+
+	return errors.Wrap(
+		recordNotification(al.svc, cooldownKey, a.Timestamp),
+		"while recording notification time",
+	)
+}
+
+// suppressed returns true if an alert has been snoozed, or an alert with the
+// given cooldown key is in cooldown.
+func (al *alerter) suppressed(a *alert, cooldownKey string) (bool, error) {
+	suppression, err := snooze.Active(al.svc, a.key(), a.Timestamp)
+	if err != nil {
+		return false, errors.Wrap(err, "while checking for snoozed alerts")
+	}
+	if suppression != nil {
+		log.Info().
+			Str("alert", a.key()).
+			Str("scope", suppression.Scope).
+			Str("action", string(suppression.Action)).
+			Time("until", suppression.Until).
+			Msg("not notifying of snoozed alert")
+		return true, nil
+	}
+
+	cooling, err := inCooldown(al.svc, cooldownKey, al.cooldown, a.Timestamp)
+	if err != nil {
+		return false, errors.Wrap(err, "while checking notification cooldown")
+	}
+	if cooling {
+		log.Info().Str("alert", a.key()).Dur("cooldown", al.cooldown).Msg("not notifying of alert in cooldown")
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// routedNotifiers returns the notifiers that an alert should be sent to: the
+// ones it targets, if any, otherwise those routed according to its severity.
+func (al *alerter) routedNotifiers(a *alert) []notifier {
+	if len(a.Notifiers) > 0 {
+		var targeted []notifier
+		for _, name := range a.Notifiers {
+			if n := findNotifier(al.notifiers, name); n != nil {
+				targeted = append(targeted, n)
+			}
+		}
+
+		return targeted
+	}
+
+	var routed []notifier
+	for _, n := range al.notifiers {
+		if a.Severity == "" || al.routes.allows(a.Severity, n.name()) {
+			routed = append(routed, n)
+		}
+	}
+
+	return routed
+}
+
+// newNotifiers constructs every alert-only notifier that is configured in the
+// environment, each wrapped to retry failed deliveries, and to skip them for a
+// while once they have failed repeatedly.
+func newNotifiers(svc *dynamodb.DynamoDB, email *emailNotifier) ([]notifier, error) {
+	breaker, err := getBreakerConfig()
+	if err != nil {
+		return nil, err
+	}
+	wrap := func(n notifier) notifier {
+		return newBreakerNotifier(svc, breaker, newRetryingNotifier(n))
+	}
+
+	var notifiers []notifier
+
+	if email != nil && len(email.recipients) > 0 {
+		notifiers = append(notifiers, wrap(email))
+	}
+
+	if teams := newTeamsNotifier(); teams != nil {
+		notifiers = append(notifiers, wrap(teams))
+	}
+
+	if slack := newSlackNotifier(); slack != nil {
+		notifiers = append(notifiers, wrap(slack))
+	}
+
+	webPush, err := newWebPushNotifier(svc)
+	if err != nil {
+		return nil, errors.Wrap(err, "while constructing web push notifier")
+	}
+	if webPush != nil {
+		notifiers = append(notifiers, wrap(webPush))
+	}
+
+	desktop, err := newDesktopNotifier()
+	if err != nil {
+		return nil, err
+	}
+	if desktop != nil {
+		notifiers = append(notifiers, wrap(desktop))
+	}
+
+	execNotifier, err := newExecNotifier()
+	if err != nil {
+		return nil, errors.Wrap(err, "while constructing exec notifier")
+	}
+	if execNotifier != nil {
+		notifiers = append(notifiers, wrap(execNotifier))
+	}
+
+	for _, n := range registeredNotifiers() {
+		notifiers = append(notifiers, wrap(n))
+	}
+
+	return notifiers, nil
+}
+
+// loadNotifiers constructs every configured notifier. The email notifier is
+// also returned, since it emails subscribers, and so is the MQTT publisher,
+// since it publishes every sample and must be closed.
+func loadNotifiers(svc *dynamodb.DynamoDB) (*emailNotifier, []notifier, *mqttPublisher, error) {
+	email, err := newEmailNotifier()
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "while constructing email notifier")
+	}
+
+	notifiers, err := newNotifiers(svc, email)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	mqttPub := newMQTTPublisher()
+	if mqttPub != nil {
+		notifiers = append(notifiers, newRetryingNotifier(mqttPub))
+	}
+
+	return email, notifiers, mqttPub, nil
+}
+
+// retryingNotifier wraps another notifier, retrying failed deliveries with
+// exponential backoff.
+type retryingNotifier struct {
+	notifier       notifier
+	maxAttempts    int
+	initialBackoff time.Duration
+}
+
+func newRetryingNotifier(n notifier) *retryingNotifier {
+	return &retryingNotifier{
+		notifier:       n,
+		maxAttempts:    notifyMaxAttempts,
+		initialBackoff: notifyInitialBackoff,
+	}
+}
+
+func (r *retryingNotifier) name() string {
+	return r.notifier.name()
+}
+
+// Unwrap returns the notifier that is retried.
+func (r *retryingNotifier) Unwrap() notifier {
+	return r.notifier
+}
+
+func (r *retryingNotifier) notify(ctx context.Context, a *alert) error {
+	backoff := r.initialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := r.notifier.notify(ctx, a)
+		if err == nil || attempt >= r.maxAttempts {
+			return err
+		}
+
+		log.Warn().
+			Err(err).
+			Str("notifier", r.name()).
+			Int("attempt", attempt).
+			Dur("backoff", backoff).
+			Msg("notification attempt failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return err
+
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// sendAlert sends an alert to every notifier, returning how many delivered it.
+// Alerts that cannot be delivered, or that are queued while a notifier's
+// circuit is open, are persisted as dead letters so that delivery can be
+// retried next run.
+func sendAlert(ctx context.Context, svc *dynamodb.DynamoDB, notifiers []notifier, a *alert) (sent int, err error) {
+	for _, n := range notifiers {
+		err := n.notify(ctx, a)
+		switch err {
+		case errAlertDropped:
+			continue
+
+		case errCircuitOpen:
+
+		case nil:
+			recordHistory(svc, n.name(), a, nil)
+			log.Info().Str("notifier", n.name()).Str("alert", a.key()).Msg("sent notification")
+			sent++
+			continue
+
+		default:
+			recordHistory(svc, n.name(), a, err)
+			log.Error().Err(err).Str("notifier", n.name()).Str("alert", a.key()).Msg("failed to send notification")
+		}
+
+		dl := deadLetter{
+			ID:        deadLetterID(n.name(), a),
+			Channel:   n.name(),
+			Alert:     *a,
+			Attempts:  1,
+			LastError: err.Error(),
+		}
+		if err := saveDeadLetter(svc, &dl); err != nil {
+			return sent, errors.Wrap(err, "while saving undelivered alert")
+		}
+	}
+
+	return sent, nil
+}
+
+// queueAlert saves an alert that could not be sent, e.g. because its cooldown
+// could not be checked, as undelivered to each of the given notifiers, so
+// that it is retried next run rather than lost.
+func (al *alerter) queueAlert(a *alert, cause error, notifiers []notifier) error {
+	log.Error().Err(cause).Str("alert", a.key()).Msg("failed to handle alert, queueing it for next run")
+
+	for _, n := range notifiers {
+		dl := deadLetter{
+			ID:        deadLetterID(n.name(), a),
+			Channel:   n.name(),
+			Alert:     *a,
+			Attempts:  1,
+			LastError: cause.Error(),
+		}
+		if err := saveDeadLetter(al.svc, &dl); err != nil {
+			return errors.Wrap(err, "while saving undelivered alert")
+		}
+	}
+
+	return nil
+}
+
+// runNotifyTest sends a test alert directly through every configured
+// notifier, reporting which succeeded and how long each took. Deliveries are
+// attempted once, so that bad credentials are reported straight away rather
+// than after backing off, and failures are not retried later.
+func runNotifyTest(ctx context.Context) error {
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return err
+	}
+
+	_, notifiers, mqttPub, err := loadNotifiers(dynamodb.New(sess))
+	if err != nil {
+		return err
+	}
+	if mqttPub != nil {
+		defer mqttPub.close()
+	}
+	if len(notifiers) == 0 {
+		return errors.New("no notifiers configured")
+	}
+
+	a := alert{Kind: testAlert, Severity: severityInfo, Timestamp: clock.Now()}
+
+	var failed []string
+	for _, n := range notifiers {
+		// The test is sent once, straight to the channel, so that it reports
+		// the channel's own error and is not skipped by an open circuit.
+		n = unwrapNotifier(n)
+
+		start := time.Now()
+		err := n.notify(ctx, &a)
+		took := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			fmt.Printf("%s: failed after %v: %v\n", n.name(), took, err)
+			failed = append(failed, n.name())
+			continue
+		}
+
+		fmt.Printf("%s: sent in %v\n", n.name(), took)
+	}
+
+	if len(failed) > 0 {
+		return errors.Errorf("failed to send test notification via %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// deadLetter is an alert that could not be delivered to a channel.
+type deadLetter struct {
+	ID        string `dynamodbav:"id"`
+	Channel   string `dynamodbav:"channel"`
+	Alert     alert  `dynamodbav:"alert"`
+	Attempts  int    `dynamodbav:"attempts"`
+	LastError string `dynamodbav:"lastError"`
+}
+
+func deadLetterID(channel string, a *alert) string {
+	return channel + "/" + a.key() + "/" + a.Timestamp.Format(time.RFC3339)
+}
+
+func saveDeadLetter(svc *dynamodb.DynamoDB, dl *deadLetter) error {
+	av, err := dynamodbattribute.MarshalMap(dl)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(deadLettersTableName),
+	}
+
+	if _, err = svc.PutItem(input); err != nil {
+		return err
+	}
+
+	log.Info().Str("id", dl.ID).Msg("saved undelivered alert")
+
+	return nil
+}
+
+func deleteDeadLetter(svc *dynamodb.DynamoDB, dl *deadLetter) error {
+	_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(dl.ID),
+			},
+		},
+		TableName: aws.String(deadLettersTableName),
+	})
+
+	return err
+}
+
+func readDeadLetters(svc *dynamodb.DynamoDB) ([]deadLetter, error) {
+	input := dynamodb.ScanInput{
+		Select:    aws.String(dynamodb.SelectAllAttributes),
+		TableName: aws.String(deadLettersTableName),
+	}
+
+	// Dead letters can outgrow a single page of results, so every page is
+	// read, otherwise those beyond the first would never be retried.
+	var deadLetters []deadLetter
+	var unmarshalErr error
+	err := svc.ScanPages(&input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for i := range page.Items {
+			var dl deadLetter
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(page.Items[i], &dl); unmarshalErr != nil {
+				return false
+			}
+			deadLetters = append(deadLetters, dl)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+
+	return deadLetters, nil
+}
+
+// retryDeadLetters attempts to redeliver any alerts from before the given
+// time that previous runs failed to deliver, leaving later ones, e.g. that
+// this run just failed to deliver, to later runs. Alerts that are delivered,
+// or are too old to still be useful, are removed.
+func retryDeadLetters(ctx context.Context, svc *dynamodb.DynamoDB, notifiers []notifier, before time.Time) error {
+	deadLetters, err := readDeadLetters(svc)
+	if err != nil {
+		return err
+	}
+
+	for i := range deadLetters {
+		dl := &deadLetters[i]
+		if !dl.Alert.Timestamp.Before(before) {
+			continue
+		}
+
+		if clock.Since(dl.Alert.Timestamp) > deadLetterMaxAge {
+			log.Warn().Str("id", dl.ID).Int("attempts", dl.Attempts).Msg("dropping undelivered alert")
+			if err := deleteDeadLetter(svc, dl); err != nil {
+				return err
+			}
+			continue
+		}
+
+		n := findNotifier(notifiers, dl.Channel)
+		if n == nil {
+			log.Warn().Str("id", dl.ID).Str("notifier", dl.Channel).Msg("notifier for undelivered alert is not configured")
+			continue
+		}
+
+		err := n.notify(ctx, &dl.Alert)
+		if err == errCircuitOpen || err == errAlertDropped {
+			// Leave it until the circuit closes, or the alert is too old.
+			continue
+		}
+
+		recordHistory(svc, n.name(), &dl.Alert, err)
+		if err != nil {
+			log.Error().Err(err).Str("id", dl.ID).Msg("failed to redeliver alert")
+
+			dl.Attempts++
+			dl.LastError = err.Error()
+			if err := saveDeadLetter(svc, dl); err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Info().Str("id", dl.ID).Msg("redelivered alert")
+		if err := deleteDeadLetter(svc, dl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordHistory records an attempt to deliver an alert in the notification
+// history. Failing to record history is logged but does not fail the run.
+func recordHistory(svc *dynamodb.DynamoDB, channel string, a *alert, sendErr error) {
+	r := notifications.NewRecord(
+		channel,
+		a.key(),
+		a.Price,
+		a.Timestamp,
+		clock.Now(),
+		sendErr,
+	)
+
+	if err := notifications.Write(svc, r); err != nil {
+		log.Error().Err(err).Msg("failed to record notification history")
+	}
+}
+
+// runNotifications prints up to limit of the most recent notifications in the
+// history, oldest first, or all of them if limit is zero. If channel is set,
+// only the notifications sent over it are printed.
+func runNotifications(limit int, channel string) error {
+	if limit < 0 {
+		return errors.Errorf("limit must not be negative, got %d", limit)
+	}
+
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return err
+	}
+
+	records, err := notifications.ReadAll(dynamodb.New(sess))
+	if err != nil {
+		return errors.Wrap(err, "while reading notification history")
+	}
+
+	if channel != "" {
+		var filtered []notifications.Record
+		for i := range records {
+			if records[i].Channel == channel {
+				filtered = append(filtered, records[i])
+			}
+		}
+		records = filtered
+	}
+
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+
+	for i := range records {
+		r := &records[i]
+		result := "delivered"
+		if !r.Delivered {
+			result = "failed: " + r.Error
+		}
+
+		fmt.Printf(
+			"%s  %-8s %-16s price=%-5d %s\n",
+			display.In(r.SentAt).Format(time.RFC3339), r.Channel, r.Transition, r.Price, result,
+		)
+	}
+
+	return nil
+}
+
+func findNotifier(notifiers []notifier, name string) notifier {
+	for _, n := range notifiers {
+		if n.name() == name {
+			return n
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package gastracker
+
+import (
+	"context"
+	"testing"
+)
+
+type namedNotifier string
+
+func (n namedNotifier) name() string                         { return string(n) }
+func (n namedNotifier) notify(context.Context, *alert) error { return nil }
+
+func TestUnwrapNotifier(t *testing.T) {
+	base := namedNotifier("email")
+
+	tests := []struct {
+		name string
+		n    notifier
+	}{
+		{name: "unwrapped", n: base},
+		{name: "retrying", n: newRetryingNotifier(base)},
+		{name: "breaker", n: &breakerNotifier{notifier: base}},
+		{name: "breaker around retrying", n: &breakerNotifier{notifier: newRetryingNotifier(base)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unwrapNotifier(tt.n); got != notifier(base) {
+				t.Errorf("unwrapNotifier() = %#v, want %#v", got, base)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package gastracker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	// Refresh access tokens slightly before they expire, to allow for clock
+	// skew and the time taken to send an email.
+	tokenExpiryMargin = time.Minute
+)
+
+// oauthTokenSource exchanges an OAuth2 refresh token for access tokens,
+// caching each access token until shortly before it expires.
+type oauthTokenSource struct {
+	client       *http.Client
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	refreshToken string
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// newOAuthTokenSource constructs a token source from the environment. It
+// returns nil if no refresh token is configured.
+func newOAuthTokenSource() (*oauthTokenSource, error) {
+	refreshToken := os.Getenv("GAS_NOTIFIER_OAUTH_REFRESH_TOKEN")
+	if refreshToken == "" {
+		return nil, nil
+	}
+	clientID := os.Getenv("GAS_NOTIFIER_OAUTH_CLIENT_ID")
+	if clientID == "" {
+		return nil, errors.New("GAS_NOTIFIER_OAUTH_CLIENT_ID not set")
+	}
+	clientSecret := os.Getenv("GAS_NOTIFIER_OAUTH_CLIENT_SECRET")
+	if clientSecret == "" {
+		return nil, errors.New("GAS_NOTIFIER_OAUTH_CLIENT_SECRET not set")
+	}
+
+	return newGoogleTokenSource(clientID, clientSecret, refreshToken), nil
+}
+
+// newGoogleTokenSource constructs a token source for a Google OAuth2 client.
+func newGoogleTokenSource(clientID, clientSecret, refreshToken string) *oauthTokenSource {
+	return &oauthTokenSource{
+		client:       &http.Client{Timeout: 30 * time.Second},
+		tokenURL:     googleTokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		refreshToken: refreshToken,
+	}
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// token returns a valid access token, refreshing it if necessary.
+func (s *oauthTokenSource) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && time.Now().Add(tokenExpiryMargin).Before(s.expiry) {
+		return s.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("client_id", s.clientID)
+	form.Set("client_secret", s.clientSecret)
+	form.Set("refresh_token", s.refreshToken)
+	form.Set("grant_type", "refresh_token")
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "while constructing token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "while making token request")
+	}
+
+	defer rsp.Body.Close()
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "while reading token response body")
+	}
+
+	var tok tokenResponse
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", errors.Wrap(err, "while unmarshalling token response body")
+	}
+
+	if rsp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+		return "", errors.Errorf(
+			"token response error: %s %s %s", rsp.Status, tok.Error, tok.ErrorDescription,
+		)
+	}
+
+	s.accessToken = tok.AccessToken
+	s.expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+
+	return s.accessToken, nil
+}
+
+// xoauth2Auth implements the XOAUTH2 SMTP authentication mechanism used by
+// Gmail, see https://developers.google.com/gmail/imap/xoauth2-protocol.
+type xoauth2Auth struct {
+	username    string
+	accessToken string
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("refusing to send OAuth2 token over unencrypted connection")
+	}
+
+	resp := "user=" + a.username + "\x01auth=Bearer " + a.accessToken + "\x01\x01"
+	return "XOAUTH2", []byte(resp), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// The server sends a JSON error challenge if authentication fails,
+		// which must be answered with an empty response to get the final
+		// error status.
+		return []byte{}, nil
+	}
+
+	return nil, nil
+}
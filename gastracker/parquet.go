@@ -0,0 +1,108 @@
+package gastracker
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	parquetFileName = "prices.parquet"
+	// parquetParallelism is the number of goroutines that encode each row
+	// group, which is small since there are few prices per day.
+	parquetParallelism = 1
+)
+
+// parquetPrice is the schema of a price in a Parquet export. The date it was
+// sampled on is the partition, so is not a column.
+type parquetPrice struct {
+	Timestamp int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Price     int64   `parquet:"name=price, type=INT64"`
+	Category  string  `parquet:"name=category, type=BYTE_ARRAY, convertedtype=UTF8"`
+	EthUSD    float64 `parquet:"name=eth_usd, type=DOUBLE"`
+}
+
+// runExportParquet writes the stored prices in the range to dir as Snappy
+// compressed Parquet, partitioned by the UTC date they were sampled on, e.g.
+// dir/date=2021-03-01/prices.parquet, so that Athena, DuckDB and Spark can
+// read dir as a table partitioned by date. Existing files for the exported
+// dates are replaced.
+func runExportParquet(dir string, opts ExportOptions) error {
+	if dir == "" {
+		return errors.New("an output directory is required for Parquet exports")
+	}
+	if len(opts.Fields) > 0 {
+		return errors.New("fields can only be selected for CSV exports")
+	}
+
+	gasPrices, err := readExportRange(opts)
+	if err != nil {
+		return err
+	}
+
+	// The prices are ordered oldest first, so each date's are contiguous.
+	for start := 0; start < len(gasPrices); {
+		date := gasPrices[start].Timestamp.UTC().Format("2006-01-02")
+		end := start + 1
+		for end < len(gasPrices) && gasPrices[end].Timestamp.UTC().Format("2006-01-02") == date {
+			end++
+		}
+
+		path := filepath.Join(dir, "date="+date, parquetFileName)
+		if err := writeParquetFile(path, gasPrices[start:end]); err != nil {
+			return errors.Wrapf(err, "while writing %s", path)
+		}
+
+		start = end
+	}
+
+	return nil
+}
+
+// writeParquetFile writes prices to a Parquet file at path, creating its
+// directory if needed.
+func writeParquetFile(path string, gasPrices []prices.GasPriceData) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := writeParquet(f, gasPrices); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeParquet(f *os.File, gasPrices []prices.GasPriceData) error {
+	pw, err := writer.NewParquetWriterFromWriter(f, new(parquetPrice), parquetParallelism)
+	if err != nil {
+		return errors.Wrap(err, "while creating Parquet writer")
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for i := range gasPrices {
+		p := &gasPrices[i]
+		row := parquetPrice{
+			Timestamp: p.Timestamp.UnixNano() / int64(time.Millisecond),
+			Price:     int64(p.Price),
+			Category:  p.Category.String(),
+			EthUSD:    p.EthUSD,
+		}
+		if err := pw.Write(row); err != nil {
+			return errors.Wrap(err, "while writing Parquet row")
+		}
+	}
+
+	return errors.Wrap(pw.WriteStop(), "while finishing Parquet file")
+}
@@ -0,0 +1,177 @@
+package gastracker
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/sources"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+// Sample is a price sampled by another system, e.g. enqueued for the queue
+// worker, to be processed in place of fetching one from the source.
+type Sample struct {
+	Price  int     `json:"price"`
+	EthUSD float64 `json:"ethUsd"`
+	// Timestamp is when the price was sampled, or if zero, when it is
+	// processed.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// MediumGas returns the sampled price, so that a Sample can be used as a
+// sources.Source.
+func (s *Sample) MediumGas(context.Context) (int, error) {
+	return s.Price, nil
+}
+
+// ETHPrice returns the sampled ETH price, or 0 if it was not given.
+func (s *Sample) ETHPrice(context.Context) (float64, error) {
+	return s.EthUSD, nil
+}
+
+// AlertRequest is an alert sent on behalf of another system. Like other
+// alerts it is routed by severity, or to the given notifiers, and is subject
+// to snoozes and the notification cooldown.
+type AlertRequest struct {
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+	// Severity is info, notice or urgent, or info if empty.
+	Severity  string   `json:"severity"`
+	Notifiers []string `json:"notifiers"`
+}
+
+// getRunSource returns the enqueued sample if there is one, otherwise the
+// source given in the options or else the configured one.
+func getRunSource(opts RunOptions) (sources.Source, string, error) {
+	if opts.Sample == nil {
+		if opts.Source != nil {
+			return opts.Source, "custom", nil
+		}
+		return getSource()
+	}
+
+	if opts.Sample.Price <= 0 {
+		return nil, "", errors.Errorf("invalid sample price %d, expected a positive number of gwei", opts.Sample.Price)
+	}
+
+	return opts.Sample, "sample", nil
+}
+
+// ErrStaleSample is returned by Run for a sample that is not newer than the
+// latest stored price. Retrying cannot store such a sample.
+var ErrStaleSample = errors.New("sample is not newer than the latest stored price")
+
+// sampledAt returns when the price of a run was sampled. An enqueued sample
+// must be newer than every stored price, since the stats and alerts assume
+// prices arrive in order.
+func sampledAt(opts RunOptions, gasPrices []prices.GasPriceData, now time.Time) (time.Time, error) {
+	if opts.Sample == nil || opts.Sample.Timestamp.IsZero() {
+		return now, nil
+	}
+
+	at := opts.Sample.Timestamp
+	if latest := prices.Latest(gasPrices); latest != nil && !at.After(latest.Timestamp) {
+		return time.Time{}, errors.Wrapf(
+			ErrStaleSample, "sample at %s, latest stored price at %s",
+			at.UTC().Format(time.RFC3339), latest.Timestamp.UTC().Format(time.RFC3339),
+		)
+	}
+
+	return at, nil
+}
+
+// runSendAlert sends a requested alert, returning the number of notifications
+// delivered.
+func runSendAlert(ctx context.Context, req AlertRequest) (int, error) {
+	a := alert{
+		Kind:      requestedAlert,
+		Severity:  severityInfo,
+		Title:     strings.TrimSpace(req.Subject),
+		Message:   req.Message,
+		Notifiers: req.Notifiers,
+		Timestamp: clock.Now(),
+	}
+	if a.Title == "" {
+		return 0, errors.New("an alert subject is required")
+	}
+	if strings.ContainsAny(a.Title, "\r\n") {
+		return 0, errors.New("an alert subject must be a single line")
+	}
+	if req.Severity != "" {
+		a.Severity = ""
+		for _, sev := range severities {
+			if strings.EqualFold(req.Severity, string(sev)) {
+				a.Severity = sev
+			}
+		}
+		if a.Severity == "" {
+			return 0, errors.Errorf("invalid alert severity %q, expected info, notice or urgent", req.Severity)
+		}
+	}
+
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return 0, err
+	}
+	svc := dynamodb.New(sess)
+
+	_, notifiers, mqttPub, err := loadNotifiers(svc)
+	if err != nil {
+		return 0, err
+	}
+	if mqttPub != nil {
+		defer mqttPub.close()
+	}
+	if len(notifiers) == 0 {
+		return 0, errors.New("no notifiers configured")
+	}
+	for _, name := range a.Notifiers {
+		if findNotifier(notifiers, name) == nil {
+			return 0, errors.Errorf("alert refers to unconfigured channel %q", name)
+		}
+	}
+
+	cooldown, err := getNotificationCooldown()
+	if err != nil {
+		return 0, err
+	}
+
+	links, err := newLinker()
+	if err != nil {
+		return 0, errors.Wrap(err, "while configuring alert links")
+	}
+
+	severityRoutes, err := getRoutes(notifiers)
+	if err != nil {
+		return 0, err
+	}
+
+	// The latest price gives notifiers that show one some context.
+	latest, err := store.ReadLatest(svc)
+	if err != nil {
+		return 0, errors.Wrap(err, "while reading latest gas price")
+	}
+	if latest != nil {
+		a.Price = latest.Price
+		a.NewCategory = latest.Category
+	}
+
+	al := alerter{
+		svc:       svc,
+		notifiers: notifiers,
+		cooldown:  cooldown,
+		linker:    links,
+		routes:    severityRoutes,
+	}
+	if err := al.handleAlert(ctx, &a); err != nil {
+		return al.sent, errors.Wrapf(err, "while notifying of %s", a.key())
+	}
+
+	return al.sent, nil
+}
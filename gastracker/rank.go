@@ -0,0 +1,69 @@
+package gastracker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+// percentileRank is where a price ranks among the prices over a window, which
+// is more intuitive than how many standard deviations it is from their mean.
+type percentileRank struct {
+	// Percentile is the percentage of the prices that were cheaper.
+	Percentile float64 `dynamodbav:"percentile"`
+	Window     string  `dynamodbav:"window"`
+}
+
+// String describes the rank from the cheaper side if the price is in the
+// cheaper half, e.g. "Cheaper than 73% of prices over the last week", and
+// otherwise from the more expensive side.
+func (r *percentileRank) String() string {
+	s := r.relative("prices over the last " + r.Window)
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// relative describes the rank relative to the prices, e.g. "cheaper than 73%
+// of stored prices".
+func (r *percentileRank) relative(of string) string {
+	if r.Percentile <= 50 {
+		return fmt.Sprintf("cheaper than %.0f%% of %s", 100-r.Percentile, of)
+	}
+
+	return fmt.Sprintf("more expensive than %.0f%% of %s", r.Percentile, of)
+}
+
+// findPercentileRank ranks the current price among the stored prices over the
+// window before it, or returns nil if there are none.
+func findPercentileRank(
+	current *prices.GasPriceData, gasPrices []prices.GasPriceData, window time.Duration,
+) *percentileRank {
+	within := prices.Within(gasPrices, window, current.Timestamp)
+	if len(within) == 0 {
+		return nil
+	}
+
+	return &percentileRank{
+		Percentile: prices.PercentileRank(current.Price, within),
+		Window:     describeWindow(window),
+	}
+}
+
+// describeWindow describes a window in words where it is a whole number of
+// days, e.g. "week" or "3 days", and otherwise as formatWindow does.
+func describeWindow(d time.Duration) string {
+	switch d {
+	case 24 * time.Hour:
+		return "day"
+
+	case 7 * 24 * time.Hour:
+		return "week"
+	}
+
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+
+	return formatWindow(d)
+}
@@ -0,0 +1,117 @@
+package gastracker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/display"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const (
+	defaultRecommendWindowHours = 3
+	// recommendHorizonHours is how far ahead to look for the cheapest window.
+	recommendHorizonHours = 24
+)
+
+// recommendation is the window in the next day when gas is expected to be
+// cheapest.
+type recommendation struct {
+	Start    time.Time `dynamodbav:"start"`
+	End      time.Time `dynamodbav:"end"`
+	Expected float64   `dynamodbav:"expected"`
+}
+
+func (r *recommendation) String() string {
+	return fmt.Sprintf(
+		"Historically cheapest window in the next %dh: %s-%s (expected ~%.0f gwei)",
+		recommendHorizonHours,
+		display.In(r.Start).Format("15:04"),
+		display.In(r.End).Format("15:04 MST"),
+		r.Expected,
+	)
+}
+
+// getRecommendWindowHours reads the length of the window to recommend
+// transacting in. Recommendations are disabled if it is set to 0.
+func getRecommendWindowHours() (int, error) {
+	raw := os.Getenv("GAS_RECOMMEND_WINDOW_HOURS")
+	if raw == "" {
+		return defaultRecommendWindowHours, nil
+	}
+
+	hours, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while parsing GAS_RECOMMEND_WINDOW_HOURS %q", raw)
+	}
+	if hours < 0 || hours > recommendHorizonHours {
+		return 0, errors.Errorf(
+			"GAS_RECOMMEND_WINDOW_HOURS must be between 0 and %d, got %d", recommendHorizonHours, hours,
+		)
+	}
+
+	return hours, nil
+}
+
+// findRecommendation finds the cheapest window of the given length in the next
+// day. The expected price for each hour combines the forecast with the mean
+// price previously seen at that hour of day, when there are enough of either.
+// It returns nil if recommendations are disabled or there is nothing to base
+// them on.
+func findRecommendation(
+	current *prices.GasPriceData,
+	gasPrices []prices.GasPriceData,
+	agg *prices.Aggregates,
+	windowHours int,
+) *recommendation {
+	if windowHours == 0 {
+		return nil
+	}
+
+	predictions := predictPrices(current, gasPrices, recommendHorizonHours)
+	start := current.Timestamp.UTC().Truncate(time.Hour)
+
+	expected := make([]float64, recommendHorizonHours)
+	for h := range expected {
+		at := start.Add(time.Duration(h+1) * time.Hour)
+
+		var sum float64
+		var n int
+		if predictions != nil {
+			sum += predictions[h]
+			n++
+		}
+		if seasonal := aggregateHourStats(agg, at); seasonal != nil {
+			sum += seasonal.Mean
+			n++
+		}
+
+		if n == 0 {
+			return nil
+		}
+		expected[h] = sum / float64(n)
+	}
+
+	var best *recommendation
+	for h := 0; h+windowHours <= len(expected); h++ {
+		var sum float64
+		for _, p := range expected[h : h+windowHours] {
+			sum += p
+		}
+		mean := sum / float64(windowHours)
+
+		if best == nil || mean < best.Expected {
+			windowStart := start.Add(time.Duration(h+1) * time.Hour)
+			best = &recommendation{
+				Start:    windowStart,
+				End:      windowStart.Add(time.Duration(windowHours) * time.Hour),
+				Expected: mean,
+			}
+		}
+	}
+
+	return best
+}
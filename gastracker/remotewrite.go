@@ -0,0 +1,145 @@
+package gastracker
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	remoteWriteTimeout = 30 * time.Second
+	defaultPromJob     = "gas_tracker"
+)
+
+// remoteWriter pushes each new gas price sample to a Prometheus remote-write
+// endpoint, such as Grafana Cloud or Mimir, so that the prices can be kept
+// and charted alongside other metrics.
+type remoteWriter struct {
+	client   *http.Client
+	url      string
+	username string
+	password string
+	job      string
+}
+
+// newRemoteWriter constructs a remote writer from the environment. It returns
+// nil if no endpoint is configured.
+func newRemoteWriter() *remoteWriter {
+	url := os.Getenv("GAS_PROMETHEUS_REMOTE_WRITE_URL")
+	if url == "" {
+		return nil
+	}
+
+	job := os.Getenv("GAS_PROMETHEUS_JOB")
+	if job == "" {
+		job = defaultPromJob
+	}
+
+	return &remoteWriter{
+		client:   &http.Client{Timeout: remoteWriteTimeout},
+		url:      url,
+		username: os.Getenv("GAS_PROMETHEUS_USERNAME"),
+		password: os.Getenv("GAS_PROMETHEUS_PASSWORD"),
+		job:      job,
+	}
+}
+
+// promSeries is a single sample of a time series, identified by its labels.
+type promSeries struct {
+	labels map[string]string
+	value  float64
+}
+
+// writeSample pushes a sample as the gas_price_gwei and gas_category series,
+// and gas_eth_usd if the ETH price is known. gas_category is 1 with the
+// category as a label, so that it can be charted as a state timeline.
+func (w *remoteWriter) writeSample(ctx context.Context, p *prices.GasPriceData) error {
+	series := []promSeries{
+		{labels: map[string]string{"__name__": "gas_price_gwei"}, value: float64(p.Price)},
+		{labels: map[string]string{"__name__": "gas_category", "category": p.Category.String()}, value: 1},
+	}
+	if p.EthUSD != 0 {
+		series = append(series, promSeries{labels: map[string]string{"__name__": "gas_eth_usd"}, value: p.EthUSD})
+	}
+
+	for i := range series {
+		series[i].labels["job"] = w.job
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(series, p.Timestamp))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "while constructing http request")
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.username != "" || w.password != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	rsp, err := w.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "while making http request")
+	}
+
+	defer rsp.Body.Close()
+
+	return responseError(rsp)
+}
+
+// encodeWriteRequest encodes a remote-write WriteRequest protobuf message of
+// the series, each with a single sample at ts. The message is small enough to
+// encode by hand rather than depend on Prometheus' generated types:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []promSeries, ts time.Time) []byte {
+	var req []byte
+	for _, s := range series {
+		// Labels must be sorted by name.
+		names := make([]string, 0, len(s.labels))
+		for name := range s.labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var timeSeries []byte
+		for _, name := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, s.labels[name])
+
+			timeSeries = protowire.AppendTag(timeSeries, 1, protowire.BytesType)
+			timeSeries = protowire.AppendBytes(timeSeries, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(ts.UnixNano()/int64(time.Millisecond)))
+
+		timeSeries = protowire.AppendTag(timeSeries, 2, protowire.BytesType)
+		timeSeries = protowire.AppendBytes(timeSeries, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, timeSeries)
+	}
+
+	return req
+}
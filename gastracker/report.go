@@ -0,0 +1,343 @@
+package gastracker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/display"
+	"github.com/ryanc414/gas-tracker/notifications"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const (
+	weeklyReportStateID     = "weeklyReport"
+	reportPeriod            = 7 * 24 * time.Hour
+	defaultReportHour       = 9
+	reportHoursListed       = 3
+	reportObjectKeyPrefix   = "reports/weekly/"
+	reportObjectContentType = "text/plain; charset=utf-8"
+)
+
+// weeklyReport summarises the prices and alerts over the past week.
+type weeklyReport struct {
+	From       time.Time       `dynamodbav:"from"`
+	To         time.Time       `dynamodbav:"to"`
+	Mean       float64         `dynamodbav:"mean"`
+	Days       []periodMean    `dynamodbav:"days"`
+	Cheapest   []periodMean    `dynamodbav:"cheapest"`
+	Priciest   []periodMean    `dynamodbav:"priciest"`
+	Categories []categoryShare `dynamodbav:"categories"`
+	// Histogram shows whether prices are bimodal, in which case categories
+	// based on the mean may be misleading.
+	Histogram  []histogramBucket `dynamodbav:"histogram"`
+	AlertsSent int               `dynamodbav:"alertsSent"`
+}
+
+// periodMean is the mean price over a period, e.g. a day or an hour of day.
+type periodMean struct {
+	Label   string  `dynamodbav:"label"`
+	Mean    float64 `dynamodbav:"mean"`
+	Samples int     `dynamodbav:"samples"`
+}
+
+// categoryShare is how many samples were in a category.
+type categoryShare struct {
+	Category string `dynamodbav:"category"`
+	Samples  int    `dynamodbav:"samples"`
+}
+
+// reportSchedule configures when the weekly report is sent, in UTC.
+type reportSchedule struct {
+	enabled bool
+	day     time.Weekday
+	hour    int
+	bucket  string
+}
+
+// getReportSchedule reads when to send the weekly report. It is disabled
+// unless GAS_WEEKLY_REPORT_DAY is set, e.g. to "Monday".
+func getReportSchedule() (reportSchedule, error) {
+	s := reportSchedule{hour: defaultReportHour, bucket: os.Getenv("GAS_REPORT_BUCKET")}
+
+	raw := os.Getenv("GAS_WEEKLY_REPORT_DAY")
+	if raw == "" {
+		return s, nil
+	}
+
+	day, ok := parseWeekday(raw)
+	if !ok {
+		return reportSchedule{}, errors.Errorf("GAS_WEEKLY_REPORT_DAY must be a day of the week, got %q", raw)
+	}
+	s.enabled = true
+	s.day = day
+
+	if raw := os.Getenv("GAS_WEEKLY_REPORT_HOUR"); raw != "" {
+		hour, err := strconv.Atoi(raw)
+		if err != nil || hour < 0 || hour > 23 {
+			return reportSchedule{}, errors.Errorf("GAS_WEEKLY_REPORT_HOUR must be an hour from 0 to 23, got %q", raw)
+		}
+
+		s.hour = hour
+	}
+
+	return s, nil
+}
+
+func parseWeekday(input string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), input) {
+			return d, true
+		}
+	}
+
+	return time.Sunday, false
+}
+
+// due returns true if the report should be sent now, given when the last one
+// was sent.
+func (s *reportSchedule) due(now, lastSent time.Time) bool {
+	now = now.UTC()
+	if !s.enabled || now.Weekday() != s.day || now.Hour() < s.hour {
+		return false
+	}
+
+	// Allow for runs drifting slightly earlier from week to week.
+	return now.Sub(lastSent) > reportPeriod-24*time.Hour
+}
+
+// buildWeeklyReport summarises the prices and delivered alerts in the week
+// before the given time.
+func buildWeeklyReport(
+	gasPrices []prices.GasPriceData, records []notifications.Record, now time.Time,
+) *weeklyReport {
+	r := weeklyReport{From: now.Add(-reportPeriod), To: now}
+
+	var week []prices.GasPriceData
+	for i := range gasPrices {
+		if !gasPrices[i].Timestamp.Before(r.From) {
+			week = append(week, gasPrices[i])
+		}
+	}
+	sort.Slice(week, func(i, j int) bool {
+		return week[i].Timestamp.Before(week[j].Timestamp)
+	})
+
+	if len(week) > 0 {
+		r.Mean = prices.Mean(week)
+	}
+
+	r.Days = groupMeans(week, func(t time.Time) string {
+		return display.In(t).Format("Mon 2 Jan")
+	})
+
+	hours := groupMeans(week, func(t time.Time) string {
+		return display.In(t).Format("15:00 MST")
+	})
+	sort.SliceStable(hours, func(i, j int) bool { return hours[i].Mean < hours[j].Mean })
+	for i := 0; i < len(hours) && i < reportHoursListed; i++ {
+		r.Cheapest = append(r.Cheapest, hours[i])
+		r.Priciest = append(r.Priciest, hours[len(hours)-1-i])
+	}
+
+	counts := make(map[prices.PriceCategory]int)
+	for i := range week {
+		counts[week[i].Category]++
+	}
+	for _, c := range []prices.PriceCategory{prices.VeryLow, prices.Low, prices.Average, prices.High, prices.VeryHigh} {
+		if counts[c] > 0 {
+			r.Categories = append(r.Categories, categoryShare{Category: c.String(), Samples: counts[c]})
+		}
+	}
+
+	r.Histogram = buildHistogram(week, DefaultHistogramBuckets)
+
+	for i := range records {
+		if records[i].Delivered && !records[i].SentAt.Before(r.From) {
+			r.AlertsSent++
+		}
+	}
+
+	return &r
+}
+
+// groupMeans returns the mean price of each group of prices with the same
+// label, in order of first appearance.
+func groupMeans(gasPrices []prices.GasPriceData, label func(time.Time) string) []periodMean {
+	var means []periodMean
+	index := make(map[string]int)
+
+	for i := range gasPrices {
+		l := label(gasPrices[i].Timestamp)
+
+		j, ok := index[l]
+		if !ok {
+			j = len(means)
+			index[l] = j
+			means = append(means, periodMean{Label: l})
+		}
+
+		means[j].Mean += float64(gasPrices[i].Price)
+		means[j].Samples++
+	}
+
+	for i := range means {
+		means[i].Mean /= float64(means[i].Samples)
+	}
+
+	return means
+}
+
+func (r *weeklyReport) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(
+		&b, "Gas prices from %s to %s averaged %.0f gwei\n\n",
+		display.In(r.From).Format("Mon 2 Jan"), display.In(r.To).Format("Mon 2 Jan"), r.Mean,
+	)
+
+	b.WriteString("Average by day:\n")
+	for _, d := range r.Days {
+		fmt.Fprintf(&b, "  %-10s %.0f gwei\n", d.Label, d.Mean)
+	}
+
+	b.WriteString("\nCheapest hours:\n")
+	for _, h := range r.Cheapest {
+		fmt.Fprintf(&b, "  %s %.0f gwei\n", h.Label, h.Mean)
+	}
+
+	b.WriteString("\nMost expensive hours:\n")
+	for _, h := range r.Priciest {
+		fmt.Fprintf(&b, "  %s %.0f gwei\n", h.Label, h.Mean)
+	}
+
+	var total int
+	for _, c := range r.Categories {
+		total += c.Samples
+	}
+
+	b.WriteString("\nTime in each category:\n")
+	for _, c := range r.Categories {
+		fmt.Fprintf(&b, "  %-10s %.0f%%\n", c.Category, float64(c.Samples)/float64(total)*100)
+	}
+
+	b.WriteString("\nPrice distribution (gwei):\n")
+	b.WriteString(formatHistogram(r.Histogram))
+
+	fmt.Fprintf(&b, "\n%d alerts were sent\n", r.AlertsSent)
+
+	return b.String()
+}
+
+// lastReport records when the weekly report was last sent.
+type lastReport struct {
+	SentAt time.Time     `dynamodbav:"sentAt"`
+	Report *weeklyReport `dynamodbav:"report"`
+}
+
+// sendWeeklyReport builds and sends the weekly report if it is due, and
+// stores it in the state table and, if configured, S3. Unlike other alerts,
+// the report is not subject to snoozes or the notification cooldown.
+func sendWeeklyReport(
+	ctx context.Context,
+	al *alerter,
+	sess *session.Session,
+	schedule reportSchedule,
+	gasPrices []prices.GasPriceData,
+	now time.Time,
+) error {
+	if !schedule.enabled {
+		return nil
+	}
+
+	var last lastReport
+	if _, err := store.ReadState(al.svc, weeklyReportStateID, &last); err != nil {
+		return errors.Wrap(err, "while reading last weekly report")
+	}
+	if !schedule.due(now, last.SentAt) {
+		return nil
+	}
+
+	records, err := notifications.ReadAll(al.svc)
+	if err != nil {
+		return errors.Wrap(err, "while reading notification history")
+	}
+
+	report := buildWeeklyReport(gasPrices, records, now)
+	log.Info().Msg("sending weekly report")
+
+	// Record the report before sending it, so that a failure to deliver it
+	// over one channel does not resend it to the others every run.
+	if err := store.WriteState(al.svc, weeklyReportStateID, &lastReport{SentAt: now, Report: report}); err != nil {
+		return errors.Wrap(err, "while writing weekly report")
+	}
+
+	if schedule.bucket != "" {
+		if err := uploadReport(s3.New(sess), schedule.bucket, report); err != nil {
+			return err
+		}
+	}
+
+	a := alert{
+		Kind:      reportAlert,
+		Severity:  severityInfo,
+		Report:    report,
+		Timestamp: now,
+	}
+
+	sent, err := sendAlert(ctx, al.svc, al.routedNotifiers(&a), &a)
+	al.sent += sent
+
+	return err
+}
+
+// uploadReport writes the report as text to S3, keyed by the day it was sent.
+func uploadReport(client *s3.S3, bucket string, report *weeklyReport) error {
+	key := reportObjectKeyPrefix + report.To.UTC().Format("2006-01-02") + ".txt"
+
+	_, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader([]byte(report.String())),
+		ContentType: aws.String(reportObjectContentType),
+	})
+
+	return errors.Wrapf(err, "while uploading weekly report to s3://%s/%s", bucket, key)
+}
+
+// runReport prints the weekly report for the stored prices.
+func runReport() error {
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return err
+	}
+	svc := dynamodb.New(sess)
+
+	gasPrices, err := store.ReadAll(svc)
+	if err != nil {
+		return errors.Wrap(err, "while reading gas prices")
+	}
+
+	records, err := notifications.ReadAll(svc)
+	if err != nil {
+		return errors.Wrap(err, "while reading notification history")
+	}
+
+	fmt.Print(buildWeeklyReport(gasPrices, records, clock.Now()))
+
+	return nil
+}
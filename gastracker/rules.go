@@ -0,0 +1,354 @@
+package gastracker
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+// alertRule is a declarative alert from GAS_ALERT_RULES, such as
+//
+//	category in Low|Very Low and hour >= 8 and hour < 22 -> email|teams
+//
+// The conditions before "->" are joined by "and", and each compares a field
+// of a sample with a value:
+//
+//	price     the medium gas price in gwei, compared with <, <=, >, >=, = or !=
+//	hour      the hour the price was sampled, 0-23 UTC, compared the same way
+//	category  the category of the price, e.g. Low
+//	previous  the category of the sample before
+//	trend     stable, rising, rising fast, falling or falling fast
+//	weekday   the day the price was sampled, e.g. Sat
+//
+// The last four are compared with = or in, which match any of a "|"-separated
+// list of values, or with !=, which matches none of them. The optional
+// notifiers after "->" are the channels the alert is sent to, rather than
+// those its severity is routed to.
+//
+// Like the built-in alerts, a rule fires once its conditions have held for the
+// sustained number of samples, rather than on every sample they hold for.
+type alertRule struct {
+	text       string
+	conditions []ruleCondition
+	notifiers  []string
+}
+
+// ruleCondition compares one field of a sample. Numeric fields are compared
+// with num, and the others are matched against values.
+type ruleCondition struct {
+	field  string
+	op     string
+	num    float64
+	values []string
+}
+
+// ruleSample is the fields of a sample that rules can refer to.
+type ruleSample struct {
+	price    int
+	hour     int
+	category string
+	previous string
+	trend    string
+	weekday  string
+}
+
+var (
+	numericRuleFields = map[string]bool{"price": true, "hour": true}
+	setRuleFields     = map[string]bool{"category": true, "previous": true, "trend": true, "weekday": true}
+	trendDirections   = []string{"stable", "rising", "rising fast", "falling", "falling fast"}
+)
+
+// getAlertRules reads the alert rules from GAS_ALERT_RULES, separated by
+// commas. If any are set they replace the built-in alert on category changes.
+func getAlertRules() ([]alertRule, error) {
+	raw := os.Getenv("GAS_ALERT_RULES")
+	if raw == "" {
+		return nil, nil
+	}
+
+	var rules []alertRule
+	for _, text := range strings.Split(raw, ",") {
+		rule, err := parseAlertRule(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while parsing GAS_ALERT_RULES rule %q", strings.TrimSpace(text))
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func parseAlertRule(text string) (alertRule, error) {
+	parts := strings.SplitN(text, "->", 2)
+	rule := alertRule{text: strings.TrimSpace(parts[0])}
+	if rule.text == "" {
+		return alertRule{}, errors.New("expected at least one condition")
+	}
+
+	for _, raw := range strings.Split(rule.text, " and ") {
+		c, err := parseRuleCondition(raw)
+		if err != nil {
+			return alertRule{}, err
+		}
+
+		rule.conditions = append(rule.conditions, c)
+	}
+
+	if len(parts) == 2 {
+		for _, name := range strings.Split(parts[1], "|") {
+			if name = strings.TrimSpace(name); name != "" {
+				rule.notifiers = append(rule.notifiers, name)
+			}
+		}
+		if len(rule.notifiers) == 0 {
+			return alertRule{}, errors.New("expected notifiers after ->")
+		}
+	}
+
+	return rule, nil
+}
+
+func parseRuleCondition(raw string) (ruleCondition, error) {
+	fields := strings.Fields(raw)
+	if len(fields) < 3 {
+		return ruleCondition{}, errors.Errorf("invalid condition %q, expected field, operator and value", raw)
+	}
+
+	c := ruleCondition{field: fields[0], op: fields[1]}
+	value := strings.Join(fields[2:], " ")
+
+	switch {
+	case numericRuleFields[c.field]:
+		switch c.op {
+		case "<", "<=", ">", ">=", "=", "!=":
+		default:
+			return ruleCondition{}, errors.Errorf("invalid operator %q for %s", c.op, c.field)
+		}
+
+		num, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return ruleCondition{}, errors.Errorf("invalid %s %q, expected a number", c.field, value)
+		}
+		c.num = num
+
+	case setRuleFields[c.field]:
+		switch c.op {
+		case "=", "in", "!=":
+		default:
+			return ruleCondition{}, errors.Errorf("invalid operator %q for %s, expected =, in or !=", c.op, c.field)
+		}
+
+		for _, v := range strings.Split(value, "|") {
+			v, err := normaliseRuleValue(c.field, strings.TrimSpace(v))
+			if err != nil {
+				return ruleCondition{}, err
+			}
+
+			c.values = append(c.values, v)
+		}
+
+	default:
+		return ruleCondition{}, errors.Errorf(
+			"unknown field %q, expected price, hour, category, previous, trend or weekday", c.field,
+		)
+	}
+
+	return c, nil
+}
+
+// normaliseRuleValue checks a value of a non-numeric field, returning it in
+// the form it is matched in.
+func normaliseRuleValue(field, value string) (string, error) {
+	switch field {
+	case "category", "previous":
+		category, err := prices.ParsePriceCategory(value)
+		if err != nil {
+			return "", errors.Errorf("invalid category %q", value)
+		}
+		return category.String(), nil
+
+	case "trend":
+		for _, d := range trendDirections {
+			if strings.EqualFold(value, d) {
+				return d, nil
+			}
+		}
+		return "", errors.Errorf("invalid trend %q, expected one of %s", value, strings.Join(trendDirections, ", "))
+
+	default:
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(value, d.String()) || strings.EqualFold(value, d.String()[:3]) {
+				return d.String(), nil
+			}
+		}
+		return "", errors.Errorf("invalid weekday %q", value)
+	}
+}
+
+func (c *ruleCondition) matches(s *ruleSample) bool {
+	switch c.field {
+	case "price":
+		return c.compare(float64(s.price))
+
+	case "hour":
+		return c.compare(float64(s.hour))
+
+	case "category":
+		return c.matchesValue(s.category)
+
+	case "previous":
+		return c.matchesValue(s.previous)
+
+	case "trend":
+		return c.matchesValue(s.trend)
+
+	default:
+		return c.matchesValue(s.weekday)
+	}
+}
+
+func (c *ruleCondition) compare(x float64) bool {
+	switch c.op {
+	case "<":
+		return x < c.num
+	case "<=":
+		return x <= c.num
+	case ">":
+		return x > c.num
+	case ">=":
+		return x >= c.num
+	case "=":
+		return x == c.num
+	default:
+		return x != c.num
+	}
+}
+
+func (c *ruleCondition) matchesValue(v string) bool {
+	found := false
+	for _, want := range c.values {
+		if v == want {
+			found = true
+			break
+		}
+	}
+
+	return found != (c.op == "!=")
+}
+
+func (r *alertRule) matches(s *ruleSample) bool {
+	for i := range r.conditions {
+		if !r.conditions[i].matches(s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkRuleNotifiers returns an error if a rule targets a channel that is not
+// configured.
+func checkRuleNotifiers(rules []alertRule, notifiers []notifier) error {
+	for i := range rules {
+		for _, name := range rules[i].notifiers {
+			if findNotifier(notifiers, name) == nil {
+				return errors.Errorf("GAS_ALERT_RULES rule %q refers to unconfigured channel %q", rules[i].text, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyRules replaces the category change alerts found by findAlerts with an
+// alert for each rule that fires for the current price. It returns alerts
+// unchanged if no rules are configured.
+func applyRules(
+	alerts []alert,
+	rules []alertRule,
+	current *prices.GasPriceData,
+	gasPrices []prices.GasPriceData,
+	stats *prices.PriceStats,
+	bands prices.Bands,
+	sustainedSamples int,
+	trendSamples int,
+) []alert {
+	if len(rules) == 0 {
+		return alerts
+	}
+
+	var applied []alert
+	for i := range alerts {
+		if alerts[i].Kind != categoryChangeAlert {
+			applied = append(applied, alerts[i])
+		}
+	}
+
+	recent := mostRecentFirst(current, gasPrices)
+	samples := make(map[time.Time]*ruleSample)
+	sampleOf := func(p *prices.GasPriceData) *ruleSample {
+		if s, ok := samples[p.Timestamp]; ok {
+			return s
+		}
+
+		s := newRuleSample(recent, p, trendSamples)
+		samples[p.Timestamp] = s
+		return s
+	}
+
+	sev := severityFor(current.Price, stats, bands)
+	for i := range rules {
+		rule := &rules[i]
+		holds := func(p *prices.GasPriceData) bool { return rule.matches(sampleOf(p)) }
+
+		if sustained(recent, sustainedSamples, holds) {
+			applied = append(applied, alert{
+				Kind:             ruleAlert,
+				Severity:         sev,
+				Rule:             rule.text,
+				Notifiers:        rule.notifiers,
+				NewCategory:      current.Category,
+				PreviousCategory: recent[1].Category,
+				Price:            current.Price,
+				Timestamp:        current.Timestamp,
+				Context:          stats.Context,
+				TypicalPrice:     stats.Mean,
+			})
+		}
+	}
+
+	return applied
+}
+
+// newRuleSample describes p, one of the recent prices ordered newest first,
+// with its trend calculated over the prices before it.
+func newRuleSample(recent []prices.GasPriceData, p *prices.GasPriceData, trendSamples int) *ruleSample {
+	s := ruleSample{
+		price:    p.Price,
+		hour:     p.Timestamp.UTC().Hour(),
+		category: p.Category.String(),
+		weekday:  p.Timestamp.UTC().Weekday().String(),
+	}
+
+	for i := range recent {
+		if !recent[i].Timestamp.Equal(p.Timestamp) {
+			continue
+		}
+
+		older := recent[i+1:]
+		if len(older) > 0 {
+			s.previous = older[0].Category.String()
+		}
+		if t := findTrend(p, older, trendSamples); t != nil {
+			s.trend = t.Direction
+		}
+		break
+	}
+
+	return &s
+}
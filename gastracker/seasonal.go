@@ -0,0 +1,114 @@
+package gastracker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+// minSeasonalSamples is the fewest stored prices from the same period that a
+// seasonal baseline is calculated from. With fewer, e.g. shortly after the
+// tracker is first deployed, the baseline over all prices is used instead.
+const minSeasonalSamples = 3
+
+// seasonalStats returns the stats of the stored prices in the same period as
+// the given time, or nil if there are too few of them.
+func seasonalStats(
+	gasPrices []prices.GasPriceData, context string, samePeriod func(time.Time) bool,
+) *prices.PriceStats {
+	var matching []prices.GasPriceData
+	for i := range gasPrices {
+		if samePeriod(gasPrices[i].Timestamp) {
+			matching = append(matching, gasPrices[i])
+		}
+	}
+
+	if len(matching) < minSeasonalSamples {
+		return nil
+	}
+
+	mean := prices.Mean(matching)
+
+	return &prices.PriceStats{
+		Mean:    mean,
+		Stddev:  prices.StdDev(matching, mean),
+		Samples: len(matching),
+		Context: context,
+	}
+}
+
+// hourOfDayStats returns the stats of the stored prices from the same UTC hour
+// of day as the given time, or nil if there are too few of them.
+func hourOfDayStats(gasPrices []prices.GasPriceData, at time.Time) *prices.PriceStats {
+	hour := at.UTC().Hour()
+
+	return seasonalStats(gasPrices, fmt.Sprintf("%02d:00 UTC", hour), func(t time.Time) bool {
+		return t.UTC().Hour() == hour
+	})
+}
+
+// dayOfWeekStats returns the stats of the stored prices from weekends if the
+// given time is at a weekend, or from weekdays otherwise. It returns nil if
+// there are too few of them.
+func dayOfWeekStats(gasPrices []prices.GasPriceData, at time.Time) *prices.PriceStats {
+	weekend := isWeekend(at)
+
+	return seasonalStats(gasPrices, "a "+at.UTC().Weekday().String(), func(t time.Time) bool {
+		return isWeekend(t) == weekend
+	})
+}
+
+// isWeekend returns true if the time is on a Saturday or Sunday in UTC.
+func isWeekend(t time.Time) bool {
+	day := t.UTC().Weekday()
+	return day == time.Saturday || day == time.Sunday
+}
+
+// aggregateDayStats returns the stats of the prices from weekends if the given
+// time is at a weekend, or from weekdays otherwise, or nil if there are too few
+// of them.
+func aggregateDayStats(agg *prices.Aggregates, at time.Time) *prices.PriceStats {
+	days := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	if isWeekend(at) {
+		days = []time.Weekday{time.Saturday, time.Sunday}
+	}
+
+	stats := agg.DayStats(days...)
+	if stats == nil || stats.Samples < minSeasonalSamples {
+		return nil
+	}
+	stats.Context = "a " + at.UTC().Weekday().String()
+
+	return stats
+}
+
+// getSeasonalStats returns the stats for a seasonal baseline, or nil if the
+// baseline is not seasonal or there are too few prices to calculate it from,
+// including fewer than minSamples, so that the window stats are used rather
+// than every price being Average. Both are calculated from the running
+// aggregates.
+func getSeasonalStats(kind baselineKind, agg *prices.Aggregates, at time.Time, minSamples int) *prices.PriceStats {
+	var stats *prices.PriceStats
+
+	switch kind {
+	case hourlyBaseline:
+		stats = aggregateHourStats(agg, at)
+
+	case dayOfWeekBaseline:
+		stats = aggregateDayStats(agg, at)
+
+	default:
+		return nil
+	}
+
+	if stats != nil && stats.Samples < minSamples {
+		stats = nil
+	}
+	if stats == nil {
+		log.Warn().Str("baseline", string(kind)).Msg("too few prices for baseline, using all prices")
+	}
+
+	return stats
+}
@@ -0,0 +1,137 @@
+package gastracker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/api"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/grpcapi"
+	"github.com/ryanc414/gas-tracker/webui"
+	"google.golang.org/grpc"
+)
+
+// serveShutdownTimeout is how long serve waits for in-flight requests to
+// finish when shutting down.
+const serveShutdownTimeout = 30 * time.Second
+
+// ServeOptions configures the price APIs.
+type ServeOptions struct {
+	// Addr is the address the HTTP API listens on, e.g. ":8080".
+	Addr string
+	// GRPCAddr is the address the gRPC API listens on, or empty to disable
+	// it.
+	GRPCAddr string
+	// PollInterval is how often the gRPC API checks for new prices to stream.
+	PollInterval time.Duration
+	// MaxFetchAge is how long after the last stored price /healthz starts
+	// failing.
+	MaxFetchAge time.Duration
+}
+
+// DefaultServeOptions serves the HTTP API on port 8080, and not the gRPC API.
+// Since the tracker runs hourly, /healthz fails once two runs have been
+// missed.
+var DefaultServeOptions = ServeOptions{Addr: ":8080", PollInterval: time.Minute, MaxFetchAge: 2 * time.Hour}
+
+// runServe serves the price APIs until either fails, or until ctx is done,
+// when it stops accepting connections and waits up to serveShutdownTimeout
+// for in-flight requests to finish.
+func runServe(ctx context.Context, opts ServeOptions) error {
+	if opts.GRPCAddr != "" && opts.PollInterval <= 0 {
+		return errors.Errorf("poll interval must be positive, got %v", opts.PollInterval)
+	}
+	if opts.MaxFetchAge <= 0 {
+		return errors.Errorf("max fetch age must be positive, got %v", opts.MaxFetchAge)
+	}
+
+	decision, err := getDecisionInputs()
+	if err != nil {
+		return err
+	}
+
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return err
+	}
+	svc := dynamodb.New(sess)
+
+	errs := make(chan error, 2)
+
+	var grpcServer *grpc.Server
+	var grpcAPI *grpcapi.Server
+	if opts.GRPCAddr != "" {
+		lis, err := net.Listen("tcp", opts.GRPCAddr)
+		if err != nil {
+			return errors.Wrap(err, "while listening for gRPC")
+		}
+
+		grpcServer = grpc.NewServer()
+		grpcAPI = grpcapi.NewServer(svc, opts.PollInterval)
+		grpcapi.RegisterGasTrackerServer(grpcServer, grpcAPI)
+
+		log.Info().Str("addr", opts.GRPCAddr).Msg("serving gRPC API")
+		go func() { errs <- errors.Wrap(grpcServer.Serve(lis), "while serving gRPC") }()
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", api.NewHandler(svc))
+	mux.Handle(webui.Path, webui.Handler())
+	mux.Handle(decisionPath, &decisionHandler{svc: svc, in: decision})
+	newHealthHandler(svc, opts.MaxFetchAge).register(mux)
+	if ingest := newIngestHandler(svc); ingest != nil {
+		mux.Handle(ingestPath, ingest)
+		log.Info().Str("path", ingestPath).Msg("accepting samples from external collectors")
+	}
+	if slack := newSlackHandler(svc); slack != nil {
+		mux.Handle(slackPath, slack)
+		log.Info().Str("path", slackPath).Msg("serving Slack app")
+	}
+	if unsubscribe := newUnsubscribeHandler(svc); unsubscribe != nil {
+		mux.Handle(unsubscribePath, unsubscribe)
+		log.Info().Str("path", unsubscribePath).Msg("serving unsubscribe links")
+	}
+	httpServer := http.Server{Addr: opts.Addr, Handler: mux}
+
+	log.Info().Str("addr", opts.Addr).Str("dashboard", webui.Path).Msg("serving price API")
+	go func() { errs <- httpServer.ListenAndServe() }()
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		log.Info().Msg("shutting down")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+
+	if grpcServer != nil {
+		grpcAPI.Shutdown()
+		stopGRPC(shutdownCtx, grpcServer)
+	}
+	if shutdownErr := httpServer.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+		err = errors.Wrap(shutdownErr, "while shutting down price API")
+	}
+
+	return err
+}
+
+// stopGRPC stops s gracefully, or forcibly once ctx is done.
+func stopGRPC(ctx context.Context, s *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.Stop()
+	}
+}
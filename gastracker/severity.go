@@ -0,0 +1,108 @@
+package gastracker
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+type severity string
+
+const (
+	severityInfo   severity = "info"
+	severityNotice severity = "notice"
+	severityUrgent severity = "urgent"
+)
+
+// Severity is derived from how many standard deviations the price is beyond
+// the band that the High or Low category starts at.
+const (
+	noticeBeyondBand = 0.5
+	urgentBeyondBand = 1.5
+)
+
+var severities = []severity{severityInfo, severityNotice, severityUrgent}
+
+// rank orders severities from info, the lowest, to urgent.
+func (s severity) rank() int {
+	for i := range severities {
+		if severities[i] == s {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// severityFor returns the severity of an alert for the given price.
+func severityFor(price int, stats *prices.PriceStats, bands prices.Bands) severity {
+	z := stats.ZScore(price, bands.MinStddev)
+
+	var beyondBand float64
+	if z > 0 {
+		beyondBand = z - bands.HighEnter
+	} else {
+		beyondBand = -z - bands.LowEnter
+	}
+
+	switch {
+	case beyondBand >= urgentBeyondBand:
+		return severityUrgent
+
+	case beyondBand >= noticeBeyondBand:
+		return severityNotice
+
+	default:
+		return severityInfo
+	}
+}
+
+// routes maps each severity to the names of the channels that alerts of that
+// severity are sent to. Severities without a route are sent to every channel.
+type routes map[severity][]string
+
+// getRoutes reads the channels for each severity from the environment, e.g.
+// GAS_ROUTE_URGENT="webpush,email".
+func getRoutes(notifiers []notifier) (routes, error) {
+	r := make(routes)
+
+	for _, sev := range severities {
+		envVar := "GAS_ROUTE_" + strings.ToUpper(string(sev))
+		raw := os.Getenv(envVar)
+		if raw == "" {
+			continue
+		}
+
+		var channels []string
+		for _, channel := range strings.Split(raw, ",") {
+			channel = strings.TrimSpace(channel)
+			if findNotifier(notifiers, channel) == nil {
+				return nil, errors.Errorf("%s refers to unconfigured channel %q", envVar, channel)
+			}
+
+			channels = append(channels, channel)
+		}
+
+		r[sev] = channels
+	}
+
+	return r, nil
+}
+
+// allows returns true if alerts of a severity should be sent to a channel.
+func (r routes) allows(sev severity, channel string) bool {
+	channels, ok := r[sev]
+	if !ok {
+		return true
+	}
+
+	for _, c := range channels {
+		if c == channel {
+			return true
+		}
+	}
+
+	return false
+}
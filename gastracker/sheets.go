@@ -0,0 +1,192 @@
+package gastracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/display"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const (
+	sheetsAPIURL       = "https://sheets.googleapis.com/v4/spreadsheets"
+	sheetsTimeout      = 30 * time.Second
+	sheetsStateID      = "sheets"
+	defaultSheetName   = "Sheet1"
+	sheetsTimeLayout   = "2006-01-02 15:04"
+	sheetsDateLayout   = "2006-01-02"
+	sheetsSampleMode   = "sample"
+	sheetsDailyMode    = "daily"
+	sheetsValueOptions = "valueInputOption=USER_ENTERED&insertDataOption=INSERT_ROWS"
+)
+
+// sheetsWriter appends the prices to a Google Sheet, for people who would
+// rather follow them in a spreadsheet. Either each sample is appended as a
+// row of time, price, category and ETH price, or each day is appended once
+// it is over as a row of date, samples, and minimum, mean and maximum price.
+type sheetsWriter struct {
+	client        *http.Client
+	tokens        *oauthTokenSource
+	svc           *dynamodb.DynamoDB
+	spreadsheetID string
+	sheet         string
+	daily         bool
+}
+
+// sheetsState records the last day appended in daily mode.
+type sheetsState struct {
+	LastDay string `dynamodbav:"lastDay"`
+}
+
+// newSheetsWriter constructs a Sheets writer from the environment. It returns
+// nil if no spreadsheet is configured.
+func newSheetsWriter(svc *dynamodb.DynamoDB) (*sheetsWriter, error) {
+	spreadsheetID := os.Getenv("GAS_SHEETS_SPREADSHEET_ID")
+	if spreadsheetID == "" {
+		return nil, nil
+	}
+
+	var daily bool
+	switch mode := os.Getenv("GAS_SHEETS_MODE"); mode {
+	case "", sheetsSampleMode:
+
+	case sheetsDailyMode:
+		daily = true
+
+	default:
+		return nil, errors.Errorf("GAS_SHEETS_MODE must be sample or daily, got %q", mode)
+	}
+
+	for _, envVar := range []string{
+		"GAS_SHEETS_OAUTH_CLIENT_ID", "GAS_SHEETS_OAUTH_CLIENT_SECRET", "GAS_SHEETS_OAUTH_REFRESH_TOKEN",
+	} {
+		if os.Getenv(envVar) == "" {
+			return nil, errors.Errorf("%s not set", envVar)
+		}
+	}
+
+	sheet := os.Getenv("GAS_SHEETS_SHEET")
+	if sheet == "" {
+		sheet = defaultSheetName
+	}
+
+	return &sheetsWriter{
+		client: &http.Client{Timeout: sheetsTimeout},
+		tokens: newGoogleTokenSource(
+			os.Getenv("GAS_SHEETS_OAUTH_CLIENT_ID"),
+			os.Getenv("GAS_SHEETS_OAUTH_CLIENT_SECRET"),
+			os.Getenv("GAS_SHEETS_OAUTH_REFRESH_TOKEN"),
+		),
+		svc:           svc,
+		spreadsheetID: spreadsheetID,
+		sheet:         sheet,
+		daily:         daily,
+	}, nil
+}
+
+// writeSample appends a sample, or in daily mode the previous day once the
+// sample is the first of a new day.
+func (w *sheetsWriter) writeSample(ctx context.Context, s *sampleContext) error {
+	if !w.daily {
+		p := s.current
+		return w.appendRows(ctx, [][]interface{}{{
+			display.In(p.Timestamp).Format(sheetsTimeLayout), p.Price, p.Category.String(), p.EthUSD,
+		}})
+	}
+
+	var state sheetsState
+	if _, err := store.ReadState(w.svc, sheetsStateID, &state); err != nil {
+		return errors.Wrap(err, "while reading Sheets state")
+	}
+
+	day := display.In(s.current.Timestamp).Format(sheetsDateLayout)
+	if day == state.LastDay {
+		return nil
+	}
+
+	// The first day seen is usually partial, so it is not appended.
+	if state.LastDay != "" {
+		row, ok := dailyRollup(s.gasPrices, state.LastDay)
+		if ok {
+			if err := w.appendRows(ctx, [][]interface{}{row}); err != nil {
+				return err
+			}
+		} else {
+			log.Info().Str("day", state.LastDay).Msg("no prices stored for the day, not appending it to Sheets")
+		}
+	}
+
+	state.LastDay = day
+	return errors.Wrap(store.WriteState(w.svc, sheetsStateID, &state), "while writing Sheets state")
+}
+
+// dailyRollup returns the row for the prices sampled on a day in the display
+// timezone, or false if there are none.
+func dailyRollup(gasPrices []prices.GasPriceData, day string) ([]interface{}, bool) {
+	var count, sum, min, max int
+	for i := range gasPrices {
+		p := &gasPrices[i]
+		if display.In(p.Timestamp).Format(sheetsDateLayout) != day {
+			continue
+		}
+
+		if count == 0 || p.Price < min {
+			min = p.Price
+		}
+		if p.Price > max {
+			max = p.Price
+		}
+		sum += p.Price
+		count++
+	}
+
+	if count == 0 {
+		return nil, false
+	}
+
+	mean := math.Round(float64(sum)/float64(count)*10) / 10
+
+	return []interface{}{day, count, min, mean, max}, true
+}
+
+// appendRows appends rows after the last row of the sheet's table.
+func (w *sheetsWriter) appendRows(ctx context.Context, rows [][]interface{}) error {
+	token, err := w.tokens.token(ctx)
+	if err != nil {
+		return errors.Wrap(err, "while getting Google access token")
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"values": rows})
+	if err != nil {
+		return errors.Wrap(err, "while marshalling rows")
+	}
+
+	u := sheetsAPIURL + "/" + url.PathEscape(w.spreadsheetID) +
+		"/values/" + url.PathEscape(w.sheet) + ":append?" + sheetsValueOptions
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "while constructing http request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rsp, err := w.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "while making http request")
+	}
+
+	defer rsp.Body.Close()
+
+	return responseError(rsp)
+}
@@ -0,0 +1,121 @@
+package gastracker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ryanc414/gas-tracker/display"
+)
+
+// The prefixes of the values of the buttons on Slack alerts, followed by the
+// snooze duration or the key of the alert to acknowledge.
+const (
+	slackSnoozeAction = "snooze:"
+	slackAckAction    = "ack:"
+)
+
+// slackNotifier posts alerts to a Slack channel via an incoming webhook,
+// formatted with Block Kit. If the Slack app's interactivity is pointed at
+// the tracker's /slack endpoint, alerts have buttons to acknowledge them or to
+// snooze alerts.
+type slackNotifier struct {
+	client     *http.Client
+	webhookURL string
+}
+
+// newSlackNotifier constructs a Slack notifier from the environment. It
+// returns nil if no webhook URL is configured.
+func newSlackNotifier() *slackNotifier {
+	webhookURL := os.Getenv("GAS_SLACK_WEBHOOK_URL")
+	if webhookURL == "" {
+		return nil
+	}
+
+	return &slackNotifier{
+		client:     &http.Client{Timeout: webhookTimeout},
+		webhookURL: webhookURL,
+	}
+}
+
+// slackMessage is a message posted to Slack. ResponseType is only set when
+// replying to a command or interaction: ephemeral to only show it to the user,
+// or in_channel to show it to everyone.
+type slackMessage struct {
+	Text         string       `json:"text"`
+	Blocks       []slackBlock `json:"blocks,omitempty"`
+	ResponseType string       `json:"response_type,omitempty"`
+}
+
+type slackBlock struct {
+	Type     string         `json:"type"`
+	Text     *slackText     `json:"text,omitempty"`
+	Fields   []slackText    `json:"fields,omitempty"`
+	Elements []slackElement `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackElement struct {
+	Type     string     `json:"type"`
+	Text     *slackText `json:"text,omitempty"`
+	ActionID string     `json:"action_id,omitempty"`
+	Value    string     `json:"value,omitempty"`
+}
+
+func (n *slackNotifier) name() string {
+	return "slack"
+}
+
+func (n *slackNotifier) notify(ctx context.Context, a *alert) error {
+	return postJSON(ctx, n.client, n.webhookURL, slackAlertMessage(a))
+}
+
+// slackAlertMessage formats an alert with buttons to acknowledge it and to
+// snooze alerts.
+func slackAlertMessage(a *alert) *slackMessage {
+	fields := []slackText{
+		{Type: "mrkdwn", Text: fmt.Sprintf("*Medium gas*\n%d gwei", a.Price)},
+		{Type: "mrkdwn", Text: "*Category*\n" + a.NewCategory.String()},
+		{Type: "mrkdwn", Text: "*Time*\n" + display.In(a.Timestamp).Format(time.RFC1123)},
+	}
+	if r := a.Details.Rank; r != nil {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: "*Rank*\n" + r.String()})
+	}
+
+	msg := slackMessage{
+		Text: a.subject(),
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: a.subject()}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: a.summary()}},
+			{Type: "section", Fields: fields},
+		},
+	}
+
+	actions := slackBlock{Type: "actions"}
+	actions.Elements = append(actions.Elements, slackButton("Acknowledge", "ack", slackAckAction+a.key()))
+	for _, d := range snoozeDurations {
+		hours := int(d.Hours())
+		actions.Elements = append(
+			actions.Elements,
+			slackButton(fmt.Sprintf("Snooze %dh", hours), fmt.Sprintf("snooze_%dh", hours), slackSnoozeAction+d.String()),
+		)
+	}
+	msg.Blocks = append(msg.Blocks, actions)
+
+	return &msg
+}
+
+func slackButton(label, actionID, value string) slackElement {
+	return slackElement{
+		Type:     "button",
+		Text:     &slackText{Type: "plain_text", Text: label},
+		ActionID: actionID,
+		Value:    value,
+	}
+}
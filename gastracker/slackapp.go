@@ -0,0 +1,276 @@
+package gastracker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/display"
+	"github.com/ryanc414/gas-tracker/snooze"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const (
+	// slackPath is the Slack app's slash command and interactivity URL.
+	slackPath = "/slack"
+	// maxSlackBody bounds the size of a request from Slack.
+	maxSlackBody = 1 << 20
+	// maxSlackSkew is how old a request from Slack may be, to stop a
+	// captured request being replayed later.
+	maxSlackSkew = 5 * time.Minute
+	// maxSlackSnooze is the longest alerts can be snoozed for from Slack.
+	maxSlackSnooze = 7 * 24 * time.Hour
+
+	slackUsage       = "Usage: `/gas` for the current price, or `/gas snooze 6h` to snooze alerts"
+	slackApplyFailed = "Something went wrong, please try again"
+)
+
+// slackHandler serves a Slack app: the /gas slash command, which shows the
+// current price or snoozes alerts, and the buttons on Slack alerts. Every
+// request is verified with the app's signing secret.
+type slackHandler struct {
+	svc           *dynamodb.DynamoDB
+	signingSecret []byte
+	client        *http.Client
+}
+
+// slackInteraction is the payload of a button being clicked.
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+}
+
+// SlackHandler returns a handler for a Slack app's requests to /slack, signed
+// with the app's signing secret.
+func SlackHandler(svc *dynamodb.DynamoDB, signingSecret string) http.Handler {
+	return &slackHandler{
+		svc:           svc,
+		signingSecret: []byte(signingSecret),
+		client:        &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// newSlackHandler constructs the Slack app handler from the environment. It
+// returns nil if GAS_SLACK_SIGNING_SECRET is not set.
+func newSlackHandler(svc *dynamodb.DynamoDB) http.Handler {
+	secret := os.Getenv("GAS_SLACK_SIGNING_SECRET")
+	if secret == "" {
+		return nil
+	}
+
+	return SlackHandler(svc, secret)
+}
+
+func (h *slackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != slackPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSlackBody))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := h.verify(r.Header, body, clock.Now()); err != nil {
+		log.Warn().Err(err).Msg("rejected Slack request")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case form.Get("payload") != "":
+		h.interaction(w, r, form.Get("payload"))
+
+	case form.Get("command") != "":
+		h.command(w, form.Get("text"))
+
+	default:
+		http.Error(w, "expected a slash command or an interaction", http.StatusBadRequest)
+	}
+}
+
+// verify checks a request's signature, which is the HMAC-SHA256 of its
+// timestamp and body with the signing secret, see
+// https://api.slack.com/authentication/verifying-requests-from-slack.
+func (h *slackHandler) verify(header http.Header, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(header.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid request timestamp")
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > maxSlackSkew || skew < -maxSlackSkew {
+		return errors.Errorf("request timestamp is %v from now", skew.Round(time.Second))
+	}
+
+	mac := hmac.New(sha256.New, h.signingSecret)
+	fmt.Fprintf(mac, "v0:%d:%s", ts, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(header.Get("X-Slack-Signature")), []byte(expected)) {
+		return errors.New("signature does not match")
+	}
+
+	return nil
+}
+
+// command answers the /gas slash command, visible only to the user who ran
+// it.
+func (h *slackHandler) command(w http.ResponseWriter, text string) {
+	fields := strings.Fields(text)
+
+	var reply string
+	switch {
+	case len(fields) == 0:
+		reply = h.currentPrice()
+
+	case fields[0] == "snooze" && len(fields) == 2:
+		d, err := time.ParseDuration(fields[1])
+		if err != nil || d <= 0 || d > maxSlackSnooze {
+			reply = fmt.Sprintf("Invalid duration %q, expected e.g. 30m or 6h, up to %v", fields[1], maxSlackSnooze)
+			break
+		}
+
+		s, err := h.apply(&snooze.Token{Action: snooze.Snooze, Scope: snooze.AllAlerts, Duration: d})
+		if err != nil {
+			reply = slackApplyFailed
+			break
+		}
+		reply = "Gas alerts snoozed until " + slackUntil(s)
+
+	default:
+		reply = slackUsage
+	}
+
+	respondSlack(w, &slackMessage{Text: reply, ResponseType: "ephemeral"})
+}
+
+// currentPrice describes the latest stored price.
+func (h *slackHandler) currentPrice() string {
+	latest, err := store.ReadLatest(h.svc)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read latest gas price")
+		return "Failed to read the current gas price, please try again"
+	}
+	if latest == nil {
+		return "No gas prices have been sampled yet"
+	}
+
+	return fmt.Sprintf(
+		"*%d gwei* (%s) at %s",
+		latest.Price, latest.Category, display.In(latest.Timestamp).Format("15:04 MST"),
+	)
+}
+
+// interaction handles a button on an alert being clicked, replying in the
+// channel so that everyone can see that the alert was dealt with.
+func (h *slackHandler) interaction(w http.ResponseWriter, r *http.Request, payload string) {
+	var in slackInteraction
+	if err := json.Unmarshal([]byte(payload), &in); err != nil || in.Type != "block_actions" || len(in.Actions) == 0 {
+		http.Error(w, "expected a block action", http.StatusBadRequest)
+		return
+	}
+
+	value := in.Actions[0].Value
+	var token *snooze.Token
+	switch {
+	case strings.HasPrefix(value, slackSnoozeAction):
+		d, err := time.ParseDuration(strings.TrimPrefix(value, slackSnoozeAction))
+		if err != nil || d <= 0 || d > maxSlackSnooze {
+			http.Error(w, "invalid snooze duration", http.StatusBadRequest)
+			return
+		}
+		token = &snooze.Token{Action: snooze.Snooze, Scope: snooze.AllAlerts, Duration: d}
+
+	case strings.HasPrefix(value, slackAckAction):
+		token = &snooze.Token{
+			Action:   snooze.Acknowledge,
+			Scope:    strings.TrimPrefix(value, slackAckAction),
+			Duration: ackDuration,
+		}
+
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	reply := slackMessage{ResponseType: "in_channel"}
+	if s, err := h.apply(token); err != nil {
+		reply = slackMessage{Text: slackApplyFailed, ResponseType: "ephemeral"}
+	} else if s.Action == snooze.Acknowledge {
+		reply.Text = fmt.Sprintf("<@%s> acknowledged the alert, repeats are silenced until %s", in.User.ID, slackUntil(s))
+	} else {
+		reply.Text = fmt.Sprintf("<@%s> snoozed gas alerts until %s", in.User.ID, slackUntil(s))
+	}
+
+	// Slack only needs the request answered, the reply is posted to the
+	// response URL.
+	if in.ResponseURL != "" {
+		if err := postJSON(r.Context(), h.client, in.ResponseURL, &reply); err != nil {
+			log.Error().Err(err).Msg("failed to reply to Slack interaction")
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// apply stores a snooze or acknowledgement.
+func (h *slackHandler) apply(t *snooze.Token) (*snooze.Suppression, error) {
+	s, err := snooze.Apply(h.svc, t, clock.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to apply action")
+		return nil, err
+	}
+
+	log.Info().Str("action", string(s.Action)).Str("scope", s.Scope).Time("until", s.Until).Msg("applied action from Slack")
+
+	return s, nil
+}
+
+func slackUntil(s *snooze.Suppression) string {
+	return display.In(s.Until).Format("Mon 2 Jan 15:04 MST")
+}
+
+func respondSlack(w http.ResponseWriter, msg *slackMessage) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal Slack response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		log.Error().Err(err).Msg("failed to write response")
+	}
+}
@@ -0,0 +1,220 @@
+package gastracker
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const smtpDialTimeout = 30 * time.Second
+
+// smtpTLSMode controls how the connection to the SMTP server is encrypted.
+type smtpTLSMode string
+
+const (
+	// tlsStartTLS connects in plaintext and upgrades using STARTTLS.
+	tlsStartTLS smtpTLSMode = "starttls"
+	// tlsImplicit connects over TLS from the start, usually on port 465.
+	tlsImplicit smtpTLSMode = "tls"
+	// tlsNone never encrypts the connection, for use with local relays.
+	tlsNone smtpTLSMode = "none"
+)
+
+// smtpAuthMechanism selects how to authenticate with the SMTP server.
+type smtpAuthMechanism string
+
+const (
+	authPlain   smtpAuthMechanism = "plain"
+	authLogin   smtpAuthMechanism = "login"
+	authXOAuth2 smtpAuthMechanism = "xoauth2"
+	authNone    smtpAuthMechanism = "none"
+)
+
+type smtpConfig struct {
+	host    string
+	port    int
+	tlsMode smtpTLSMode
+	auth    smtpAuthMechanism
+}
+
+// getSMTPConfig reads the SMTP transport configuration. By default, this is
+// Gmail over STARTTLS, authenticating with OAuth2 if a refresh token is
+// configured or a password otherwise.
+func getSMTPConfig(hasOAuth bool) (smtpConfig, error) {
+	cfg := smtpConfig{
+		host:    os.Getenv("GAS_NOTIFIER_SMTP_HOST"),
+		tlsMode: smtpTLSMode(strings.ToLower(os.Getenv("GAS_NOTIFIER_SMTP_TLS"))),
+		auth:    smtpAuthMechanism(strings.ToLower(os.Getenv("GAS_NOTIFIER_SMTP_AUTH"))),
+	}
+
+	if cfg.host == "" {
+		cfg.host = "smtp.gmail.com"
+	}
+
+	switch cfg.tlsMode {
+	case "":
+		cfg.tlsMode = tlsStartTLS
+
+	case tlsStartTLS, tlsImplicit, tlsNone:
+
+	default:
+		return smtpConfig{}, errors.Errorf(
+			"GAS_NOTIFIER_SMTP_TLS must be one of starttls, tls or none, got %q", cfg.tlsMode,
+		)
+	}
+
+	switch cfg.auth {
+	case "":
+		if hasOAuth {
+			cfg.auth = authXOAuth2
+		} else {
+			cfg.auth = authPlain
+		}
+
+	case authPlain, authLogin, authXOAuth2, authNone:
+
+	default:
+		return smtpConfig{}, errors.Errorf(
+			"GAS_NOTIFIER_SMTP_AUTH must be one of plain, login, xoauth2 or none, got %q", cfg.auth,
+		)
+	}
+
+	port := os.Getenv("GAS_NOTIFIER_SMTP_PORT")
+	if port == "" {
+		cfg.port = defaultSMTPPort(cfg.tlsMode)
+		return cfg, nil
+	}
+
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 || p > 65535 {
+		return smtpConfig{}, errors.Errorf("invalid GAS_NOTIFIER_SMTP_PORT %q", port)
+	}
+	cfg.port = p
+
+	return cfg, nil
+}
+
+func defaultSMTPPort(mode smtpTLSMode) int {
+	switch mode {
+	case tlsImplicit:
+		return 465
+
+	case tlsNone:
+		return 25
+
+	default:
+		return 587
+	}
+}
+
+func (c *smtpConfig) addr() string {
+	return net.JoinHostPort(c.host, strconv.Itoa(c.port))
+}
+
+// sendMail sends a message over SMTP, using the configured TLS mode. Unlike
+// smtp.SendMail, it supports implicit TLS and unencrypted connections.
+func sendMail(
+	ctx context.Context, cfg *smtpConfig, auth smtp.Auth, from string, to []string, msg []byte,
+) error {
+	conn, err := dialSMTP(ctx, cfg)
+	if err != nil {
+		return errors.Wrapf(err, "while connecting to %s", cfg.addr())
+	}
+
+	c, err := smtp.NewClient(conn, cfg.host)
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "while starting SMTP session")
+	}
+
+	defer c.Close()
+
+	if cfg.tlsMode == tlsStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.Errorf("%s does not support STARTTLS", cfg.host)
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: cfg.host}); err != nil {
+			return errors.Wrap(err, "while starting TLS")
+		}
+	}
+
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.Errorf("%s does not support authentication", cfg.host)
+		}
+		if err := c.Auth(auth); err != nil {
+			return errors.Wrap(err, "while authenticating")
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return errors.Wrapf(err, "while adding recipient %s", addr)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+func dialSMTP(ctx context.Context, cfg *smtpConfig) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: smtpDialTimeout}
+
+	if cfg.tlsMode == tlsImplicit {
+		return tls.DialWithDialer(&dialer, "tcp", cfg.addr(), &tls.Config{ServerName: cfg.host})
+	}
+
+	return dialer.DialContext(ctx, "tcp", cfg.addr())
+}
+
+// loginAuth implements the non-standard LOGIN authentication mechanism,
+// which is required by some servers such as Office 365.
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("refusing to send password over unencrypted connection")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+
+	case "password:":
+		return []byte(a.password), nil
+
+	default:
+		return nil, errors.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
@@ -0,0 +1,27 @@
+package gastracker
+
+import (
+	"os"
+
+	"github.com/ryanc414/gas-tracker/sources"
+)
+
+const defaultSource = "etherscan"
+
+// getSource constructs the price source named by GAS_SOURCE, Etherscan by
+// default, returning its name too. GAS_SOURCE may name several sources,
+// separated by commas, which are fetched from in parallel and combined. See
+// sources.Register for adding sources.
+func getSource() (sources.Source, string, error) {
+	name := os.Getenv("GAS_SOURCE")
+	if name == "" {
+		name = defaultSource
+	}
+
+	source, err := sources.NewFromNames(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return source, name, nil
+}
@@ -0,0 +1,123 @@
+package gastracker
+
+import (
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const (
+	defaultSpikeWindow = 24
+	// minSpikeMAD stops a perfectly flat recent history, with a median
+	// absolute deviation of 0, from treating any increase as a spike.
+	minSpikeMAD = 1.0
+)
+
+// spike describes how far a price jumped above the recent median.
+type spike struct {
+	Median float64 `dynamodbav:"median"`
+	MAD    float64 `dynamodbav:"mad"`
+}
+
+// spikeConfig configures spike detection. A price is a spike if it is more
+// than multiplier median absolute deviations (MAD) above the median of the
+// previous window samples.
+type spikeConfig struct {
+	multiplier float64
+	window     int
+}
+
+// getSpikeConfig reads the spike detection config from the environment.
+// Spike detection is disabled unless GAS_SPIKE_MAD_MULTIPLIER is set.
+func getSpikeConfig() (spikeConfig, error) {
+	cfg := spikeConfig{window: defaultSpikeWindow}
+
+	if raw := os.Getenv("GAS_SPIKE_MAD_MULTIPLIER"); raw != "" {
+		multiplier, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return spikeConfig{}, errors.Wrapf(err, "while parsing GAS_SPIKE_MAD_MULTIPLIER %q", raw)
+		}
+		if multiplier <= 0 {
+			return spikeConfig{}, errors.Errorf("GAS_SPIKE_MAD_MULTIPLIER must be positive, got %v", multiplier)
+		}
+
+		cfg.multiplier = multiplier
+	}
+
+	if raw := os.Getenv("GAS_SPIKE_WINDOW"); raw != "" {
+		window, err := strconv.Atoi(raw)
+		if err != nil {
+			return spikeConfig{}, errors.Wrapf(err, "while parsing GAS_SPIKE_WINDOW %q", raw)
+		}
+		if window < 3 {
+			return spikeConfig{}, errors.Errorf("GAS_SPIKE_WINDOW must be at least 3, got %d", window)
+		}
+
+		cfg.window = window
+	}
+
+	return cfg, nil
+}
+
+// findSpike returns a spike alert if the current price has jumped above the
+// spike limit since the previous sample, or nil otherwise. Unlike category
+// changes, spikes are not required to be sustained.
+func findSpike(
+	current *prices.GasPriceData,
+	gasPrices []prices.GasPriceData,
+	stats *prices.PriceStats,
+	bands prices.Bands,
+	cfg spikeConfig,
+) *alert {
+	if cfg.multiplier == 0 {
+		return nil
+	}
+
+	recent := mostRecentFirst(current, gasPrices)
+	if len(recent) <= cfg.window {
+		return nil
+	}
+
+	window := make([]float64, cfg.window)
+	for i := range window {
+		window[i] = float64(recent[i+1].Price)
+	}
+
+	median := medianOf(window)
+
+	deviations := make([]float64, len(window))
+	for i := range window {
+		deviations[i] = math.Abs(window[i] - median)
+	}
+	mad := math.Max(medianOf(deviations), minSpikeMAD)
+
+	limit := median + cfg.multiplier*mad
+	if float64(current.Price) <= limit || float64(recent[1].Price) > limit {
+		return nil
+	}
+
+	return &alert{
+		Kind:        spikeAlert,
+		Severity:    severityFor(current.Price, stats, bands),
+		NewCategory: current.Category,
+		Price:       current.Price,
+		Spike:       &spike{Median: median, MAD: mad},
+		Timestamp:   current.Timestamp,
+	}
+}
+
+// medianOf returns the median of the values, reordering them in place.
+func medianOf(values []float64) float64 {
+	sort.Float64s(values)
+
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+
+	return values[mid]
+}
@@ -0,0 +1,104 @@
+package gastracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+func TestFindSpike(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	stats := &prices.PriceStats{Mean: 10, Stddev: 5, Samples: 100}
+	cfg := spikeConfig{multiplier: 3, window: 5}
+
+	// history returns prices sampled a minute apart before now, most recent
+	// first.
+	history := func(gwei ...int) []prices.GasPriceData {
+		gasPrices := make([]prices.GasPriceData, len(gwei))
+		for i := range gwei {
+			gasPrices[i] = prices.GasPriceData{Price: gwei[i], Timestamp: now.Add(-time.Duration(i+1) * time.Minute)}
+		}
+		return gasPrices
+	}
+
+	tests := []struct {
+		name      string
+		price     int
+		gasPrices []prices.GasPriceData
+		cfg       spikeConfig
+		want      *spike
+	}{
+		{
+			name:      "above the limit",
+			price:     14,
+			gasPrices: history(10, 11, 10, 12, 10, 50),
+			cfg:       cfg,
+			want:      &spike{Median: 10, MAD: 1},
+		},
+		{
+			name:      "at the limit",
+			price:     13,
+			gasPrices: history(10, 11, 10, 12, 10, 50),
+			cfg:       cfg,
+		},
+		{
+			name:      "uses the MAD of the window",
+			price:     51,
+			gasPrices: history(10, 20, 30, 20, 10, 20),
+			cfg:       cfg,
+			want:      &spike{Median: 20, MAD: 10},
+		},
+		{
+			name:      "below the MAD of the window",
+			price:     50,
+			gasPrices: history(10, 20, 30, 20, 10, 20),
+			cfg:       cfg,
+		},
+		{
+			name:      "previous sample already above the limit",
+			price:     30,
+			gasPrices: history(20, 10, 11, 10, 12, 10),
+			cfg:       cfg,
+		},
+		{
+			name:      "window not yet full",
+			price:     100,
+			gasPrices: history(10, 10, 10, 10),
+			cfg:       cfg,
+		},
+		{
+			name:      "disabled",
+			price:     100,
+			gasPrices: history(10, 10, 10, 10, 10, 10),
+			cfg:       spikeConfig{window: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := &prices.GasPriceData{Price: tt.price, Timestamp: now}
+
+			// The stored prices are not necessarily ordered.
+			gasPrices := append([]prices.GasPriceData(nil), tt.gasPrices...)
+			for i, j := 0, len(gasPrices)-1; i < j; i, j = i+1, j-1 {
+				gasPrices[i], gasPrices[j] = gasPrices[j], gasPrices[i]
+			}
+
+			a := findSpike(current, gasPrices, stats, prices.DefaultBands, tt.cfg)
+			if tt.want == nil {
+				if a != nil {
+					t.Errorf("findSpike() = %+v, want nil", a.Spike)
+				}
+				return
+			}
+
+			if a == nil {
+				t.Fatal("findSpike() = nil, want a spike")
+			}
+			if a.Kind != spikeAlert || a.Price != tt.price || *a.Spike != *tt.want {
+				t.Errorf("findSpike() = %s %d %+v, want spike %d %+v", a.Kind, a.Price, a.Spike, tt.price, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package gastracker
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/clock"
+)
+
+// The stages of a run, for orchestrating it with e.g. Step Functions so that
+// each stage is retried separately: Fetch samples the price, Analyse
+// categorises and stores the Sample it returns, and NotifyStored sends the
+// alerts for the RunSummary that Analyse returns, which decodes as a
+// NotifyRequest.
+
+// Fetch samples the current price from the configured source, without storing
+// it.
+func Fetch(ctx context.Context) (*Sample, error) {
+	var sample *Sample
+
+	err := withConfig(func() error {
+		timeout, err := getRunTimeout()
+		if err != nil {
+			return err
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		source, sourceName, err := getSource()
+		if err != nil {
+			return err
+		}
+
+		gas, err := source.MediumGas(ctx)
+		if err != nil {
+			return errors.Wrap(err, "while getting current gas price")
+		}
+
+		ethUSD, err := source.ETHPrice(ctx)
+		if err != nil {
+			log.Warn().Err(err).Str("source", sourceName).Msg("failed to get ETH price")
+		}
+
+		sample = &Sample{Price: gas, EthUSD: ethUSD, Timestamp: clock.Now()}
+		log.Info().Int("price", gas).Str("source", sourceName).Msg("fetched medium gas price")
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sample, nil
+}
+
+// Analyse categorises and stores a fetched sample, leaving its alerts to
+// NotifyStored. Retrying it after the sample was stored stores nothing more.
+func Analyse(ctx context.Context, sample Sample) (*RunSummary, error) {
+	if sample.Timestamp.IsZero() {
+		return nil, errors.New("a sample timestamp is required")
+	}
+
+	return runTraced(ctx, "finished analysing sample", func(ctx context.Context, summary *RunSummary) error {
+		return run(ctx, RunOptions{Sample: &sample, storeOnly: true}, summary)
+	})
+}
@@ -0,0 +1,117 @@
+package gastracker
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const defaultStatsdPrefix = "gas_tracker."
+
+// statsd emits metrics to StatsD, or is nil if it is not configured.
+var statsd *statsdClient
+
+// statsdClient sends metrics over UDP in the DogStatsD format, i.e. StatsD
+// with tags, which Datadog agents, Telegraf and the Prometheus statsd_exporter
+// all accept. Sending is best effort: a metric that cannot be sent is logged
+// and dropped.
+type statsdClient struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+}
+
+// initStatsd connects to the StatsD server at GAS_STATSD_ADDR, e.g.
+// "localhost:8125", if set, prefixing metric names with GAS_STATSD_PREFIX,
+// "gas_tracker." by default, and tagging every metric with the comma
+// separated GAS_STATSD_TAGS, e.g. "env:prod,team:infra". It is a no-op after
+// the first call.
+func initStatsd() error {
+	if statsd != nil {
+		return nil
+	}
+
+	c, err := newStatsdClient()
+	if err != nil {
+		return err
+	}
+
+	statsd = c
+	return nil
+}
+
+// newStatsdClient constructs a StatsD client from the environment. It returns
+// nil if no address is configured.
+func newStatsdClient() (*statsdClient, error) {
+	addr := os.Getenv("GAS_STATSD_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, errors.Wrapf(err, "while parsing GAS_STATSD_ADDR %q", addr)
+	}
+
+	prefix, ok := os.LookupEnv("GAS_STATSD_PREFIX")
+	if !ok {
+		prefix = defaultStatsdPrefix
+	}
+
+	var tags []string
+	for _, tag := range strings.Split(os.Getenv("GAS_STATSD_TAGS"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	// Dialling UDP only resolves the address, so it fails fast if the host
+	// is unknown but not if nothing is listening.
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while connecting to StatsD at %s", addr)
+	}
+
+	return &statsdClient{conn: conn, prefix: prefix, tags: tags}, nil
+}
+
+// gauge records the current value of a metric.
+func (c *statsdClient) gauge(name string, value float64, tags ...string) {
+	c.send(name, fmt.Sprintf("%g", value), "g", tags)
+}
+
+// count adds to a counter.
+func (c *statsdClient) count(name string, value int, tags ...string) {
+	c.send(name, fmt.Sprintf("%d", value), "c", tags)
+}
+
+// timing records how long something took, in milliseconds.
+func (c *statsdClient) timing(name string, d time.Duration, tags ...string) {
+	c.send(name, fmt.Sprintf("%d", d.Milliseconds()), "ms", tags)
+}
+
+func (c *statsdClient) send(name, value, kind string, tags []string) {
+	if c == nil {
+		return
+	}
+
+	msg := c.prefix + name + ":" + value + "|" + kind
+	if all := append(c.tags[:len(c.tags):len(c.tags)], tags...); len(all) > 0 {
+		msg += "|#" + strings.Join(all, ",")
+	}
+
+	if _, err := c.conn.Write([]byte(msg)); err != nil {
+		log.Warn().Err(err).Str("metric", name).Msg("failed to send metric to StatsD")
+	}
+}
+
+// statsdTag formats a tag, replacing characters that DogStatsD does not
+// allow in tags, e.g. "category:very_low".
+func statsdTag(key, value string) string {
+	value = strings.ToLower(strings.NewReplacer(" ", "_", ",", "_", "|", "_").Replace(value))
+	return key + ":" + value
+}
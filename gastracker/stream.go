@@ -0,0 +1,111 @@
+package gastracker
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+// NotifyStored finds and sends the alerts for the stored price sampled at,
+// as the tracker does when it samples a price itself. It is run by the
+// consumer of the gas price table's stream when GAS_NOTIFY_FROM_STREAM is set,
+// or by the notifier function when GAS_NOTIFIER_FUNCTION is, so that a failure
+// to notify is retried without sampling again.
+//
+// Only the latest stored price is alerted on, so that backfilled prices and
+// retries that have been overtaken by a newer sample send nothing.
+func NotifyStored(ctx context.Context, at time.Time) (*RunSummary, error) {
+	return runTraced(ctx, "finished notifying of stored price", func(ctx context.Context, summary *RunSummary) error {
+		return notifyStored(ctx, at, summary)
+	})
+}
+
+func notifyStored(ctx context.Context, at time.Time, summary *RunSummary) error {
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return err
+	}
+	svc := dynamodb.New(sess)
+
+	cfg, err := loadRunConfig()
+	if err != nil {
+		return err
+	}
+
+	ch, err := loadChannels(svc, cfg.rules, false)
+	if err != nil {
+		return err
+	}
+	defer ch.close()
+
+	window := runWindow(cfg)
+	recent, agg, err := loadStoredPrices(svc, window, at)
+	if err != nil {
+		return err
+	}
+
+	latest := prices.Latest(recent)
+	if latest == nil || !latest.Timestamp.Equal(at) {
+		log.Info().Time("timestamp", at).Msg("not notifying of stored price that is not the latest")
+		return retryStoredDeadLetters(ctx, svc, ch, summary, nil)
+	}
+
+	// The price is categorised against the prices before it, as it was when
+	// it was sampled.
+	gasPrices := windowOf(recent[:len(recent)-1], window, at)
+
+	// The persisted aggregates and EWMA already include the price, so it is
+	// removed from the aggregates, and the EWMA is recalculated from the
+	// prices before it.
+	agg.Remove(latest)
+	var ewma *prices.EWMA
+	if cfg.baseline.kind == ewmaBaseline {
+		ewma = replayEWMA(gasPrices, cfg.baseline.halfLife)
+	}
+
+	stats, windowStats, err := baselineStats(ctx, cfg, agg, gasPrices, ewma, at)
+	if err != nil {
+		return err
+	}
+
+	sample := sampleContext{
+		current:     latest,
+		gasPrices:   gasPrices,
+		agg:         agg,
+		stats:       stats,
+		windowStats: windowStats,
+	}
+	sample.summarise(summary)
+
+	alerts, details, err := findRunAlerts(svc, cfg, &sample, RunOptions{})
+	if err != nil {
+		return err
+	}
+	summary.Alerts = len(alerts)
+
+	err = ch.notify(ctx, svc, cfg, &sample, alerts, details)
+	if uerr := ch.sendUpdates(ctx, sess, cfg, &sample); err == nil {
+		err = uerr
+	}
+
+	return retryStoredDeadLetters(ctx, svc, ch, summary, err)
+}
+
+// retryStoredDeadLetters retries the alerts that earlier runs failed to
+// deliver, last as run does, so that failing notifiers cannot stop the stored
+// price's alerts and updates being sent. It returns err if set, otherwise any
+// error from retrying.
+func retryStoredDeadLetters(ctx context.Context, svc *dynamodb.DynamoDB, ch *channels, summary *RunSummary, err error) error {
+	if rerr := retryDeadLetters(ctx, svc, ch.retryNotifiers(), clock.Now()); err == nil && rerr != nil {
+		err = errors.Wrap(rerr, "while retrying undelivered alerts")
+	}
+	summary.NotificationsSent = ch.alerter.sent
+
+	return err
+}
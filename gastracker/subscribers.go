@@ -0,0 +1,317 @@
+package gastracker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/subscribers"
+)
+
+// trackedChain is the chain whose gas prices this tracker samples.
+const trackedChain = "ethereum"
+
+// notifySubscribers evaluates every active subscriber's categories,
+// thresholds and rules against the current price, and notifies them over
+// their own channels. The alerts for each channel are batched, so that a
+// channel that several subscribers share, or that several of a subscriber's
+// alerts are for, is sent a single digest. Each digest is sent by the
+// alerter, so that it is snoozed, cooled down and retried when it cannot be
+// delivered as the operator's alerts are. Failures to notify one channel do
+// not affect the others. It returns the notifier of every subscriber
+// channel, for retrying undelivered alerts.
+func notifySubscribers(
+	ctx context.Context,
+	svc *dynamodb.DynamoDB,
+	al *alerter,
+	email *emailNotifier,
+	cfg *runConfig,
+	s *sampleContext,
+	details alertDetails,
+) ([]notifier, error) {
+	subs, err := subscribers.ReadActive(svc)
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading subscribers")
+	}
+
+	unsubscribe, err := newUnsubscribeLinker()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Int("subscribers", len(subs)).Msg("evaluating subscriber alerts")
+
+	var batches []*channelBatch
+	var notifiers []notifier
+	byAddress := make(map[string]*channelBatch)
+
+	for i := range subs {
+		sub := &subs[i]
+		if !sub.Tracks(trackedChain) {
+			continue
+		}
+
+		channels, err := subscriberChannels(sub, email, unsubscribe)
+		if err != nil {
+			log.Warn().Err(err).Str("subscriber", sub.ID).Msg("skipping subscriber")
+			continue
+		}
+
+		rules, err := subscriberRules(sub)
+		if err != nil {
+			log.Warn().Err(err).Str("subscriber", sub.ID).Msg("skipping subscriber")
+			continue
+		}
+
+		alerts := findAlerts(
+			s.current, s.gasPrices, s.stats, cfg.bands, subscriberThresholds(sub), cfg.sustainedSamples,
+		)
+		alerts = applyRules(
+			alerts, rules, s.current, s.gasPrices, s.stats, cfg.bands, cfg.sustainedSamples, cfg.trendSamples,
+		)
+
+		for j := range channels {
+			b, ok := byAddress[channels[j].address]
+			if !ok {
+				b = &channelBatch{notifier: channels[j].notifier, keys: make(map[string]bool)}
+				byAddress[channels[j].address] = b
+				batches = append(batches, b)
+				notifiers = append(notifiers, b.notifier)
+			}
+
+			b.add(&channels[j], sub.ID, alerts)
+		}
+	}
+
+	for _, b := range batches {
+		if len(b.alerts) == 0 {
+			continue
+		}
+
+		a := b.alert(details)
+		if err := al.handleSubscriberAlert(ctx, b.notifier, &a); err != nil {
+			log.Error().
+				Err(err).
+				Str("channel", b.notifier.name()).
+				Strs("subscribers", b.subscribers).
+				Str("alert", a.key()).
+				Msg("failed to notify subscribers")
+		}
+	}
+
+	return notifiers, nil
+}
+
+// subscriberNotifier is the notifier of a subscriber channel, named for the
+// address it delivers to, so that its cooldowns and undelivered alerts are
+// kept per channel. The address is hashed, since it may be a secret webhook
+// URL.
+type subscriberNotifier struct {
+	notifier
+	id string
+}
+
+func newSubscriberNotifier(kind, address string, n notifier) *subscriberNotifier {
+	sum := sha256.Sum256([]byte(address))
+	return &subscriberNotifier{notifier: n, id: kind + "/" + hex.EncodeToString(sum[:8])}
+}
+
+func (n *subscriberNotifier) name() string {
+	return "subscriber/" + n.id
+}
+
+// subscriberChannel is one of a subscriber's channels.
+type subscriberChannel struct {
+	// address identifies where the channel delivers to, e.g. an email
+	// address, so that subscribers sharing it are sent one batch.
+	address string
+	// kind is the kind of channel, "email" or "teams", which rules target.
+	kind       string
+	notifier   notifier
+	categories []prices.PriceCategory
+}
+
+// wants returns true if an alert should be sent over the channel: category
+// change alerts must be for a wanted category, and rule alerts that target
+// channels must target this one.
+func (c *subscriberChannel) wants(a *alert) bool {
+	if a.Kind == categoryChangeAlert && !wantsCategory(c.categories, a.NewCategory) {
+		return false
+	}
+
+	if len(a.Notifiers) == 0 {
+		return true
+	}
+	for _, name := range a.Notifiers {
+		if name == c.kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// channelBatch is the alerts to send to an address that one or more
+// subscribers' channels deliver to, and the subscribers they are sent on
+// behalf of. Each subscriber's alerts are filtered by their own channel, so
+// the batch only keeps the notifier of the first.
+type channelBatch struct {
+	notifier    notifier
+	subscribers []string
+	alerts      []alert
+	// keys is the keys of the alerts, so that an alert that several
+	// subscribers sharing the channel want is only sent once.
+	keys map[string]bool
+}
+
+// add adds the alerts that a subscriber's channel to the batch's address wants.
+func (b *channelBatch) add(channel *subscriberChannel, id string, alerts []alert) {
+	added := false
+	for i := range alerts {
+		if !channel.wants(&alerts[i]) {
+			continue
+		}
+
+		added = true
+		if key := alerts[i].key(); !b.keys[key] {
+			b.keys[key] = true
+			b.alerts = append(b.alerts, alerts[i])
+		}
+	}
+
+	if added {
+		b.subscribers = append(b.subscribers, id)
+	}
+}
+
+// alert returns the batch's alert with the details set, which is a digest
+// of them if there is more than one.
+func (b *channelBatch) alert(details alertDetails) alert {
+	if len(b.alerts) == 1 {
+		a := b.alerts[0]
+		a.Details = details
+		return a
+	}
+
+	digest := alert{
+		Kind:        digestAlert,
+		NewCategory: b.alerts[0].NewCategory,
+		Price:       b.alerts[0].Price,
+		Timestamp:   b.alerts[0].Timestamp,
+		Details:     details,
+		Batch:       b.alerts,
+	}
+	// The digest is as severe as the most severe alert in it.
+	for i := range b.alerts {
+		if b.alerts[i].Severity.rank() > digest.Severity.rank() {
+			digest.Severity = b.alerts[i].Severity
+		}
+	}
+
+	return digest
+}
+
+// subscriberChannels constructs the channels a subscriber is notified over.
+// Emails include an unsubscribe link if they are configured.
+func subscriberChannels(
+	sub *subscribers.Subscriber, email *emailNotifier, unsubscribe *unsubscribeLinker,
+) ([]subscriberChannel, error) {
+	categories, err := sub.PriceCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	var channels []subscriberChannel
+
+	if sub.Email != "" {
+		if email == nil {
+			return nil, errors.New("email is not configured, set GAS_NOTIFIER_FROM")
+		}
+
+		// The channel filters by category, so the recipient wants every
+		// alert that reaches it.
+		unsubscribeURL, err := unsubscribe.link(sub.Email)
+		if err != nil {
+			return nil, errors.Wrap(err, "while generating unsubscribe link")
+		}
+		subEmail := email.withRecipients([]recipient{{addr: sub.Email}}).withUnsubscribe(unsubscribeURL)
+		address := strings.ToLower(sub.Email)
+		channels = append(channels, subscriberChannel{
+			address:    "email/" + address,
+			kind:       "email",
+			notifier:   newSubscriberNotifier("email", address, newRetryingNotifier(subEmail)),
+			categories: categories,
+		})
+	}
+
+	if sub.TeamsWebhookURL != "" {
+		teams := teamsNotifier{
+			client:     &http.Client{Timeout: webhookTimeout},
+			webhookURL: sub.TeamsWebhookURL,
+		}
+		channels = append(channels, subscriberChannel{
+			address:    "teams/" + sub.TeamsWebhookURL,
+			kind:       "teams",
+			notifier:   newSubscriberNotifier("teams", sub.TeamsWebhookURL, newRetryingNotifier(&teams)),
+			categories: categories,
+		})
+	}
+
+	return channels, nil
+}
+
+// subscriberRules parses a subscriber's alert rules.
+func subscriberRules(sub *subscribers.Subscriber) ([]alertRule, error) {
+	rules := make([]alertRule, 0, len(sub.Rules))
+	for _, text := range sub.Rules {
+		rule, err := parseAlertRule(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while parsing rule %q", strings.TrimSpace(text))
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// CheckSubscriberRules returns an error if any of a subscriber's rules is
+// invalid, or targets a channel the subscriber does not have.
+func CheckSubscriberRules(sub *subscribers.Subscriber) error {
+	rules, err := subscriberRules(sub)
+	if err != nil {
+		return err
+	}
+
+	for i := range rules {
+		for _, name := range rules[i].notifiers {
+			switch {
+			case name == "email" && sub.Email != "":
+			case name == "teams" && sub.TeamsWebhookURL != "":
+			default:
+				return errors.Errorf("rule %q targets %q, which is not one of your channels", rules[i].text, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func subscriberThresholds(sub *subscribers.Subscriber) []threshold {
+	var thresholds []threshold
+
+	if sub.BelowGwei > 0 {
+		thresholds = append(thresholds, threshold{Direction: thresholdBelow, Gwei: sub.BelowGwei})
+	}
+	if sub.AboveGwei > 0 {
+		thresholds = append(thresholds, threshold{Direction: thresholdAbove, Gwei: sub.AboveGwei})
+	}
+
+	return thresholds
+}
@@ -0,0 +1,165 @@
+package gastracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/display"
+)
+
+const webhookTimeout = 30 * time.Second
+
+// teamsNotifier posts alerts to a Microsoft Teams channel via an incoming
+// webhook, formatted as an Adaptive Card.
+type teamsNotifier struct {
+	client     *http.Client
+	webhookURL string
+}
+
+// newTeamsNotifier constructs a Teams notifier from the environment. It
+// returns nil if no webhook URL is configured.
+func newTeamsNotifier() *teamsNotifier {
+	webhookURL := os.Getenv("GAS_TEAMS_WEBHOOK_URL")
+	if webhookURL == "" {
+		return nil
+	}
+
+	return &teamsNotifier{
+		client:     &http.Client{Timeout: webhookTimeout},
+		webhookURL: webhookURL,
+	}
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     adaptiveCard `json:"content"`
+}
+
+type adaptiveCard struct {
+	Schema  string               `json:"$schema"`
+	Type    string               `json:"type"`
+	Version string               `json:"version"`
+	Body    []adaptiveCardBlock  `json:"body"`
+	Actions []adaptiveCardAction `json:"actions,omitempty"`
+}
+
+type adaptiveCardAction struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+type adaptiveCardBlock struct {
+	Type   string             `json:"type"`
+	Text   string             `json:"text,omitempty"`
+	Size   string             `json:"size,omitempty"`
+	Weight string             `json:"weight,omitempty"`
+	Wrap   bool               `json:"wrap,omitempty"`
+	Facts  []adaptiveCardFact `json:"facts,omitempty"`
+}
+
+type adaptiveCardFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+func (n *teamsNotifier) name() string {
+	return "teams"
+}
+
+func (n *teamsNotifier) notify(ctx context.Context, a *alert) error {
+	facts := []adaptiveCardFact{
+		{Title: "Medium gas", Value: fmt.Sprintf("%d gwei", a.Price)},
+		{Title: "Category", Value: a.NewCategory.String()},
+		{Title: "Time", Value: display.In(a.Timestamp).Format(time.RFC1123)},
+	}
+	if r := a.Details.Rank; r != nil {
+		facts = append(facts, adaptiveCardFact{Title: "Rank", Value: r.String()})
+	}
+
+	msg := teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: adaptiveCard{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.2",
+				Body: []adaptiveCardBlock{
+					{
+						Type:   "TextBlock",
+						Text:   a.subject(),
+						Size:   "Medium",
+						Weight: "Bolder",
+					},
+					{
+						Type: "TextBlock",
+						Text: a.summary(),
+						Wrap: true,
+					},
+					{Type: "FactSet", Facts: facts},
+				},
+			},
+		}},
+	}
+
+	for _, l := range a.Links {
+		msg.Attachments[0].Content.Actions = append(
+			msg.Attachments[0].Content.Actions,
+			adaptiveCardAction{Type: "Action.OpenUrl", Title: l.Label, URL: l.URL},
+		)
+	}
+
+	return postJSON(ctx, n.client, n.webhookURL, &msg)
+}
+
+// postJSON posts a JSON-encoded payload to a webhook, returning an error if
+// the response status is not successful.
+func postJSON(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "while marshalling payload")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "while constructing http request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "while making http request")
+	}
+
+	defer rsp.Body.Close()
+
+	return responseError(rsp)
+}
+
+// responseError returns an error including the response body if the response
+// status is not successful.
+func responseError(rsp *http.Response) error {
+	if rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err == nil {
+		return errors.Errorf("response error: %s %s", rsp.Status, string(body))
+	}
+
+	return errors.Wrapf(err, "response error: %s", rsp.Status)
+}
@@ -0,0 +1,72 @@
+package gastracker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+type thresholdDirection string
+
+const (
+	thresholdBelow thresholdDirection = "below"
+	thresholdAbove thresholdDirection = "above"
+)
+
+// threshold is an absolute gas price, in gwei, that triggers an alert when the
+// price crosses it, independently of the statistical price categories.
+type threshold struct {
+	Direction thresholdDirection `dynamodbav:"direction"`
+	Gwei      int                `dynamodbav:"gwei"`
+}
+
+func (t *threshold) String() string {
+	return fmt.Sprintf("%s %d gwei", t.Direction, t.Gwei)
+}
+
+// exceeded returns true if the price is beyond the threshold.
+func (t *threshold) exceeded(price int) bool {
+	switch t.Direction {
+	case thresholdBelow:
+		return price < t.Gwei
+
+	case thresholdAbove:
+		return price > t.Gwei
+
+	default:
+		return false
+	}
+}
+
+// getThresholds reads the absolute price thresholds from the environment.
+// Either or both may be unset.
+func getThresholds() ([]threshold, error) {
+	var thresholds []threshold
+
+	for _, t := range []struct {
+		envVar    string
+		direction thresholdDirection
+	}{
+		{envVar: "GAS_ALERT_BELOW_GWEI", direction: thresholdBelow},
+		{envVar: "GAS_ALERT_ABOVE_GWEI", direction: thresholdAbove},
+	} {
+		raw := os.Getenv(t.envVar)
+		if raw == "" {
+			continue
+		}
+
+		gwei, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while parsing %s %q", t.envVar, raw)
+		}
+		if gwei <= 0 {
+			return nil, errors.Errorf("%s must be positive, got %d", t.envVar, gwei)
+		}
+
+		thresholds = append(thresholds, threshold{Direction: t.direction, Gwei: gwei})
+	}
+
+	return thresholds, nil
+}
@@ -0,0 +1,97 @@
+package gastracker
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "gas-tracker"
+
+var tracer = otel.Tracer("github.com/ryanc414/gas-tracker/gastracker")
+
+var (
+	// tracerProvider exports spans over OTLP, or is nil if tracing is not
+	// configured.
+	tracerProvider *sdktrace.TracerProvider
+	// coldStart is true until the first run in this process, which on
+	// Lambda is the first invocation after a cold start.
+	coldStart = true
+)
+
+// initTracing exports spans over OTLP/gRPC if OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set. The exporter reads the endpoint,
+// headers and other settings from the standard OTEL_ environment variables.
+// It is a no-op after the first call.
+func initTracing(ctx context.Context) error {
+	if tracerProvider != nil {
+		return nil
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil
+	}
+
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return errors.Wrap(err, "while constructing OTLP exporter")
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+		)),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	return nil
+}
+
+// flushTracing exports any buffered spans, since a Lambda may be frozen as
+// soon as the invocation returns.
+func flushTracing(ctx context.Context) {
+	if tracerProvider == nil {
+		return
+	}
+
+	if err := tracerProvider.ForceFlush(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to export spans")
+	}
+}
+
+// startRunSpan starts the root span of a run.
+func startRunSpan(ctx context.Context) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, "run", trace.WithAttributes(semconv.FaaSColdstartKey.Bool(coldStart)))
+	coldStart = false
+
+	return ctx, span
+}
+
+// endSpan ends a span, recording err if it is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// priceAttributes describe the sampled price on a span.
+func priceAttributes(price int, category string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("gas.price_gwei", price),
+		attribute.String("gas.category", category),
+	}
+}
@@ -0,0 +1,1064 @@
+package gastracker
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/charts"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/sources"
+	"github.com/ryanc414/gas-tracker/store"
+	"github.com/ryanc414/gas-tracker/version"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// windowStatsStateID is the ID of the stats over the stored window of
+	// prices, including the lowest and highest prices, as of the latest run.
+	windowStatsStateID = "windowStats"
+	// defaultRunTimeout bounds a run, so that a hung request cannot stall a
+	// scheduled run forever.
+	defaultRunTimeout = 5 * time.Minute
+	// summaryRecentPrices is how many recent prices a run's summary
+	// includes.
+	summaryRecentPrices = 48
+	// alertChartPeriod is how far back the chart attached to alert emails
+	// goes.
+	alertChartPeriod = 24 * time.Hour
+)
+
+// RunSummary describes a successful run, so that the Lambda response and
+// invocation logs carry machine-readable output.
+type RunSummary struct {
+	// Timestamp is when the price was sampled, which identifies it in the
+	// store.
+	Timestamp        time.Time `json:"timestamp"`
+	Price            int       `json:"price"`
+	Category         string    `json:"category"`
+	PreviousCategory string    `json:"previousCategory,omitempty"`
+	Mean             float64   `json:"mean"`
+	Stddev           float64   `json:"stddev"`
+	// Alerts is the number of alerts found, and NotificationsSent the number
+	// of notifications delivered for them, excluding those to subscribers.
+	Alerts            int `json:"alerts"`
+	NotificationsSent int `json:"notificationsSent"`
+	// Pruned is the number of stored prices deleted for being older than the
+	// retention.
+	Pruned int `json:"pruned"`
+	// AWSRetries is the number of requests to AWS, e.g. to DynamoDB, that
+	// were retried, of which AWSThrottled were retried for being throttled.
+	AWSRetries   int64        `json:"awsRetries"`
+	AWSThrottled int64        `json:"awsThrottled"`
+	DurationMS   int64        `json:"durationMs"`
+	Build        version.Info `json:"build"`
+	// Recent are the most recent prices, oldest first and ending with the
+	// sampled price, to chart the run's result in a terminal.
+	Recent []prices.GasPriceData `json:"-"`
+}
+
+// RunOptions override the configuration for a single run, e.g. from the
+// event that invoked the Lambda.
+type RunOptions struct {
+	// DryRun samples the price and finds any alerts, logging them rather
+	// than sending them, and stores nothing.
+	DryRun bool `json:"dryRun"`
+	// ForceNotify sends an alert of the current category even if it has not
+	// changed, and sends every alert even if it is snoozed or in cooldown.
+	ForceNotify bool `json:"forceNotify"`
+	// Chain, if set, is the chain to sample, which must be the one that the
+	// tracker samples, so that a schedule meant for another chain fails
+	// rather than sampling the wrong one.
+	Chain string `json:"chain"`
+	// Sample, if set, is processed instead of fetching the current price
+	// from the source.
+	Sample *Sample `json:"-"`
+	// Source, if set, is used instead of the configured source, e.g. a
+	// scripted source from package fakes.
+	Source sources.Source `json:"-"`
+	// RequestID, if set, identifies the invocation, e.g. by its Lambda
+	// request ID, so that a retry of an invocation whose price was stored
+	// stores nothing more.
+	RequestID string `json:"-"`
+
+	// storeOnly stores the price without sending its alerts, leaving them to
+	// a later stage.
+	storeOnly bool
+}
+
+// Run samples the current gas price once, sends any alerts and stores the
+// sample. It is run on a schedule, either as a Lambda or locally.
+func Run(ctx context.Context, opts RunOptions) (*RunSummary, error) {
+	return runTraced(ctx, "finished run", func(ctx context.Context, summary *RunSummary) error {
+		return run(ctx, opts, summary)
+	})
+}
+
+// runTraced runs f with the config loaded, in a traced run span, and logs the
+// summary it fills in if it succeeds.
+func runTraced(
+	ctx context.Context, msg string, f func(ctx context.Context, summary *RunSummary) error,
+) (*RunSummary, error) {
+	summary := RunSummary{Build: version.Get()}
+
+	err := withConfig(func() error {
+		timeout, err := getRunTimeout()
+		if err != nil {
+			return err
+		}
+
+		if err := initTracing(ctx); err != nil {
+			return err
+		}
+		defer flushTracing(ctx)
+
+		if err := initStatsd(); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		retriesBefore := awsconfig.Retries()
+		runCtx := ctx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			runCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		runCtx, span := startRunSpan(runCtx)
+		err = f(runCtx, &summary)
+		if err != nil && runCtx.Err() == context.DeadlineExceeded {
+			err = errors.Wrapf(err, "while running with a GAS_RUN_TIMEOUT of %v", timeout)
+		}
+		retried := awsconfig.Retries().Since(retriesBefore)
+		summary.AWSRetries, summary.AWSThrottled = retried.Retries, retried.Throttled
+		span.SetAttributes(
+			attribute.Int64("aws.retries", retried.Retries),
+			attribute.Int64("aws.throttled", retried.Throttled),
+		)
+		endSpan(span, err)
+		summary.DurationMS = time.Since(start).Milliseconds()
+
+		emitRunMetrics(&summary, err)
+		reportRunOutcome(ctx, err)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Int("price", summary.Price).
+		Str("category", summary.Category).
+		Str("previousCategory", summary.PreviousCategory).
+		Int("alerts", summary.Alerts).
+		Int("notificationsSent", summary.NotificationsSent).
+		Int("pruned", summary.Pruned).
+		Int64("awsRetries", summary.AWSRetries).
+		Int64("awsThrottled", summary.AWSThrottled).
+		Int64("durationMs", summary.DurationMS).
+		Stringer("build", summary.Build).
+		Msg(msg)
+
+	return &summary, nil
+}
+
+// getRunTimeout reads the longest a run may take from GAS_RUN_TIMEOUT, 5
+// minutes by default, or no limit if it is 0.
+func getRunTimeout() (time.Duration, error) {
+	raw := os.Getenv("GAS_RUN_TIMEOUT")
+	if raw == "" {
+		return defaultRunTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(raw)
+	if err != nil || timeout < 0 {
+		return 0, errors.Errorf("invalid GAS_RUN_TIMEOUT %q, expected a duration such as 5m, or 0 for no limit", raw)
+	}
+
+	return timeout, nil
+}
+
+// run samples the current gas price, filling in summary as it goes.
+func run(ctx context.Context, opts RunOptions, summary *RunSummary) error {
+	if opts.Chain != "" && opts.Chain != trackedChain {
+		return errors.Errorf("chain %q is not supported, the tracker samples %s", opts.Chain, trackedChain)
+	}
+
+	source, sourceName, err := getRunSource(opts)
+	if err != nil {
+		return err
+	}
+
+	sess, err := awsconfig.Session()
+	if err != nil {
+		return err
+	}
+
+	// Create DynamoDB client
+	svc := dynamodb.New(sess)
+
+	cfg, err := loadRunConfig()
+	if err != nil {
+		return err
+	}
+
+	metrics, err := newPriceMetrics(sess)
+	if err != nil {
+		return errors.Wrap(err, "while configuring CloudWatch metrics")
+	}
+
+	// When the stream consumer or the notifier function sends the alerts, the
+	// tracker only samples and stores prices, so it needs no notifiers.
+	fromStream := os.Getenv("GAS_NOTIFY_FROM_STREAM") == "true"
+	notifier := notifierFunction()
+
+	var ch *channels
+	if !fromStream && notifier == "" && !opts.storeOnly {
+		ch, err = loadChannels(svc, cfg.rules, opts.ForceNotify)
+		if err != nil {
+			return err
+		}
+		defer ch.close()
+	}
+
+	fetchStart := time.Now()
+	gas, err := source.MediumGas(ctx)
+	statsd.timing("fetch.latency", time.Since(fetchStart), statsdTag("source", sourceName))
+	if err != nil {
+		statsd.count("fetch.errors", 1, statsdTag("source", sourceName))
+		metrics.publishFetchError(ctx)
+
+		var rateLimit *sources.RateLimitError
+		if errors.As(err, &rateLimit) {
+			log.Warn().Str("source", sourceName).Msg("source is rate limiting requests, sample less often or share its API key less")
+		}
+		return errors.Wrap(err, "while getting current gas price")
+	}
+	log.Info().Int("price", gas).Str("source", sourceName).Msg("fetched medium gas price")
+
+	// The ETH price only adds context to alerts, so failing to get it
+	// should not stop them being sent.
+	ethUSD, err := source.ETHPrice(ctx)
+	if err != nil {
+		log.Warn().Err(err).Str("source", sourceName).Msg("failed to get ETH price")
+	}
+
+	// Only the prices within the run window of the sample are read, which
+	// the copy of the recent prices usually has.
+	at := clock.Now()
+	if opts.Sample != nil && !opts.Sample.Timestamp.IsZero() {
+		at = opts.Sample.Timestamp
+	}
+	window := runWindow(cfg)
+
+	_, span := tracer.Start(ctx, "store.ReadRecent")
+	recent, agg, err := loadStoredPrices(svc, window, at)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	gasPrices := windowOf(recent, window, at)
+
+	if stored := storedByRequest(gasPrices, opts.RequestID); stored != nil {
+		log.Info().Str("requestId", opts.RequestID).Time("timestamp", stored.Timestamp).Msg("price of this request already stored")
+		summary.Timestamp, summary.Price, summary.Category = stored.Timestamp, stored.Price, stored.Category.String()
+		return nil
+	}
+
+	// A retried analyse stage finds its sample already stored, and leaves it
+	// for the notify stage as before.
+	if latest := prices.Latest(gasPrices); opts.storeOnly && latest != nil && latest.Timestamp.Equal(opts.Sample.Timestamp) {
+		log.Info().Time("timestamp", latest.Timestamp).Msg("sample already stored")
+		summary.Timestamp, summary.Price, summary.Category = latest.Timestamp, latest.Price, latest.Category.String()
+		return nil
+	}
+
+	now, err := sampledAt(opts, gasPrices, clock.Now())
+	if err != nil {
+		return err
+	}
+
+	var ewma *prices.EWMA
+	if cfg.baseline.kind == ewmaBaseline {
+		ewma, err = loadEWMA(svc, gasPrices, cfg.baseline.halfLife)
+		if err != nil {
+			return err
+		}
+	}
+
+	stats, windowStats, err := baselineStats(ctx, cfg, agg, gasPrices, ewma, now)
+	if err != nil {
+		return err
+	}
+
+	if stats.Samples < cfg.bands.MinSamples {
+		log.Info().
+			Int("samples", stats.Samples).
+			Int("minSamples", cfg.bands.MinSamples).
+			Msg("too few prices to categorise against, treating price as average")
+	}
+
+	lastCategory := prices.LastCategory(gasPrices)
+	category := prices.CategorisePriceWithBands(gas, stats, lastCategory, cfg.bands)
+	log.Info().Int("price", gas).Stringer("category", category).Msg("categorised gas price")
+	trace.SpanFromContext(ctx).SetAttributes(priceAttributes(gas, category.String())...)
+
+	currGasPrice := prices.GasPriceData{
+		Price:     gas,
+		Timestamp: now,
+		Category:  category,
+		EthUSD:    ethUSD,
+		RequestID: opts.RequestID,
+	}
+
+	sample := sampleContext{
+		current:     &currGasPrice,
+		gasPrices:   gasPrices,
+		agg:         agg,
+		stats:       stats,
+		windowStats: windowStats,
+	}
+	sample.summarise(summary)
+
+	var alerts []alert
+	var details alertDetails
+	if ch != nil || opts.DryRun {
+		alerts, details, err = findRunAlerts(svc, cfg, &sample, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	summary.Alerts = len(alerts)
+	if opts.DryRun {
+		for i := range alerts {
+			log.Info().Str("alert", alerts[i].key()).Str("subject", alerts[i].subject()).Msg("dry run, not sending alert")
+		}
+		return nil
+	}
+
+	// The sample is stored before its alerts are sent, so that failing to
+	// send them cannot lose it.
+	_, span = tracer.Start(ctx, "store.Write")
+	pruned, err := updateGasPrices(svc, agg, recent, &currGasPrice, cfg.windows.retention)
+	summary.Pruned = len(pruned)
+	endSpan(span, err)
+	if err == store.ErrExists {
+		return errors.Errorf("a gas price sampled at %v was stored by another run", now)
+	}
+	if err != nil {
+		return errors.Wrap(err, "while writing gas prices")
+	}
+
+	if err := store.WriteLatest(svc, &currGasPrice); err != nil {
+		return errors.Wrap(err, "while writing latest gas price")
+	}
+
+	if err := saveAggregates(svc, agg, &currGasPrice, pruned); err != nil {
+		return err
+	}
+	saveRecentPrices(svc, recent, &currGasPrice, pruned)
+
+	if err := store.WriteState(svc, windowStatsStateID, windowStats); err != nil {
+		return errors.Wrap(err, "while writing window stats")
+	}
+
+	if ewma != nil {
+		if err := saveEWMA(svc, ewma, &currGasPrice, cfg.baseline.halfLife); err != nil {
+			return err
+		}
+	}
+
+	emitPriceMetrics(&currGasPrice, lastCategory)
+	metrics.publishPrice(ctx, &currGasPrice)
+
+	switch {
+	case opts.storeOnly:
+		log.Info().Msg("stored gas price, leaving alerts to the notify stage")
+		return nil
+	case notifier != "":
+		return dispatchNotify(ctx, sess, notifier, now)
+	case ch == nil:
+		log.Info().Msg("stored gas price, leaving alerts to the stream consumer")
+		return nil
+	}
+
+	err = ch.notify(ctx, svc, cfg, &sample, alerts, details)
+	if uerr := ch.sendUpdates(ctx, sess, cfg, &sample); err == nil {
+		err = uerr
+	}
+
+	// Alerts that earlier runs failed to deliver are retried last, so that
+	// slow or failing notifiers cannot stop this run's price being stored or
+	// its alerts being sent.
+	if rerr := retryDeadLetters(ctx, svc, ch.retryNotifiers(), now); err == nil && rerr != nil {
+		err = errors.Wrap(rerr, "while retrying undelivered alerts")
+	}
+	summary.NotificationsSent = ch.alerter.sent
+
+	return err
+}
+
+// emitPriceMetrics sends a stored price to StatsD, counting a transition if
+// its category differs from the previous one.
+func emitPriceMetrics(p *prices.GasPriceData, previous *prices.PriceCategory) {
+	category := statsdTag("category", p.Category.String())
+	statsd.gauge("price", float64(p.Price), category)
+	if p.EthUSD > 0 {
+		statsd.gauge("eth_usd", p.EthUSD)
+	}
+
+	if previous != nil && *previous != p.Category {
+		statsd.count(
+			"category.transitions", 1,
+			statsdTag("from", previous.String()), statsdTag("to", p.Category.String()),
+		)
+	}
+}
+
+// emitRunMetrics sends the outcome of a run to StatsD.
+func emitRunMetrics(summary *RunSummary, runErr error) {
+	outcome := "success"
+	if runErr != nil {
+		outcome = "failure"
+		statsd.count("errors", 1)
+	}
+
+	statsd.count("runs", 1, statsdTag("outcome", outcome))
+	statsd.timing("run.duration", time.Duration(summary.DurationMS)*time.Millisecond, statsdTag("outcome", outcome))
+	if summary.Alerts > 0 {
+		statsd.count("alerts", summary.Alerts)
+	}
+	if summary.NotificationsSent > 0 {
+		statsd.count("notifications.sent", summary.NotificationsSent)
+	}
+}
+
+// runConfig is the configuration of how prices are categorised and which
+// alerts are found for them.
+type runConfig struct {
+	bands                prices.Bands
+	thresholds           []threshold
+	sustainedSamples     int
+	baseline             baselineConfig
+	forecastHours        int
+	spikes               spikeConfig
+	trendSamples         int
+	volatility           volatilityConfig
+	correlationWindow    int
+	recommendWindowHours int
+	costPresets          []costPreset
+	reports              reportSchedule
+	windows              windowConfig
+	minCoverage          float64
+	warmup               time.Duration
+	rules                []alertRule
+}
+
+func loadRunConfig() (*runConfig, error) {
+	var cfg runConfig
+	var err error
+
+	if cfg.bands, err = getBands(); err != nil {
+		return nil, err
+	}
+	if cfg.thresholds, err = getThresholds(); err != nil {
+		return nil, err
+	}
+	if cfg.sustainedSamples, err = getSustainedSamples(); err != nil {
+		return nil, err
+	}
+	if cfg.baseline, err = getBaselineConfig(); err != nil {
+		return nil, err
+	}
+	if cfg.forecastHours, err = getForecastHours(); err != nil {
+		return nil, err
+	}
+	if cfg.spikes, err = getSpikeConfig(); err != nil {
+		return nil, err
+	}
+	if cfg.trendSamples, err = getTrendSamples(); err != nil {
+		return nil, err
+	}
+	if cfg.volatility, err = getVolatilityConfig(); err != nil {
+		return nil, err
+	}
+	if cfg.correlationWindow, err = getCorrelationWindow(); err != nil {
+		return nil, err
+	}
+	if cfg.recommendWindowHours, err = getRecommendWindowHours(); err != nil {
+		return nil, err
+	}
+	if cfg.costPresets, err = getCostPresets(); err != nil {
+		return nil, err
+	}
+	if cfg.reports, err = getReportSchedule(); err != nil {
+		return nil, err
+	}
+	if cfg.windows, err = getWindowConfig(); err != nil {
+		return nil, err
+	}
+	if cfg.minCoverage, err = getMinCoverage(); err != nil {
+		return nil, err
+	}
+	if cfg.warmup, err = getWarmup(); err != nil {
+		return nil, err
+	}
+	if cfg.rules, err = getAlertRules(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// channels are the configured notifiers that alerts and prices are sent to.
+type channels struct {
+	email       *emailNotifier
+	mqttPub     *mqttPublisher
+	remoteWrite *remoteWriter
+	sheets      *sheetsWriter
+	dashboard   dashboardConfig
+	subscribers bool
+	alerter     alerter
+	// subscriberNotifiers are the notifiers of the subscribers' channels,
+	// once they have been notified.
+	subscriberNotifiers []notifier
+}
+
+// retryNotifiers returns the notifiers that undelivered alerts can be retried
+// with: the configured notifiers, and those of the subscribers' channels.
+func (c *channels) retryNotifiers() []notifier {
+	notifiers := make([]notifier, 0, len(c.alerter.notifiers)+len(c.subscriberNotifiers))
+	notifiers = append(notifiers, c.alerter.notifiers...)
+	return append(notifiers, c.subscriberNotifiers...)
+}
+
+// loadChannels constructs the configured notifiers, returning an error if
+// there are none. The channels must be closed after use.
+func loadChannels(svc *dynamodb.DynamoDB, rules []alertRule, force bool) (ch *channels, err error) {
+	email, notifiers, mqttPub, err := loadNotifiers(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	sheets, err := newSheetsWriter(svc)
+	if err != nil {
+		if mqttPub != nil {
+			mqttPub.close()
+		}
+		return nil, errors.Wrap(err, "while configuring Google Sheets")
+	}
+
+	ch = &channels{
+		email:       email,
+		mqttPub:     mqttPub,
+		remoteWrite: newRemoteWriter(),
+		sheets:      sheets,
+		dashboard:   getDashboardConfig(),
+		subscribers: os.Getenv("GAS_SUBSCRIBERS_ENABLED") == "true",
+	}
+	defer func() {
+		if err != nil {
+			ch.close()
+		}
+	}()
+
+	outputs := ch.remoteWrite != nil || ch.sheets != nil || ch.dashboard.bucket != ""
+	if len(notifiers) == 0 && !ch.subscribers && !outputs {
+		return nil, errors.New(
+			"no notifiers configured: set GAS_NOTIFIER_TO, GAS_TEAMS_WEBHOOK_URL, " +
+				"GAS_WEBPUSH_VAPID_PRIVATE_KEY, GAS_MQTT_BROKER, GAS_DESKTOP_NOTIFICATIONS, " +
+				"GAS_SUBSCRIBERS_ENABLED, GAS_PROMETHEUS_REMOTE_WRITE_URL, GAS_SHEETS_SPREADSHEET_ID " +
+				"or GAS_DASHBOARD_BUCKET",
+		)
+	}
+
+	cooldown, err := getNotificationCooldown()
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := newLinker()
+	if err != nil {
+		return nil, errors.Wrap(err, "while configuring alert links")
+	}
+
+	severityRoutes, err := getRoutes(notifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkRuleNotifiers(rules, notifiers); err != nil {
+		return nil, err
+	}
+
+	ch.alerter = alerter{
+		svc:       svc,
+		notifiers: notifiers,
+		cooldown:  cooldown,
+		linker:    links,
+		routes:    severityRoutes,
+		force:     force,
+	}
+
+	return ch, nil
+}
+
+func (c *channels) close() {
+	if c.mqttPub != nil {
+		c.mqttPub.close()
+	}
+}
+
+// sampleContext is a sampled price along with the stored prices within the run
+// window before it, the aggregates of every stored price before it, and the
+// stats it was categorised against, from which its alerts are found.
+type sampleContext struct {
+	current     *prices.GasPriceData
+	gasPrices   []prices.GasPriceData
+	agg         *prices.Aggregates
+	stats       *prices.PriceStats
+	windowStats *prices.PriceStats
+}
+
+// withCurrent returns the stored prices including the current one.
+func (s *sampleContext) withCurrent() []prices.GasPriceData {
+	return append(s.gasPrices[:len(s.gasPrices):len(s.gasPrices)], *s.current)
+}
+
+func (s *sampleContext) summarise(summary *RunSummary) {
+	summary.Timestamp = s.current.Timestamp
+	summary.Price = s.current.Price
+	summary.Category = s.current.Category.String()
+	if lastCategory := prices.LastCategory(s.gasPrices); lastCategory != nil {
+		summary.PreviousCategory = lastCategory.String()
+	}
+	summary.Mean = s.stats.Mean
+	summary.Stddev = s.stats.Stddev
+
+	recent := s.withCurrent()
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i].Timestamp.Before(recent[j].Timestamp)
+	})
+	if len(recent) > summaryRecentPrices {
+		recent = recent[len(recent)-summaryRecentPrices:]
+	}
+	summary.Recent = recent
+}
+
+// baselineStats returns the stats that a price sampled at now is categorised
+// against, according to the configured baseline, along with the stats over
+// the stats window. ewma is the EWMA of the prices before now, if it is the
+// baseline.
+func baselineStats(
+	ctx context.Context,
+	cfg *runConfig,
+	agg *prices.Aggregates,
+	gasPrices []prices.GasPriceData,
+	ewma *prices.EWMA,
+	now time.Time,
+) (stats, windowStats *prices.PriceStats, err error) {
+	_, span := tracer.Start(ctx, "stats.window")
+	windowStats, err = getWindowStats(agg, gasPrices, cfg.windows.stats, cfg.windows.retention, now)
+	endSpan(span, err)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "while calcuating gas price stats")
+	}
+	log.Info().Float64("mean", windowStats.Mean).Float64("stddev", windowStats.Stddev).Msg("calculated window stats")
+	stats = windowStats
+
+	if ewma != nil {
+		stats = ewma.Stats()
+		log.Info().Float64("mean", stats.Mean).Float64("stddev", stats.Stddev).Msg("calculated EWMA stats")
+	}
+
+	if seasonal := getSeasonalStats(cfg.baseline.kind, agg, now, cfg.bands.MinSamples); seasonal != nil {
+		stats = seasonal
+		log.Info().
+			Str("context", stats.Context).
+			Float64("mean", stats.Mean).
+			Float64("stddev", stats.Stddev).
+			Msg("calculated seasonal stats")
+	}
+
+	return stats, windowStats, nil
+}
+
+// findRunAlerts finds the alerts for a sampled price, along with the details
+// of the price that they include.
+func findRunAlerts(
+	svc *dynamodb.DynamoDB, cfg *runConfig, s *sampleContext, opts RunOptions,
+) ([]alert, alertDetails, error) {
+	current, gasPrices, now := s.current, s.gasPrices, s.current.Timestamp
+
+	details := alertDetails{
+		Window:     s.windowStats,
+		WindowDays: windowDays(prices.Within(gasPrices, cfg.windows.stats, now), now),
+		Rank:       findPercentileRank(current, gasPrices, cfg.windows.stats),
+		Summaries:  summariseWindows(s.withCurrent(), cfg.windows.summaries, now),
+		Baselines: compareBaselines(
+			current, gasPrices, cfg.bands, cfg.windows.stats, cfg.windows.short, now,
+		),
+		Trend:      findTrend(current, gasPrices, cfg.trendSamples),
+		Volatility: findVolatility(current, gasPrices, cfg.volatility.window),
+		Market:     findMarketContext(current, gasPrices, cfg.correlationWindow),
+		Recommend:  findRecommendation(current, gasPrices, s.agg, cfg.recommendWindowHours),
+		Costs:      estimateCosts(cfg.costPresets, current.Price, current.EthUSD),
+		Forecast:   forecastPrices(current, gasPrices, cfg.forecastHours),
+		Coverage:   findCoverage(current, gasPrices, cfg.windows.stats),
+	}
+	if c := details.Coverage; c != nil {
+		log.Info().Float64("coverage", c.Percent).Int("gaps", c.Gaps).Dur("missing", c.Missing).Msg("found stats window coverage")
+	}
+	if details.Trend != nil {
+		log.Info().Stringer("trend", details.Trend).Msg("found price trend")
+	}
+	if details.Volatility != nil {
+		log.Info().Stringer("volatility", details.Volatility).Msg("found price volatility")
+	}
+	if details.Market != nil {
+		log.Info().Stringer("market", details.Market).Msg("found market context")
+	}
+	if details.Forecast != nil {
+		log.Info().Stringer("forecast", details.Forecast).Msg("forecast prices")
+	}
+	if details.Recommend != nil {
+		log.Info().Stringer("recommendation", details.Recommend).Msg("found recommendation")
+	}
+
+	alerts := findAlerts(current, gasPrices, s.stats, cfg.bands, cfg.thresholds, cfg.sustainedSamples)
+	alerts = withDetails(
+		applyRules(
+			alerts, cfg.rules, current, gasPrices, s.stats, cfg.bands, cfg.sustainedSamples, cfg.trendSamples,
+		),
+		details,
+	)
+	if sp := findSpike(current, gasPrices, s.stats, cfg.bands, cfg.spikes); sp != nil {
+		sp.Details = details
+		alerts = append(alerts, *sp)
+	}
+
+	v, err := findVolatilityChange(svc, current, details.Volatility, cfg.volatility, opts.DryRun)
+	if err != nil {
+		return nil, alertDetails{}, err
+	}
+	if v != nil {
+		v.Details = details
+		alerts = append(alerts, *v)
+	}
+
+	lastCategory := prices.LastCategory(gasPrices)
+	if opts.ForceNotify && lastCategory != nil && !hasAlertOf(alerts, categoryChangeAlert) {
+		forced := newCategoryAlert(current, *lastCategory, s.stats, cfg.bands)
+		forced.Details = details
+		alerts = append(alerts, forced)
+	}
+
+	// Stats over a window with too many gaps are unreliable, so alerts found
+	// against them are not sent, unless forced.
+	if c := details.Coverage; c != nil && c.Percent < cfg.minCoverage && !opts.ForceNotify && len(alerts) > 0 {
+		log.Warn().
+			Float64("coverage", c.Percent).
+			Float64("minCoverage", cfg.minCoverage).
+			Int("alerts", len(alerts)).
+			Msg("not alerting, stats window coverage is below GAS_MIN_COVERAGE")
+		return nil, details, nil
+	}
+
+	// Until the tracker has warmed up, the baseline is too young to alert
+	// against, unless forced.
+	if warmingUp(cfg.warmup, s) && !opts.ForceNotify && len(alerts) > 0 {
+		log.Info().Dur("warmup", cfg.warmup).Int("alerts", len(alerts)).Msg("not alerting, still warming up")
+		return nil, details, nil
+	}
+
+	return alerts, details, nil
+}
+
+// notify sends the alerts for a sampled price, and notifies subscribers if
+// they are enabled.
+func (c *channels) notify(
+	ctx context.Context,
+	svc *dynamodb.DynamoDB,
+	cfg *runConfig,
+	s *sampleContext,
+	alerts []alert,
+	details alertDetails,
+) error {
+	if c.email != nil && len(alerts) > 0 {
+		chartAlerts(alerts, s, cfg.bands)
+	}
+
+	var err error
+	notifyCtx, span := tracer.Start(ctx, "notify", trace.WithAttributes(attribute.Int("alerts", len(alerts))))
+	// Every alert is attempted even if an earlier one fails, so that one
+	// failure does not hold back the rest.
+	for i := range alerts {
+		if aerr := c.alerter.handleAlert(notifyCtx, &alerts[i]); aerr != nil && err == nil {
+			err = errors.Wrapf(aerr, "while notifying of %s", alerts[i].key())
+		}
+	}
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	if !c.subscribers || warmingUp(cfg.warmup, s) {
+		return nil
+	}
+
+	subscribersCtx, span := tracer.Start(ctx, "notify.subscribers")
+	c.subscriberNotifiers, err = notifySubscribers(subscribersCtx, svc, &c.alerter, c.email, cfg, s, details)
+	endSpan(span, err)
+
+	return errors.Wrap(err, "while notifying subscribers")
+}
+
+// chartAlerts charts the prices over the day before the current one, to attach
+// to the alerts. Alerts are still sent without the chart if it fails.
+func chartAlerts(alerts []alert, s *sampleContext, bands prices.Bands) {
+	from := s.current.Timestamp.Add(-alertChartPeriod)
+
+	var recent []prices.GasPriceData
+	for _, p := range s.withCurrent() {
+		if !p.Timestamp.Before(from) {
+			recent = append(recent, p)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := charts.PNG(&buf, recent, charts.Options{Bands: bands}); err != nil {
+		log.Warn().Err(err).Msg("failed to chart prices for alerts")
+		return
+	}
+
+	for i := range alerts {
+		alerts[i].Chart = buf.Bytes()
+	}
+}
+
+// sendUpdates publishes a stored price to MQTT, pushes it to Prometheus,
+// appends it to Google Sheets and publishes the dashboard, if configured,
+// announces when the tracker has warmed up, and sends the weekly report if it
+// is due.
+func (c *channels) sendUpdates(ctx context.Context, sess *session.Session, cfg *runConfig, s *sampleContext) error {
+	if c.mqttPub != nil {
+		if err := c.mqttPub.publishSample(s.current); err != nil {
+			return errors.Wrap(err, "while publishing gas price to MQTT")
+		}
+	}
+
+	if c.remoteWrite != nil {
+		if err := c.remoteWrite.writeSample(ctx, s.current); err != nil {
+			return errors.Wrap(err, "while pushing gas price to Prometheus")
+		}
+	}
+
+	if c.sheets != nil {
+		if err := c.sheets.writeSample(ctx, s); err != nil {
+			return errors.Wrap(err, "while appending gas price to Google Sheets")
+		}
+	}
+
+	if c.dashboard.bucket != "" {
+		if err := publishDashboard(sess, c.dashboard, s.withCurrent(), cfg.bands, s.current.Timestamp); err != nil {
+			return errors.Wrap(err, "while publishing dashboard")
+		}
+	}
+
+	if err := announceCalibrated(ctx, &c.alerter, cfg.warmup, s); err != nil {
+		return errors.Wrap(err, "while announcing calibration")
+	}
+
+	return errors.Wrap(
+		sendWeeklyReport(ctx, &c.alerter, sess, cfg.reports, s.withCurrent(), s.current.Timestamp),
+		"while sending weekly report",
+	)
+}
+
+// storedByRequest returns the stored price sampled by the invocation with the
+// given request ID, or nil if there is none or the ID is empty.
+func storedByRequest(gasPrices []prices.GasPriceData, requestID string) *prices.GasPriceData {
+	if requestID == "" {
+		return nil
+	}
+
+	for i := range gasPrices {
+		if gasPrices[i].RequestID == requestID {
+			return &gasPrices[i]
+		}
+	}
+
+	return nil
+}
+
+// updateGasPrices writes the current price, first pruning every stored price
+// that is older than the retention, so that a backlog of them, e.g. after the
+// retention was shortened, is pruned in one run. It returns the prices that
+// were pruned, leaving out any that could not be deleted.
+func updateGasPrices(
+	svc *dynamodb.DynamoDB,
+	agg *prices.Aggregates,
+	recent []prices.GasPriceData,
+	currGasPrice *prices.GasPriceData,
+	retention time.Duration,
+) ([]prices.GasPriceData, error) {
+	expired, err := findExpired(svc, agg, recent, currGasPrice.Timestamp.Add(-retention))
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading expired gas prices")
+	}
+
+	// Failing to prune is not fatal, since whatever was left is pruned by the
+	// next run, but only the prices that were deleted are returned.
+	deleted, err := store.DeleteConfirmed(svc, expired)
+	if err != nil {
+		log.Warn().Err(err).Int("deleted", len(deleted)).Int("expired", len(expired)).Msg("failed to delete every expired gas price")
+	}
+
+	return deleted, store.Write(svc, currGasPrice)
+}
+
+// getWindowStats returns the stats over the prices within the stats window.
+// If the window covers every retained price, the mean and standard deviation
+// come from the running aggregates.
+func getWindowStats(
+	agg *prices.Aggregates,
+	gasPrices []prices.GasPriceData,
+	window, retention time.Duration,
+	now time.Time,
+) (*prices.PriceStats, error) {
+	if window < retention {
+		return prices.Stats(prices.Within(gasPrices, window, now))
+	}
+
+	stats := agg.All.Stats()
+	if stats == nil {
+		return nil, errors.New("no gas prices")
+	}
+	stats.SetExtremes(gasPrices)
+
+	return stats, nil
+}
+
+// getBands reads the bands, in standard deviations from the mean, at which
+// prices enter and exit the High and Low categories. The entry bands default
+// to 1, and the exit bands default to the corresponding entry band. The Very
+// High and Very Low categories are disabled unless their bands are set.
+// GAS_MIN_SAMPLES and GAS_MIN_STDDEV_GWEI set how many prices the stats must
+// be calculated from before any price is High or Low, and the least standard
+// deviation that the bands are measured in.
+func getBands() (prices.Bands, error) {
+	var bands prices.Bands
+	var err error
+
+	bands.HighEnter, err = getSigmaEnv("GAS_HIGH_SIGMA", prices.DefaultBands.HighEnter)
+	if err != nil {
+		return prices.Bands{}, err
+	}
+	bands.LowEnter, err = getSigmaEnv("GAS_LOW_SIGMA", prices.DefaultBands.LowEnter)
+	if err != nil {
+		return prices.Bands{}, err
+	}
+	bands.HighExit, err = getSigmaEnv("GAS_HIGH_EXIT_SIGMA", bands.HighEnter)
+	if err != nil {
+		return prices.Bands{}, err
+	}
+	bands.LowExit, err = getSigmaEnv("GAS_LOW_EXIT_SIGMA", bands.LowEnter)
+	if err != nil {
+		return prices.Bands{}, err
+	}
+	bands.VeryHighEnter, err = getSigmaEnv("GAS_VERY_HIGH_SIGMA", 0)
+	if err != nil {
+		return prices.Bands{}, err
+	}
+	bands.VeryLowEnter, err = getSigmaEnv("GAS_VERY_LOW_SIGMA", 0)
+	if err != nil {
+		return prices.Bands{}, err
+	}
+	bands.MinSamples, err = getMinSamples()
+	if err != nil {
+		return prices.Bands{}, err
+	}
+	bands.MinStddev, err = getSigmaEnv("GAS_MIN_STDDEV_GWEI", prices.DefaultBands.MinStddev)
+	if err != nil {
+		return prices.Bands{}, err
+	}
+
+	if bands.HighExit > bands.HighEnter {
+		return prices.Bands{}, errors.Errorf(
+			"GAS_HIGH_EXIT_SIGMA (%v) must not exceed GAS_HIGH_SIGMA (%v)", bands.HighExit, bands.HighEnter,
+		)
+	}
+	if bands.LowExit > bands.LowEnter {
+		return prices.Bands{}, errors.Errorf(
+			"GAS_LOW_EXIT_SIGMA (%v) must not exceed GAS_LOW_SIGMA (%v)", bands.LowExit, bands.LowEnter,
+		)
+	}
+	if bands.VeryHighEnter > 0 && bands.VeryHighEnter <= bands.HighEnter {
+		return prices.Bands{}, errors.Errorf(
+			"GAS_VERY_HIGH_SIGMA (%v) must exceed GAS_HIGH_SIGMA (%v)", bands.VeryHighEnter, bands.HighEnter,
+		)
+	}
+	if bands.VeryLowEnter > 0 && bands.VeryLowEnter <= bands.LowEnter {
+		return prices.Bands{}, errors.Errorf(
+			"GAS_VERY_LOW_SIGMA (%v) must exceed GAS_LOW_SIGMA (%v)", bands.VeryLowEnter, bands.LowEnter,
+		)
+	}
+
+	return bands, nil
+}
+
+// defaultMinSamples is the fewest prices that the stats must be calculated
+// from before the tracker categorises a price as anything but Average.
+const defaultMinSamples = 10
+
+// getMinSamples reads the fewest prices that the stats must be calculated
+// from before a price is categorised as anything but Average.
+func getMinSamples() (int, error) {
+	raw := os.Getenv("GAS_MIN_SAMPLES")
+	if raw == "" {
+		return defaultMinSamples, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while parsing GAS_MIN_SAMPLES %q", raw)
+	}
+	if n < 0 {
+		return 0, errors.Errorf("GAS_MIN_SAMPLES must not be negative, got %d", n)
+	}
+
+	return n, nil
+}
+
+func getSigmaEnv(name string, defaultValue float64) (float64, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return defaultValue, nil
+	}
+
+	val, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while parsing %s %q", name, raw)
+	}
+	if val < 0 {
+		return 0, errors.Errorf("%s must not be negative, got %v", name, val)
+	}
+
+	return val, nil
+}
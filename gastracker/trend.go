@@ -0,0 +1,108 @@
+package gastracker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const defaultTrendSamples = 6
+
+// Trends are classified by the slope of the price as a percentage of the mean
+// price per hour.
+const (
+	stableTrendPercent = 1.0
+	fastTrendPercent   = 5.0
+)
+
+// trend describes the direction and rate of change of recent prices.
+type trend struct {
+	Direction string `dynamodbav:"direction"`
+	// Slope is the least squares slope of recent prices, in gwei per hour.
+	Slope float64 `dynamodbav:"slope"`
+	// ChangePercent is the change since the previous sample.
+	ChangePercent float64 `dynamodbav:"changePercent"`
+}
+
+func (t *trend) String() string {
+	return fmt.Sprintf(
+		"Trend is %s (%+.1f gwei/hour), %+.1f%% since the last sample",
+		t.Direction, t.Slope, t.ChangePercent,
+	)
+}
+
+// getTrendSamples reads how many of the most recent samples, including the
+// current one, the trend is calculated over.
+func getTrendSamples() (int, error) {
+	raw := os.Getenv("GAS_TREND_SAMPLES")
+	if raw == "" {
+		return defaultTrendSamples, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while parsing GAS_TREND_SAMPLES %q", raw)
+	}
+	if n < 2 {
+		return 0, errors.Errorf("GAS_TREND_SAMPLES must be at least 2, got %d", n)
+	}
+
+	return n, nil
+}
+
+// findTrend calculates the trend over the most recent samples, or returns nil
+// if there is no previous sample.
+func findTrend(current *prices.GasPriceData, gasPrices []prices.GasPriceData, samples int) *trend {
+	recent := mostRecentFirst(current, gasPrices)
+	if len(recent) < 2 {
+		return nil
+	}
+	if len(recent) > samples {
+		recent = recent[:samples]
+	}
+
+	// Least squares fit of price against hours before the current sample.
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range recent {
+		x := recent[i].Timestamp.Sub(current.Timestamp).Hours()
+		y := float64(recent[i].Price)
+
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	n := float64(len(recent))
+	t := trend{Direction: "stable"}
+
+	if denom := n*sumXX - sumX*sumX; denom != 0 {
+		t.Slope = (n*sumXY - sumX*sumY) / denom
+	}
+	if previous := recent[1].Price; previous != 0 {
+		t.ChangePercent = float64(current.Price-previous) / float64(previous) * 100
+	}
+
+	if mean := sumY / n; mean != 0 {
+		percentPerHour := t.Slope / mean * 100
+
+		switch {
+		case percentPerHour >= fastTrendPercent:
+			t.Direction = "rising fast"
+
+		case percentPerHour >= stableTrendPercent:
+			t.Direction = "rising"
+
+		case percentPerHour <= -fastTrendPercent:
+			t.Direction = "falling fast"
+
+		case percentPerHour <= -stableTrendPercent:
+			t.Direction = "falling"
+		}
+	}
+
+	return &t
+}
@@ -0,0 +1,117 @@
+package gastracker
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/linkpage"
+	"github.com/ryanc414/gas-tracker/subscribers"
+)
+
+// unsubscribePath is where the unsubscribe links in subscriber emails point.
+const unsubscribePath = "/unsubscribe"
+
+// unsubscribeLinker generates the signed unsubscribe links included in
+// subscriber emails.
+type unsubscribeLinker struct {
+	baseURL string
+	secret  []byte
+}
+
+// newUnsubscribeLinker constructs an unsubscribe linker from the environment.
+// It returns nil if GAS_UNSUBSCRIBE_URL is not set.
+func newUnsubscribeLinker() (*unsubscribeLinker, error) {
+	baseURL := os.Getenv("GAS_UNSUBSCRIBE_URL")
+	if baseURL == "" {
+		return nil, nil
+	}
+	secret := os.Getenv("GAS_UNSUBSCRIBE_SECRET")
+	if secret == "" {
+		return nil, errors.New("GAS_UNSUBSCRIBE_SECRET not set")
+	}
+
+	return &unsubscribeLinker{baseURL: baseURL, secret: []byte(secret)}, nil
+}
+
+// link returns the unsubscribe link for an email address, or an empty string
+// if unsubscribe links are not configured.
+func (l *unsubscribeLinker) link(email string) (string, error) {
+	if l == nil {
+		return "", nil
+	}
+
+	return subscribers.UnsubscribeLink(l.baseURL, l.secret, email)
+}
+
+// unsubscribeHandler serves the unsubscribe links in subscriber emails. A GET,
+// e.g. from following the link, shows a page asking to confirm, so that link
+// scanners do not unsubscribe anyone. A POST, either from confirming or the
+// one-click unsubscribe of RFC 8058 that mail clients send when the
+// List-Unsubscribe-Post header is present, marks every subscriber with the
+// email address inactive.
+type unsubscribeHandler struct {
+	svc    *dynamodb.DynamoDB
+	secret []byte
+}
+
+// UnsubscribeHandler returns a handler for unsubscribe links signed with the
+// secret.
+func UnsubscribeHandler(svc *dynamodb.DynamoDB, secret string) http.Handler {
+	return &unsubscribeHandler{svc: svc, secret: []byte(secret)}
+}
+
+// newUnsubscribeHandler constructs the unsubscribe handler from the
+// environment. It returns nil if GAS_UNSUBSCRIBE_SECRET is not set.
+func newUnsubscribeHandler(svc *dynamodb.DynamoDB) http.Handler {
+	secret := os.Getenv("GAS_UNSUBSCRIBE_SECRET")
+	if secret == "" {
+		return nil
+	}
+
+	return UnsubscribeHandler(svc, secret)
+}
+
+func (h *unsubscribeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != unsubscribePath {
+		http.NotFound(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+	email := q.Get("email")
+	if err := subscribers.VerifyUnsubscribe(h.secret, email, q.Get("sig")); err != nil || email == "" {
+		unsubscribePage(w, http.StatusForbidden, "Invalid unsubscribe link", "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// The form posts back to the same link, relative so that it works
+		// behind a proxy that strips a path prefix.
+		unsubscribePage(w, http.StatusOK, "Stop gas price alerts to "+email+"?", "?"+r.URL.RawQuery)
+
+	case http.MethodPost:
+		n, err := subscribers.UnsubscribeEmail(h.svc, email, clock.Now())
+		if err != nil {
+			log.Error().Err(err).Msg("failed to unsubscribe")
+			unsubscribePage(w, http.StatusInternalServerError, "Something went wrong, please try again", "")
+			return
+		}
+
+		log.Info().Int("subscribers", n).Msg("unsubscribed email address")
+		unsubscribePage(w, http.StatusOK, "Unsubscribed, "+email+" will no longer receive gas price alerts", "")
+
+	default:
+		unsubscribePage(w, http.StatusMethodNotAllowed, "Method not allowed", "")
+	}
+}
+
+// unsubscribePage writes a page with a message, and a button that posts to
+// confirm if the confirm URL is set.
+func unsubscribePage(w http.ResponseWriter, status int, msg, confirm string) {
+	linkpage.Write(w, status, linkpage.Page{Message: msg, Confirm: confirm, Button: "Unsubscribe"})
+}
@@ -0,0 +1,174 @@
+package gastracker
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const (
+	volatilityStateID       = "volatility"
+	defaultVolatilityWindow = 24
+	// The volatility regime is classified by the ratio of recent volatility
+	// to volatility over all stored prices.
+	highVolatilityRatio = 1.5
+	lowVolatilityRatio  = 1 / highVolatilityRatio
+)
+
+type volatilityRegime string
+
+const (
+	lowVolatility    volatilityRegime = "low"
+	normalVolatility volatilityRegime = "normal"
+	highVolatility   volatilityRegime = "high"
+)
+
+// volatility is the standard deviation of log returns between consecutive
+// samples, over the recent window and over all stored prices.
+type volatility struct {
+	Recent   float64          `dynamodbav:"recent"`
+	Baseline float64          `dynamodbav:"baseline"`
+	Regime   volatilityRegime `dynamodbav:"regime"`
+}
+
+// volatilityChange describes a change in the volatility regime.
+type volatilityChange struct {
+	Previous volatilityRegime `dynamodbav:"previous"`
+	Current  volatilityRegime `dynamodbav:"current"`
+}
+
+func (v *volatility) String() string {
+	return fmt.Sprintf(
+		"Volatility is %s (%.1f%% per sample, usually %.1f%%)",
+		v.Regime, v.Recent*100, v.Baseline*100,
+	)
+}
+
+// volatilityConfig configures the volatility window, and whether to alert when
+// the volatility regime changes.
+type volatilityConfig struct {
+	window int
+	alerts bool
+}
+
+// getVolatilityConfig reads the volatility config from the environment.
+func getVolatilityConfig() (volatilityConfig, error) {
+	cfg := volatilityConfig{
+		window: defaultVolatilityWindow,
+		alerts: os.Getenv("GAS_VOLATILITY_ALERTS") == "true",
+	}
+
+	if raw := os.Getenv("GAS_VOLATILITY_WINDOW"); raw != "" {
+		window, err := strconv.Atoi(raw)
+		if err != nil {
+			return volatilityConfig{}, errors.Wrapf(err, "while parsing GAS_VOLATILITY_WINDOW %q", raw)
+		}
+		if window < 2 {
+			return volatilityConfig{}, errors.Errorf("GAS_VOLATILITY_WINDOW must be at least 2, got %d", window)
+		}
+
+		cfg.window = window
+	}
+
+	return cfg, nil
+}
+
+// findVolatility calculates the volatility of the most recent samples and of
+// all stored prices. It returns nil if there are too few samples.
+func findVolatility(
+	current *prices.GasPriceData, gasPrices []prices.GasPriceData, window int,
+) *volatility {
+	recent := mostRecentFirst(current, gasPrices)
+
+	returns := make([]float64, 0, len(recent))
+	for i := 0; i+1 < len(recent); i++ {
+		if recent[i].Price > 0 && recent[i+1].Price > 0 {
+			returns = append(returns, math.Log(float64(recent[i].Price)/float64(recent[i+1].Price)))
+		}
+	}
+
+	if len(returns) <= window {
+		return nil
+	}
+
+	v := volatility{
+		Recent:   stddevOf(returns[:window]),
+		Baseline: stddevOf(returns),
+		Regime:   normalVolatility,
+	}
+
+	if v.Baseline > 0 {
+		ratio := v.Recent / v.Baseline
+
+		switch {
+		case ratio >= highVolatilityRatio:
+			v.Regime = highVolatility
+
+		case ratio <= lowVolatilityRatio:
+			v.Regime = lowVolatility
+		}
+	}
+
+	return &v
+}
+
+func stddevOf(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var sumSquares float64
+	for _, v := range values {
+		sumSquares += (v - mean) * (v - mean)
+	}
+
+	return math.Sqrt(sumSquares / float64(len(values)-1))
+}
+
+// findVolatilityChange returns a volatility alert if the regime has changed
+// since the previous run, and persists the current regime unless dryRun is
+// true. It returns nil if alerts are disabled or the regime is unchanged.
+func findVolatilityChange(
+	svc *dynamodb.DynamoDB, current *prices.GasPriceData, v *volatility, cfg volatilityConfig, dryRun bool,
+) (*alert, error) {
+	if !cfg.alerts || v == nil {
+		return nil, nil
+	}
+
+	var previous volatility
+	found, err := store.ReadState(svc, volatilityStateID, &previous)
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading volatility state")
+	}
+
+	if !dryRun {
+		if err := store.WriteState(svc, volatilityStateID, v); err != nil {
+			return nil, errors.Wrap(err, "while writing volatility state")
+		}
+	}
+
+	if !found || previous.Regime == v.Regime {
+		return nil, nil
+	}
+
+	return &alert{
+		Kind:        volatilityAlert,
+		Severity:    severityInfo,
+		NewCategory: current.Category,
+		Price:       current.Price,
+		Volatility:  &volatilityChange{Previous: previous.Regime, Current: v.Regime},
+		Timestamp:   current.Timestamp,
+	}, nil
+}
@@ -0,0 +1,103 @@
+package gastracker
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/store"
+)
+
+const warmupStateID = "warmup"
+
+// warmupState records when the tracker was first seen warming up, and when it
+// announced that it had calibrated, so that the announcement is sent once, and
+// not at all by a deployment that was already running before the warm-up was
+// configured.
+type warmupState struct {
+	Started      time.Time `dynamodbav:"started"`
+	CalibratedAt time.Time `dynamodbav:"calibratedAt"`
+}
+
+// getWarmup reads GAS_WARMUP, how long after the oldest stored price the
+// tracker collects prices without alerting, e.g. "3d", so that a fresh
+// deployment does not alert against a baseline of only a few prices. Defaults
+// to 0, which alerts from the start.
+func getWarmup() (time.Duration, error) {
+	raw := os.Getenv("GAS_WARMUP")
+	if raw == "" {
+		return 0, nil
+	}
+
+	warmup, err := parseWindow(raw)
+	if err != nil {
+		return 0, errors.Wrap(err, "while parsing GAS_WARMUP")
+	}
+
+	return warmup, nil
+}
+
+// warmingUp returns true if the prices stored before the sample span less than
+// the warm-up period.
+func warmingUp(warmup time.Duration, s *sampleContext) bool {
+	if warmup == 0 {
+		return false
+	}
+
+	oldest := s.agg.Oldest
+	return oldest.IsZero() || s.current.Timestamp.Sub(oldest) < warmup
+}
+
+// announceCalibrated records that the tracker is warming up, and once it has
+// finished, sends a single alert saying that it is calibrated.
+func announceCalibrated(ctx context.Context, al *alerter, warmup time.Duration, s *sampleContext) error {
+	if warmup == 0 {
+		return nil
+	}
+
+	var state warmupState
+	if _, err := store.ReadState(al.svc, warmupStateID, &state); err != nil {
+		return errors.Wrap(err, "while reading warm-up state")
+	}
+
+	now := s.current.Timestamp
+	if warmingUp(warmup, s) {
+		if !state.Started.IsZero() {
+			return nil
+		}
+
+		log.Info().Dur("warmup", warmup).Msg("warming up, not alerting until the baseline is ready")
+		state.Started = now
+		return errors.Wrap(store.WriteState(al.svc, warmupStateID, &state), "while writing warm-up state")
+	}
+
+	if state.Started.IsZero() || !state.CalibratedAt.IsZero() {
+		return nil
+	}
+
+	log.Info().Time("started", state.Started).Msg("finished warming up, announcing calibration")
+
+	// Record the announcement before sending it, as the weekly report is, so
+	// that a failure to deliver it over one channel does not resend it to the
+	// others every run.
+	state.CalibratedAt = now
+	if err := store.WriteState(al.svc, warmupStateID, &state); err != nil {
+		return errors.Wrap(err, "while writing warm-up state")
+	}
+
+	a := alert{
+		Kind:         calibratedAlert,
+		Severity:     severityInfo,
+		NewCategory:  s.current.Category,
+		Price:        s.current.Price,
+		TypicalPrice: s.stats.Mean,
+		Timestamp:    now,
+	}
+
+	sent, err := sendAlert(ctx, al.svc, al.routedNotifiers(&a), &a)
+	al.sent += sent
+
+	return err
+}
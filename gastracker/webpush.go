@@ -0,0 +1,126 @@
+package gastracker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	webpush "github.com/SherClockHolmes/webpush-go"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/pushsubs"
+)
+
+// Push services may discard notifications that cannot be delivered within
+// this many seconds, since a stale price alert is not useful.
+const webPushTTL = 60 * 60
+
+// webPushNotifier sends alerts to every stored browser push subscription,
+// using VAPID to identify this application to the push services.
+type webPushNotifier struct {
+	svc     *dynamodb.DynamoDB
+	options webpush.Options
+}
+
+// newWebPushNotifier constructs a Web Push notifier from the environment. It
+// returns nil if no VAPID keys are configured.
+func newWebPushNotifier(svc *dynamodb.DynamoDB) (*webPushNotifier, error) {
+	privateKey := os.Getenv("GAS_WEBPUSH_VAPID_PRIVATE_KEY")
+	if privateKey == "" {
+		return nil, nil
+	}
+	publicKey := os.Getenv("GAS_WEBPUSH_VAPID_PUBLIC_KEY")
+	if publicKey == "" {
+		return nil, errors.New("GAS_WEBPUSH_VAPID_PUBLIC_KEY not set")
+	}
+	subscriber := os.Getenv("GAS_WEBPUSH_SUBSCRIBER")
+	if subscriber == "" {
+		return nil, errors.New("GAS_WEBPUSH_SUBSCRIBER not set")
+	}
+
+	return &webPushNotifier{
+		svc: svc,
+		options: webpush.Options{
+			HTTPClient:      &http.Client{Timeout: webhookTimeout},
+			Subscriber:      subscriber,
+			TTL:             webPushTTL,
+			VAPIDPublicKey:  publicKey,
+			VAPIDPrivateKey: privateKey,
+		},
+	}, nil
+}
+
+// webPushMessage is the payload received by the PWA's service worker.
+type webPushMessage struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Price int    `json:"price"`
+}
+
+func (n *webPushNotifier) name() string {
+	return "webpush"
+}
+
+func (n *webPushNotifier) notify(_ context.Context, a *alert) error {
+	msg, err := json.Marshal(webPushMessage{
+		Title: a.subject(),
+		Body:  a.summary(),
+		Price: a.Price,
+	})
+	if err != nil {
+		return errors.Wrap(err, "while marshalling push message")
+	}
+
+	subs, err := pushsubs.ReadAll(n.svc)
+	if err != nil {
+		return errors.Wrap(err, "while reading push subscriptions")
+	}
+
+	var failed int
+	for i := range subs {
+		if err := n.send(msg, &subs[i]); err != nil {
+			log.Error().Err(err).Str("endpoint", subs[i].Endpoint).Msg("failed to send push notification")
+			failed++
+		}
+	}
+
+	// Only fail if nothing could be delivered, since retrying would otherwise
+	// send duplicate notifications to the subscriptions that succeeded.
+	if failed > 0 && failed == len(subs) {
+		return errors.Errorf("failed to send all %d push notifications", failed)
+	}
+
+	return nil
+}
+
+func (n *webPushNotifier) send(msg []byte, sub *pushsubs.Subscription) error {
+	rsp, err := webpush.SendNotification(msg, &webpush.Subscription{
+		Endpoint: sub.Endpoint,
+		Keys: webpush.Keys{
+			Auth:   sub.Keys.Auth,
+			P256dh: sub.Keys.P256dh,
+		},
+	}, &n.options)
+	if err != nil {
+		return err
+	}
+
+	defer rsp.Body.Close()
+
+	switch {
+	case rsp.StatusCode == http.StatusNotFound || rsp.StatusCode == http.StatusGone:
+		// The subscription has expired or the user unsubscribed.
+		log.Info().Str("endpoint", sub.Endpoint).Msg("removing expired push subscription")
+		return pushsubs.Delete(n.svc, sub.Endpoint)
+
+	case rsp.StatusCode < 200 || rsp.StatusCode >= 300:
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return errors.Errorf("response error: %s %s", rsp.Status, string(body))
+
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,226 @@
+package gastracker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const (
+	defaultRetention   = 7 * 24 * time.Hour
+	defaultShortWindow = 24 * time.Hour
+)
+
+// windowConfig configures how long prices are kept, and the windows that
+// stats are calculated over. The stats window is the baseline prices are
+// categorised against, the short window is a second baseline that alerts
+// compare it with, and the summary windows are reported in alerts.
+type windowConfig struct {
+	retention time.Duration
+	stats     time.Duration
+	short     time.Duration
+	summaries []time.Duration
+}
+
+// getWindowConfig reads the retention and stats windows. GAS_RETENTION and
+// GAS_STATS_WINDOW default to 7 days, GAS_SHORT_BASELINE_WINDOW defaults to
+// 24 hours or may be "none" to disable it, and GAS_STATS_SUMMARY_WINDOWS is a
+// comma-separated list, e.g. "24h,7d,30d". No window may exceed the retention.
+func getWindowConfig() (windowConfig, error) {
+	cfg := windowConfig{retention: defaultRetention}
+
+	var err error
+	if raw := os.Getenv("GAS_RETENTION"); raw != "" {
+		cfg.retention, err = parseWindow(raw)
+		if err != nil {
+			return windowConfig{}, errors.Wrap(err, "while parsing GAS_RETENTION")
+		}
+	}
+
+	cfg.stats = cfg.retention
+	if raw := os.Getenv("GAS_STATS_WINDOW"); raw != "" {
+		cfg.stats, err = parseWindow(raw)
+		if err != nil {
+			return windowConfig{}, errors.Wrap(err, "while parsing GAS_STATS_WINDOW")
+		}
+	}
+	if cfg.stats > cfg.retention {
+		return windowConfig{}, errors.Errorf(
+			"GAS_STATS_WINDOW (%v) must not exceed GAS_RETENTION (%v)", cfg.stats, cfg.retention,
+		)
+	}
+
+	cfg.short = defaultShortWindow
+	switch raw := os.Getenv("GAS_SHORT_BASELINE_WINDOW"); raw {
+	case "":
+
+	case "none":
+		cfg.short = 0
+
+	default:
+		cfg.short, err = parseWindow(raw)
+		if err != nil {
+			return windowConfig{}, errors.Wrap(err, "while parsing GAS_SHORT_BASELINE_WINDOW")
+		}
+	}
+	if cfg.short >= cfg.stats {
+		// A short baseline at least as long as the stats window adds nothing.
+		cfg.short = 0
+	}
+
+	if raw := os.Getenv("GAS_STATS_SUMMARY_WINDOWS"); raw != "" {
+		for _, field := range strings.Split(raw, ",") {
+			w, err := parseWindow(strings.TrimSpace(field))
+			if err != nil {
+				return windowConfig{}, errors.Wrap(err, "while parsing GAS_STATS_SUMMARY_WINDOWS")
+			}
+			if w > cfg.retention {
+				return windowConfig{}, errors.Errorf(
+					"summary window %v must not exceed GAS_RETENTION (%v)", w, cfg.retention,
+				)
+			}
+
+			cfg.summaries = append(cfg.summaries, w)
+		}
+	}
+
+	return cfg, nil
+}
+
+// minRunWindow is the least that a run reads back, so that the forecast is
+// fitted to at least two daily cycles, the previous day is whole for the daily
+// Google Sheets rollup, and the chart in alerts is full.
+const minRunWindow = 48 * time.Hour
+
+// runWindow returns how far back the stored prices that a run reads go: the
+// longest window that its stats, alerts and updates cover, up to the
+// retention.
+func runWindow(cfg *runConfig) time.Duration {
+	window := cfg.windows.stats
+	longer := append([]time.Duration{minRunWindow}, cfg.windows.summaries...)
+	if cfg.reports.enabled || getDashboardConfig().bucket != "" {
+		longer = append(longer, reportPeriod, dashboardPeriod)
+	}
+	for _, w := range longer {
+		if w > window {
+			window = w
+		}
+	}
+
+	if window > cfg.windows.retention {
+		window = cfg.windows.retention
+	}
+
+	return window
+}
+
+// parseWindow parses a positive duration, which may also be a whole number of
+// days, e.g. "7d".
+func parseWindow(raw string) (time.Duration, error) {
+	var d time.Duration
+
+	if strings.HasSuffix(raw, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(raw, "d"))
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid window %q", raw)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		d, err = time.ParseDuration(raw)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid window %q", raw)
+		}
+	}
+
+	if d <= 0 {
+		return 0, errors.Errorf("window must be positive, got %q", raw)
+	}
+
+	return d, nil
+}
+
+// formatWindow formats a window as a number of days if it is a whole number
+// of days, e.g. "7d", otherwise as a duration.
+func formatWindow(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(d.String(), "0s"), "0m")
+}
+
+// windowSummary is the mean price over a window.
+type windowSummary struct {
+	Window  string  `dynamodbav:"window"`
+	Mean    float64 `dynamodbav:"mean"`
+	Samples int     `dynamodbav:"samples"`
+}
+
+// summariseWindows calculates the mean price over each window, skipping
+// windows that contain no prices.
+func summariseWindows(
+	gasPrices []prices.GasPriceData, windows []time.Duration, now time.Time,
+) []windowSummary {
+	var summaries []windowSummary
+	for _, w := range windows {
+		within := prices.Within(gasPrices, w, now)
+		if len(within) == 0 {
+			continue
+		}
+
+		summaries = append(summaries, windowSummary{
+			Window:  formatWindow(w),
+			Mean:    prices.Mean(within),
+			Samples: len(within),
+		})
+	}
+
+	return summaries
+}
+
+// baselineCategory is the category of the current price relative to the
+// prices within a window.
+type baselineCategory struct {
+	Window   string               `dynamodbav:"window"`
+	Category prices.PriceCategory `dynamodbav:"category"`
+}
+
+// compareBaselines categorises the current price against both the long-term
+// baseline it was categorised against, and the prices within a shorter
+// window, since a price can be low for the week but unremarkable for the day.
+// It returns nil if the short window is disabled or has too few prices.
+func compareBaselines(
+	current *prices.GasPriceData,
+	gasPrices []prices.GasPriceData,
+	bands prices.Bands,
+	longWindow, shortWindow time.Duration,
+	now time.Time,
+) []baselineCategory {
+	if shortWindow == 0 {
+		return nil
+	}
+
+	within := prices.Within(gasPrices, shortWindow, now)
+	if len(within) < minSeasonalSamples {
+		return nil
+	}
+
+	shortStats, err := prices.Stats(within)
+	if err != nil {
+		return nil
+	}
+
+	return []baselineCategory{
+		{Window: formatWindow(longWindow), Category: current.Category},
+		{
+			Window:   formatWindow(shortWindow),
+			Category: prices.CategorisePriceWithBands(current.Price, shortStats, prices.LastCategory(within), bands),
+		},
+	}
+}
@@ -1,9 +1,25 @@
 module github.com/ryanc414/gas-tracker
 
-go 1.15
+go 1.16
 
 require (
-	github.com/aws/aws-lambda-go v1.22.0
+	github.com/SherClockHolmes/webpush-go v1.1.3
+	github.com/aws/aws-lambda-go v1.28.0
 	github.com/aws/aws-sdk-go v1.37.7
+	github.com/eclipse/paho.mqtt.golang v1.3.5
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/golang/snappy v0.0.3
+	github.com/graph-gophers/graphql-go v1.1.0
 	github.com/pkg/errors v0.9.1
+	github.com/rs/zerolog v1.20.0
+	github.com/spf13/cobra v1.1.3
+	github.com/xitongsys/parquet-go v1.6.2
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	google.golang.org/grpc v1.40.0
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,249 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: gastracker.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// GasTrackerClient is the client API for GasTracker service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GasTrackerClient interface {
+	// GetCurrent returns the most recent price and its category.
+	GetCurrent(ctx context.Context, in *GetCurrentRequest, opts ...grpc.CallOption) (*Price, error)
+	// GetStats returns the stats of the prices in a range.
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error)
+	// QueryHistory returns a page of prices in a range, oldest first.
+	QueryHistory(ctx context.Context, in *QueryHistoryRequest, opts ...grpc.CallOption) (*QueryHistoryResponse, error)
+	// StreamUpdates streams each new price as it is stored.
+	StreamUpdates(ctx context.Context, in *StreamUpdatesRequest, opts ...grpc.CallOption) (GasTracker_StreamUpdatesClient, error)
+}
+
+type gasTrackerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGasTrackerClient(cc grpc.ClientConnInterface) GasTrackerClient {
+	return &gasTrackerClient{cc}
+}
+
+func (c *gasTrackerClient) GetCurrent(ctx context.Context, in *GetCurrentRequest, opts ...grpc.CallOption) (*Price, error) {
+	out := new(Price)
+	err := c.cc.Invoke(ctx, "/gastracker.v1.GasTracker/GetCurrent", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gasTrackerClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*Stats, error) {
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, "/gastracker.v1.GasTracker/GetStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gasTrackerClient) QueryHistory(ctx context.Context, in *QueryHistoryRequest, opts ...grpc.CallOption) (*QueryHistoryResponse, error) {
+	out := new(QueryHistoryResponse)
+	err := c.cc.Invoke(ctx, "/gastracker.v1.GasTracker/QueryHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gasTrackerClient) StreamUpdates(ctx context.Context, in *StreamUpdatesRequest, opts ...grpc.CallOption) (GasTracker_StreamUpdatesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GasTracker_ServiceDesc.Streams[0], "/gastracker.v1.GasTracker/StreamUpdates", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gasTrackerStreamUpdatesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GasTracker_StreamUpdatesClient interface {
+	Recv() (*PriceUpdate, error)
+	grpc.ClientStream
+}
+
+type gasTrackerStreamUpdatesClient struct {
+	grpc.ClientStream
+}
+
+func (x *gasTrackerStreamUpdatesClient) Recv() (*PriceUpdate, error) {
+	m := new(PriceUpdate)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GasTrackerServer is the server API for GasTracker service.
+// All implementations must embed UnimplementedGasTrackerServer
+// for forward compatibility
+type GasTrackerServer interface {
+	// GetCurrent returns the most recent price and its category.
+	GetCurrent(context.Context, *GetCurrentRequest) (*Price, error)
+	// GetStats returns the stats of the prices in a range.
+	GetStats(context.Context, *GetStatsRequest) (*Stats, error)
+	// QueryHistory returns a page of prices in a range, oldest first.
+	QueryHistory(context.Context, *QueryHistoryRequest) (*QueryHistoryResponse, error)
+	// StreamUpdates streams each new price as it is stored.
+	StreamUpdates(*StreamUpdatesRequest, GasTracker_StreamUpdatesServer) error
+	mustEmbedUnimplementedGasTrackerServer()
+}
+
+// UnimplementedGasTrackerServer must be embedded to have forward compatible implementations.
+type UnimplementedGasTrackerServer struct {
+}
+
+func (UnimplementedGasTrackerServer) GetCurrent(context.Context, *GetCurrentRequest) (*Price, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCurrent not implemented")
+}
+func (UnimplementedGasTrackerServer) GetStats(context.Context, *GetStatsRequest) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedGasTrackerServer) QueryHistory(context.Context, *QueryHistoryRequest) (*QueryHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryHistory not implemented")
+}
+func (UnimplementedGasTrackerServer) StreamUpdates(*StreamUpdatesRequest, GasTracker_StreamUpdatesServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamUpdates not implemented")
+}
+func (UnimplementedGasTrackerServer) mustEmbedUnimplementedGasTrackerServer() {}
+
+// UnsafeGasTrackerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GasTrackerServer will
+// result in compilation errors.
+type UnsafeGasTrackerServer interface {
+	mustEmbedUnimplementedGasTrackerServer()
+}
+
+func RegisterGasTrackerServer(s grpc.ServiceRegistrar, srv GasTrackerServer) {
+	s.RegisterService(&GasTracker_ServiceDesc, srv)
+}
+
+func _GasTracker_GetCurrent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCurrentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GasTrackerServer).GetCurrent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gastracker.v1.GasTracker/GetCurrent",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GasTrackerServer).GetCurrent(ctx, req.(*GetCurrentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GasTracker_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GasTrackerServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gastracker.v1.GasTracker/GetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GasTrackerServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GasTracker_QueryHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GasTrackerServer).QueryHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gastracker.v1.GasTracker/QueryHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GasTrackerServer).QueryHistory(ctx, req.(*QueryHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GasTracker_StreamUpdates_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamUpdatesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GasTrackerServer).StreamUpdates(m, &gasTrackerStreamUpdatesServer{stream})
+}
+
+type GasTracker_StreamUpdatesServer interface {
+	Send(*PriceUpdate) error
+	grpc.ServerStream
+}
+
+type gasTrackerStreamUpdatesServer struct {
+	grpc.ServerStream
+}
+
+func (x *gasTrackerStreamUpdatesServer) Send(m *PriceUpdate) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// GasTracker_ServiceDesc is the grpc.ServiceDesc for GasTracker service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GasTracker_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gastracker.v1.GasTracker",
+	HandlerType: (*GasTrackerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCurrent",
+			Handler:    _GasTracker_GetCurrent_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _GasTracker_GetStats_Handler,
+		},
+		{
+			MethodName: "QueryHistory",
+			Handler:    _GasTracker_QueryHistory_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamUpdates",
+			Handler:       _GasTracker_StreamUpdates_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gastracker.proto",
+}
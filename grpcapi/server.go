@@ -0,0 +1,185 @@
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gastracker.proto
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Server implements the GasTracker service over the stored prices. Streamed
+// updates are found by polling the store.
+type Server struct {
+	UnimplementedGasTrackerServer
+
+	svc          *dynamodb.DynamoDB
+	pollInterval time.Duration
+	done         chan struct{}
+	shutdown     sync.Once
+}
+
+// NewServer constructs a Server that polls for new prices every
+// pollInterval.
+func NewServer(svc *dynamodb.DynamoDB, pollInterval time.Duration) *Server {
+	return &Server{svc: svc, pollInterval: pollInterval, done: make(chan struct{})}
+}
+
+// Shutdown ends every update stream, so that grpc.Server.GracefulStop does
+// not wait for clients to disconnect.
+func (s *Server) Shutdown() {
+	s.shutdown.Do(func() { close(s.done) })
+}
+
+func newPrice(p *prices.GasPriceData) *Price {
+	return &Price{
+		Price:    int64(p.Price),
+		UnixTime: p.Timestamp.Unix(),
+		Category: p.Category.String(),
+		EthUsd:   p.EthUSD,
+	}
+}
+
+// GetCurrent returns the most recent price and its category.
+func (s *Server) GetCurrent(context.Context, *GetCurrentRequest) (*Price, error) {
+	latest, err := store.ReadLatest(s.svc)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "while reading latest gas price: %v", err)
+	}
+	if latest == nil {
+		return nil, status.Error(codes.NotFound, "no gas prices")
+	}
+
+	return newPrice(latest), nil
+}
+
+// GetStats returns the stats of the prices in a range.
+func (s *Server) GetStats(_ context.Context, req *GetStatsRequest) (*Stats, error) {
+	gasPrices, err := store.ReadRange(s.svc, unixTime(req.FromUnix), unixTime(req.ToUnix))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "while reading gas prices: %v", err)
+	}
+
+	stats, err := prices.Stats(gasPrices)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "no gas prices in range")
+	}
+
+	return &Stats{
+		Count:  int64(len(gasPrices)),
+		Mean:   stats.Mean,
+		Stddev: stats.Stddev,
+		Min:    &Price{Price: int64(stats.Min), UnixTime: stats.MinAt.Unix()},
+		Max:    &Price{Price: int64(stats.Max), UnixTime: stats.MaxAt.Unix()},
+	}, nil
+}
+
+// QueryHistory returns a page of prices in a range, oldest first. The page
+// token is the time of the last price on the previous page, in nanoseconds
+// since the epoch.
+func (s *Server) QueryHistory(_ context.Context, req *QueryHistoryRequest) (*QueryHistoryResponse, error) {
+	pageSize := int(req.PageSize)
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize < 0 || pageSize > maxPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must be between 1 and %d", maxPageSize)
+	}
+
+	from := unixTime(req.FromUnix)
+	if req.PageToken != "" {
+		after, err := strconv.ParseInt(req.PageToken, 10, 64)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		from = time.Unix(0, after+1)
+	}
+
+	gasPrices, err := store.ReadRange(s.svc, from, unixTime(req.ToUnix))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "while reading gas prices: %v", err)
+	}
+
+	var rsp QueryHistoryResponse
+	for i := range gasPrices {
+		if i == pageSize {
+			rsp.NextPageToken = strconv.FormatInt(gasPrices[i-1].Timestamp.UnixNano(), 10)
+			break
+		}
+
+		rsp.Prices = append(rsp.Prices, newPrice(&gasPrices[i]))
+	}
+
+	return &rsp, nil
+}
+
+// StreamUpdates streams each price stored after the stream starts, until the
+// client disconnects or the server shuts down, when it fails with
+// codes.Unavailable so that the client reconnects.
+func (s *Server) StreamUpdates(req *StreamUpdatesRequest, stream GasTracker_StreamUpdatesServer) error {
+	ctx := stream.Context()
+
+	last, err := store.ReadLatest(s.svc)
+	if err != nil {
+		return status.Errorf(codes.Internal, "while reading latest gas price: %v", err)
+	}
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server is shutting down")
+
+		case <-ticker.C:
+		}
+
+		latest, err := store.ReadLatest(s.svc)
+		if err != nil {
+			return status.Errorf(codes.Internal, "while reading latest gas price: %v", err)
+		}
+		if latest == nil || (last != nil && !latest.Timestamp.After(last.Timestamp)) {
+			continue
+		}
+
+		update := PriceUpdate{Price: newPrice(latest)}
+		if last != nil {
+			update.PreviousCategory = last.Category.String()
+		}
+		changed := last == nil || last.Category != latest.Category
+		last = latest
+
+		if req.CategoryChangesOnly && !changed {
+			continue
+		}
+		if err := stream.Send(&update); err != nil {
+			return err
+		}
+	}
+}
+
+// unixTime converts seconds since the epoch to a time, leaving zero as the
+// zero time.
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(sec, 0)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/api"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/gastracker"
+	"github.com/ryanc414/gas-tracker/logging"
+)
+
+// Accepts prices sampled by external collectors behind API Gateway, posted
+// to /samples with the token in GAS_INGEST_TOKEN as a bearer token, and
+// processes them as if the tracker had sampled them.
+func main() {
+	if err := logging.Setup(false); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	token := gastracker.IngestToken()
+	if token == "" {
+		log.Fatal().Msg("GAS_INGEST_TOKEN not set")
+	}
+
+	sess, err := awsconfig.NewSession()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create AWS session")
+	}
+
+	h := gastracker.IngestHandler(dynamodb.New(sess), token)
+	lambda.Start(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return api.ServeAPIGateway(ctx, h, req)
+	})
+}
@@ -0,0 +1,77 @@
+// Package linkpage renders the pages that the signed links in alerts and
+// emails show, e.g. to snooze alerts, unsubscribe or confirm a subscription.
+// Following a link shows a page asking to confirm, with a button that posts
+// back to the link, so that link scanners and prefetchers do not act on it.
+package linkpage
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/rs/zerolog/log"
+)
+
+var tmpl = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html><head><title>Gas Tracker</title></head><body><p>{{.Message}}</p>
+{{- if .Confirm}}<form method="post" action="{{.Confirm}}"><button type="submit">{{.Button}}</button></form>{{end -}}
+</body></html>`))
+
+// Page is a message, and a button that posts to Confirm if it is set.
+type Page struct {
+	Message string
+	// Confirm is the URL the button posts to, usually the link itself,
+	// relative so that it works behind a proxy that strips a path prefix.
+	Confirm string
+	// Button is the label of the button, "Confirm" if it is empty.
+	Button string
+}
+
+func (p Page) render() (string, error) {
+	if p.Button == "" {
+		p.Button = "Confirm"
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &p); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// Write writes a page as the response to a request.
+func Write(w http.ResponseWriter, status int, p Page) {
+	body, err := p.render()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to render page")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(body)); err != nil {
+		log.Error().Err(err).Msg("failed to write response")
+	}
+}
+
+// Response returns a page as the response to an API Gateway request.
+func Response(status int, p Page) events.APIGatewayProxyResponse {
+	body, err := p.render()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to render page")
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+			Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+			Body:       "internal error",
+		}
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "text/html; charset=utf-8"},
+		Body:       body,
+	}
+}
@@ -0,0 +1,63 @@
+package linkpage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    Page
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "message only",
+			page:    Page{Message: "Unsubscribed"},
+			want:    []string{"<p>Unsubscribed</p>"},
+			notWant: []string{"<form"},
+		},
+		{
+			name: "confirm button",
+			page: Page{Message: "Snooze?", Confirm: "?token=a.b"},
+			want: []string{`<form method="post" action="?token=a.b">`, ">Confirm</button>"},
+		},
+		{
+			name: "button label",
+			page: Page{Message: "Stop?", Confirm: "?email=a%40example.com&sig=x", Button: "Unsubscribe"},
+			want: []string{`action="?email=a%40example.com&amp;sig=x"`, ">Unsubscribe</button>"},
+		},
+		{
+			name:    "escapes the message",
+			page:    Page{Message: "Stop alerts to <script>alert(1)</script>?"},
+			want:    []string{"&lt;script&gt;"},
+			notWant: []string{"<script>"},
+		},
+		{
+			name:    "filters unsafe URLs",
+			page:    Page{Message: "Confirm?", Confirm: "javascript:alert(1)"},
+			notWant: []string{"javascript:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.page.render()
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+
+			for _, s := range tt.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("render() = %s, want it to contain %s", got, s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(got, s) {
+					t.Errorf("render() = %s, want it not to contain %s", got, s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Package logging configures the leveled, structured logger shared by the
+// gas tracker binaries.
+package logging
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/version"
+)
+
+// Setup configures the global logger from the environment:
+//
+//	GAS_LOG_LEVEL   the minimum level logged: debug, info (the default),
+//	                warn or error
+//	GAS_LOG_FORMAT  json, or console for human-friendly output
+//
+// If GAS_LOG_FORMAT is not set, logs are written as console output if console
+// is true, e.g. when run from a terminal, or as JSON otherwise. JSON logs
+// include the version of the build that wrote them.
+func Setup(console bool) error {
+	level := zerolog.InfoLevel
+	if raw := os.Getenv("GAS_LOG_LEVEL"); raw != "" {
+		var err error
+		level, err = zerolog.ParseLevel(strings.ToLower(raw))
+		if err != nil || level < zerolog.DebugLevel || level > zerolog.ErrorLevel {
+			return errors.Errorf("GAS_LOG_LEVEL must be debug, info, warn or error, not %q", raw)
+		}
+	}
+	zerolog.SetGlobalLevel(level)
+
+	switch format := os.Getenv("GAS_LOG_FORMAT"); format {
+	case "":
+	case "json":
+		console = false
+	case "console":
+		console = true
+	default:
+		return errors.Errorf("GAS_LOG_FORMAT must be json or console, not %q", format)
+	}
+
+	if console {
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	} else {
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Str("version", version.Get().Version).Logger()
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+// Package notifications records the history of notifications sent by the
+// tracker, so that it is possible to audit what was sent and when.
+package notifications
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+const TableName = "gasNotificationHistory"
+
+// Record describes a single attempt to deliver a notification over a channel.
+type Record struct {
+	ID             string    `dynamodbav:"id"`
+	Channel        string    `dynamodbav:"channel"`
+	Transition     string    `dynamodbav:"transition"`
+	Price          int       `dynamodbav:"price"`
+	AlertTimestamp time.Time `dynamodbav:"alertTimestamp"`
+	SentAt         time.Time `dynamodbav:"sentAt"`
+	Delivered      bool      `dynamodbav:"delivered"`
+	Error          string    `dynamodbav:"error,omitempty"`
+}
+
+// NewRecord constructs a record of a delivery attempt. The error should be nil
+// if the notification was delivered successfully.
+func NewRecord(
+	channel, transition string, price int, alertTimestamp, sentAt time.Time, err error,
+) *Record {
+	r := Record{
+		ID:             channel + "/" + sentAt.Format(time.RFC3339Nano),
+		Channel:        channel,
+		Transition:     transition,
+		Price:          price,
+		AlertTimestamp: alertTimestamp,
+		SentAt:         sentAt,
+		Delivered:      err == nil,
+	}
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	return &r
+}
+
+// Write stores a record in the notification history table.
+func Write(svc *dynamodb.DynamoDB, r *Record) error {
+	av, err := dynamodbattribute.MarshalMap(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(TableName),
+	})
+	return err
+}
+
+// ReadAll reads every record from the notification history table, ordered
+// from oldest to newest.
+func ReadAll(svc *dynamodb.DynamoDB) ([]Record, error) {
+	var records []Record
+	var startKey map[string]*dynamodb.AttributeValue
+
+	for {
+		result, err := svc.Scan(&dynamodb.ScanInput{
+			Select:            aws.String(dynamodb.SelectAllAttributes),
+			TableName:         aws.String(TableName),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range result.Items {
+			var r Record
+			if err := dynamodbattribute.UnmarshalMap(result.Items[i], &r); err != nil {
+				return nil, err
+			}
+
+			records = append(records, r)
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].SentAt.Before(records[j].SentAt)
+	})
+
+	return records, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/gastracker"
+	"github.com/ryanc414/gas-tracker/logging"
+)
+
+// Sends the alerts for gas prices stored by the tracker. Deploy it with the
+// same notifier configuration as the tracker would have, and set
+// GAS_NOTIFIER_FUNCTION for the tracker to its name, so that the tracker
+// invokes it asynchronously after storing each price rather than sending
+// alerts itself.
+func main() {
+	if err := logging.Setup(false); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	lambda.Start(HandleRequest)
+}
+
+// HandleRequest sends the alerts for a stored price. Returning an error makes
+// Lambda retry the invocation, so that alerts are not lost if notifying fails.
+func HandleRequest(ctx context.Context, req gastracker.NotifyRequest) (*gastracker.RunSummary, error) {
+	if req.Timestamp.IsZero() {
+		return nil, errors.New("a timestamp is required")
+	}
+
+	summary, err := gastracker.NotifyStored(ctx, req.Timestamp)
+	if err != nil {
+		log.Error().Err(err).Time("timestamp", req.Timestamp).Msg("notify failed")
+		return nil, errors.Wrap(err, "while notifying of stored gas price")
+	}
+
+	return summary, nil
+}
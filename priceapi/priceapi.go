@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/api"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/logging"
+)
+
+// The price API behind API Gateway. See api.Handler for the endpoints.
+func main() {
+	if err := logging.Setup(false); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	sess, err := awsconfig.NewSession()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create AWS session")
+	}
+
+	h := api.NewHandler(dynamodb.New(sess))
+	lambda.Start(h.HandleAPIGateway)
+}
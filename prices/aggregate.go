@@ -0,0 +1,158 @@
+package prices
+
+import (
+	"math"
+	"time"
+)
+
+// Aggregate is a running count, sum and sum of squares of prices, from which
+// the mean and standard deviation can be calculated without the prices
+// themselves.
+type Aggregate struct {
+	Count      int     `dynamodbav:"count"`
+	Sum        float64 `dynamodbav:"sum"`
+	SumSquares float64 `dynamodbav:"sumSquares"`
+}
+
+// Add includes a price in the aggregate.
+func (a *Aggregate) Add(price int) {
+	x := float64(price)
+	a.Count++
+	a.Sum += x
+	a.SumSquares += x * x
+}
+
+// Remove excludes a price that was previously added.
+func (a *Aggregate) Remove(price int) {
+	x := float64(price)
+	a.Count--
+	a.Sum -= x
+	a.SumSquares -= x * x
+}
+
+// Stats returns the mean and sample standard deviation of the aggregated
+// prices, or nil if there are none.
+func (a *Aggregate) Stats() *PriceStats {
+	if a.Count == 0 {
+		return nil
+	}
+
+	n := float64(a.Count)
+	mean := a.Sum / n
+
+	var stddev float64
+	if a.Count > 1 {
+		// Rounding errors from removing prices can make the variance very
+		// slightly negative.
+		variance := (a.SumSquares - n*mean*mean) / (n - 1)
+		stddev = math.Sqrt(math.Max(variance, 0))
+	}
+
+	return &PriceStats{Mean: mean, Stddev: stddev, Samples: a.Count}
+}
+
+// RunningStats accumulates the stats of prices one at a time, so that they can
+// be calculated as prices are read, a page at a time, rather than after
+// holding them all.
+type RunningStats struct {
+	agg      Aggregate
+	extremes PriceStats
+}
+
+// Add includes a price in the stats.
+func (r *RunningStats) Add(p *GasPriceData) {
+	if r.agg.Count == 0 || p.Price < r.extremes.Min {
+		r.extremes.Min = p.Price
+		r.extremes.MinAt = p.Timestamp
+	}
+	if r.agg.Count == 0 || p.Price > r.extremes.Max {
+		r.extremes.Max = p.Price
+		r.extremes.MaxAt = p.Timestamp
+	}
+
+	r.agg.Add(p.Price)
+}
+
+// Count returns the number of prices added.
+func (r *RunningStats) Count() int {
+	return r.agg.Count
+}
+
+// Stats returns the stats of the prices added, or nil if there are none.
+func (r *RunningStats) Stats() *PriceStats {
+	stats := r.agg.Stats()
+	if stats == nil {
+		return nil
+	}
+
+	stats.Min, stats.MinAt = r.extremes.Min, r.extremes.MinAt
+	stats.Max, stats.MaxAt = r.extremes.Max, r.extremes.MaxAt
+
+	return stats
+}
+
+// Aggregates are the running aggregates of all stored prices, and of the
+// prices sampled in each UTC hour of the day and on each UTC day of the week.
+type Aggregates struct {
+	All   Aggregate   `dynamodbav:"all"`
+	Hours []Aggregate `dynamodbav:"hours"`
+	Days  []Aggregate `dynamodbav:"days"`
+	// Oldest is when the oldest price added was sampled. Remove leaves it
+	// unchanged, since the oldest price left is not known.
+	Oldest time.Time `dynamodbav:"oldest"`
+	// RebuiltAt is when the aggregates were last calculated from every
+	// stored price, rather than updated as prices were added and removed.
+	RebuiltAt time.Time `dynamodbav:"rebuiltAt"`
+}
+
+// NewAggregates returns the aggregates of the given prices.
+func NewAggregates(gasPrices []GasPriceData) *Aggregates {
+	a := Aggregates{Hours: make([]Aggregate, 24), Days: make([]Aggregate, 7)}
+	for i := range gasPrices {
+		a.Add(&gasPrices[i])
+	}
+
+	return &a
+}
+
+// Valid returns true if the aggregates have every bucket, which those
+// persisted by older versions may not.
+func (a *Aggregates) Valid() bool {
+	return len(a.Hours) == 24 && len(a.Days) == 7
+}
+
+// Add includes a price in the aggregates.
+func (a *Aggregates) Add(p *GasPriceData) {
+	a.All.Add(p.Price)
+	a.Hours[p.Timestamp.UTC().Hour()].Add(p.Price)
+	a.Days[p.Timestamp.UTC().Weekday()].Add(p.Price)
+	if a.Oldest.IsZero() || p.Timestamp.Before(a.Oldest) {
+		a.Oldest = p.Timestamp.UTC()
+	}
+}
+
+// Remove excludes a price that was previously added.
+func (a *Aggregates) Remove(p *GasPriceData) {
+	a.All.Remove(p.Price)
+	a.Hours[p.Timestamp.UTC().Hour()].Remove(p.Price)
+	a.Days[p.Timestamp.UTC().Weekday()].Remove(p.Price)
+}
+
+// HourStats returns the stats of the prices sampled in the same UTC hour of
+// the day as the given time, or nil if there are none.
+func (a *Aggregates) HourStats(at time.Time) *PriceStats {
+	return a.Hours[at.UTC().Hour()].Stats()
+}
+
+// DayStats returns the stats of the prices sampled on any of the given UTC
+// days of the week, or nil if there are none.
+func (a *Aggregates) DayStats(days ...time.Weekday) *PriceStats {
+	var sum Aggregate
+	for _, day := range days {
+		sum.Count += a.Days[day].Count
+		sum.Sum += a.Days[day].Sum
+		sum.SumSquares += a.Days[day].SumSquares
+	}
+
+	return sum.Stats()
+}
@@ -0,0 +1,117 @@
+package prices
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAggregateStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		add     []int
+		remove  []int
+		want    *PriceStats
+		wantNil bool
+	}{
+		{name: "empty", wantNil: true},
+		{name: "single price", add: []int{10}, want: &PriceStats{Mean: 10, Samples: 1}},
+		{
+			name: "sample stddev",
+			add:  []int{2, 4, 4, 4, 5, 5, 7, 9},
+			want: &PriceStats{Mean: 5, Stddev: math.Sqrt(32.0 / 7), Samples: 8},
+		},
+		{
+			name:   "removed prices",
+			add:    []int{10, 20, 30, 1000},
+			remove: []int{1000},
+			want:   &PriceStats{Mean: 20, Stddev: 10, Samples: 3},
+		},
+		{name: "all removed", add: []int{10, 20}, remove: []int{10, 20}, wantNil: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a Aggregate
+			for _, p := range tt.add {
+				a.Add(p)
+			}
+			for _, p := range tt.remove {
+				a.Remove(p)
+			}
+
+			got := a.Stats()
+			if tt.wantNil {
+				if got != nil {
+					t.Errorf("Stats() = %+v, want nil", got)
+				}
+				return
+			}
+
+			if got == nil || !statsEqual(got, tt.want) {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregatesRemove(t *testing.T) {
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var gasPrices []GasPriceData
+	for i := 0; i < 24*14; i++ {
+		gasPrices = append(gasPrices, GasPriceData{
+			Price:     10 + i%7*3 + i%24,
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+		})
+	}
+
+	tests := []struct {
+		name    string
+		removed int
+	}{
+		{name: "none removed", removed: 0},
+		{name: "first day removed", removed: 24},
+		{name: "first week removed", removed: 24 * 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAggregates(gasPrices)
+			for i := 0; i < tt.removed; i++ {
+				a.Remove(&gasPrices[i])
+			}
+
+			want := NewAggregates(gasPrices[tt.removed:])
+
+			if !statsEqual(a.All.Stats(), want.All.Stats()) {
+				t.Errorf("All = %+v, want %+v", a.All.Stats(), want.All.Stats())
+			}
+			for hour := 0; hour < 24; hour++ {
+				at := start.Add(time.Duration(hour) * time.Hour)
+				if !statsEqual(a.HourStats(at), want.HourStats(at)) {
+					t.Errorf("HourStats(%d) = %+v, want %+v", hour, a.HourStats(at), want.HourStats(at))
+				}
+			}
+			weekend := []time.Weekday{time.Saturday, time.Sunday}
+			if !statsEqual(a.DayStats(weekend...), want.DayStats(weekend...)) {
+				t.Errorf("DayStats(weekend) = %+v, want %+v", a.DayStats(weekend...), want.DayStats(weekend...))
+			}
+
+			// Remove leaves the oldest price unchanged.
+			if !a.Oldest.Equal(start) {
+				t.Errorf("Oldest = %s, want %s", a.Oldest, start)
+			}
+		})
+	}
+}
+
+// statsEqual compares the mean, stddev and number of samples of stats,
+// allowing for the rounding errors of removing prices.
+func statsEqual(a, b *PriceStats) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Samples == b.Samples && math.Abs(a.Mean-b.Mean) < 1e-9 && math.Abs(a.Stddev-b.Stddev) < 1e-6
+}
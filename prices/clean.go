@@ -0,0 +1,54 @@
+package prices
+
+import (
+	"sort"
+	"time"
+)
+
+// maxClockSkew is how far in the future a price may have been sampled, to
+// allow for clocks that are slightly ahead.
+const maxClockSkew = 5 * time.Minute
+
+// Discarded is a price that Clean left out, and why.
+type Discarded struct {
+	Price  GasPriceData
+	Reason string
+}
+
+// Clean normalises the timestamps of gas prices to UTC and orders them oldest
+// first. It discards prices without a timestamp, those sampled after now, and
+// all but the first of those sampled at the same instant, e.g. stored twice
+// with timestamps in different time zones, so that they do not skew stats.
+func Clean(gasPrices []GasPriceData, now time.Time) ([]GasPriceData, []Discarded) {
+	cleaned := make([]GasPriceData, 0, len(gasPrices))
+	var discarded []Discarded
+
+	for i := range gasPrices {
+		p := gasPrices[i]
+		p.Timestamp = p.Timestamp.UTC()
+
+		switch {
+		case p.Timestamp.IsZero():
+			discarded = append(discarded, Discarded{Price: p, Reason: "no timestamp"})
+		case p.Timestamp.After(now.Add(maxClockSkew)):
+			discarded = append(discarded, Discarded{Price: p, Reason: "sampled in the future"})
+		default:
+			cleaned = append(cleaned, p)
+		}
+	}
+
+	sort.SliceStable(cleaned, func(i, j int) bool {
+		return cleaned[i].Timestamp.Before(cleaned[j].Timestamp)
+	})
+
+	deduped := cleaned[:0]
+	for i := range cleaned {
+		if len(deduped) > 0 && cleaned[i].Timestamp.Equal(deduped[len(deduped)-1].Timestamp) {
+			discarded = append(discarded, Discarded{Price: cleaned[i], Reason: "duplicate timestamp"})
+			continue
+		}
+		deduped = append(deduped, cleaned[i])
+	}
+
+	return deduped, discarded
+}
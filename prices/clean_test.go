@@ -0,0 +1,92 @@
+package prices
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClean(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	est := time.FixedZone("EST", -5*60*60)
+
+	tests := []struct {
+		name      string
+		input     []GasPriceData
+		want      []GasPriceData
+		discarded []string
+	}{
+		{
+			name: "sorts oldest first",
+			input: []GasPriceData{
+				{Price: 2, Timestamp: now.Add(-time.Hour)},
+				{Price: 1, Timestamp: now.Add(-2 * time.Hour)},
+				{Price: 3, Timestamp: now},
+			},
+			want: []GasPriceData{
+				{Price: 1, Timestamp: now.Add(-2 * time.Hour)},
+				{Price: 2, Timestamp: now.Add(-time.Hour)},
+				{Price: 3, Timestamp: now},
+			},
+		},
+		{
+			name: "normalises to UTC",
+			input: []GasPriceData{
+				{Price: 1, Timestamp: now.In(est)},
+			},
+			want: []GasPriceData{
+				{Price: 1, Timestamp: now},
+			},
+		},
+		{
+			name: "discards duplicates in other time zones",
+			input: []GasPriceData{
+				{Price: 1, Timestamp: now},
+				{Price: 2, Timestamp: now.In(est)},
+			},
+			want: []GasPriceData{
+				{Price: 1, Timestamp: now},
+			},
+			discarded: []string{"duplicate timestamp"},
+		},
+		{
+			name: "discards prices without a timestamp",
+			input: []GasPriceData{
+				{Price: 1},
+				{Price: 2, Timestamp: now},
+			},
+			want: []GasPriceData{
+				{Price: 2, Timestamp: now},
+			},
+			discarded: []string{"no timestamp"},
+		},
+		{
+			name: "allows for clock skew",
+			input: []GasPriceData{
+				{Price: 1, Timestamp: now.Add(maxClockSkew)},
+				{Price: 2, Timestamp: now.Add(maxClockSkew + time.Second)},
+			},
+			want: []GasPriceData{
+				{Price: 1, Timestamp: now.Add(maxClockSkew)},
+			},
+			discarded: []string{"sampled in the future"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, discarded := Clean(tt.input, now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Clean() = %v, want %v", got, tt.want)
+			}
+
+			var reasons []string
+			for i := range discarded {
+				reasons = append(reasons, discarded[i].Reason)
+			}
+			if !reflect.DeepEqual(reasons, tt.discarded) {
+				t.Errorf("Clean() discarded %v, want %v", reasons, tt.discarded)
+			}
+		})
+	}
+}
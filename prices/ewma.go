@@ -0,0 +1,49 @@
+package prices
+
+import (
+	"math"
+	"time"
+)
+
+// EWMA tracks an exponentially weighted moving average and variance of gas
+// prices. Unlike a flat mean over a fixed window, it weights recent prices
+// more heavily, so it reacts faster to sustained shifts in price.
+type EWMA struct {
+	Mean     float64   `dynamodbav:"mean"`
+	Variance float64   `dynamodbav:"variance"`
+	Samples  int       `dynamodbav:"samples"`
+	Updated  time.Time `dynamodbav:"updated"`
+}
+
+// Update incorporates a new price observed at the given time. The weight of
+// older prices halves every half-life, regardless of how often prices are
+// sampled.
+func (e *EWMA) Update(price int, at time.Time, halfLife time.Duration) {
+	x := float64(price)
+
+	if e.Samples == 0 {
+		e.Mean = x
+		e.Variance = 0
+		e.Samples = 1
+		e.Updated = at
+		return
+	}
+
+	elapsed := at.Sub(e.Updated)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	alpha := 1 - math.Exp(-math.Ln2*float64(elapsed)/float64(halfLife))
+
+	diff := x - e.Mean
+	incr := alpha * diff
+	e.Mean += incr
+	e.Variance = (1 - alpha) * (e.Variance + diff*incr)
+	e.Samples++
+	e.Updated = at
+}
+
+// Stats returns the current mean and standard deviation.
+func (e *EWMA) Stats() *PriceStats {
+	return &PriceStats{Mean: e.Mean, Stddev: math.Sqrt(e.Variance), Samples: e.Samples}
+}
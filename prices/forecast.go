@@ -0,0 +1,138 @@
+package prices
+
+import (
+	"errors"
+	"math"
+)
+
+// HoltWinters is an additive exponential smoothing model of a price series.
+// When the series covers at least two seasons it models level, trend and
+// seasonality (triple exponential smoothing), otherwise only level and trend
+// (double exponential smoothing).
+type HoltWinters struct {
+	Alpha  float64
+	Beta   float64
+	Gamma  float64
+	Period int
+
+	level    float64
+	trend    float64
+	seasonal []float64
+	n        int
+}
+
+// smoothingGrid is the set of values tried for each smoothing parameter when
+// fitting a model.
+var smoothingGrid = []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+
+// FitHoltWinters fits a model to a series of evenly spaced prices, oldest
+// first, choosing the smoothing parameters that minimise the squared error of
+// one-step-ahead predictions. The period is the number of samples in a season,
+// e.g. 24 for hourly samples with a daily cycle, or 0 to disable seasonality.
+func FitHoltWinters(series []float64, period int) (*HoltWinters, error) {
+	if len(series) < 2 {
+		return nil, errors.New("at least two prices are needed to forecast")
+	}
+	if period < 2 || len(series) < 2*period {
+		period = 0
+	}
+
+	gammas := smoothingGrid
+	if period == 0 {
+		gammas = []float64{0}
+	}
+
+	var best *HoltWinters
+	bestSSE := math.Inf(1)
+
+	for _, alpha := range smoothingGrid {
+		for _, beta := range smoothingGrid {
+			for _, gamma := range gammas {
+				m := HoltWinters{Alpha: alpha, Beta: beta, Gamma: gamma, Period: period}
+				sse := m.fit(series)
+
+				if sse < bestSSE {
+					bestSSE = sse
+					best = &m
+				}
+			}
+		}
+	}
+
+	return best, nil
+}
+
+// fit runs the model over the series, leaving it ready to predict the
+// following prices, and returns the sum of squared one-step-ahead errors.
+func (m *HoltWinters) fit(series []float64) float64 {
+	var start int
+
+	if m.Period == 0 {
+		m.level = series[0]
+		m.trend = series[1] - series[0]
+		m.seasonal = nil
+		start = 1
+	} else {
+		first := mean(series[:m.Period])
+		second := mean(series[m.Period : 2*m.Period])
+
+		m.level = first
+		m.trend = (second - first) / float64(m.Period)
+		m.seasonal = make([]float64, m.Period)
+		for i := range m.seasonal {
+			m.seasonal[i] = series[i] - first
+		}
+		start = m.Period
+	}
+
+	var sse float64
+
+	for t := start; t < len(series); t++ {
+		x := series[t]
+		s := m.season(t)
+
+		diff := x - (m.level + m.trend + s)
+		sse += diff * diff
+
+		level := m.Alpha*(x-s) + (1-m.Alpha)*(m.level+m.trend)
+		m.trend = m.Beta*(level-m.level) + (1-m.Beta)*m.trend
+		if m.seasonal != nil {
+			m.seasonal[t%m.Period] = m.Gamma*(x-level) + (1-m.Gamma)*s
+		}
+		m.level = level
+	}
+
+	m.n = len(series)
+
+	return sse
+}
+
+func (m *HoltWinters) season(t int) float64 {
+	if m.seasonal == nil {
+		return 0
+	}
+
+	return m.seasonal[t%m.Period]
+}
+
+// Predict returns the predicted prices for the given number of samples
+// following the fitted series. Predictions are never negative.
+func (m *HoltWinters) Predict(steps int) []float64 {
+	predictions := make([]float64, steps)
+
+	for h := 1; h <= steps; h++ {
+		p := m.level + float64(h)*m.trend + m.season(m.n+h-1)
+		predictions[h-1] = math.Max(p, 0)
+	}
+
+	return predictions
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
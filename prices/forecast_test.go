@@ -0,0 +1,75 @@
+package prices
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHoltWinters(t *testing.T) {
+	tests := []struct {
+		name   string
+		series []float64
+		period int
+		steps  int
+		want   []float64
+	}{
+		{
+			name:   "constant",
+			series: []float64{30, 30, 30, 30},
+			steps:  2,
+			want:   []float64{30, 30},
+		},
+		{
+			name:   "linear trend",
+			series: []float64{10, 12, 14, 16, 18},
+			steps:  3,
+			want:   []float64{20, 22, 24},
+		},
+		{
+			name:   "never negative",
+			series: []float64{10, 5},
+			steps:  3,
+			want:   []float64{0, 0, 0},
+		},
+		{
+			name:   "seasonal",
+			series: []float64{10, 20, 30, 20, 10, 20, 30, 20, 10, 20, 30, 20},
+			period: 4,
+			steps:  5,
+			want:   []float64{10, 20, 30, 20, 10},
+		},
+		{
+			name:   "too short for seasonality",
+			series: []float64{10, 20, 30, 40, 50},
+			period: 4,
+			steps:  1,
+			want:   []float64{60},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := FitHoltWinters(tt.series, tt.period)
+			if err != nil {
+				t.Fatalf("FitHoltWinters: %v", err)
+			}
+
+			got := m.Predict(tt.steps)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Predict(%d) returned %d predictions", tt.steps, len(got))
+			}
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-6 {
+					t.Errorf("Predict(%d) = %v, want %v", tt.steps, got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestHoltWintersTooShort(t *testing.T) {
+	if _, err := FitHoltWinters([]float64{10}, 0); err == nil {
+		t.Error("FitHoltWinters of a single price succeeded")
+	}
+}
@@ -2,6 +2,7 @@ package prices
 
 import (
 	"errors"
+	"math"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -12,6 +13,17 @@ type GasPriceData struct {
 	Price     int           `json:"price"`
 	Timestamp time.Time     `json:"timestamp"`
 	Category  PriceCategory `json:"category"`
+	// EthUSD is the price of ETH in USD when the gas price was sampled, or 0
+	// if it is unknown.
+	EthUSD float64 `json:"ethUsd,omitempty"`
+	// RequestID identifies the invocation that sampled the price, if known,
+	// so that a retried invocation does not store a second sample.
+	RequestID string `json:"-" dynamodbav:"requestId,omitempty"`
+	// Key is the timestamp that the price is stored under, if it was read
+	// from the store. It may be in a different time zone to Timestamp, for
+	// prices stored by earlier versions, so it is what the price is deleted
+	// by.
+	Key string `json:"-" dynamodbav:"key,omitempty"`
 }
 
 type PriceCategory int
@@ -20,10 +32,22 @@ const (
 	High PriceCategory = iota
 	Average
 	Low
+	// VeryHigh and VeryLow are only used when the corresponding bands are
+	// configured, and are appended to keep the values of existing categories.
+	VeryHigh
+	VeryLow
 )
 
+// Valid returns true if p is one of the categories above.
+func (p PriceCategory) Valid() bool {
+	return p >= High && p <= VeryLow
+}
+
 func (p PriceCategory) String() string {
 	switch p {
+	case VeryHigh:
+		return "Very High"
+
 	case High:
 		return "High"
 
@@ -33,10 +57,50 @@ func (p PriceCategory) String() string {
 	case Low:
 		return "Low"
 
+	case VeryLow:
+		return "Very Low"
+
 	default:
 		panic("unexpected price category")
 	}
 }
+
+// Broad returns the equivalent category on the three-level scale, i.e. High
+// for Very High and Low for Very Low.
+func (p PriceCategory) Broad() PriceCategory {
+	switch p {
+	case VeryHigh:
+		return High
+
+	case VeryLow:
+		return Low
+
+	default:
+		return p
+	}
+}
+
+// Level orders the categories from cheapest to most expensive, from 0 for
+// Very Low to 4 for Very High, so that a category can be charted as a number.
+func (p PriceCategory) Level() int {
+	switch p {
+	case VeryLow:
+		return 0
+
+	case Low:
+		return 1
+
+	case Average:
+		return 2
+
+	case High:
+		return 3
+
+	default:
+		return 4
+	}
+}
+
 func (p PriceCategory) MarshalDynamoDBAttributeValue(av *dynamodb.AttributeValue) error {
 	av.S = aws.String(p.String())
 	return nil
@@ -47,7 +111,7 @@ func (p *PriceCategory) UnmarshalDynamoDBAttributeValue(av *dynamodb.AttributeVa
 		return nil
 	}
 
-	val, err := parsePriceCategory(av.S)
+	val, err := ParsePriceCategory(*av.S)
 	if err != nil {
 		return err
 	}
@@ -56,8 +120,13 @@ func (p *PriceCategory) UnmarshalDynamoDBAttributeValue(av *dynamodb.AttributeVa
 	return nil
 }
 
-func parsePriceCategory(input *string) (PriceCategory, error) {
-	switch *input {
+// ParsePriceCategory parses the string representation of a price category, as
+// returned by PriceCategory.String().
+func ParsePriceCategory(input string) (PriceCategory, error) {
+	switch input {
+	case "Very High", "VeryHigh":
+		return VeryHigh, nil
+
 	case "High":
 		return High, nil
 
@@ -67,26 +136,123 @@ func parsePriceCategory(input *string) (PriceCategory, error) {
 	case "Low":
 		return Low, nil
 
+	case "Very Low", "VeryLow":
+		return VeryLow, nil
+
 	default:
 		return Average, errors.New("unexpected price category")
 	}
 }
 
 func CategorisePrice(price int, stats *PriceStats) PriceCategory {
+	return CategorisePriceWithBands(price, stats, nil, DefaultBands)
+}
+
+// Bands configures, in standard deviations from the mean, where prices enter
+// and exit the High and Low categories. The bands may be asymmetric, e.g. to
+// only treat prices as High when they are far above the mean. Setting an exit
+// band closer to the mean than the corresponding entry band adds hysteresis,
+// which stops prices that hover around a boundary from flapping between
+// categories.
+//
+// The Very High and Very Low categories are only used if their bands are
+// non-zero, in which case they must be further from the mean than the High
+// and Low bands.
+//
+// Until the stats are calculated from MinSamples prices, every price is
+// Average, and the standard deviation is taken to be at least MinStddev, so
+// that the first few prices, which often barely vary, do not make every
+// later price High or Low.
+type Bands struct {
+	VeryHighEnter float64
+	HighEnter     float64
+	HighExit      float64
+	LowEnter      float64
+	LowExit       float64
+	VeryLowEnter  float64
+	MinSamples    int
+	MinStddev     float64
+}
+
+// DefaultBands enters and exits the High and Low categories at 1 standard
+// deviation from the mean, without the Very High and Very Low categories,
+// taking the standard deviation to be at least 1 gwei.
+var DefaultBands = Bands{
+	HighEnter: 1.0, HighExit: 1.0, LowEnter: 1.0, LowExit: 1.0, MinStddev: 1.0,
+}
+
+// CategorisePriceWithBands categorises a price using the given bands. If the
+// previous category is known, a High or Low price only returns to Average once
+// it has crossed the corresponding exit band.
+func CategorisePriceWithBands(
+	price int, stats *PriceStats, previous *PriceCategory, bands Bands,
+) PriceCategory {
+	if stats.Samples < bands.MinSamples {
+		return Average
+	}
+
 	fprice := float64(price)
+	mean, stddev := stats.Mean, math.Max(stats.Stddev, bands.MinStddev)
 
-	if fprice < (stats.Mean - stats.Stddev) {
+	if bands.VeryLowEnter > 0 && fprice < (mean-bands.VeryLowEnter*stddev) {
+		return VeryLow
+	}
+
+	if fprice < (mean - bands.LowEnter*stddev) {
 		return Low
 	}
 
-	if fprice > (stats.Mean + stats.Stddev) {
+	if bands.VeryHighEnter > 0 && fprice > (mean+bands.VeryHighEnter*stddev) {
+		return VeryHigh
+	}
+
+	if fprice > (mean + bands.HighEnter*stddev) {
 		return High
 	}
 
+	if previous == nil {
+		return Average
+	}
+
+	switch previous.Broad() {
+	case High:
+		if fprice > (mean + bands.HighExit*stddev) {
+			return High
+		}
+
+	case Low:
+		if fprice < (mean - bands.LowExit*stddev) {
+			return Low
+		}
+	}
+
 	return Average
 }
 
 type PriceStats struct {
 	Mean   float64
 	Stddev float64
+	// Samples is the number of prices that the stats were calculated from.
+	Samples int
+	// Context describes what the stats are typical of when they are not
+	// calculated over all stored prices, e.g. "15:00 UTC" or "a Sunday".
+	Context string
+	// Min and Max are the lowest and highest prices in the window, and
+	// MinAt and MaxAt when they were sampled.
+	Min   int
+	MinAt time.Time
+	Max   int
+	MaxAt time.Time
+}
+
+// ZScore returns how many standard deviations a price is above the mean, or
+// below it if negative, taking the standard deviation to be at least
+// minStddev, as CategorisePriceWithBands does.
+func (s *PriceStats) ZScore(price int, minStddev float64) float64 {
+	stddev := math.Max(s.Stddev, minStddev)
+	if stddev == 0 {
+		return 0
+	}
+
+	return (float64(price) - s.Mean) / stddev
 }
@@ -0,0 +1,79 @@
+package prices
+
+import "testing"
+
+func TestCategorisePriceWithBands(t *testing.T) {
+	bands := Bands{
+		VeryHighEnter: 2,
+		HighEnter:     1,
+		HighExit:      0.5,
+		LowEnter:      1,
+		LowExit:       0.5,
+		VeryLowEnter:  2,
+		MinSamples:    10,
+		MinStddev:     5,
+	}
+	stats := &PriceStats{Mean: 100, Stddev: 10, Samples: 100}
+	flat := &PriceStats{Mean: 100, Stddev: 0.5, Samples: 100}
+	few := &PriceStats{Mean: 100, Stddev: 10, Samples: 5}
+
+	high, veryHigh, low, average := High, VeryHigh, Low, Average
+
+	tests := []struct {
+		name     string
+		price    int
+		stats    *PriceStats
+		previous *PriceCategory
+		want     PriceCategory
+	}{
+		{name: "at the mean", price: 100, stats: stats, want: Average},
+		{name: "above the high band", price: 111, stats: stats, want: High},
+		{name: "above the very high band", price: 121, stats: stats, want: VeryHigh},
+		{name: "below the low band", price: 89, stats: stats, want: Low},
+		{name: "below the very low band", price: 79, stats: stats, want: VeryLow},
+		{name: "between the high bands", price: 106, stats: stats, want: Average},
+		{name: "high stays high above the exit band", price: 106, stats: stats, previous: &high, want: High},
+		{name: "very high stays high above the exit band", price: 106, stats: stats, previous: &veryHigh, want: High},
+		{name: "high exits below the exit band", price: 104, stats: stats, previous: &high, want: Average},
+		{name: "low stays low below the exit band", price: 94, stats: stats, previous: &low, want: Low},
+		{name: "low exits above the exit band", price: 96, stats: stats, previous: &low, want: Average},
+		{name: "average does not enter high at the exit band", price: 106, stats: stats, previous: &average, want: Average},
+		{name: "too few samples", price: 200, stats: few, want: Average},
+		{name: "flat prices use the minimum stddev", price: 103, stats: flat, want: Average},
+		{name: "above the minimum stddev", price: 106, stats: flat, want: High},
+		{name: "far below flat prices", price: 89, stats: flat, want: VeryLow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CategorisePriceWithBands(tt.price, tt.stats, tt.previous, bands)
+			if got != tt.want {
+				t.Errorf("CategorisePriceWithBands(%d) = %s, want %s", tt.price, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCategorisePrice(t *testing.T) {
+	tests := []struct {
+		name  string
+		price int
+		stats *PriceStats
+		want  PriceCategory
+	}{
+		{name: "average", price: 105, stats: &PriceStats{Mean: 100, Stddev: 10, Samples: 10}, want: Average},
+		{name: "high", price: 111, stats: &PriceStats{Mean: 100, Stddev: 10, Samples: 10}, want: High},
+		{name: "no very high by default", price: 200, stats: &PriceStats{Mean: 100, Stddev: 10, Samples: 10}, want: High},
+		{name: "no very low by default", price: 1, stats: &PriceStats{Mean: 100, Stddev: 10, Samples: 10}, want: Low},
+		{name: "stddev of at least 1 gwei", price: 101, stats: &PriceStats{Mean: 100, Samples: 10}, want: Average},
+		{name: "above 1 gwei", price: 102, stats: &PriceStats{Mean: 100, Samples: 10}, want: High},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CategorisePrice(tt.price, tt.stats); got != tt.want {
+				t.Errorf("CategorisePrice(%d) = %s, want %s", tt.price, got, tt.want)
+			}
+		})
+	}
+}
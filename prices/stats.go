@@ -0,0 +1,137 @@
+package prices
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Stats returns the mean, standard deviation and extremes of the gas prices.
+func Stats(gasPrices []GasPriceData) (*PriceStats, error) {
+	if len(gasPrices) == 0 {
+		return nil, errors.New("no gas prices")
+	}
+
+	mean := Mean(gasPrices)
+	stddev := StdDev(gasPrices, mean)
+
+	stats := PriceStats{Mean: mean, Stddev: stddev, Samples: len(gasPrices)}
+	stats.SetExtremes(gasPrices)
+
+	return &stats, nil
+}
+
+// SetExtremes sets the lowest and highest prices, and when they were sampled.
+func (s *PriceStats) SetExtremes(gasPrices []GasPriceData) {
+	for i := range gasPrices {
+		p := &gasPrices[i]
+
+		if i == 0 || p.Price < s.Min {
+			s.Min = p.Price
+			s.MinAt = p.Timestamp
+		}
+		if i == 0 || p.Price > s.Max {
+			s.Max = p.Price
+			s.MaxAt = p.Timestamp
+		}
+	}
+}
+
+// Mean returns the mean of the gas prices.
+func Mean(gasPrices []GasPriceData) float64 {
+	var sum float64
+
+	for i := range gasPrices {
+		sum += float64(gasPrices[i].Price)
+	}
+
+	return sum / float64(len(gasPrices))
+}
+
+// StdDev returns the sample standard deviation of the gas prices about mean.
+func StdDev(gasPrices []GasPriceData, mean float64) float64 {
+	if len(gasPrices) == 1 {
+		return 0.0
+	}
+
+	var sumSquares float64
+
+	for i := range gasPrices {
+		diff := float64(gasPrices[i].Price) - mean
+		sumSquares += diff * diff
+	}
+
+	variance := sumSquares / float64(len(gasPrices)-1)
+	return math.Sqrt(variance)
+}
+
+// Within returns the prices sampled within the window before now.
+func Within(gasPrices []GasPriceData, window time.Duration, now time.Time) []GasPriceData {
+	since := now.Add(-window)
+
+	var within []GasPriceData
+	for i := range gasPrices {
+		if gasPrices[i].Timestamp.After(since) {
+			within = append(within, gasPrices[i])
+		}
+	}
+
+	return within
+}
+
+// PercentileRank returns the percentage of the prices that are cheaper than
+// price, counting those equal to it as half cheaper, e.g. 25 if price is
+// cheaper than 75% of them. It returns 0 if there are no prices.
+func PercentileRank(price int, gasPrices []GasPriceData) float64 {
+	if len(gasPrices) == 0 {
+		return 0
+	}
+
+	var below float64
+	for i := range gasPrices {
+		switch {
+		case gasPrices[i].Price < price:
+			below++
+
+		case gasPrices[i].Price == price:
+			below += 0.5
+		}
+	}
+
+	return below / float64(len(gasPrices)) * 100
+}
+
+// Oldest returns the least recent gas price, or nil if there are none.
+func Oldest(gasPrices []GasPriceData) *GasPriceData {
+	var oldestPrice *GasPriceData
+	for i := range gasPrices {
+		if oldestPrice == nil || gasPrices[i].Timestamp.Before(oldestPrice.Timestamp) {
+			oldestPrice = &gasPrices[i]
+		}
+	}
+
+	return oldestPrice
+}
+
+// Latest returns the most recent gas price, or nil if there are none.
+func Latest(gasPrices []GasPriceData) *GasPriceData {
+	var lastPrice *GasPriceData
+	for i := range gasPrices {
+		if lastPrice == nil || gasPrices[i].Timestamp.After(lastPrice.Timestamp) {
+			lastPrice = &gasPrices[i]
+		}
+	}
+
+	return lastPrice
+}
+
+// LastCategory returns the category of the most recent gas price, or nil if
+// there are none.
+func LastCategory(gasPrices []GasPriceData) *PriceCategory {
+	lastPrice := Latest(gasPrices)
+	if lastPrice == nil {
+		return nil
+	}
+
+	return &lastPrice.Category
+}
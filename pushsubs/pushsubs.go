@@ -0,0 +1,105 @@
+// Package pushsubs stores the Web Push subscriptions of browsers that want to
+// receive gas price alerts.
+package pushsubs
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+)
+
+const TableName = "gasPushSubscriptions"
+
+// Subscription is a browser push subscription, in the same JSON format as
+// returned by PushSubscription.toJSON() in the browser.
+type Subscription struct {
+	Endpoint  string    `json:"endpoint" dynamodbav:"endpoint"`
+	Keys      Keys      `json:"keys" dynamodbav:"keys"`
+	CreatedAt time.Time `json:"-" dynamodbav:"createdAt"`
+}
+
+type Keys struct {
+	Auth   string `json:"auth" dynamodbav:"auth"`
+	P256dh string `json:"p256dh" dynamodbav:"p256dh"`
+}
+
+// Validate checks that a subscription has an HTTPS endpoint and both keys.
+func (s *Subscription) Validate() error {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return errors.Wrap(err, "invalid endpoint")
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("endpoint must be an https URL, got %q", s.Endpoint)
+	}
+	if s.Keys.Auth == "" || s.Keys.P256dh == "" {
+		return errors.New("subscription keys must include auth and p256dh")
+	}
+
+	return nil
+}
+
+// Save stores a subscription, replacing any existing subscription with the
+// same endpoint.
+func Save(svc *dynamodb.DynamoDB, s *Subscription) error {
+	av, err := dynamodbattribute.MarshalMap(s)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(TableName),
+	})
+	return err
+}
+
+// Delete removes the subscription with the given endpoint.
+func Delete(svc *dynamodb.DynamoDB, endpoint string) error {
+	_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"endpoint": {
+				S: aws.String(endpoint),
+			},
+		},
+		TableName: aws.String(TableName),
+	})
+	return err
+}
+
+// ReadAll reads every stored subscription.
+func ReadAll(svc *dynamodb.DynamoDB) ([]Subscription, error) {
+	var subs []Subscription
+	var startKey map[string]*dynamodb.AttributeValue
+
+	for {
+		result, err := svc.Scan(&dynamodb.ScanInput{
+			Select:            aws.String(dynamodb.SelectAllAttributes),
+			TableName:         aws.String(TableName),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range result.Items {
+			var s Subscription
+			if err := dynamodbattribute.UnmarshalMap(result.Items[i], &s); err != nil {
+				return nil, err
+			}
+
+			subs = append(subs, s)
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
+	}
+
+	return subs, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/gastracker"
+	"github.com/ryanc414/gas-tracker/logging"
+)
+
+// queueMessage is the body of a message on the queue: either a price sampled
+// by another system, e.g.
+//
+//	{"type": "sample", "sample": {"price": 42, "ethUsd": 1800.5, "timestamp": "2021-03-01T12:00:00Z"}}
+//
+// which is processed as if the tracker had sampled it, or an alert to send,
+// e.g.
+//
+//	{"type": "alert", "alert": {"subject": "Deploy window open", "message": "...", "severity": "notice"}}
+type queueMessage struct {
+	Type   string                   `json:"type"`
+	Sample *gastracker.Sample       `json:"sample"`
+	Alert  *gastracker.AlertRequest `json:"alert"`
+}
+
+// pendingMessage is a message from the batch that is yet to be processed.
+type pendingMessage struct {
+	id  string
+	msg queueMessage
+}
+
+// Processes price samples and alerts enqueued on SQS by other systems. The
+// event source mapping must enable ReportBatchItemFailures, so that only the
+// messages that failed are retried rather than the whole batch.
+func main() {
+	if err := logging.Setup(false); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	lambda.Start(HandleRequest)
+}
+
+// HandleRequest processes a batch of messages, reporting those that failed.
+// Alerts are sent first, then samples oldest first, since a sample older than
+// the latest stored price is rejected. Such stale samples are dropped, since
+// they can never be stored. Once a sample fails otherwise, those after it are
+// reported as failed too, so that they are retried after it rather than
+// leaving it behind.
+func HandleRequest(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	var resp events.SQSEventResponse
+	fail := func(id string, err error) {
+		log.Error().Err(err).Str("messageId", id).Msg("failed to process message")
+		resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: id})
+	}
+
+	var samples, alerts []pendingMessage
+	for _, record := range event.Records {
+		msg, err := parseMessage(record.Body)
+		if err != nil {
+			fail(record.MessageId, err)
+			continue
+		}
+
+		if msg.Sample != nil {
+			samples = append(samples, pendingMessage{id: record.MessageId, msg: msg})
+		} else {
+			alerts = append(alerts, pendingMessage{id: record.MessageId, msg: msg})
+		}
+	}
+
+	for _, m := range alerts {
+		sent, err := gastracker.SendAlert(ctx, *m.msg.Alert)
+		if err != nil {
+			fail(m.id, err)
+			continue
+		}
+
+		log.Info().Str("messageId", m.id).Int("notificationsSent", sent).Msg("processed alert")
+	}
+
+	// Samples without a timestamp are processed as of now, so after the rest.
+	sort.SliceStable(samples, func(i, j int) bool {
+		a, b := samples[i].msg.Sample.Timestamp, samples[j].msg.Sample.Timestamp
+		return !a.IsZero() && (b.IsZero() || a.Before(b))
+	})
+
+	var sampleErr error
+	for _, m := range samples {
+		if sampleErr != nil {
+			fail(m.id, errors.Wrap(sampleErr, "while processing an earlier sample"))
+			continue
+		}
+
+		// The message ID stops a redelivered message storing its sample twice.
+		opts := gastracker.RunOptions{Sample: m.msg.Sample, RequestID: m.id}
+		_, err := gastracker.Run(ctx, opts)
+		switch {
+		case errors.Is(err, gastracker.ErrStaleSample):
+			// A stale sample can never be stored, so it is dropped rather
+			// than retried along with every sample after it.
+			log.Warn().Err(err).Str("messageId", m.id).Msg("dropped stale sample")
+		case err != nil:
+			sampleErr = err
+			fail(m.id, err)
+		}
+	}
+
+	return resp, nil
+}
+
+// parseMessage parses and checks the body of a message.
+func parseMessage(body string) (queueMessage, error) {
+	var msg queueMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		return queueMessage{}, errors.Wrap(err, "while parsing message")
+	}
+
+	switch {
+	case msg.Type == "sample" && msg.Sample != nil:
+		msg.Alert = nil
+	case msg.Type == "alert" && msg.Alert != nil:
+		msg.Sample = nil
+	default:
+		return queueMessage{}, errors.Errorf(`invalid message of type %q, expected a "sample" or an "alert"`, msg.Type)
+	}
+
+	return msg, nil
+}
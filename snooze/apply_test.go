@@ -0,0 +1,66 @@
+package snooze_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/ryanc414/gas-tracker/fakes"
+	"github.com/ryanc414/gas-tracker/snooze"
+)
+
+func TestApply(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		wantUntil time.Time
+	}{
+		{name: "first snooze", durations: []time.Duration{4 * time.Hour}, wantUntil: now.Add(4 * time.Hour)},
+		{
+			name:      "longer snooze extends",
+			durations: []time.Duration{time.Hour, 4 * time.Hour},
+			wantUntil: now.Add(4 * time.Hour),
+		},
+		{
+			name:      "shorter snooze is ignored",
+			durations: []time.Duration{4 * time.Hour, time.Hour},
+			wantUntil: now.Add(4 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := dynamodb.New(fakes.NewStore().Session())
+
+			var s *snooze.Suppression
+			for _, d := range tt.durations {
+				var err error
+				s, err = snooze.Apply(svc, &snooze.Token{Action: snooze.Snooze, Scope: snooze.AllAlerts, Duration: d}, now)
+				if err != nil {
+					t.Fatalf("Apply: %v", err)
+				}
+			}
+			if !s.Until.Equal(tt.wantUntil) {
+				t.Errorf("Apply() until %s, want %s", s.Until, tt.wantUntil)
+			}
+
+			active, err := snooze.Active(svc, "spike", now.Add(3*time.Hour))
+			if err != nil {
+				t.Fatalf("Active: %v", err)
+			}
+			if active == nil || !active.Until.Equal(tt.wantUntil) {
+				t.Errorf("Active() = %+v, want until %s", active, tt.wantUntil)
+			}
+
+			active, err = snooze.Active(svc, "spike", tt.wantUntil)
+			if err != nil {
+				t.Fatalf("Active: %v", err)
+			}
+			if active != nil {
+				t.Errorf("Active() after it ends = %+v, want nil", active)
+			}
+		})
+	}
+}
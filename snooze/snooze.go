@@ -0,0 +1,237 @@
+// Package snooze implements signed links that let recipients snooze further
+// alerts, or acknowledge a specific alert, along with the persisted state that
+// the tracker checks before sending alerts.
+package snooze
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+)
+
+const (
+	TableName = "gasSnoozes"
+	// AllAlerts is the scope used to snooze every alert.
+	AllAlerts = "all"
+	// LinkLifetime is how long links remain valid after they are sent.
+	LinkLifetime = 7 * 24 * time.Hour
+)
+
+type Action string
+
+const (
+	// Snooze suppresses every alert for a duration.
+	Snooze Action = "snooze"
+	// Acknowledge suppresses repeats of a single alert for a duration.
+	Acknowledge Action = "ack"
+)
+
+// Token is the signed content of an action link.
+type Token struct {
+	Action   Action        `json:"action"`
+	Scope    string        `json:"scope"`
+	Duration time.Duration `json:"duration"`
+	Expires  time.Time     `json:"expires"`
+}
+
+// Sign encodes and signs a token so that it can be included in a URL.
+func Sign(secret []byte, t *Token) (string, error) {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac(secret, encoded)), nil
+}
+
+// Verify checks the signature and expiry of a signed token and decodes it.
+func Verify(secret []byte, signed string, now time.Time) (*Token, error) {
+	parts := strings.SplitN(signed, ".", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed token")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed token signature")
+	}
+	if !hmac.Equal(sig, mac(secret, parts[0])) {
+		return nil, errors.New("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed token payload")
+	}
+
+	var t Token
+	if err := json.Unmarshal(payload, &t); err != nil {
+		return nil, errors.Wrap(err, "malformed token payload")
+	}
+
+	if now.After(t.Expires) {
+		return nil, errors.New("link has expired")
+	}
+
+	return &t, nil
+}
+
+func mac(secret []byte, payload string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// Link returns a URL to the action endpoint for a signed token.
+func Link(baseURL string, secret []byte, t *Token) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", errors.Wrap(err, "while parsing base URL")
+	}
+
+	signed, err := Sign(secret, t)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("token", signed)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Suppression stops alerts in a scope, either every alert or a single alert
+// key, from being sent until a given time.
+type Suppression struct {
+	Scope     string    `dynamodbav:"scope"`
+	Action    Action    `dynamodbav:"action"`
+	Until     time.Time `dynamodbav:"until"`
+	CreatedAt time.Time `dynamodbav:"createdAt"`
+}
+
+// maxApplyAttempts bounds how often Apply retries when the stored
+// suppression changes between reading and writing it.
+const maxApplyAttempts = 3
+
+// Apply stores the suppression described by a verified token. A suppression
+// that is already active for the scope and lasts longer is kept, so following
+// a shorter link never cuts an earlier snooze short. It returns the
+// suppression that is in effect afterwards.
+func Apply(svc *dynamodb.DynamoDB, t *Token, now time.Time) (*Suppression, error) {
+	s := Suppression{
+		Scope:     t.Scope,
+		Action:    t.Action,
+		Until:     now.Add(t.Duration),
+		CreatedAt: now,
+	}
+
+	av, err := dynamodbattribute.MarshalMap(&s)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < maxApplyAttempts; attempt++ {
+		item, err := get(svc, t.Scope)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only replace the suppression that was read, so that one stored in
+		// the meantime is not overwritten.
+		condition := "attribute_not_exists(#scope)"
+		names := map[string]*string{"#scope": aws.String("scope")}
+		var values map[string]*dynamodb.AttributeValue
+
+		if item != nil {
+			var existing Suppression
+			if err := dynamodbattribute.UnmarshalMap(item, &existing); err != nil {
+				return nil, err
+			}
+
+			if !existing.Until.Before(s.Until) {
+				return &existing, nil
+			}
+
+			names = map[string]*string{"#until": aws.String("until")}
+			if until, ok := item["until"]; ok {
+				condition = "#until = :until"
+				values = map[string]*dynamodb.AttributeValue{":until": until}
+			} else {
+				condition = "attribute_not_exists(#until)"
+			}
+		}
+
+		_, err = svc.PutItem(&dynamodb.PutItemInput{
+			Item:                      av,
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+			TableName:                 aws.String(TableName),
+		})
+		if err == nil {
+			return &s, nil
+		}
+
+		var aerr awserr.Error
+		if !errors.As(err, &aerr) || aerr.Code() != dynamodb.ErrCodeConditionalCheckFailedException {
+			return nil, err
+		}
+	}
+
+	return nil, errors.New("suppression changed concurrently, please try again")
+}
+
+func get(svc *dynamodb.DynamoDB, scope string) (map[string]*dynamodb.AttributeValue, error) {
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"scope": {
+				S: aws.String(scope),
+			},
+		},
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String(TableName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Item, nil
+}
+
+// Active returns the suppression for an alert key, or for all alerts, that is
+// active at the given time. It returns nil if alerts are not suppressed.
+func Active(svc *dynamodb.DynamoDB, alertKey string, now time.Time) (*Suppression, error) {
+	for _, scope := range []string{AllAlerts, alertKey} {
+		item, err := get(svc, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		if item == nil {
+			continue
+		}
+
+		var s Suppression
+		if err := dynamodbattribute.UnmarshalMap(item, &s); err != nil {
+			return nil, err
+		}
+
+		if now.Before(s.Until) {
+			return &s, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,74 @@
+package snooze_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryanc414/gas-tracker/snooze"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	token := snooze.Token{
+		Action:   snooze.Snooze,
+		Scope:    snooze.AllAlerts,
+		Duration: 4 * time.Hour,
+		Expires:  now.Add(snooze.LinkLifetime),
+	}
+
+	signed, err := snooze.Sign(secret, &token)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	parts := strings.SplitN(signed, ".", 2)
+
+	other, err := snooze.Sign(secret, &snooze.Token{
+		Action:   snooze.Snooze,
+		Scope:    snooze.AllAlerts,
+		Duration: 1000 * time.Hour,
+		Expires:  now.Add(snooze.LinkLifetime),
+	})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	otherPayload := strings.SplitN(other, ".", 2)[0]
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		signed  string
+		now     time.Time
+		wantErr string
+	}{
+		{name: "valid", secret: secret, signed: signed, now: now},
+		{name: "valid until it expires", secret: secret, signed: signed, now: token.Expires},
+		{name: "expired", secret: secret, signed: signed, now: token.Expires.Add(time.Second), wantErr: "expired"},
+		{name: "wrong secret", secret: []byte("other"), signed: signed, now: now, wantErr: "invalid token signature"},
+		{name: "tampered payload", secret: secret, signed: otherPayload + "." + parts[1], now: now, wantErr: "invalid token signature"},
+		{name: "tampered signature", secret: secret, signed: parts[0] + ".AAAA", now: now, wantErr: "invalid token signature"},
+		{name: "malformed signature", secret: secret, signed: parts[0] + ".!", now: now, wantErr: "malformed token signature"},
+		{name: "no signature", secret: secret, signed: parts[0], now: now, wantErr: "malformed token"},
+		{name: "empty", secret: secret, signed: "", now: now, wantErr: "malformed token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := snooze.Verify(tt.secret, tt.signed, tt.now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if *got != token {
+				t.Errorf("Verify() = %+v, want %+v", got, token)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/display"
+	"github.com/ryanc414/gas-tracker/linkpage"
+	"github.com/ryanc414/gas-tracker/logging"
+	"github.com/ryanc414/gas-tracker/snooze"
+)
+
+// handler serves the snooze and acknowledge links included in alerts. Each
+// link carries a signed token describing the action to take. A GET, e.g. from
+// following the link, shows a page asking to confirm, so that link scanners
+// and prefetchers do not snooze alerts. A POST from confirming applies it.
+type handler struct {
+	svc    *dynamodb.DynamoDB
+	secret []byte
+}
+
+func main() {
+	if err := logging.Setup(false); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	secret := os.Getenv("GAS_ACTIONS_SECRET")
+	if secret == "" {
+		log.Fatal().Msg("GAS_ACTIONS_SECRET not set")
+	}
+
+	sess, err := awsconfig.NewSession()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create AWS session")
+	}
+
+	h := handler{svc: dynamodb.New(sess), secret: []byte(secret)}
+	lambda.Start(h.handleRequest)
+}
+
+func (h *handler) handleRequest(
+	_ context.Context, req events.APIGatewayProxyRequest,
+) (events.APIGatewayProxyResponse, error) {
+	now := clock.Now()
+
+	signed := req.QueryStringParameters["token"]
+	token, err := snooze.Verify(h.secret, signed, now)
+	if err != nil {
+		return page(http.StatusForbidden, "Invalid link: "+err.Error(), ""), nil
+	}
+
+	switch req.HTTPMethod {
+	case http.MethodGet:
+		// The form posts back to the same link, relative so that it works
+		// behind the API Gateway stage prefix.
+		confirm := "?" + url.Values{"token": {signed}}.Encode()
+		return page(http.StatusOK, confirmMessage(token), confirm), nil
+
+	case http.MethodPost:
+		return h.apply(token, now), nil
+
+	default:
+		return page(http.StatusMethodNotAllowed, "Method not allowed", ""), nil
+	}
+}
+
+// apply applies the action of a verified token.
+func (h *handler) apply(token *snooze.Token, now time.Time) events.APIGatewayProxyResponse {
+	s, err := snooze.Apply(h.svc, token, now)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to apply action")
+		return page(http.StatusInternalServerError, "Something went wrong, please try again", "")
+	}
+
+	log.Info().Str("action", string(s.Action)).Str("scope", s.Scope).Time("until", s.Until).Msg("applied action")
+
+	until := display.In(s.Until).Format("Mon 2 Jan 15:04 MST")
+	if s.Action == snooze.Acknowledge {
+		return page(http.StatusOK, fmt.Sprintf("Alert acknowledged, repeats are silenced until %s", until), "")
+	}
+
+	return page(http.StatusOK, fmt.Sprintf("Gas alerts snoozed until %s", until), "")
+}
+
+// confirmMessage asks to confirm the action of a token.
+func confirmMessage(token *snooze.Token) string {
+	hours := int(token.Duration.Hours())
+	if token.Action == snooze.Acknowledge {
+		return fmt.Sprintf("Acknowledge this alert and silence its repeats for %dh?", hours)
+	}
+
+	return fmt.Sprintf("Snooze gas alerts for %dh?", hours)
+}
+
+// page returns a page with a message, and a button that posts to confirm if
+// the confirm URL is set.
+func page(status int, msg, confirm string) events.APIGatewayProxyResponse {
+	return linkpage.Response(status, linkpage.Page{Message: msg, Confirm: confirm})
+}
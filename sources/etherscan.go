@@ -0,0 +1,210 @@
+// Package sources fetches gas prices, and related market data, from external
+// APIs. Sources are registered by name, so that new ones, including the Exec
+// source that runs an external program, can be chosen by configuration.
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/ryanc414/gas-tracker/sources")
+
+const (
+	// EtherscanBaseURL is the base URL of the Etherscan API.
+	EtherscanBaseURL = "https://api.etherscan.io/api"
+	// DefaultEtherscanTimeout is how long each request to Etherscan may take.
+	DefaultEtherscanTimeout = 10 * time.Second
+)
+
+// Etherscan fetches gas and ETH prices from the Etherscan API.
+type Etherscan struct {
+	Client  *http.Client
+	APIKey  string
+	BaseURL string
+	Retry   RetryPolicy
+}
+
+// NewEtherscan constructs an Etherscan source with an HTTP client that times
+// out after DefaultEtherscanTimeout, retrying with the DefaultRetryPolicy.
+func NewEtherscan(apiKey string) *Etherscan {
+	return &Etherscan{
+		Client:  &http.Client{Timeout: DefaultEtherscanTimeout},
+		APIKey:  apiKey,
+		BaseURL: EtherscanBaseURL,
+		Retry:   DefaultRetryPolicy,
+	}
+}
+
+// etherscanResponse is the envelope of every Etherscan API response.
+type etherscanResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+}
+
+type gasOracleResult struct {
+	LastBlock       string `json:"LastBlock"`
+	SafeGasPrice    string `json:"SafeGasPrice"`
+	ProposeGasPrice string `json:"ProposeGasPrice"`
+	FastGasPrice    string `json:"FastGasPrice"`
+}
+
+type ethPriceResult struct {
+	EthUSD string `json:"ethusd"`
+}
+
+// MediumGas returns the current proposed gas price in gwei.
+func (e *Etherscan) MediumGas(ctx context.Context) (int, error) {
+	var gas gasOracleResult
+	if err := e.call(ctx, "gastracker", "gasoracle", &gas); err != nil {
+		return -1, err
+	}
+
+	mediumGas, err := strconv.ParseInt(gas.ProposeGasPrice, 10, 32)
+	if err != nil {
+		return -1, errors.Wrapf(err, "while parsing gas price %s", gas.ProposeGasPrice)
+	}
+
+	return int(mediumGas), nil
+}
+
+// ETHPrice returns the current price of ETH in USD.
+func (e *Etherscan) ETHPrice(ctx context.Context) (float64, error) {
+	var result ethPriceResult
+	if err := e.call(ctx, "stats", "ethprice", &result); err != nil {
+		return 0, err
+	}
+
+	price, err := strconv.ParseFloat(result.EthUSD, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while parsing ETH price %s", result.EthUSD)
+	}
+
+	return price, nil
+}
+
+// call calls an Etherscan API action and unmarshals its result, retrying
+// transient failures and recording the request as a span.
+func (e *Etherscan) call(ctx context.Context, module, action string, result interface{}) (err error) {
+	ctx, span := tracer.Start(
+		ctx,
+		"etherscan "+module+"."+action,
+		trace.WithSpanKind(trace.SpanKindClient),
+	)
+	start := time.Now()
+	defer func() {
+		log.Debug().
+			Err(err).
+			Str("source", "etherscan").
+			Str("action", module+"."+action).
+			Dur("duration", time.Since(start)).
+			Msg("called source API")
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	u, err := url.Parse(e.BaseURL)
+	if err != nil {
+		return errors.Wrap(err, "while parsing URL")
+	}
+	q := u.Query()
+	q.Set("module", module)
+	q.Set("action", action)
+	q.Set("apikey", e.APIKey)
+	u.RawQuery = q.Encode()
+
+	var envelope etherscanResponse
+	err = e.Retry.do(ctx, "etherscan", func() error {
+		body, err := e.get(ctx, u.String(), span)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return errors.Wrap(err, "while unmarshalling response body")
+		}
+
+		if envelope.Status != "1" || envelope.Message != "OK" {
+			// Rate limited requests succeed with an error in the body, e.g.
+			// {"status": "0", "message": "NOTOK", "result": "Max rate limit reached"}
+			var reason string
+			if json.Unmarshal(envelope.Result, &reason) == nil && strings.Contains(strings.ToLower(reason), "rate limit") {
+				return transient(&RateLimitError{Source: "etherscan", Message: reason})
+			}
+
+			return errors.Errorf("error response body: %s %s", envelope.Status, envelope.Message)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(json.Unmarshal(envelope.Result, result), "while unmarshalling result")
+}
+
+// get makes a GET request, returning the body of a 200 response. Requests are
+// only read, so any that fail without a response, time out, are rate limited
+// or fail with a server error are marked as transient, to be retried.
+func (e *Etherscan) get(ctx context.Context, url string, span trace.Span) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "while constructing http request")
+	}
+
+	rsp, err := e.Client.Do(req)
+	if err != nil {
+		err = errors.Wrap(err, "while making http request")
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, transient(err)
+	}
+
+	defer rsp.Body.Close()
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(rsp.StatusCode))
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if rsp.StatusCode == http.StatusTooManyRequests {
+		return nil, transient(&RateLimitError{
+			Source:     "etherscan",
+			Message:    rsp.Status,
+			RetryAfter: parseRetryAfter(rsp.Header.Get("Retry-After")),
+		})
+	}
+	if rsp.StatusCode != http.StatusOK {
+		if err == nil {
+			err = errors.Errorf("response error: %s %s", rsp.Status, string(body))
+		} else {
+			err = errors.Wrapf(err, "response error: %s", rsp.Status)
+		}
+		if rsp.StatusCode >= http.StatusInternalServerError || rsp.StatusCode == http.StatusRequestTimeout {
+			return nil, transient(err)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, transient(errors.Wrap(err, "while reading response body"))
+	}
+
+	return body, nil
+}
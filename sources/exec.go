@@ -0,0 +1,152 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	// DefaultExecTimeout is how long an Exec source waits for its program.
+	DefaultExecTimeout = 30 * time.Second
+	// execResultMaxAge is how long the output of the program is reused for,
+	// so that fetching the gas and ETH prices of one sample runs it once.
+	execResultMaxAge = time.Minute
+)
+
+// Exec fetches prices by running an external program, so that sources can be
+// added without modifying the tracker. The program must print a JSON object
+// to stdout such as
+//
+//	{"price": 42, "ethUsd": 3100.25}
+//
+// where price is the medium gas price in gwei and ethUsd, the price of ETH in
+// USD, is optional. A non-zero exit status fails the fetch, with anything the
+// program wrote to stderr included in the error.
+type Exec struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	result    *execResult
+	fetchedAt time.Time
+}
+
+type execResult struct {
+	Price  int     `json:"price"`
+	EthUSD float64 `json:"ethUsd"`
+}
+
+// NewExec constructs an Exec source running path with args.
+func NewExec(path string, args ...string) *Exec {
+	return &Exec{Path: path, Args: args, Timeout: DefaultExecTimeout}
+}
+
+// newExecFromEnv constructs an Exec source running the command line in
+// GAS_SOURCE_EXEC_COMMAND, split on whitespace, with an optional timeout in
+// GAS_SOURCE_EXEC_TIMEOUT.
+func newExecFromEnv() (Source, error) {
+	fields := strings.Fields(os.Getenv("GAS_SOURCE_EXEC_COMMAND"))
+	if len(fields) == 0 {
+		return nil, errors.New("GAS_SOURCE_EXEC_COMMAND is not set")
+	}
+
+	e := NewExec(fields[0], fields[1:]...)
+
+	if raw := os.Getenv("GAS_SOURCE_EXEC_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			return nil, errors.Errorf("invalid GAS_SOURCE_EXEC_TIMEOUT %q, expected a positive duration", raw)
+		}
+		e.Timeout = timeout
+	}
+
+	return e, nil
+}
+
+// MediumGas returns the gas price printed by the program.
+func (e *Exec) MediumGas(ctx context.Context) (int, error) {
+	result, err := e.fetch(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	return result.Price, nil
+}
+
+// ETHPrice returns the ETH price printed by the program, or 0 if it printed
+// none.
+func (e *Exec) ETHPrice(ctx context.Context) (float64, error) {
+	result, err := e.fetch(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.EthUSD, nil
+}
+
+// fetch runs the program, unless it was run within execResultMaxAge.
+func (e *Exec) fetch(ctx context.Context) (_ *execResult, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.result != nil && time.Since(e.fetchedAt) < execResultMaxAge {
+		return e.result, nil
+	}
+
+	ctx, span := tracer.Start(ctx, "exec "+e.Path)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Path, e.Args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	log.Debug().
+		Err(err).
+		Str("source", "exec").
+		Str("command", e.Path).
+		Dur("duration", time.Since(start)).
+		Msg("ran source command")
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.Wrapf(err, "while running %s: %s", e.Path, msg)
+		}
+
+		return nil, errors.Wrapf(err, "while running %s", e.Path)
+	}
+
+	var result execResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, errors.Wrapf(err, "while parsing output of %s", e.Path)
+	}
+	if result.Price <= 0 {
+		return nil, errors.Errorf("%s printed an invalid gas price %d", e.Path, result.Price)
+	}
+
+	e.result = &result
+	e.fetchedAt = time.Now()
+
+	return e.result, nil
+}
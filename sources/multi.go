@@ -0,0 +1,154 @@
+package sources
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// DefaultMultiTimeout is how long a Multi source waits for each source.
+	DefaultMultiTimeout = 15 * time.Second
+	// DefaultMultiConcurrency is how many sources a Multi source fetches from
+	// at once.
+	DefaultMultiConcurrency = 4
+)
+
+// Named is a source along with the name it is configured by.
+type Named struct {
+	Name   string
+	Source Source
+}
+
+// Multi fetches from several sources in parallel, returning the median of the
+// prices of those that succeed, so that one slow or failing source neither
+// multiplies the duration of a run nor fails it. It only fails if every
+// source does.
+type Multi struct {
+	Sources     []Named
+	Timeout     time.Duration
+	Concurrency int
+}
+
+// NewMulti constructs a Multi source with the default timeout and concurrency.
+func NewMulti(sources ...Named) *Multi {
+	return &Multi{Sources: sources, Timeout: DefaultMultiTimeout, Concurrency: DefaultMultiConcurrency}
+}
+
+// MediumGas returns the median of the gas prices of the sources.
+func (m *Multi) MediumGas(ctx context.Context) (int, error) {
+	values, err := m.fetch(ctx, "gas price", func(ctx context.Context, s Source) (float64, error) {
+		gas, err := s.MediumGas(ctx)
+		return float64(gas), err
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	return int(median(values) + 0.5), nil
+}
+
+// ETHPrice returns the median of the ETH prices of the sources that know it,
+// or 0 if none do.
+func (m *Multi) ETHPrice(ctx context.Context) (float64, error) {
+	values, err := m.fetch(ctx, "ETH price", func(ctx context.Context, s Source) (float64, error) {
+		return s.ETHPrice(ctx)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var known []float64
+	for _, v := range values {
+		if v > 0 {
+			known = append(known, v)
+		}
+	}
+	if len(known) == 0 {
+		return 0, nil
+	}
+
+	return median(known), nil
+}
+
+// fetch calls get for every source, at most Concurrency at a time and each
+// within Timeout, returning the values of those that succeeded. Failures are
+// logged, and only returned if every source failed.
+func (m *Multi) fetch(
+	ctx context.Context, what string, get func(context.Context, Source) (float64, error),
+) ([]float64, error) {
+	concurrency := m.Concurrency
+	if concurrency <= 0 {
+		concurrency = len(m.Sources)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var mu sync.Mutex
+	var values []float64
+	var failures []string
+
+	g, gctx := errgroup.WithContext(ctx)
+	for _, s := range m.Sources {
+		s := s
+		g.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			defer func() { <-sem }()
+
+			sctx := gctx
+			if m.Timeout > 0 {
+				var cancel context.CancelFunc
+				sctx, cancel = context.WithTimeout(gctx, m.Timeout)
+				defer cancel()
+			}
+
+			v, err := get(sctx, s.Source)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				log.Warn().Err(err).Str("source", s.Name).Msgf("failed to get %s", what)
+				failures = append(failures, s.Name+": "+err.Error())
+				return nil
+			}
+			values = append(values, v)
+
+			return nil
+		})
+	}
+
+	// Failures of single sources are not returned to the group, so only the
+	// run being cancelled fails it.
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	if len(values) == 0 {
+		sort.Strings(failures)
+		return nil, errors.Errorf("every source failed to get the %s: %s", what, strings.Join(failures, "; "))
+	}
+
+	return values, nil
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+
+	return sorted[mid]
+}
@@ -0,0 +1,145 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// RetryPolicy is how a source retries requests that fail transiently, such as
+// with a 502 or a dropped connection.
+type RetryPolicy struct {
+	// MaxAttempts is the most times a request is made, including the first.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. It doubles for each
+	// retry after that, and each wait is jittered so that many trackers do not
+	// retry in step.
+	InitialBackoff time.Duration
+	// Budget is the most time spent on a request and its retries. A retry
+	// whose wait would exceed it is not made. Zero means no limit.
+	Budget time.Duration
+}
+
+// DefaultRetryPolicy makes up to 3 attempts within 20 seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	Budget:         20 * time.Second,
+}
+
+// RateLimitError is returned by a source whose requests were rejected for
+// exceeding its rate limit, even after retrying, so that callers can tell it
+// from other failures.
+type RateLimitError struct {
+	Source  string
+	Message string
+	// RetryAfter is how long the source asked to wait before retrying, or 0
+	// if it did not say.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit reached: %s", e.Source, e.Message)
+}
+
+// parseRetryAfter parses a Retry-After header, in seconds or as a date,
+// returning 0 if it is empty or invalid.
+func parseRetryAfter(raw string) time.Duration {
+	if raw == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(raw); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(raw); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
+
+var (
+	jitterMu  sync.Mutex
+	jitterRNG = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter returns a random wait between half and all of backoff.
+func jitter(backoff time.Duration) time.Duration {
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+
+	return backoff/2 + time.Duration(jitterRNG.Int63n(int64(backoff/2)+1))
+}
+
+// transientError marks an error after which the request may be retried.
+type transientError struct {
+	error
+}
+
+func (e transientError) Cause() error {
+	return e.error
+}
+
+func (e transientError) Unwrap() error {
+	return e.error
+}
+
+// transient marks err as transient, so that the request is retried.
+func transient(err error) error {
+	return transientError{err}
+}
+
+func isTransient(err error) bool {
+	var t transientError
+	return errors.As(err, &t)
+}
+
+// do calls f until it succeeds, fails with an error that is not transient, or
+// the attempts or budget run out, returning the last error.
+func (p RetryPolicy) do(ctx context.Context, source string, f func() error) error {
+	deadline := time.Now().Add(p.Budget)
+	backoff := p.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || !isTransient(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		wait := jitter(backoff)
+		var rateLimit *RateLimitError
+		if errors.As(err, &rateLimit) && rateLimit.RetryAfter > wait {
+			wait = rateLimit.RetryAfter
+		}
+		if p.Budget > 0 && time.Now().Add(wait).After(deadline) {
+			return errors.Wrap(err, "retry budget exhausted")
+		}
+
+		log.Warn().
+			Err(err).
+			Str("source", source).
+			Int("attempt", attempt).
+			Dur("backoff", wait).
+			Msg("source request failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return err
+
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+	}
+}
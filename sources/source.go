@@ -0,0 +1,151 @@
+package sources
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Source fetches the current gas price.
+type Source interface {
+	// MediumGas returns the current medium, or proposed, gas price in gwei.
+	MediumGas(ctx context.Context) (int, error)
+	// ETHPrice returns the current price of ETH in USD, or 0 if the source
+	// does not know it.
+	ETHPrice(ctx context.Context) (float64, error)
+}
+
+// Factory constructs a Source, reading any settings it needs from the
+// environment.
+type Factory func() (Source, error)
+
+var factories = map[string]Factory{}
+
+func init() {
+	Register("etherscan", newEtherscanFromEnv)
+	Register("exec", newExecFromEnv)
+}
+
+// Register makes a source available by name. Like database/sql drivers, it is
+// meant to be called from the init function of the package that implements
+// the source, so that importing that package is enough to use it. It panics if
+// the name is already registered.
+func Register(name string, f Factory) {
+	if _, ok := factories[name]; ok {
+		panic("sources: source " + name + " is already registered")
+	}
+
+	factories[name] = f
+}
+
+// New constructs the source registered under name.
+func New(name string) (Source, error) {
+	f, ok := factories[name]
+	if !ok {
+		return nil, errors.Errorf("unknown source %q, expected one of %s", name, strings.Join(Names(), ", "))
+	}
+
+	return f()
+}
+
+// Names returns the names of the registered sources, sorted.
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// newEtherscanFromEnv constructs an Etherscan source with the API key in
+// ETHERSCAN_API_KEY. GAS_SOURCE_ETHERSCAN_TIMEOUT overrides the timeout of
+// each request, and GAS_SOURCE_ETHERSCAN_ATTEMPTS and
+// GAS_SOURCE_ETHERSCAN_RETRY_BUDGET the retry policy.
+func newEtherscanFromEnv() (Source, error) {
+	apiKey := os.Getenv("ETHERSCAN_API_KEY")
+	if apiKey == "" {
+		return nil, errors.New("ETHERSCAN_API_KEY is not set")
+	}
+
+	e := NewEtherscan(apiKey)
+
+	if raw := os.Getenv("GAS_SOURCE_ETHERSCAN_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			return nil, errors.Errorf("invalid GAS_SOURCE_ETHERSCAN_TIMEOUT %q, expected a positive duration", raw)
+		}
+		e.Client.Timeout = timeout
+	}
+
+	if raw := os.Getenv("GAS_SOURCE_ETHERSCAN_ATTEMPTS"); raw != "" {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil || attempts < 1 {
+			return nil, errors.Errorf("invalid GAS_SOURCE_ETHERSCAN_ATTEMPTS %q, expected a positive integer", raw)
+		}
+		e.Retry.MaxAttempts = attempts
+	}
+
+	if raw := os.Getenv("GAS_SOURCE_ETHERSCAN_RETRY_BUDGET"); raw != "" {
+		budget, err := time.ParseDuration(raw)
+		if err != nil || budget < 0 {
+			return nil, errors.Errorf("invalid GAS_SOURCE_ETHERSCAN_RETRY_BUDGET %q, expected a duration, or 0 for no limit", raw)
+		}
+		e.Retry.Budget = budget
+	}
+
+	return e, nil
+}
+
+// NewFromNames constructs the sources registered under the comma-separated
+// names, combining them in a Multi source if there are several, with the
+// timeout of each in GAS_SOURCE_TIMEOUT and how many are fetched from at once
+// in GAS_SOURCE_CONCURRENCY.
+func NewFromNames(names string) (Source, error) {
+	var named []Named
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		s, err := New(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while constructing %s source", name)
+		}
+		named = append(named, Named{Name: name, Source: s})
+	}
+
+	switch len(named) {
+	case 0:
+		return nil, errors.New("no source named")
+	case 1:
+		return named[0].Source, nil
+	}
+
+	m := NewMulti(named...)
+
+	if raw := os.Getenv("GAS_SOURCE_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			return nil, errors.Errorf("invalid GAS_SOURCE_TIMEOUT %q, expected a positive duration", raw)
+		}
+		m.Timeout = timeout
+	}
+
+	if raw := os.Getenv("GAS_SOURCE_CONCURRENCY"); raw != "" {
+		concurrency, err := strconv.Atoi(raw)
+		if err != nil || concurrency < 1 {
+			return nil, errors.Errorf("invalid GAS_SOURCE_CONCURRENCY %q, expected a positive integer", raw)
+		}
+		m.Concurrency = concurrency
+	}
+
+	return m, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/gastracker"
+	"github.com/ryanc414/gas-tracker/logging"
+)
+
+// Runs one stage of the tracker, chosen by GAS_STAGE, so that a Step Functions
+// state machine can run the stages as separate tasks with their own retries
+// and catch branches. Deploy it once per stage and chain them, passing each
+// output to the next stage as its input:
+//
+//	fetch    {}                                    -> {"price": 42, "ethUsd": 1800.5, "timestamp": "..."}
+//	analyse  the sample from fetch                 -> a run summary, including "timestamp"
+//	notify   the summary from analyse              -> a run summary, including the alerts sent
+func main() {
+	if err := logging.Setup(false); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	switch stage := os.Getenv("GAS_STAGE"); stage {
+	case "fetch":
+		lambda.Start(HandleFetch)
+	case "analyse":
+		lambda.Start(HandleAnalyse)
+	case "notify":
+		lambda.Start(HandleNotify)
+	default:
+		log.Fatal().Str("stage", stage).Msg("GAS_STAGE must be fetch, analyse or notify")
+	}
+}
+
+// HandleFetch samples the current price.
+func HandleFetch(ctx context.Context) (*gastracker.Sample, error) {
+	sample, err := gastracker.Fetch(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("fetch failed")
+		return nil, err
+	}
+
+	return sample, nil
+}
+
+// HandleAnalyse categorises and stores a sample.
+func HandleAnalyse(ctx context.Context, sample gastracker.Sample) (*gastracker.RunSummary, error) {
+	summary, err := gastracker.Analyse(ctx, sample)
+	if err != nil {
+		log.Error().Err(err).Msg("analyse failed")
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// HandleNotify sends the alerts for a stored price.
+func HandleNotify(ctx context.Context, req gastracker.NotifyRequest) (*gastracker.RunSummary, error) {
+	summary, err := gastracker.NotifyStored(ctx, req.Timestamp)
+	if err != nil {
+		log.Error().Err(err).Msg("notify failed")
+		return nil, err
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// StateTableName is a table of miscellaneous state that the tracker keeps
+// between runs, with one item per kind of state.
+const StateTableName = "gasTrackerState"
+
+// stateItem wraps a value stored in the state table under an ID.
+type stateItem struct {
+	ID    string      `dynamodbav:"id"`
+	Value interface{} `dynamodbav:"value"`
+}
+
+// ReadState reads the state with the given ID into out. It returns false if
+// there is no such state yet.
+func ReadState(svc *dynamodb.DynamoDB, id string, out interface{}) (bool, error) {
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(id),
+			},
+		},
+		TableName:      aws.String(StateTableName),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	value, ok := result.Item["value"]
+	if !ok {
+		return false, nil
+	}
+
+	if err := dynamodbattribute.Unmarshal(value, out); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// WriteState stores a value in the state table under the given ID.
+func WriteState(svc *dynamodb.DynamoDB, id string, value interface{}) error {
+	av, err := dynamodbattribute.MarshalMap(stateItem{ID: id, Value: value})
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(StateTableName),
+	})
+	return err
+}
+
+// DeleteState deletes the state with the given ID, if there is any.
+func DeleteState(svc *dynamodb.DynamoDB, id string) error {
+	_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(id),
+			},
+		},
+		TableName: aws.String(StateTableName),
+	})
+	return err
+}
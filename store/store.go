@@ -0,0 +1,588 @@
+// Package store persists gas price samples, and state that the tracker keeps
+// between runs, in DynamoDB.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const (
+	// TableName is the table of gas price samples, keyed by timestamp.
+	TableName = "gasPrices"
+	// latestStateID is the ID of the copy of the latest sample kept in the
+	// state table, so that it can be read without scanning every sample.
+	latestStateID = "latest"
+	// recentStateID is the ID of the copy of the most recent samples kept in
+	// the state table, so that a run reads one item rather than scanning them.
+	recentStateID = "recent"
+	// maxRecent is the most samples kept in the copy of the recent samples,
+	// so that the item stays well within DynamoDB's 400 KB item limit however
+	// long samples are retained.
+	maxRecent = 500
+	// filterMargin widens the range that scans filter stored samples by.
+	// Timestamps are compared as strings, which orders them correctly only
+	// when both are in UTC, so the margin takes in any stored in another time
+	// zone, and the range is applied exactly once they are decoded.
+	filterMargin = 24 * time.Hour
+)
+
+// sampleAttributes are the attributes of a stored sample that are read into
+// a prices.GasPriceData, and priceAttributes the ones that stats over the
+// prices need. Every attribute read must be present in each item, except the
+// optionalAttributes.
+var (
+	sampleAttributes   = []string{"timestamp", "price", "category", "ethUsd", "requestId"}
+	priceAttributes    = []string{"timestamp", "price"}
+	optionalAttributes = map[string]bool{"ethUsd": true, "requestId": true}
+)
+
+// ReadAll reads every stored gas price sample, ordered oldest first. Their
+// timestamps are in UTC, and samples that are invalid or duplicates are
+// discarded, as by prices.Clean.
+func ReadAll(svc *dynamodb.DynamoDB) ([]prices.GasPriceData, error) {
+	return readRange(svc, sampleAttributes, time.Time{}, time.Time{})
+}
+
+// EachPrice calls f with the price and timestamp of every stored sample, in no
+// particular order, leaving the other fields zero. Samples are read a page at
+// a time and not kept, so memory use does not grow with the number stored.
+// Timestamps are in UTC, and samples without one are skipped, but duplicates
+// are not detected. It stops at the first error that f returns.
+func EachPrice(svc *dynamodb.DynamoDB, f func(p *prices.GasPriceData) error) error {
+	return each(svc, priceAttributes, time.Time{}, time.Time{}, func(p *prices.GasPriceData) error {
+		if p.Timestamp.IsZero() {
+			return nil
+		}
+		p.Timestamp = p.Timestamp.UTC()
+
+		return f(p)
+	})
+}
+
+func readRange(svc *dynamodb.DynamoDB, attrs []string, from, to time.Time) ([]prices.GasPriceData, error) {
+	gasPrices := make([]prices.GasPriceData, 0)
+	err := each(svc, attrs, from, to, func(p *prices.GasPriceData) error {
+		ts := p.Timestamp
+		if (from.IsZero() || !ts.Before(from)) && (to.IsZero() || !ts.After(to)) {
+			gasPrices = append(gasPrices, *p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return clean(gasPrices), nil
+}
+
+// clean discards the samples that are invalid or duplicates, as by
+// prices.Clean, logging each.
+func clean(gasPrices []prices.GasPriceData) []prices.GasPriceData {
+	cleaned, discarded := prices.Clean(gasPrices, clock.Now())
+	for i := range discarded {
+		log.Warn().
+			Time("timestamp", discarded[i].Price.Timestamp).
+			Int("price", discarded[i].Price.Price).
+			Str("reason", discarded[i].Reason).
+			Msg("discarded stored gas price")
+	}
+
+	return cleaned
+}
+
+// each scans the given attributes of every stored sample, a page at a time,
+// calling f with each. If from or to is set, DynamoDB leaves out most of the
+// samples outside of that range, but f must still check the range itself.
+func each(svc *dynamodb.DynamoDB, attrs []string, from, to time.Time, f func(p *prices.GasPriceData) error) error {
+	// Attribute names such as "timestamp" are reserved words, so every name
+	// is given by a placeholder.
+	names := make(map[string]*string, len(attrs))
+	projection := make([]string, len(attrs))
+	for i, attr := range attrs {
+		placeholder := "#" + attr
+		names[placeholder] = aws.String(attr)
+		projection[i] = placeholder
+	}
+
+	input := dynamodb.ScanInput{
+		TableName:                aws.String(TableName),
+		ProjectionExpression:     aws.String(strings.Join(projection, ", ")),
+		ExpressionAttributeNames: names,
+	}
+	setRangeFilter(&input, from, to)
+
+	var count, skipped int
+	for {
+		result, err := svc.Scan(&input)
+		if err != nil {
+			return err
+		}
+
+		for i := range result.Items {
+			price, err := decodeSample(result.Items[i], attrs)
+			if err != nil {
+				// One malformed item, e.g. written by hand, should not stop
+				// every run, so it is reported and skipped.
+				log.Error().Err(err).Msg("skipped malformed gas price record")
+				skipped++
+				continue
+			}
+
+			if err := f(&price); err != nil {
+				return err
+			}
+		}
+		count += len(result.Items)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	log.Info().Int("count", count).Int("skipped", skipped).Msg("read gas price records")
+
+	return nil
+}
+
+// setRangeFilter filters a scan of the stored samples to those between from
+// and to, widened by filterMargin. A zero from or to leaves that end open.
+func setRangeFilter(input *dynamodb.ScanInput, from, to time.Time) {
+	var conditions []string
+	values := make(map[string]*dynamodb.AttributeValue)
+	if !from.IsZero() {
+		conditions = append(conditions, "#timestamp >= :from")
+		values[":from"] = &dynamodb.AttributeValue{S: aws.String(from.Add(-filterMargin).UTC().Format(time.RFC3339Nano))}
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, "#timestamp <= :to")
+		values[":to"] = &dynamodb.AttributeValue{S: aws.String(to.Add(filterMargin).UTC().Format(time.RFC3339Nano))}
+	}
+	if len(conditions) == 0 {
+		return
+	}
+
+	input.FilterExpression = aws.String(strings.Join(conditions, " AND "))
+	input.ExpressionAttributeValues = values
+}
+
+// decodeSample decodes the given attributes of a stored sample, returning an
+// error naming the item and the problem if it is malformed.
+func decodeSample(item map[string]*dynamodb.AttributeValue, attrs []string) (prices.GasPriceData, error) {
+	key := "with no timestamp"
+	if ts := item["timestamp"]; ts != nil && ts.S != nil {
+		key = *ts.S
+	}
+
+	for _, attr := range attrs {
+		if av := item[attr]; !optionalAttributes[attr] && (av == nil || av.NULL != nil) {
+			return prices.GasPriceData{}, fmt.Errorf("item %s has no %s attribute", key, attr)
+		}
+	}
+
+	var price prices.GasPriceData
+	if err := dynamodbattribute.UnmarshalMap(item, &price); err != nil {
+		return prices.GasPriceData{}, fmt.Errorf("item %s: %v", key, err)
+	}
+	if !price.Category.Valid() {
+		return prices.GasPriceData{}, fmt.Errorf("item %s has unknown category %d", key, price.Category)
+	}
+	if ts := item["timestamp"]; ts != nil && ts.S != nil {
+		price.Key = *ts.S
+	}
+
+	return price, nil
+}
+
+// ReadRange reads the stored gas price samples between from and to, inclusive,
+// ordered oldest first and cleaned as by ReadAll. A zero from or to leaves
+// that end of the range open. Only the samples in range are kept, so memory
+// use grows with the range rather than the number stored, though the table
+// is still scanned since it is keyed by timestamp alone.
+func ReadRange(svc *dynamodb.DynamoDB, from, to time.Time) ([]prices.GasPriceData, error) {
+	return readRange(svc, sampleAttributes, from, to)
+}
+
+// ReadExpired reads every stored gas price sample sampled at or before the
+// given time, ordered oldest first, for pruning. Unlike ReadRange, samples
+// sampled at the same instant but stored under different keys are all
+// returned, so that each of them is deleted.
+func ReadExpired(svc *dynamodb.DynamoDB, before time.Time) ([]prices.GasPriceData, error) {
+	var expired []prices.GasPriceData
+	err := each(svc, sampleAttributes, time.Time{}, before, func(p *prices.GasPriceData) error {
+		if !p.Timestamp.IsZero() && !p.Timestamp.After(before) {
+			p.Timestamp = p.Timestamp.UTC()
+			expired = append(expired, *p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].Timestamp.Before(expired[j].Timestamp)
+	})
+
+	return expired, nil
+}
+
+// ErrExists is returned by Write if a sample with the same timestamp is
+// already stored.
+var ErrExists = errors.New("a gas price with the same timestamp is already stored")
+
+// ReadLatest reads the latest stored sample, or returns nil if there are none.
+// It reads the copy written by WriteLatest, falling back to scanning every
+// sample, a page at a time, if there is no copy yet. Samples sampled in the
+// future are skipped, as by ReadAll.
+func ReadLatest(svc *dynamodb.DynamoDB) (*prices.GasPriceData, error) {
+	var latest prices.GasPriceData
+	found, err := ReadState(svc, latestStateID, &latest)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return &latest, nil
+	}
+
+	var newest *prices.GasPriceData
+	err = each(svc, sampleAttributes, time.Time{}, time.Time{}, func(p *prices.GasPriceData) error {
+		cleaned, _ := prices.Clean([]prices.GasPriceData{*p}, clock.Now())
+		if len(cleaned) > 0 && (newest == nil || cleaned[0].Timestamp.After(newest.Timestamp)) {
+			newest = &cleaned[0]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newest, nil
+}
+
+// WriteLatest records p as the latest stored sample, for ReadLatest. It must
+// be called after writing a sample newer than every other.
+func WriteLatest(svc *dynamodb.DynamoDB, p *prices.GasPriceData) error {
+	return WriteState(svc, latestStateID, p)
+}
+
+// recentSamples is the copy of the most recent stored samples kept by
+// WriteRecent.
+type recentSamples struct {
+	Samples []prices.GasPriceData `dynamodbav:"samples"`
+}
+
+// ReadRecent reads the copy of the most recent stored samples written by
+// WriteRecent, up to maxRecent of them, ordered oldest first and cleaned as
+// by ReadAll. It returns nil if there is no copy, or if the copy is out of
+// date, e.g. because a run failed after writing a sample but before updating
+// the copy. Every stored sample since the oldest returned is included.
+func ReadRecent(svc *dynamodb.DynamoDB) ([]prices.GasPriceData, error) {
+	var recent recentSamples
+	found, err := ReadState(svc, recentStateID, &recent)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	var latest prices.GasPriceData
+	found, err = ReadState(svc, latestStateID, &latest)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	for i := range recent.Samples {
+		if c := recent.Samples[i].Category; !c.Valid() {
+			log.Error().Int("category", int(c)).Msg("copy of the recent gas prices has an unknown category, ignoring it")
+			return nil, nil
+		}
+	}
+
+	samples := clean(recent.Samples)
+	if newest := prices.Latest(samples); newest == nil || !newest.Timestamp.Equal(latest.Timestamp) {
+		log.Info().Msg("copy of the recent gas prices is out of date")
+		return nil, nil
+	}
+
+	return samples, nil
+}
+
+// WriteRecent records the most recent of gasPrices, up to maxRecent, as the
+// copy of the recent samples for ReadRecent. gasPrices must be ordered oldest
+// first, and include every stored sample since the oldest of them, after
+// writing one newer than every other. Anything else that writes samples must
+// call ClearRecent.
+func WriteRecent(svc *dynamodb.DynamoDB, gasPrices []prices.GasPriceData) error {
+	if len(gasPrices) > maxRecent {
+		gasPrices = gasPrices[len(gasPrices)-maxRecent:]
+	}
+
+	recent := recentSamples{Samples: make([]prices.GasPriceData, len(gasPrices))}
+	for i := range gasPrices {
+		recent.Samples[i] = gasPrices[i]
+		recent.Samples[i].Timestamp = gasPrices[i].Timestamp.UTC()
+	}
+
+	return WriteState(svc, recentStateID, &recent)
+}
+
+// ClearRecent deletes the copy of the recent samples, so that the next run
+// reads the samples it needs from the table, and rebuilds anything else kept
+// from them.
+func ClearRecent(svc *dynamodb.DynamoDB) error {
+	return DeleteState(svc, recentStateID)
+}
+
+// Write stores a gas price sample, unless one with the same timestamp is
+// already stored, so that a retried write cannot replace it. The timestamp is
+// stored in UTC.
+func Write(svc *dynamodb.DynamoDB, p *prices.GasPriceData) error {
+	stored := *p
+	stored.Timestamp = p.Timestamp.UTC()
+	stored.Key = ""
+
+	av, err := dynamodbattribute.MarshalMap(&stored)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:                     av,
+		TableName:                aws.String(TableName),
+		ConditionExpression:      aws.String("attribute_not_exists(#ts)"),
+		ExpressionAttributeNames: map[string]*string{"#ts": aws.String("timestamp")},
+	}
+
+	if _, err = svc.PutItem(input); err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrExists
+		}
+		return err
+	}
+
+	log.Info().Int("price", p.Price).Stringer("category", p.Category).Msg("wrote gas price to DB")
+
+	return nil
+}
+
+// ErrNotStored is returned by Rewrite if the sample is no longer stored, e.g.
+// because it expired in the meantime.
+var ErrNotStored = errors.New("the gas price is no longer stored")
+
+// Rewrite replaces a stored gas price sample, e.g. to change its category,
+// keeping the key it is stored under.
+func Rewrite(svc *dynamodb.DynamoDB, p *prices.GasPriceData) error {
+	key, err := sampleKey(p)
+	if err != nil {
+		return err
+	}
+
+	stored := *p
+	stored.Timestamp = p.Timestamp.UTC()
+	stored.Key = ""
+
+	av, err := dynamodbattribute.MarshalMap(&stored)
+	if err != nil {
+		return err
+	}
+	av["timestamp"] = key["timestamp"]
+
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		Item:                      av,
+		TableName:                 aws.String(TableName),
+		ConditionExpression:       aws.String("#ts = :ts"),
+		ExpressionAttributeNames:  map[string]*string{"#ts": aws.String("timestamp")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":ts": key["timestamp"]},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrNotStored
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes a stored gas price sample.
+func Delete(svc *dynamodb.DynamoDB, p *prices.GasPriceData) error {
+	key, err := sampleKey(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.DeleteItem(
+		&dynamodb.DeleteItemInput{
+			Key:       key,
+			TableName: aws.String(TableName),
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Time("timestamp", p.Timestamp).Msg("deleted gas price")
+
+	return nil
+}
+
+// DeleteConfirmed removes the given stored gas price samples, one at a time,
+// and returns those that were deleted, so that only prices actually removed
+// are subtracted from anything kept over the stored prices. Samples that are
+// not stored under their key, e.g. because another run already deleted them,
+// are left out. BatchWriteItem is not used since it does not report whether
+// each item existed. If a delete fails, the samples deleted before it are
+// returned along with the error.
+func DeleteConfirmed(svc *dynamodb.DynamoDB, gasPrices []prices.GasPriceData) ([]prices.GasPriceData, error) {
+	deleted := make([]prices.GasPriceData, 0, len(gasPrices))
+	for i := range gasPrices {
+		p := gasPrices[i]
+		found, err := deleteSample(svc, &p)
+		if !found && err == nil && p.Key != "" {
+			// The sample may have been rewritten under its UTC key by
+			// NormaliseKeys since it was read.
+			p.Key = ""
+			found, err = deleteSample(svc, &p)
+		}
+		if err != nil {
+			return deleted, err
+		}
+
+		if found {
+			deleted = append(deleted, gasPrices[i])
+		}
+	}
+
+	log.Info().Int("count", len(deleted)).Int("missing", len(gasPrices)-len(deleted)).Msg("deleted gas prices")
+
+	return deleted, nil
+}
+
+// deleteSample deletes a stored sample, returning whether it was stored.
+func deleteSample(svc *dynamodb.DynamoDB, p *prices.GasPriceData) (bool, error) {
+	key, err := sampleKey(p)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		Key:          key,
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+		TableName:    aws.String(TableName),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return len(result.Attributes) > 0, nil
+}
+
+// NormaliseKeys rewrites the samples that earlier versions stored under a
+// timestamp in a time zone other than UTC, so that each is stored under the
+// key that Write uses, and ranges of keys are ordered by time. A sample that
+// is already stored under that key too is a duplicate, and is only deleted.
+// It returns how many samples were rewritten or deleted.
+func NormaliseKeys(svc *dynamodb.DynamoDB) (int, error) {
+	input := dynamodb.ScanInput{TableName: aws.String(TableName)}
+
+	// The samples are rewritten once the scan is complete, so that it does
+	// not also return the rewritten ones.
+	var legacy []map[string]*dynamodb.AttributeValue
+	for {
+		result, err := svc.Scan(&input)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, item := range result.Items {
+			if _, ok := utcKey(item); ok {
+				legacy = append(legacy, item)
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	for _, item := range legacy {
+		key, _ := utcKey(item)
+
+		rewritten := make(map[string]*dynamodb.AttributeValue, len(item))
+		for attr, av := range item {
+			rewritten[attr] = av
+		}
+		rewritten["timestamp"] = &dynamodb.AttributeValue{S: aws.String(key)}
+
+		_, err := svc.PutItem(&dynamodb.PutItemInput{
+			Item:                     rewritten,
+			TableName:                aws.String(TableName),
+			ConditionExpression:      aws.String("attribute_not_exists(#ts)"),
+			ExpressionAttributeNames: map[string]*string{"#ts": aws.String("timestamp")},
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			log.Info().Str("key", *item["timestamp"].S).Msg("deleting gas price stored twice")
+		} else if err != nil {
+			return 0, err
+		}
+
+		_, err = svc.DeleteItem(&dynamodb.DeleteItemInput{
+			Key:       map[string]*dynamodb.AttributeValue{"timestamp": item["timestamp"]},
+			TableName: aws.String(TableName),
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if len(legacy) > 0 {
+		log.Info().Int("count", len(legacy)).Msg("rewrote gas prices stored under non-UTC keys")
+	}
+
+	return len(legacy), nil
+}
+
+// utcKey returns the key that Write would store an item under, and whether
+// that differs from the key it is stored under. Items with a malformed
+// timestamp are left as they are.
+func utcKey(item map[string]*dynamodb.AttributeValue) (string, bool) {
+	ts := item["timestamp"]
+	if ts == nil || ts.S == nil {
+		return "", false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, *ts.S)
+	if err != nil {
+		return "", false
+	}
+
+	key := t.UTC().Format(time.RFC3339Nano)
+	return key, key != *ts.S
+}
+
+// sampleKey returns the key of a stored sample: the key it was read with, if
+// any, otherwise its timestamp encoded as Write encodes it.
+func sampleKey(p *prices.GasPriceData) (map[string]*dynamodb.AttributeValue, error) {
+	if p.Key != "" {
+		return map[string]*dynamodb.AttributeValue{"timestamp": {S: aws.String(p.Key)}}, nil
+	}
+
+	ts, err := dynamodbattribute.Marshal(p.Timestamp.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]*dynamodb.AttributeValue{"timestamp": ts}, nil
+}
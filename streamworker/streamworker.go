@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/gastracker"
+	"github.com/ryanc414/gas-tracker/logging"
+)
+
+// Sends the alerts for gas prices as they are written, consuming the stream
+// of the gasPrices table. Deploy it with GAS_NOTIFY_FROM_STREAM=true set for
+// both it and the tracker, so that the tracker only samples and stores prices.
+// The stream must include keys, e.g. with the KEYS_ONLY view type.
+func main() {
+	if err := logging.Setup(false); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	lambda.Start(HandleRequest)
+}
+
+// HandleRequest notifies of the newest price inserted in the batch. Older
+// ones would not be alerted on anyway, as only the latest stored price is.
+// Returning an error retries the batch, so that alerts are not lost if
+// notifying fails.
+func HandleRequest(ctx context.Context, event events.DynamoDBEvent) (*gastracker.RunSummary, error) {
+	var newest time.Time
+	for _, record := range event.Records {
+		if record.EventName != string(events.DynamoDBOperationTypeInsert) {
+			continue
+		}
+
+		raw := record.Change.Keys["timestamp"].String()
+		at, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			log.Error().Err(err).Str("eventId", record.EventID).Msg("invalid gas price timestamp")
+			continue
+		}
+
+		if at.After(newest) {
+			newest = at
+		}
+	}
+
+	if newest.IsZero() {
+		log.Info().Int("records", len(event.Records)).Msg("no gas prices inserted")
+		return nil, nil
+	}
+
+	summary, err := gastracker.NotifyStored(ctx, newest)
+	if err != nil {
+		log.Error().Err(err).Time("timestamp", newest).Msg("notify failed")
+		return nil, errors.Wrap(err, "while notifying of stored gas price")
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/logging"
+	"github.com/ryanc414/gas-tracker/pushsubs"
+)
+
+// handler manages Web Push subscriptions behind API Gateway:
+//
+//	GET    returns the VAPID public key needed to subscribe in the browser
+//	POST   stores the subscription in the request body
+//	DELETE removes the subscription in the request body
+type handler struct {
+	svc            *dynamodb.DynamoDB
+	vapidPublicKey string
+	allowedOrigin  string
+}
+
+func main() {
+	if err := logging.Setup(false); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	sess, err := awsconfig.NewSession()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create AWS session")
+	}
+
+	h := handler{
+		svc:            dynamodb.New(sess),
+		vapidPublicKey: os.Getenv("GAS_WEBPUSH_VAPID_PUBLIC_KEY"),
+		allowedOrigin:  os.Getenv("GAS_WEBPUSH_ALLOWED_ORIGIN"),
+	}
+	if h.vapidPublicKey == "" {
+		log.Fatal().Msg("GAS_WEBPUSH_VAPID_PUBLIC_KEY not set")
+	}
+
+	lambda.Start(h.handleRequest)
+}
+
+func (h *handler) handleRequest(
+	_ context.Context, req events.APIGatewayProxyRequest,
+) (events.APIGatewayProxyResponse, error) {
+	switch req.HTTPMethod {
+	case http.MethodGet:
+		return h.respond(http.StatusOK, map[string]string{"publicKey": h.vapidPublicKey}), nil
+
+	case http.MethodPost:
+		sub, rsp := h.parseSubscription(req.Body)
+		if sub == nil {
+			return rsp, nil
+		}
+
+		sub.CreatedAt = clock.Now()
+		if err := pushsubs.Save(h.svc, sub); err != nil {
+			log.Error().Err(err).Msg("failed to save subscription")
+			return h.respondError(http.StatusInternalServerError, "failed to save subscription"), nil
+		}
+
+		return h.respond(http.StatusCreated, map[string]string{"status": "subscribed"}), nil
+
+	case http.MethodDelete:
+		sub, rsp := h.parseSubscription(req.Body)
+		if sub == nil {
+			return rsp, nil
+		}
+
+		if err := pushsubs.Delete(h.svc, sub.Endpoint); err != nil {
+			log.Error().Err(err).Msg("failed to delete subscription")
+			return h.respondError(http.StatusInternalServerError, "failed to delete subscription"), nil
+		}
+
+		return h.respond(http.StatusOK, map[string]string{"status": "unsubscribed"}), nil
+
+	case http.MethodOptions:
+		return h.respond(http.StatusNoContent, nil), nil
+
+	default:
+		return h.respondError(http.StatusMethodNotAllowed, "method not allowed"), nil
+	}
+}
+
+// parseSubscription parses and validates a subscription from a request body.
+// If the subscription is invalid, it returns nil and the response to send.
+func (h *handler) parseSubscription(body string) (*pushsubs.Subscription, events.APIGatewayProxyResponse) {
+	var sub pushsubs.Subscription
+	if err := json.Unmarshal([]byte(body), &sub); err != nil {
+		return nil, h.respondError(http.StatusBadRequest, "invalid JSON: "+err.Error())
+	}
+
+	if err := sub.Validate(); err != nil {
+		return nil, h.respondError(http.StatusBadRequest, err.Error())
+	}
+
+	return &sub, events.APIGatewayProxyResponse{}
+}
+
+func (h *handler) respond(status int, payload interface{}) events.APIGatewayProxyResponse {
+	rsp := events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+	}
+
+	if h.allowedOrigin != "" {
+		rsp.Headers["Access-Control-Allow-Origin"] = h.allowedOrigin
+		rsp.Headers["Access-Control-Allow-Methods"] = "GET, POST, DELETE, OPTIONS"
+		rsp.Headers["Access-Control-Allow-Headers"] = "Content-Type"
+	}
+
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to marshal response")
+			rsp.StatusCode = http.StatusInternalServerError
+			return rsp
+		}
+
+		rsp.Body = string(body)
+	}
+
+	return rsp
+}
+
+func (h *handler) respondError(status int, msg string) events.APIGatewayProxyResponse {
+	return h.respond(status, map[string]string{"error": msg})
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/clock"
+	"github.com/ryanc414/gas-tracker/gastracker"
+	"github.com/ryanc414/gas-tracker/linkpage"
+	"github.com/ryanc414/gas-tracker/logging"
+	"github.com/ryanc414/gas-tracker/subscribers"
+)
+
+// handler manages subscribers behind API Gateway:
+//
+//	POST     /subscribers               subscribes, returning the new
+//	                                    subscriber and a management token
+//	GET      /subscribers/{id}          returns the subscriber
+//	PUT      /subscribers/{id}          updates the subscriber's channels,
+//	                                    chains, thresholds and rules
+//	DELETE   /subscribers/{id}          unsubscribes
+//	GET/POST /subscribers/{id}/confirm  confirms the subscriber's channels
+//
+// Requests for an existing subscriber must include the management token as
+// "Authorization: Bearer <token>", except to confirm.
+//
+// New subscribers are pending until they follow the confirm link sent to
+// each of their channels, as are subscribers who change their channels or
+// resubscribe, so that nobody is sent alerts they did not ask for. A GET of
+// the link, e.g. from following it, shows a page asking to confirm, so that
+// link scanners do not confirm anything. A POST from confirming applies it.
+type handler struct {
+	svc     *dynamodb.DynamoDB
+	confirm *gastracker.SubscriptionConfirmer
+}
+
+// subscriberRequest is the body of a subscribe or update request.
+type subscriberRequest struct {
+	Email           string   `json:"email"`
+	TeamsWebhookURL string   `json:"teamsWebhookUrl"`
+	Chains          []string `json:"chains"`
+	Categories      []string `json:"categories"`
+	BelowGwei       int      `json:"belowGwei"`
+	AboveGwei       int      `json:"aboveGwei"`
+	Rules           []string `json:"rules"`
+}
+
+type subscribeResponse struct {
+	Subscriber *subscribers.Subscriber `json:"subscriber"`
+	Token      string                  `json:"token"`
+}
+
+// Confirm links are to GAS_SUBSCRIBE_URL, the public URL of /subscribers,
+// and are signed with the secret in GAS_SUBSCRIBE_SECRET.
+func main() {
+	if err := logging.Setup(false); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	baseURL := os.Getenv("GAS_SUBSCRIBE_URL")
+	if baseURL == "" {
+		log.Fatal().Msg("GAS_SUBSCRIBE_URL not set")
+	}
+	secret := os.Getenv("GAS_SUBSCRIBE_SECRET")
+	if secret == "" {
+		log.Fatal().Msg("GAS_SUBSCRIBE_SECRET not set")
+	}
+
+	confirm, err := gastracker.NewSubscriptionConfirmer(baseURL, secret)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to configure confirmations")
+	}
+
+	sess, err := awsconfig.NewSession()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create AWS session")
+	}
+
+	h := handler{svc: dynamodb.New(sess), confirm: confirm}
+	lambda.Start(h.handleRequest)
+}
+
+func (h *handler) handleRequest(
+	ctx context.Context, req events.APIGatewayProxyRequest,
+) (events.APIGatewayProxyResponse, error) {
+	id := req.PathParameters["id"]
+
+	if id == "" {
+		if req.HTTPMethod != http.MethodPost {
+			return respondError(http.StatusMethodNotAllowed, "method not allowed"), nil
+		}
+
+		return h.subscribe(ctx, req.Body), nil
+	}
+
+	if strings.HasSuffix(req.Path, "/confirm") {
+		return h.confirmChannels(id, req), nil
+	}
+
+	sub, rsp := h.authorise(id, req.Headers)
+	if sub == nil {
+		return rsp, nil
+	}
+
+	switch req.HTTPMethod {
+	case http.MethodGet:
+		return respond(http.StatusOK, sub), nil
+
+	case http.MethodPut:
+		return h.update(ctx, sub, req.Body), nil
+
+	case http.MethodDelete:
+		return h.unsubscribe(sub), nil
+
+	default:
+		return respondError(http.StatusMethodNotAllowed, "method not allowed"), nil
+	}
+}
+
+func (h *handler) subscribe(ctx context.Context, body string) events.APIGatewayProxyResponse {
+	var req subscriberRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return respondError(http.StatusBadRequest, "invalid JSON: "+err.Error())
+	}
+
+	id, err := subscribers.NewID()
+	if err != nil {
+		return internalError(errors.Wrap(err, "while generating subscriber ID"))
+	}
+	token, hash, err := subscribers.NewToken()
+	if err != nil {
+		return internalError(errors.Wrap(err, "while generating token"))
+	}
+
+	now := clock.Now()
+	sub := subscribers.Subscriber{
+		ID:        id,
+		Pending:   true,
+		TokenHash: hash,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	req.applyTo(&sub)
+
+	if err := validate(&sub); err != nil {
+		return respondError(http.StatusBadRequest, err.Error())
+	}
+
+	// The confirmation is sent first, so that a subscriber is not stored
+	// unless they can be confirmed.
+	if err := h.confirm.Send(ctx, &sub); err != nil {
+		return confirmError(err)
+	}
+
+	if err := subscribers.Save(h.svc, &sub); err != nil {
+		return internalError(errors.Wrap(err, "while saving subscriber"))
+	}
+
+	log.Info().Str("subscriber", sub.ID).Msg("created pending subscriber")
+
+	return respond(http.StatusCreated, &subscribeResponse{Subscriber: &sub, Token: token})
+}
+
+func (h *handler) update(
+	ctx context.Context, sub *subscribers.Subscriber, body string,
+) events.APIGatewayProxyResponse {
+	var req subscriberRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return respondError(http.StatusBadRequest, "invalid JSON: "+err.Error())
+	}
+
+	previous := *sub
+	req.applyTo(sub)
+	sub.UpdatedAt = clock.Now()
+
+	if err := validate(sub); err != nil {
+		return respondError(http.StatusBadRequest, err.Error())
+	}
+
+	// New channels must be confirmed, as must resubscribing, since an
+	// inactive subscriber may have been unsubscribed by the recipient of
+	// their emails rather than by the holder of the management token.
+	if !sub.Active || !sub.SameChannels(&previous) {
+		sub.Active = false
+		sub.Pending = true
+		if err := h.confirm.Send(ctx, sub); err != nil {
+			return confirmError(err)
+		}
+	}
+
+	if err := subscribers.Save(h.svc, sub); err != nil {
+		return internalError(errors.Wrap(err, "while saving subscriber"))
+	}
+
+	log.Info().Str("subscriber", sub.ID).Msg("updated subscriber")
+
+	return respond(http.StatusOK, sub)
+}
+
+func (h *handler) unsubscribe(sub *subscribers.Subscriber) events.APIGatewayProxyResponse {
+	sub.Active = false
+	sub.Pending = false
+	sub.UpdatedAt = clock.Now()
+
+	if err := subscribers.Save(h.svc, sub); err != nil {
+		return internalError(errors.Wrap(err, "while saving subscriber"))
+	}
+
+	log.Info().Str("subscriber", sub.ID).Msg("unsubscribed subscriber")
+
+	return respond(http.StatusOK, sub)
+}
+
+// confirmChannels serves the confirm links sent to a subscriber's channels.
+func (h *handler) confirmChannels(id string, req events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	signed := req.QueryStringParameters["token"]
+
+	sub, err := subscribers.Get(h.svc, id)
+	if err == subscribers.ErrNotFound {
+		return page(http.StatusNotFound, "Subscription not found", "")
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read subscriber")
+		return page(http.StatusInternalServerError, "Something went wrong, please try again", "")
+	}
+
+	if err := h.confirm.Verify(sub, signed); err != nil {
+		return page(http.StatusForbidden, "Invalid link: "+err.Error(), "")
+	}
+
+	switch req.HTTPMethod {
+	case http.MethodGet:
+		if !sub.Pending {
+			return page(http.StatusOK, "Your gas price alerts are already confirmed", "")
+		}
+
+		// The form posts back to the same link, relative so that it works
+		// behind the API Gateway stage prefix.
+		confirm := "?" + url.Values{"token": {signed}}.Encode()
+		return page(http.StatusOK, "Start sending gas price alerts to "+channelNames(sub)+"?", confirm)
+
+	case http.MethodPost:
+		if sub.Pending {
+			sub.Active = true
+			sub.Pending = false
+			sub.UpdatedAt = clock.Now()
+
+			if err := subscribers.Save(h.svc, sub); err != nil {
+				log.Error().Err(err).Msg("failed to save subscriber")
+				return page(http.StatusInternalServerError, "Something went wrong, please try again", "")
+			}
+
+			log.Info().Str("subscriber", sub.ID).Msg("confirmed subscriber")
+		}
+
+		return page(http.StatusOK, "Confirmed, gas price alerts will be sent to "+channelNames(sub), "")
+
+	default:
+		return page(http.StatusMethodNotAllowed, "Method not allowed", "")
+	}
+}
+
+// channelNames describes a subscriber's channels, without revealing the
+// secret part of their webhook URL.
+func channelNames(sub *subscribers.Subscriber) string {
+	var names []string
+	if sub.Email != "" {
+		names = append(names, sub.Email)
+	}
+	if sub.TeamsWebhookURL != "" {
+		names = append(names, "your Teams channel")
+	}
+
+	return strings.Join(names, " and ")
+}
+
+// authorise reads a subscriber and checks the request's management token. If
+// the request is not authorised, it returns nil and the response to send.
+func (h *handler) authorise(
+	id string, headers map[string]string,
+) (*subscribers.Subscriber, events.APIGatewayProxyResponse) {
+	token := bearerToken(headers)
+	if token == "" {
+		return nil, respondError(http.StatusUnauthorized, "missing bearer token")
+	}
+
+	sub, err := subscribers.Get(h.svc, id)
+	if err == subscribers.ErrNotFound {
+		return nil, respondError(http.StatusNotFound, "subscriber not found")
+	}
+	if err != nil {
+		return nil, internalError(errors.Wrap(err, "while reading subscriber"))
+	}
+
+	if !sub.CheckToken(token) {
+		return nil, respondError(http.StatusForbidden, "invalid token")
+	}
+
+	return sub, events.APIGatewayProxyResponse{}
+}
+
+func (r *subscriberRequest) applyTo(sub *subscribers.Subscriber) {
+	sub.Email = r.Email
+	sub.TeamsWebhookURL = r.TeamsWebhookURL
+	sub.Chains = r.Chains
+	sub.Categories = r.Categories
+	sub.BelowGwei = r.BelowGwei
+	sub.AboveGwei = r.AboveGwei
+	sub.Rules = r.Rules
+
+	if len(sub.Chains) == 0 {
+		sub.Chains = subscribers.SupportedChains
+	}
+}
+
+func bearerToken(headers map[string]string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, "Authorization") && strings.HasPrefix(v, "Bearer ") {
+			return strings.TrimPrefix(v, "Bearer ")
+		}
+	}
+
+	return ""
+}
+
+func respond(status int, payload interface{}) events.APIGatewayProxyResponse {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return internalError(errors.Wrap(err, "while marshalling response"))
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}
+}
+
+func respondError(status int, msg string) events.APIGatewayProxyResponse {
+	return respond(status, map[string]string{"error": msg})
+}
+
+// confirmError responds to a failure to send a confirmation, which is most
+// likely due to the channel rather than the request, e.g. a webhook that does
+// not exist.
+func confirmError(err error) events.APIGatewayProxyResponse {
+	log.Warn().Err(err).Msg("failed to send confirmation")
+	return respondError(http.StatusBadGateway, "could not send the confirmation to your channels, please check them")
+}
+
+// page returns a page with a message, and a button that posts to confirm if
+// the confirm URL is set.
+func page(status int, msg, confirm string) events.APIGatewayProxyResponse {
+	return linkpage.Response(status, linkpage.Page{Message: msg, Confirm: confirm})
+}
+
+func internalError(err error) events.APIGatewayProxyResponse {
+	log.Error().Err(err).Msg("internal error")
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusInternalServerError,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       `{"error":"internal error"}`,
+	}
+}
+
+// validate checks a subscriber, including the syntax of their alert rules.
+func validate(sub *subscribers.Subscriber) error {
+	if err := sub.Validate(); err != nil {
+		return err
+	}
+
+	return gastracker.CheckSubscriberRules(sub)
+}
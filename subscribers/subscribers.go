@@ -0,0 +1,391 @@
+// Package subscribers stores the users subscribed to alerts from a hosted
+// tracker, each with their own channels, chains and thresholds.
+package subscribers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/snooze"
+)
+
+const TableName = "gasSubscribers"
+
+// SupportedChains lists the chains that subscribers may track.
+var SupportedChains = []string{"ethereum"}
+
+// MaxRules is the most alert rules a subscriber may have.
+const MaxRules = 10
+
+// ErrNotFound is returned when a subscriber does not exist.
+var ErrNotFound = errors.New("subscriber not found")
+
+// ConfirmLifetime is how long a link to confirm a subscriber's channels
+// remains valid after it is sent.
+const ConfirmLifetime = 48 * time.Hour
+
+// confirmAction is the action of the signed tokens in confirm links.
+const confirmAction snooze.Action = "confirm"
+
+// TeamsWebhookHosts are the domains that Teams incoming webhooks and the
+// workflows that replace them are hosted under. Webhook URLs must be on one
+// of them, so that subscribers cannot have the tracker post to any host.
+var TeamsWebhookHosts = []string{"webhook.office.com", "outlook.office.com", "logic.azure.com"}
+
+// Subscriber is a user subscribed to gas price alerts. Rules are alert rules
+// in the same syntax as GAS_ALERT_RULES, which replace the alerts on category
+// changes for this subscriber. A subscriber is Pending, and not Active, until
+// they follow the confirm link sent to their channels.
+type Subscriber struct {
+	ID              string    `json:"id" dynamodbav:"id"`
+	Email           string    `json:"email,omitempty" dynamodbav:"email,omitempty"`
+	TeamsWebhookURL string    `json:"teamsWebhookUrl,omitempty" dynamodbav:"teamsWebhookUrl,omitempty"`
+	Chains          []string  `json:"chains" dynamodbav:"chains"`
+	Categories      []string  `json:"categories,omitempty" dynamodbav:"categories"`
+	BelowGwei       int       `json:"belowGwei,omitempty" dynamodbav:"belowGwei"`
+	AboveGwei       int       `json:"aboveGwei,omitempty" dynamodbav:"aboveGwei"`
+	Rules           []string  `json:"rules,omitempty" dynamodbav:"rules"`
+	Active          bool      `json:"active" dynamodbav:"active"`
+	Pending         bool      `json:"pending" dynamodbav:"pending"`
+	TokenHash       string    `json:"-" dynamodbav:"tokenHash"`
+	CreatedAt       time.Time `json:"createdAt" dynamodbav:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt" dynamodbav:"updatedAt"`
+}
+
+// Validate checks that a subscriber has at least one valid channel, only
+// supported chains, and valid categories and thresholds.
+func (s *Subscriber) Validate() error {
+	if s.Email == "" && s.TeamsWebhookURL == "" {
+		return errors.New("at least one of email or teamsWebhookUrl is required")
+	}
+
+	if s.Email != "" {
+		if _, err := mail.ParseAddress(s.Email); err != nil {
+			return errors.Wrap(err, "invalid email")
+		}
+	}
+
+	if s.TeamsWebhookURL != "" {
+		u, err := url.Parse(s.TeamsWebhookURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.Errorf("teamsWebhookUrl must be an https URL, got %q", s.TeamsWebhookURL)
+		}
+		if u.Port() != "" || !isTeamsWebhookHost(u.Hostname()) {
+			return errors.Errorf(
+				"teamsWebhookUrl must be a Teams webhook under one of %s, got host %q",
+				strings.Join(TeamsWebhookHosts, ", "), u.Host,
+			)
+		}
+	}
+
+	if len(s.Chains) == 0 {
+		return errors.New("at least one chain is required")
+	}
+	for _, chain := range s.Chains {
+		if !isSupportedChain(chain) {
+			return errors.Errorf("unsupported chain %q", chain)
+		}
+	}
+
+	if _, err := s.PriceCategories(); err != nil {
+		return err
+	}
+
+	if s.BelowGwei < 0 || s.AboveGwei < 0 {
+		return errors.New("thresholds must not be negative")
+	}
+	if s.BelowGwei > 0 && s.AboveGwei > 0 && s.BelowGwei >= s.AboveGwei {
+		return errors.New("belowGwei must be less than aboveGwei")
+	}
+
+	if len(s.Rules) > MaxRules {
+		return errors.Errorf("at most %d rules are allowed, got %d", MaxRules, len(s.Rules))
+	}
+	for _, rule := range s.Rules {
+		if strings.TrimSpace(rule) == "" {
+			return errors.New("rules must not be empty")
+		}
+	}
+
+	return nil
+}
+
+// PriceCategories parses the categories the subscriber wants to be notified
+// about. An empty result means all categories.
+func (s *Subscriber) PriceCategories() ([]prices.PriceCategory, error) {
+	categories := make([]prices.PriceCategory, len(s.Categories))
+	for i := range s.Categories {
+		category, err := prices.ParsePriceCategory(s.Categories[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid category %q", s.Categories[i])
+		}
+
+		categories[i] = category
+	}
+
+	return categories, nil
+}
+
+// Tracks returns true if the subscriber tracks the given chain.
+func (s *Subscriber) Tracks(chain string) bool {
+	for _, c := range s.Chains {
+		if c == chain {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isTeamsWebhookHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range TeamsWebhookHosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSupportedChain(chain string) bool {
+	for _, c := range SupportedChains {
+		if c == chain {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewID generates a random subscriber ID.
+func NewID() (string, error) {
+	return randomHex(16)
+}
+
+// NewToken generates a random management token for a subscriber, returning
+// the token to give to the subscriber and the hash to store.
+func NewToken() (token, hash string, err error) {
+	token, err = randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, hashToken(token), nil
+}
+
+// CheckToken returns true if the token matches the subscriber's stored hash.
+func (s *Subscriber) CheckToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(s.TokenHash)) == 1
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// UnsubscribeLink returns a link that unsubscribes an email address, signed
+// with the secret so that only the recipient of an email can use it.
+//
+// Unlike snooze and confirm links, unsubscribe links deliberately do not
+// expire: one-click unsubscribe (RFC 8058) expects the link in any email,
+// however old, to keep working, and a leaked link can only stop alerts to the
+// address it was sent to, which resubscribing undoes. Rotating the secret
+// revokes every link sent so far.
+func UnsubscribeLink(baseURL string, secret []byte, email string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", errors.Wrap(err, "while parsing base URL")
+	}
+
+	email = strings.ToLower(email)
+	q := u.Query()
+	q.Set("email", email)
+	q.Set("sig", base64.RawURLEncoding.EncodeToString(unsubscribeMAC(secret, email)))
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// VerifyUnsubscribe checks the signature of an unsubscribe link.
+func VerifyUnsubscribe(secret []byte, email, sig string) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return errors.Wrap(err, "malformed signature")
+	}
+	if !hmac.Equal(decoded, unsubscribeMAC(secret, strings.ToLower(email))) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+func unsubscribeMAC(secret []byte, email string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte("unsubscribe:" + email))
+	return h.Sum(nil)
+}
+
+// SameChannels returns true if two subscribers are notified at the same email
+// address and Teams webhook, so that a confirmation of one's channels also
+// holds for the other.
+func (s *Subscriber) SameChannels(other *Subscriber) bool {
+	return strings.EqualFold(s.Email, other.Email) && s.TeamsWebhookURL == other.TeamsWebhookURL
+}
+
+// confirmScope identifies a subscriber and the channels a confirm link was
+// sent to, so that a link stops working once the channels change.
+func (s *Subscriber) confirmScope() string {
+	sum := sha256.Sum256([]byte(strings.ToLower(s.Email) + "\n" + s.TeamsWebhookURL))
+	return s.ID + ":" + hex.EncodeToString(sum[:])
+}
+
+// ConfirmLink returns a link that confirms a subscriber's current channels,
+// signed with the secret so that only a recipient of the link can use it. The
+// link is to the subscriber under baseURL, and expires after ConfirmLifetime.
+func ConfirmLink(baseURL string, secret []byte, s *Subscriber, now time.Time) (string, error) {
+	return snooze.Link(strings.TrimSuffix(baseURL, "/")+"/"+url.PathEscape(s.ID)+"/confirm", secret, &snooze.Token{
+		Action:  confirmAction,
+		Scope:   s.confirmScope(),
+		Expires: now.Add(ConfirmLifetime),
+	})
+}
+
+// VerifyConfirm checks that a signed token from a confirm link is valid and
+// unexpired, and was sent for the subscriber's current channels.
+func VerifyConfirm(secret []byte, s *Subscriber, signed string, now time.Time) error {
+	t, err := snooze.Verify(secret, signed, now)
+	if err != nil {
+		return err
+	}
+
+	if t.Action != confirmAction || t.Scope != s.confirmScope() {
+		return errors.New("link is not for this subscription")
+	}
+
+	return nil
+}
+
+// Save stores a subscriber, replacing any existing subscriber with the same ID.
+func Save(svc *dynamodb.DynamoDB, s *Subscriber) error {
+	av, err := dynamodbattribute.MarshalMap(s)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(TableName),
+	})
+	return err
+}
+
+// Get reads a single subscriber by ID, returning ErrNotFound if there is no
+// such subscriber.
+func Get(svc *dynamodb.DynamoDB, id string) (*Subscriber, error) {
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(id),
+			},
+		},
+		TableName: aws.String(TableName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, ErrNotFound
+	}
+
+	var s Subscriber
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// UnsubscribeEmail marks every active subscriber with an email address as
+// inactive, returning how many there were.
+func UnsubscribeEmail(svc *dynamodb.DynamoDB, email string, now time.Time) (int, error) {
+	subs, err := ReadActive(svc)
+	if err != nil {
+		return 0, errors.Wrap(err, "while reading subscribers")
+	}
+
+	n := 0
+	for i := range subs {
+		if !strings.EqualFold(subs[i].Email, email) {
+			continue
+		}
+
+		subs[i].Active = false
+		subs[i].UpdatedAt = now
+		if err := Save(svc, &subs[i]); err != nil {
+			return n, errors.Wrapf(err, "while saving subscriber %s", subs[i].ID)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// ReadActive reads every active subscriber.
+func ReadActive(svc *dynamodb.DynamoDB) ([]Subscriber, error) {
+	var subs []Subscriber
+	var startKey map[string]*dynamodb.AttributeValue
+
+	for {
+		result, err := svc.Scan(&dynamodb.ScanInput{
+			TableName:         aws.String(TableName),
+			ExclusiveStartKey: startKey,
+			FilterExpression:  aws.String("active = :active"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":active": {BOOL: aws.Bool(true)},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range result.Items {
+			var s Subscriber
+			if err := dynamodbattribute.UnmarshalMap(result.Items[i], &s); err != nil {
+				return nil, err
+			}
+
+			subs = append(subs, s)
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = result.LastEvaluatedKey
+	}
+
+	return subs, nil
+}
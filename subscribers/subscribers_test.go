@@ -0,0 +1,138 @@
+package subscribers
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyUnsubscribe(t *testing.T) {
+	secret := []byte("secret")
+
+	link, err := UnsubscribeLink("https://gas.example.com/unsubscribe", secret, "Alice@Example.com")
+	if err != nil {
+		t.Fatalf("UnsubscribeLink: %v", err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("while parsing link: %v", err)
+	}
+	email, sig := u.Query().Get("email"), u.Query().Get("sig")
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		email   string
+		sig     string
+		wantErr bool
+	}{
+		{name: "valid", secret: secret, email: email, sig: sig},
+		{name: "any case", secret: secret, email: "ALICE@example.com", sig: sig},
+		{name: "other email", secret: secret, email: "bob@example.com", sig: sig, wantErr: true},
+		{name: "wrong secret", secret: []byte("other"), email: email, sig: sig, wantErr: true},
+		{name: "tampered signature", secret: secret, email: email, sig: "A" + sig[1:], wantErr: true},
+		{name: "malformed signature", secret: secret, email: email, sig: "!", wantErr: true},
+		{name: "no signature", secret: secret, email: email, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyUnsubscribe(tt.secret, tt.email, tt.sig)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyUnsubscribe() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyConfirm(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	sub := Subscriber{ID: "abc", Email: "alice@example.com", TeamsWebhookURL: "https://example.webhook.office.com/x"}
+
+	link, err := ConfirmLink("https://gas.example.com/subscribers/", secret, &sub, now)
+	if err != nil {
+		t.Fatalf("ConfirmLink: %v", err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("while parsing link: %v", err)
+	}
+	if u.Path != "/subscribers/abc/confirm" {
+		t.Errorf("ConfirmLink() path = %s, want /subscribers/abc/confirm", u.Path)
+	}
+	token := u.Query().Get("token")
+
+	renamed := sub
+	renamed.Email = "ALICE@example.com"
+	otherEmail := sub
+	otherEmail.Email = "bob@example.com"
+	otherWebhook := sub
+	otherWebhook.TeamsWebhookURL = "https://example.webhook.office.com/y"
+	otherID := sub
+	otherID.ID = "def"
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		sub     *Subscriber
+		token   string
+		now     time.Time
+		wantErr string
+	}{
+		{name: "valid", secret: secret, sub: &sub, token: token, now: now},
+		{name: "email in another case", secret: secret, sub: &renamed, token: token, now: now},
+		{name: "expired", secret: secret, sub: &sub, token: token, now: now.Add(ConfirmLifetime + time.Second), wantErr: "expired"},
+		{name: "email changed", secret: secret, sub: &otherEmail, token: token, now: now, wantErr: "not for this subscription"},
+		{name: "webhook changed", secret: secret, sub: &otherWebhook, token: token, now: now, wantErr: "not for this subscription"},
+		{name: "other subscriber", secret: secret, sub: &otherID, token: token, now: now, wantErr: "not for this subscription"},
+		{name: "wrong secret", secret: []byte("other"), sub: &sub, token: token, now: now, wantErr: "invalid token signature"},
+		{name: "tampered", secret: secret, sub: &sub, token: "A" + token[1:], now: now, wantErr: "invalid token signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyConfirm(tt.secret, tt.sub, tt.token, tt.now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("VerifyConfirm: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VerifyConfirm() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTeamsWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "incoming webhook", url: "https://contoso.webhook.office.com/webhookb2/abc"},
+		{name: "legacy webhook", url: "https://outlook.office.com/webhook/abc"},
+		{name: "workflow", url: "https://prod-01.westus.logic.azure.com/workflows/abc"},
+		{name: "any case", url: "https://Contoso.Webhook.Office.com/webhookb2/abc"},
+		{name: "not https", url: "http://contoso.webhook.office.com/webhookb2/abc", wantErr: true},
+		{name: "other host", url: "https://example.com/webhook", wantErr: true},
+		{name: "suffix of another domain", url: "https://evilwebhook.office.com/abc", wantErr: true},
+		{name: "domain as a subdomain", url: "https://webhook.office.com.example.com/abc", wantErr: true},
+		{name: "port", url: "https://contoso.webhook.office.com:8443/abc", wantErr: true},
+		{name: "internal address", url: "https://169.254.169.254/latest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := Subscriber{TeamsWebhookURL: tt.url, Chains: SupportedChains}
+			err := sub.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
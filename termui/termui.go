@@ -0,0 +1,75 @@
+// Package termui formats gas prices for people reading them in a terminal,
+// with unicode sparklines and ANSI colours.
+package termui
+
+import (
+	"os"
+	"strings"
+
+	"github.com/ryanc414/gas-tracker/prices"
+)
+
+const reset = "\x1b[0m"
+
+// sparks are the bars of a sparkline, from lowest to highest.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// categoryColours are the ANSI colours of each category, from bright green
+// for Very Low to bright red for Very High.
+var categoryColours = map[prices.PriceCategory]string{
+	prices.VeryLow:  "\x1b[1;32m",
+	prices.Low:      "\x1b[32m",
+	prices.Average:  "\x1b[37m",
+	prices.High:     "\x1b[33m",
+	prices.VeryHigh: "\x1b[1;31m",
+}
+
+// Interactive returns true if f is a terminal and colours have not been
+// turned off by setting NO_COLOR, see https://no-color.org.
+func Interactive(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Colour returns s in the colour of a category.
+func Colour(c prices.PriceCategory, s string) string {
+	return categoryColours[c] + s + reset
+}
+
+// Sparkline returns a bar for each price, scaled between the lowest and
+// highest, and coloured by its category.
+func Sparkline(gasPrices []prices.GasPriceData) string {
+	if len(gasPrices) == 0 {
+		return ""
+	}
+
+	lo, hi := gasPrices[0].Price, gasPrices[0].Price
+	for i := range gasPrices {
+		if gasPrices[i].Price < lo {
+			lo = gasPrices[i].Price
+		}
+		if gasPrices[i].Price > hi {
+			hi = gasPrices[i].Price
+		}
+	}
+
+	var b strings.Builder
+	for i := range gasPrices {
+		bar := len(sparks) / 2
+		if hi > lo {
+			bar = (gasPrices[i].Price - lo) * (len(sparks) - 1) / (hi - lo)
+		}
+
+		b.WriteString(Colour(gasPrices[i].Category, string(sparks[bar])))
+	}
+
+	return b.String()
+}
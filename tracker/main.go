@@ -0,0 +1,608 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/gastracker"
+	"github.com/ryanc414/gas-tracker/logging"
+	"github.com/ryanc414/gas-tracker/termui"
+	"github.com/ryanc414/gas-tracker/version"
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	onLambda := runningOnLambda()
+	if err := logging.Setup(!onLambda); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	if onLambda {
+		lambda.Start(HandleRequest)
+		return
+	}
+
+	if err := newRootCommand().ExecuteContext(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("command failed")
+	}
+}
+
+func runningOnLambda() bool {
+	return os.Getenv("_LAMBDA_SERVER_PORT") != "" || os.Getenv("AWS_LAMBDA_RUNTIME_API") != ""
+}
+
+// trackEvent is the event the Lambda is invoked with. Run options may be set
+// at the top level, e.g. by the constant input of an EventBridge schedule such
+// as {"dryRun": true} or {"chain": "ethereum"}, or in the detail of a custom
+// EventBridge event. Other fields, such as those of a plain scheduled event,
+// are ignored.
+//
+// An event with a backfill range, e.g.
+// {"backfill": {"from": "2021-03-01", "to": "2021-03-07T12:00:00Z"}},
+// recategorises the stored prices in the range rather than sampling the price.
+type trackEvent struct {
+	trackOptions
+	Detail *trackOptions `json:"detail"`
+}
+
+type trackOptions struct {
+	gastracker.RunOptions
+	Backfill *backfillRange `json:"backfill"`
+}
+
+// backfillRange is the range of stored prices to recategorise, each bound an
+// RFC 3339 timestamp or a date. Either may be omitted to leave the range open.
+type backfillRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// HandleRequest runs the tracker once, returning a summary of the run, or
+// recategorises the stored prices in a backfill range, returning a summary of
+// the backfill.
+func HandleRequest(ctx context.Context, event trackEvent) (interface{}, error) {
+	opts := event.RunOptions
+	backfill := event.Backfill
+	if d := event.Detail; d != nil {
+		opts.DryRun = opts.DryRun || d.DryRun
+		opts.ForceNotify = opts.ForceNotify || d.ForceNotify
+		if opts.Chain == "" {
+			opts.Chain = d.Chain
+		}
+		if backfill == nil {
+			backfill = d.Backfill
+		}
+	}
+
+	if backfill != nil {
+		summary, err := gastracker.BackfillRange(backfill.From, backfill.To)
+		if err != nil {
+			log.Error().Err(err).Msg("backfill failed")
+			return nil, err
+		}
+
+		return summary, nil
+	}
+
+	// Lambda retries a failed asynchronous invocation with the same request
+	// ID, so a retry after the price was stored stores nothing more.
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		opts.RequestID = lc.AwsRequestID
+	}
+
+	summary, err := gastracker.Run(ctx, opts)
+	if err != nil {
+		log.Error().Err(err).Msg("run failed")
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "gas-tracker",
+		Short: "Track Ethereum gas prices and alert when they are unusually low or high",
+		Long: "Track Ethereum gas prices and alert when they are unusually low or high.\n\n" +
+			"Configuration is read from GAS_ environment variables, or from the YAML file\n" +
+			"named by GAS_CONFIG_FILE. Running without a command is the same as track, so\n" +
+			"that existing cron and launchd schedules keep working.",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return track(cmd.Context(), gastracker.RunOptions{}, 0)
+		},
+	}
+
+	root.AddCommand(
+		newTrackCommand(),
+		newStatsCommand(),
+		newHistoryCommand(),
+		newNotificationsCommand(),
+		newExportCommand(),
+		newBackfillCommand(),
+		newServeCommand(),
+		newBacktestCommand(),
+		newCostsCommand(),
+		newShouldTransactCommand(),
+		newReportCommand(),
+		newPublishCommand(),
+		newNotifyTestCommand(),
+		newConfigCommand(),
+		newVersionCommand(),
+	)
+
+	return root
+}
+
+func newTrackCommand() *cobra.Command {
+	var opts gastracker.RunOptions
+	var watch time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "track",
+		Short: "Sample the current gas price once, send any alerts and store the sample",
+		Long: "Sample the current gas price once, send any alerts and store the sample.\n\n" +
+			"With --watch, keep sampling at that interval until interrupted, e.g. to run\n" +
+			"the tracker in a terminal with desktop notifications rather than from cron.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if watch != 0 && watch < minWatchInterval {
+				return errors.Errorf("--watch must be at least %v, got %v", minWatchInterval, watch)
+			}
+
+			return track(cmd.Context(), opts, watch)
+		},
+	}
+	cmd.Flags().DurationVar(&watch, "watch", 0, "sample repeatedly at this interval until interrupted, e.g. 5m")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "log any alerts rather than sending them, and store nothing")
+	cmd.Flags().BoolVar(
+		&opts.ForceNotify, "force-notify", false, "notify of the current category even if unchanged, ignoring snoozes and cooldowns",
+	)
+
+	return cmd
+}
+
+// minWatchInterval is the shortest interval that track samples at in watch
+// mode, so that it does not exceed the rate limits of the price sources.
+const minWatchInterval = 10 * time.Second
+
+// track samples the gas price once or, if watch is non-zero, at that interval
+// until interrupted. An interrupt does not stop a sample part way through
+// writing it or sending its alerts, so the first SIGINT or SIGTERM waits for
+// the in-flight sample to finish, or exits at once between samples, and only a
+// second exits immediately. In watch mode, a failed sample is logged and the
+// next one is still taken.
+//
+// When run from a terminal, the result is shown as a coloured summary rather
+// than info logs, unless GAS_LOG_LEVEL is set.
+func track(ctx context.Context, opts gastracker.RunOptions, watch time.Duration) error {
+	interactive := termui.Interactive(os.Stdout)
+	if interactive && os.Getenv("GAS_LOG_LEVEL") == "" {
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	}
+
+	interrupted := make(chan struct{})
+	stop := onInterrupt(func(sig os.Signal) {
+		log.Warn().
+			Stringer("signal", sig).
+			Msg("finishing any in-flight sample before exiting, interrupt again to exit now")
+		close(interrupted)
+	})
+	defer stop()
+
+	var ticks <-chan time.Time
+	if watch > 0 {
+		ticker := time.NewTicker(watch)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		summary, err := gastracker.Run(ctx, opts)
+		switch {
+		case err != nil && watch == 0:
+			return err
+
+		case err != nil:
+			log.Error().Err(err).Msg("run failed, sampling again at the next interval")
+
+		case interactive && summary != nil && summary.Category != "":
+			printSummary(os.Stdout, summary)
+		}
+
+		if watch == 0 {
+			return nil
+		}
+
+		select {
+		case <-interrupted:
+			return nil
+
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-ticks:
+		}
+	}
+}
+
+// onInterrupt calls f on the first SIGINT or SIGTERM, after which signals are
+// handled as usual again. The returned function stops waiting for a signal.
+func onInterrupt(f func(os.Signal)) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			signal.Stop(sigs)
+			f(sig)
+
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+func newStatsCommand() *cobra.Command {
+	var buckets int
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Print the stats and price distribution of the stored prices",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return gastracker.Stats(buckets)
+		},
+	}
+	cmd.Flags().IntVar(&buckets, "buckets", gastracker.DefaultHistogramBuckets, "number of histogram buckets")
+
+	return cmd
+}
+
+func newHistoryCommand() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Print the most recent stored prices",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return gastracker.History(limit)
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 24, "maximum number of prices to show, 0 for all")
+
+	return cmd
+}
+
+func newNotificationsCommand() *cobra.Command {
+	var (
+		limit   int
+		channel string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "notifications",
+		Short: "Print the most recent notifications sent, and whether each was delivered",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return gastracker.Notifications(limit, channel)
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "maximum number of notifications to show, 0 for all")
+	cmd.Flags().StringVar(&channel, "channel", "", "only show notifications sent over this channel")
+
+	return cmd
+}
+
+func newExportCommand() *cobra.Command {
+	var (
+		opts   gastracker.ExportOptions
+		output string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the stored prices as JSON, CSV or Parquet",
+		Long: "Export the stored prices as JSON, CSV or Parquet.\n\n" +
+			"Parquet exports are written to the --output directory, partitioned by the UTC\n" +
+			"date the prices were sampled on, e.g. date=2021-03-01/prices.parquet, so that\n" +
+			"Athena, DuckDB or Spark can query the directory as a table.",
+		Example: "  gas-tracker export --format csv -o prices.csv\n" +
+			"  gas-tracker export --format csv --from 2021-03-01 --to 2021-03-31 --fields timestamp,price\n" +
+			"  gas-tracker export --format parquet -o prices/",
+		Args: cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			if opts.Format == "parquet" {
+				return gastracker.ExportParquet(output, opts)
+			}
+			if output == "" {
+				return gastracker.Export(os.Stdout, opts)
+			}
+
+			f, err := os.Create(output)
+			if err != nil {
+				return errors.Wrap(err, "while creating output file")
+			}
+			if err := gastracker.Export(f, opts); err != nil {
+				f.Close()
+				return err
+			}
+
+			return errors.Wrap(f.Close(), "while closing output file")
+		},
+	}
+	cmd.Flags().StringVar(&opts.Format, "format", "json", "output format, json, csv or parquet")
+	cmd.Flags().StringVarP(
+		&output, "output", "o", "", "file to write to instead of stdout, or directory for Parquet",
+	)
+	cmd.Flags().StringVar(&opts.From, "from", "", "earliest price to export, as an RFC 3339 timestamp or a date")
+	cmd.Flags().StringVar(&opts.To, "to", "", "latest price to export, as an RFC 3339 timestamp or a date")
+	cmd.Flags().StringSliceVar(
+		&opts.Fields, "fields", nil,
+		"CSV columns to write: timestamp, local_time, unix, price, category or eth_usd "+
+			"(default timestamp,price,category,eth_usd)",
+	)
+
+	return cmd
+}
+
+func newBackfillCommand() *cobra.Command {
+	var from, to string
+
+	cmd := &cobra.Command{
+		Use:   "backfill [FILE]",
+		Short: "Store prices from a JSON or CSV (timestamp,price) history file",
+		Long: "Store prices from a JSON or CSV (timestamp,price) history file, such as one\n" +
+			"written by export. Prices that are already stored, or are older than the\n" +
+			"retention, are skipped. Each price is categorised against the prices before it.\n\n" +
+			"Without a file, recategorise the stored prices between --from and --to instead,\n" +
+			"e.g. after changing the bands or the stats window.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				if cmd.Flags().Changed("from") || cmd.Flags().Changed("to") {
+					return errors.New("--from and --to recategorise stored prices, and cannot be used with a file")
+				}
+				return gastracker.Backfill(args[0])
+			}
+
+			summary, err := gastracker.BackfillRange(from, to)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("recategorised %d of %d stored gas prices\n", summary.Recategorised, summary.Checked)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&from, "from", "", "earliest price to recategorise, as an RFC 3339 timestamp or a date")
+	cmd.Flags().StringVar(&to, "to", "", "latest price to recategorise, as an RFC 3339 timestamp or a date")
+
+	return cmd
+}
+
+func newServeCommand() *cobra.Command {
+	opts := gastracker.DefaultServeOptions
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the latest price, stats and history over HTTP, and optionally gRPC",
+		Long: "Serve the latest price, stats and history over HTTP, and optionally gRPC.\n\n" +
+			"/healthz reports when a price was last stored, failing once that is older than\n" +
+			"--max-fetch-age, and /readyz reports whether the store is reachable and the\n" +
+			"notifiers are configured, so that an orchestrator can restart a wedged tracker.\n" +
+			"/ui/ is a web dashboard of the latest price, recent prices and recent alerts,\n" +
+			"and /decision answers whether to transact now, as should-transact does.\n" +
+			"On SIGINT or SIGTERM it stops accepting connections and waits for in-flight\n" +
+			"requests to finish.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			stop := onInterrupt(func(os.Signal) { cancel() })
+			defer stop()
+
+			return gastracker.Serve(ctx, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.Addr, "addr", opts.Addr, "address the JSON HTTP API listens on")
+	cmd.Flags().StringVar(&opts.GRPCAddr, "grpc-addr", "", "address the gRPC API listens on, e.g. :9090")
+	cmd.Flags().DurationVar(
+		&opts.PollInterval, "poll-interval", opts.PollInterval, "how often to check for new prices to stream over gRPC",
+	)
+	cmd.Flags().DurationVar(
+		&opts.MaxFetchAge, "max-fetch-age", opts.MaxFetchAge, "how long after the last stored price /healthz fails",
+	)
+
+	return cmd
+}
+
+func newBacktestCommand() *cobra.Command {
+	opts := gastracker.DefaultBacktestOptions
+
+	cmd := &cobra.Command{
+		Use:   "backtest",
+		Short: "Replay history through the configured alert rules",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return gastracker.Backtest(opts)
+		},
+	}
+	cmd.Flags().StringVar(
+		&opts.File, "file", "", "JSON or CSV (timestamp,price) history to replay instead of the stored prices",
+	)
+	cmd.Flags().IntVar(&opts.Window, "window", opts.Window, "number of previous samples the baseline is calculated over")
+	cmd.Flags().BoolVarP(&opts.Verbose, "verbose", "v", false, "print every alert rather than only the summary")
+
+	return cmd
+}
+
+func newCostsCommand() *cobra.Command {
+	var gwei int
+
+	cmd := &cobra.Command{
+		Use:   "costs",
+		Short: "Estimate the cost of common transactions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return gastracker.Costs(cmd.Context(), gwei)
+		},
+	}
+	cmd.Flags().IntVar(&gwei, "gwei", 0, "gas price in gwei to estimate costs at, rather than the current price")
+
+	return cmd
+}
+
+// exitWait is the exit status of should-transact --exit-code when the
+// recommendation is to wait.
+const exitWait = 2
+
+func newShouldTransactCommand() *cobra.Command {
+	var (
+		opts     = gastracker.DecisionOptions{MaxPercentile: gastracker.DefaultDecisionPercentile}
+		asJSON   bool
+		exitCode bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "should-transact",
+		Short: "Decide whether to transact at the current gas price",
+		Long: "Decide whether to transact at the latest stored gas price, with a confidence\n" +
+			"from 0 to 1 and the rationale: the percentile of the price over the stats\n" +
+			"window, the trend and the forecast. It fails if the latest price is more than\n" +
+			"2 hours old. With --exit-code it exits with status 2 if the recommendation is\n" +
+			"to wait, so that scripts can gate on it, e.g.\n\n" +
+			"  gas-tracker should-transact --exit-code && ./rebalance.sh",
+		Args: cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			d, err := gastracker.Decide(opts)
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				if err := json.NewEncoder(os.Stdout).Encode(d); err != nil {
+					return errors.Wrap(err, "while writing decision")
+				}
+			} else {
+				printDecision(d)
+			}
+
+			if exitCode && !d.Transact {
+				os.Exit(exitWait)
+			}
+
+			return nil
+		},
+	}
+	cmd.Flags().Float64Var(
+		&opts.MaxPercentile, "max-percentile", opts.MaxPercentile,
+		"highest percentile of recent prices to transact at",
+	)
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the decision as JSON")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "exit with status 2 if the recommendation is to wait")
+
+	return cmd
+}
+
+func printDecision(d *gastracker.Decision) {
+	verdict := "wait"
+	if d.Transact {
+		verdict = "transact"
+	}
+
+	fmt.Printf("%s (confidence %.2f) at %d gwei, %s\n", verdict, d.Confidence, d.Price, d.Category)
+	for _, reason := range d.Rationale {
+		fmt.Printf("  %s\n", reason)
+	}
+}
+
+func newReportCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "report",
+		Short: "Print the weekly report for the stored prices",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return gastracker.Report()
+		},
+	}
+}
+
+func newPublishCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "publish",
+		Short: "Publish the dashboard of the stored prices to S3",
+		Long: "Render a static HTML dashboard of the current price and category, and the\n" +
+			"chart and stats of the past 7 days, and upload it to GAS_DASHBOARD_BUCKET.\n" +
+			"Each run also publishes it when the bucket is set.",
+		Args: cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return gastracker.Publish()
+		},
+	}
+}
+
+func newNotifyTestCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "notify-test",
+		Short: "Send a test notification through every configured notifier",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return gastracker.NotifyTest(cmd.Context())
+		},
+	}
+}
+
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration without fetching or storing any prices",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			if err := gastracker.ValidateConfig(); err != nil {
+				return err
+			}
+
+			log.Info().Msg("configuration is valid")
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+func newVersionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version of this build",
+		Args:  cobra.NoArgs,
+		Run: func(*cobra.Command, []string) {
+			fmt.Println(version.Get())
+		},
+	}
+}
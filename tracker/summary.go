@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ryanc414/gas-tracker/display"
+	"github.com/ryanc414/gas-tracker/gastracker"
+	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/termui"
+)
+
+// printSummary shows the result of a run in a terminal: the sampled price in
+// the colour of its category, a sparkline of the recent prices, and the mean
+// with the band of one standard deviation either side, outside which prices
+// are typically categorised as high or low.
+func printSummary(w io.Writer, summary *gastracker.RunSummary) {
+	category, err := prices.ParsePriceCategory(summary.Category)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(
+		w, "%d gwei %s at %s",
+		summary.Price, termui.Colour(category, summary.Category), display.In(summary.Timestamp).Format("15:04 MST"),
+	)
+	if summary.PreviousCategory != "" && summary.PreviousCategory != summary.Category {
+		fmt.Fprintf(w, ", was %s", summary.PreviousCategory)
+	}
+	fmt.Fprintln(w)
+
+	if len(summary.Recent) > 1 {
+		lo, hi := summary.Recent[0].Price, summary.Recent[0].Price
+		for i := range summary.Recent {
+			if p := summary.Recent[i].Price; p < lo {
+				lo = p
+			} else if p > hi {
+				hi = p
+			}
+		}
+
+		span := summary.Recent[len(summary.Recent)-1].Timestamp.Sub(summary.Recent[0].Timestamp)
+		fmt.Fprintf(
+			w, "%s  %d-%d gwei over %s\n",
+			termui.Sparkline(summary.Recent), lo, hi, span.Round(time.Minute),
+		)
+	}
+
+	fmt.Fprintf(
+		w, "mean %.1f gwei, typical %.1f-%.1f gwei\n",
+		summary.Mean, summary.Mean-summary.Stddev, summary.Mean+summary.Stddev,
+	)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/api"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/gastracker"
+	"github.com/ryanc414/gas-tracker/logging"
+)
+
+// Serves the unsubscribe links in subscriber emails behind API Gateway, at
+// /unsubscribe, signed with the secret in GAS_UNSUBSCRIBE_SECRET.
+func main() {
+	if err := logging.Setup(false); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	secret := os.Getenv("GAS_UNSUBSCRIBE_SECRET")
+	if secret == "" {
+		log.Fatal().Msg("GAS_UNSUBSCRIBE_SECRET not set")
+	}
+
+	sess, err := awsconfig.NewSession()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create AWS session")
+	}
+
+	h := gastracker.UnsubscribeHandler(dynamodb.New(sess), secret)
+	lambda.Start(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return api.ServeAPIGateway(ctx, h, req)
+	})
+}
@@ -3,104 +3,108 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
-	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/ryanc414/gas-tracker/awsconfig"
+	"github.com/ryanc414/gas-tracker/logging"
 	"github.com/ryanc414/gas-tracker/prices"
+	"github.com/ryanc414/gas-tracker/store"
 )
 
 func main() {
-	if err := run(context.Background()); err != nil {
-		log.Fatal(err)
+	file := flag.String("file", "/users/ryan/.gas_prices.json", "gas price history written by the old CLI")
+	flag.Parse()
+
+	if err := logging.Setup(true); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+
+	if err := run(context.Background(), *file); err != nil {
+		log.Fatal().Err(err).Msg("failed to upload gas price history")
 	}
 }
 
-type convertedPrice struct {
-	Price     int    `dynamodbav:"price"`
-	Timestamp string `dynamodbav:"timestamp"`
-	Category  string `dynamodbav:"category"`
+// historicalGasPrices is the gas price history file written by the old CLI,
+// which only recorded the category of the most recent price.
+type historicalGasPrices struct {
+	Prices       []prices.GasPriceData `json:"prices"`
+	LastCategory prices.PriceCategory  `json:"lastCategory"`
 }
 
-func run(context.Context) error {
-	priceData, err := getItems()
+func run(_ context.Context, file string) error {
+	history, err := getItems(file)
 	if err != nil {
 		return err
 	}
 
-	converted := convertPrices(priceData)
-	return uploadPrices(converted)
+	return uploadPrices(convertPrices(history))
 }
 
-const tableName = "gasPrices"
-
-func uploadPrices(converted []convertedPrice) error {
+func uploadPrices(gasPrices []prices.GasPriceData) error {
 	// Initialize a session that the SDK will use to load
 	// credentials from the shared credentials file ~/.aws/credentials
 	// and region from the shared configuration file ~/.aws/config.
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+	sess, err := awsconfig.NewSession()
+	if err != nil {
+		return err
+	}
 
 	// Create DynamoDB client
 	svc := dynamodb.New(sess)
 
-	for i := range converted {
-		av, err := dynamodbattribute.MarshalMap(converted[i])
-		if err != nil {
-			return err
+	for i := range gasPrices {
+		if err := store.Write(svc, &gasPrices[i]); err != nil {
+			return errors.Wrapf(err, "while writing gas price at %s", gasPrices[i].Timestamp)
 		}
+	}
 
-		input := &dynamodb.PutItemInput{
-			Item:      av,
-			TableName: aws.String(tableName),
-		}
-
-		if _, err = svc.PutItem(input); err != nil {
-			return err
-		}
-
-		ts := converted[i].Timestamp
-
-		fmt.Println("Successfully added " + ts + " to table " + tableName)
+	// The copy of the recent prices that runs read no longer has every price
+	// since its oldest, and clearing it makes the next run rebuild the
+	// aggregates too.
+	if err := store.ClearRecent(svc); err != nil {
+		return errors.Wrap(err, "while clearing recent gas prices")
 	}
 
-	fmt.Println("successfully added all items to table")
+	fmt.Println("successfully added all items to table " + store.TableName)
 
 	return nil
 }
 
-func getItems() (*prices.HistoricalGasPrices, error) {
-	raw, err := ioutil.ReadFile("/users/ryan/.gas_prices.json")
+func getItems(file string) (*historicalGasPrices, error) {
+	raw, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
 
-	var prices prices.HistoricalGasPrices
-	if err := json.Unmarshal(raw, &prices); err != nil {
-		return nil, err
+	var history historicalGasPrices
+	if err := json.Unmarshal(raw, &history); err != nil {
+		return nil, errors.Wrapf(err, "while parsing %s", file)
 	}
 
-	return &prices, nil
+	return &history, nil
 }
 
-func convertPrices(priceData *prices.HistoricalGasPrices) []convertedPrice {
-	converted := make([]convertedPrice, len(priceData.Prices))
+// convertPrices categorises every price as Average, apart from the most
+// recent, whose category the old CLI did record.
+func convertPrices(history *historicalGasPrices) []prices.GasPriceData {
+	converted := make([]prices.GasPriceData, len(history.Prices))
 
-	for i := range priceData.Prices {
-		converted[i] = convertedPrice{
-			Price:     priceData.Prices[i].Price,
-			Timestamp: priceData.Prices[i].Timestamp.Format(time.RFC3339),
-			Category:  prices.Average.String(),
+	for i := range history.Prices {
+		converted[i] = prices.GasPriceData{
+			Price:     history.Prices[i].Price,
+			Timestamp: history.Prices[i].Timestamp,
+			Category:  prices.Average,
 		}
 	}
 
-	converted[len(priceData.Prices)-1].Category = priceData.LastCategory.String()
+	if len(converted) > 0 {
+		converted[len(converted)-1].Category = history.LastCategory
+	}
 
 	return converted
 }
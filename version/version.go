@@ -0,0 +1,67 @@
+// Package version describes the build of the gas tracker binaries, so that
+// logs, Lambda responses and the API show which build produced them. The
+// version, commit and build time are set when building, e.g.
+//
+//	go build -ldflags "\
+//	    -X github.com/ryanc414/gas-tracker/version.Version=v1.4.0 \
+//	    -X github.com/ryanc414/gas-tracker/version.Commit=$(git rev-parse --short HEAD) \
+//	    -X github.com/ryanc414/gas-tracker/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+//	    ./tracker
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set with -ldflags -X when building.
+var (
+	Version   string
+	Commit    string
+	BuildTime string
+)
+
+// Info describes a build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build info. If the version was not set when building, it is
+// the module version, e.g. when installed with go install, or else "dev".
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+		if build, ok := debug.ReadBuildInfo(); ok && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+	}
+
+	return info
+}
+
+// String describes the build on one line, e.g.
+// "v1.4.0 (commit 1a2b3c4, built 2021-03-01T12:00:00Z, go1.15.8)".
+func (i Info) String() string {
+	var details []string
+	if i.Commit != "" {
+		details = append(details, "commit "+i.Commit)
+	}
+	if i.BuildTime != "" {
+		details = append(details, "built "+i.BuildTime)
+	}
+	details = append(details, i.GoVersion)
+
+	return fmt.Sprintf("%s (%s)", i.Version, strings.Join(details, ", "))
+}
@@ -0,0 +1,88 @@
+// Reads the price API, which is served from the root, one level above the
+// dashboard, and refreshes every minute.
+"use strict";
+
+const api = "../";
+const refreshInterval = 60 * 1000;
+
+// The colours of the categories, as in the charts package.
+const categoryColours = {
+  "Very Low": "#1a7f37",
+  "Low": "#4ac26b",
+  "Average": "#6e7781",
+  "High": "#d4a72c",
+  "Very High": "#cf222e",
+};
+
+async function getJSON(path) {
+  const rsp = await fetch(api + path);
+  const body = await rsp.json();
+  if (!rsp.ok) {
+    throw new Error(body.error || rsp.statusText);
+  }
+  return body;
+}
+
+function formatTime(timestamp) {
+  return new Date(timestamp).toLocaleString(undefined, {
+    weekday: "short", day: "numeric", month: "short", hour: "2-digit", minute: "2-digit",
+  });
+}
+
+async function showLatest() {
+  const latest = await getJSON("prices/latest");
+
+  document.getElementById("price").textContent = latest.price;
+  const category = document.getElementById("category");
+  category.textContent = latest.category;
+  category.style.background = categoryColours[latest.category] || "#6e7781";
+  document.getElementById("sampled").textContent = "Sampled " + formatTime(latest.timestamp);
+  document.title = "Gas: " + latest.price + " gwei (" + latest.category + ")";
+}
+
+function showChart() {
+  const hours = Number(document.getElementById("range").value);
+  const from = new Date(Date.now() - hours * 60 * 60 * 1000);
+  from.setSeconds(0, 0);
+
+  document.getElementById("chart").src =
+    api + "chart.svg?from=" + encodeURIComponent(from.toISOString().replace(/\.\d+Z$/, "Z"));
+}
+
+async function showAlerts() {
+  const alerts = await getJSON("alerts");
+  if (alerts.length === 0) {
+    return;
+  }
+
+  const rows = document.getElementById("alerts");
+  rows.replaceChildren();
+  for (const alert of alerts) {
+    const row = rows.insertRow();
+    row.insertCell().textContent = formatTime(alert.timestamp);
+    row.insertCell().textContent = alert.alert;
+    row.insertCell().textContent = alert.price + " gwei";
+
+    const channels = row.insertCell();
+    channels.textContent = alert.channels.join(", ");
+    if (!alert.delivered) {
+      channels.textContent += " (failed)";
+      channels.className = "failed";
+    }
+  }
+}
+
+async function refresh() {
+  const error = document.getElementById("error");
+  try {
+    await Promise.all([showLatest(), showAlerts()]);
+    showChart();
+    error.textContent = "";
+  } catch (err) {
+    error.textContent = "Failed to refresh: " + err.message;
+  }
+}
+
+document.getElementById("range").addEventListener("change", showChart);
+refresh();
+setInterval(refresh, refreshInterval);
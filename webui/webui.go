@@ -0,0 +1,30 @@
+// Package webui is a small web dashboard embedded in the binary, showing the
+// latest price and its category, a chart of recent prices and the recent
+// alerts. It is static, and reads everything from the price API, which must be
+// served alongside it.
+package webui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// Path is where the dashboard is served. Its pages refer to the price API
+// relative to the parent of Path, i.e. the root.
+const Path = "/ui/"
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the dashboard at Path.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		// The embedded directory is fixed at build time, so this cannot
+		// happen.
+		panic(err)
+	}
+
+	return http.StripPrefix(Path, http.FileServer(http.FS(files)))
+}